@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"github.com/lsmoura/health/pkg/anonymize"
+	"os"
+)
+
+// anonymizeOptions are the flags of the commands that can anonymize what
+// they write.
+type anonymizeOptions struct {
+	enabled  bool
+	salt     string
+	maxWeeks int
+	jitter   float64
+}
+
+func (o *anonymizeOptions) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.enabled, "anonymize", false, "shift dates, replace sources and devices by pseudonyms, and drop clinical records, prescriptions and routes")
+	fs.StringVar(&o.salt, "anonymize-salt", "", "secret keying pseudonyms and the date shift (prefer HEALTH_ANONYMIZE_SALT, random when unset)")
+	fs.IntVar(&o.maxWeeks, "anonymize-weeks", 52, "maximum shift of the dates, in weeks")
+	fs.Float64Var(&o.jitter, "anonymize-jitter", 500, "maximum move of the start and end points of routes, in meters")
+}
+
+// anonymizer returns the anonymizer of the flags for the named person, or
+// nil when -anonymize is not set.
+func (o *anonymizeOptions) anonymizer(person string) (*anonymize.Anonymizer, error) {
+	if !o.enabled {
+		return nil, nil
+	}
+	salt := o.salt
+	if salt == "" {
+		salt = os.Getenv("HEALTH_ANONYMIZE_SALT")
+	}
+
+	return anonymize.New(anonymize.Options{Salt: []byte(salt), Person: person, MaxWeeks: o.maxWeeks, Jitter: o.jitter})
+}
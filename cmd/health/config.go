@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+func runConfig(ctx context.Context, args []string) error {
+	var options Options
+
+	fs := newFlagSet("config")
+	options.register(fs)
+	if subcommand := parseSubcommand(fs, args); subcommand != "show" {
+		fs.Usage()
+		return fmt.Errorf("expected show, got %q", subcommand)
+	}
+
+	connection, err := options.resolve()
+	if err != nil {
+		return fmt.Errorf("resolve: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+	for _, setting := range connection.Redacted() {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", setting.Key, setting.Value, setting.Source)
+	}
+
+	return w.Flush()
+}
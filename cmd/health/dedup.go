@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lsmoura/health/pkg/dedup"
+)
+
+// deduplicate rebuilds the deduplicated rows of a person with the source
+// priority of the config file.
+func deduplicate(ctx context.Context, db *pgxpool.Pool, options *Options, personID int64) error {
+	file, err := options.loadFile()
+	if err != nil {
+		return err
+	}
+	priority, err := dedup.ParsePriority(file.Priority)
+	if err != nil {
+		return fmt.Errorf("dedup.ParsePriority: %w", err)
+	}
+
+	deduplicator := dedup.Deduplicator{Pool: db, PersonID: personID, Priority: priority}
+	return deduplicator.Run(ctx)
+}
+
+func runDedup(ctx context.Context, args []string) error {
+	var options Options
+	var name string
+
+	fs := newFlagSet("dedup")
+	options.register(fs)
+	registerPerson(fs, &name)
+	fs.Parse(args)
+
+	db, err := options.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+	personID, err := lookupPerson(ctx, db, name)
+	if err != nil {
+		return err
+	}
+
+	return deduplicate(ctx, db, &options, personID)
+}
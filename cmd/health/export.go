@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/lsmoura/health/pkg/importer"
+	"io"
+	"os"
+)
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// createOutput creates the named file, or returns stdout for "-".
+func createOutput(name string) (io.WriteCloser, error) {
+	if name == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("os.Create: %w", err)
+	}
+
+	return f, nil
+}
+
+func knownTable(name string) bool {
+	for _, table := range importer.TableNames() {
+		if table == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func runExport(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "workouts":
+			return runExportWorkouts(ctx, args[1:])
+		case "xml":
+			return runExportXML(ctx, args[1:])
+		case "fhir":
+			return runExportFHIR(ctx, args[1:])
+		case "omh":
+			return runExportOMH(ctx, args[1:])
+		}
+	}
+
+	var options Options
+	var table, format, outputName, name string
+
+	fs := newFlagSet("export")
+	options.register(fs)
+	registerPerson(fs, &name)
+	fs.StringVar(&table, "table", "records", "table to export")
+	fs.StringVar(&format, "format", "csv", "output format: csv or json (one object per line)")
+	fs.StringVar(&outputName, "output", "-", "output file (- for stdout)")
+	fs.Parse(args)
+
+	if !knownTable(table) {
+		return fmt.Errorf("unknown table %q", table)
+	}
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	db, err := options.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+	personID, err := lookupPerson(ctx, db, name)
+	if err != nil {
+		return err
+	}
+
+	out, err := createOutput(outputName)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	identifier := pgx.Identifier{table}.Sanitize()
+	// COPY takes no parameters, the id is an integer
+	query := fmt.Sprintf("SELECT * FROM %s WHERE person_id = %d", identifier, personID)
+
+	if format == "csv" {
+		conn, err := db.Acquire(ctx)
+		if err != nil {
+			return fmt.Errorf("db.Acquire: %w", err)
+		}
+		defer conn.Release()
+
+		if _, err := conn.Conn().PgConn().CopyTo(ctx, w, "COPY ("+query+") TO STDOUT WITH (FORMAT csv, HEADER)"); err != nil {
+			return fmt.Errorf("copy %s: %w", table, err)
+		}
+		return w.Flush()
+	}
+
+	rows, err := db.Query(ctx, "SELECT row_to_json(t)::text FROM ("+query+") t")
+	if err != nil {
+		return fmt.Errorf("db.Query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return fmt.Errorf("rows.Scan: %w", err)
+		}
+		w.WriteString(line)
+		w.WriteByte('\n')
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return w.Flush()
+}
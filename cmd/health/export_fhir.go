@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/lsmoura/health/pkg/export"
+	"github.com/lsmoura/health/pkg/fhir"
+	"github.com/lsmoura/health/pkg/health"
+	"os"
+	"strings"
+	"time"
+)
+
+func runExportFHIR(ctx context.Context, args []string) error {
+	var options Options
+	var format, outputName, dir, patientID string
+	var bundleSize int
+	var since, until *time.Time
+	var name string
+
+	fs := newFlagSet("export")
+	options.register(fs)
+	registerPerson(fs, &name)
+	fs.StringVar(&format, "format", "bundle", "output format: bundle (transaction bundles, one per line) or bulk (an NDJSON file per resource type)")
+	fs.StringVar(&outputName, "output", "-", "output file of the bundles (- for stdout)")
+	fs.StringVar(&dir, "dir", ".", "directory of the bulk files")
+	fs.IntVar(&bundleSize, "bundle-size", 500, "resources per transaction bundle")
+	fs.StringVar(&patientID, "patient", "me", "id of the Patient the observations refer to")
+	fs.Var(timeValue{&since}, "since", "export only observations starting at or after a date, or a duration ago such as 90d")
+	fs.Var(timeValue{&until}, "until", "export only observations starting before a date, or a duration ago")
+	fs.Parse(args)
+
+	if format != "bundle" && format != "bulk" {
+		return fmt.Errorf("unknown format %q", format)
+	}
+	if bundleSize < 1 {
+		return fmt.Errorf("invalid bundle size %d", bundleSize)
+	}
+
+	db, err := options.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+	personID, err := lookupPerson(ctx, db, name)
+	if err != nil {
+		return err
+	}
+
+	var w fhir.Writer
+	var bundles *fhir.BundleWriter
+	var buffered *bufio.Writer
+	if format == "bulk" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("os.MkdirAll: %w", err)
+		}
+		w = fhir.NewBulkWriter(dir, "health export fhir "+strings.Join(args, " "))
+	} else {
+		out, err := createOutput(outputName)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		buffered = bufio.NewWriter(out)
+		bundles = fhir.NewBundleWriter(buffered, bundleSize)
+		w = bundles
+	}
+
+	store := export.Store{Pool: db, PersonID: personID}
+	me, err := store.Me(ctx)
+	if err != nil {
+		return fmt.Errorf("Me: %w", err)
+	}
+	if err := w.Write(fhir.NewPatient(patientID, me)); err != nil {
+		return err
+	}
+
+	var observations int
+	err = store.Records(ctx, fhir.ObservationTypes(), since, until, func(r *health.Record) error {
+		o, ok := fhir.RecordObservation(r, patientID)
+		if !ok {
+			return nil
+		}
+		observations++
+		return w.Write(o)
+	})
+	if err != nil {
+		return fmt.Errorf("Records: %w", err)
+	}
+	err = store.Correlations(ctx, []string{health.BloodPressureType}, since, until, func(c *health.Correlation) error {
+		o, ok := fhir.BloodPressureObservation(c, patientID)
+		if !ok {
+			return nil
+		}
+		observations++
+		return w.Write(o)
+	})
+	if err != nil {
+		return fmt.Errorf("Correlations: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if buffered != nil {
+		if err := buffered.Flush(); err != nil {
+			return err
+		}
+	}
+
+	// the bundles may be on stdout
+	report := os.Stdout
+	if format == "bundle" && outputName == "-" {
+		report = os.Stderr
+	}
+	if bundles != nil {
+		fmt.Fprintf(report, "wrote a patient and %d observations in %d bundles\n", observations, bundles.Bundles)
+	} else {
+		fmt.Fprintf(report, "wrote a patient and %d observations to %s\n", observations, dir)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lsmoura/health/pkg/export"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/omh"
+	"github.com/lsmoura/health/pkg/sleep"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxIssues is the number of invalid data points described by the report.
+const maxIssues = 10
+
+func runExportOMH(ctx context.Context, args []string) error {
+	var options Options
+	var outputName, schemaNames, name string
+	var since, until *time.Time
+
+	var names []string
+	for _, schema := range omh.Schemas {
+		names = append(names, schema.Name)
+	}
+
+	fs := newFlagSet("export")
+	options.register(fs)
+	registerPerson(fs, &name)
+	fs.StringVar(&outputName, "output", "-", "output file of the data points (- for stdout)")
+	fs.StringVar(&schemaNames, "schema", strings.Join(names, ","), "comma separated schemas of the data points to write")
+	fs.Var(timeValue{&since}, "since", "export only samples starting at or after a date, or a duration ago such as 90d")
+	fs.Var(timeValue{&until}, "until", "export only samples starting before a date, or a duration ago")
+	fs.Parse(args)
+
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(schemaNames, ",") {
+		name = strings.TrimPrefix(strings.TrimSpace(name), "omh:")
+		known := false
+		for _, schema := range omh.Schemas {
+			known = known || schema.Name == name
+		}
+		if !known {
+			return fmt.Errorf("unknown schema %q", name)
+		}
+		selected[name] = true
+	}
+
+	db, err := options.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+	personID, err := lookupPerson(ctx, db, name)
+	if err != nil {
+		return err
+	}
+
+	out, err := createOutput(outputName)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	buffered := bufio.NewWriter(out)
+	w := omh.NewWriter(buffered)
+	var invalid int
+	write := func(p *omh.DataPoint) error {
+		if !selected[p.Header.SchemaID.Name] {
+			return nil
+		}
+		err := w.Write(p)
+		var invalidErr *omh.InvalidError
+		if errors.As(err, &invalidErr) {
+			if invalid < maxIssues {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			invalid++
+			return nil
+		}
+		return err
+	}
+
+	store := export.Store{Pool: db, PersonID: personID}
+	err = store.Records(ctx, omh.RecordTypes, since, until, func(r *health.Record) error {
+		if p, ok := omh.RecordDataPoint(r); ok {
+			return write(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Records: %w", err)
+	}
+	if selected["physical-activity"] {
+		err = store.Workouts(ctx, since, until, func(workout *health.Workout) error {
+			if p, ok := omh.WorkoutDataPoint(workout); ok {
+				return write(p)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("Workouts: %w", err)
+		}
+	}
+	if selected["sleep-episode"] {
+		err = store.SleepSessions(ctx, since, until, func(s *sleep.Session) error {
+			return write(omh.SleepDataPoint(s))
+		})
+		if err != nil {
+			return fmt.Errorf("SleepSessions: %w", err)
+		}
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+
+	// the data points may be on stdout
+	report := os.Stdout
+	if outputName == "-" {
+		report = os.Stderr
+	}
+	for _, schema := range omh.Schemas {
+		if selected[schema.Name] {
+			fmt.Fprintf(report, "%-20s %d\n", schema.Namespace+":"+schema.Name, w.Written[schema.String()])
+		}
+	}
+	if invalid > 0 {
+		fmt.Fprintf(report, "skipped %d data points not matching their schema\n", invalid)
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/lsmoura/health/pkg/activity"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var activityWriters = map[string]func(*activity.Activity, io.Writer) error{
+	"gpx": (*activity.Activity).WriteGPX,
+	"tcx": (*activity.Activity).WriteTCX,
+	"fit": (*activity.Activity).WriteFIT,
+}
+
+func writeActivity(a *activity.Activity, name string, write func(*activity.Activity, io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("os.Create: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if err := write(a, w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func runExportWorkouts(ctx context.Context, args []string) error {
+	var options Options
+	var formats, dir string
+	var id int64
+	var selection activity.Selection
+	var name string
+
+	fs := newFlagSet("export")
+	options.register(fs)
+	registerPerson(fs, &name)
+	fs.StringVar(&formats, "format", "gpx,tcx,fit", "comma separated file formats: gpx, tcx and fit")
+	fs.StringVar(&dir, "dir", ".", "directory the files are written to")
+	fs.Int64Var(&id, "id", 0, "export a single workout")
+	fs.Var(&selection.Types.Include, "include-workout", "export only workouts whose activity type matches (repeatable)")
+	fs.Var(&selection.Types.Exclude, "exclude-workout", "skip workouts whose activity type matches (repeatable)")
+	fs.Var(timeValue{&selection.Since}, "since", "export only workouts starting at or after a date, or a duration ago such as 90d")
+	fs.Var(timeValue{&selection.Until}, "until", "export only workouts starting before a date, or a duration ago")
+	fs.Parse(args)
+
+	var extensions []string
+	for _, format := range strings.Split(formats, ",") {
+		format = strings.TrimSpace(format)
+		if _, ok := activityWriters[format]; !ok {
+			return fmt.Errorf("unknown format %q", format)
+		}
+		extensions = append(extensions, format)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("os.MkdirAll: %w", err)
+	}
+
+	db, err := options.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+	personID, err := lookupPerson(ctx, db, name)
+	if err != nil {
+		return err
+	}
+
+	loader := activity.Loader{Pool: db, PersonID: personID}
+	ids := []int64{id}
+	if id == 0 {
+		if ids, err = loader.IDs(ctx, selection); err != nil {
+			return fmt.Errorf("IDs: %w", err)
+		}
+	}
+
+	var files int
+	for _, id := range ids {
+		a, err := loader.Load(ctx, id)
+		if err != nil {
+			return fmt.Errorf("Load: %w", err)
+		}
+
+		base := fmt.Sprintf("%s_%s_%d", a.Start.Format("2006-01-02_150405"), a.Sport().Name, a.ID)
+		for _, extension := range extensions {
+			if extension == "gpx" && !a.HasRoute() {
+				fmt.Printf("skipping the GPX file of workout %d: no route\n", a.ID)
+				continue
+			}
+			name := filepath.Join(dir, base+"."+extension)
+			if err := writeActivity(a, name, activityWriters[extension]); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			files++
+		}
+	}
+
+	fmt.Printf("Wrote %d files for %d workouts to %s\n", files, len(ids), dir)
+	return nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/lsmoura/health/pkg/anonymize"
+	"github.com/lsmoura/health/pkg/export"
+	"github.com/lsmoura/health/pkg/filter"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/input"
+	"github.com/lsmoura/health/pkg/pipeline"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stringsValue is a repeatable string flag.
+type stringsValue []string
+
+func (v *stringsValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(*v, " ")
+}
+
+func (v *stringsValue) Set(s string) error {
+	*v = append(*v, s)
+	return nil
+}
+
+// xmlCounts counts the elements written, and the elements of the inputs that
+// were left out.
+type xmlCounts struct {
+	written    int
+	duplicates int
+	unknown    map[string]int
+}
+
+// anonymizeXML anonymizes the prolog of an export: Me and the export date.
+func anonymizeXML(e *health.Encoder, anonymizer *anonymize.Anonymizer) {
+	if anonymizer == nil {
+		return
+	}
+	anonymizer.Element(&e.Me)
+	if e.ExportDate != nil {
+		shifted := health.HealthTime(anonymizer.Time(time.Time(*e.ExportDate)))
+		e.ExportDate = &shifted
+	}
+}
+
+// encodeInputs re-encodes the elements of several exports. Me and the export
+// date come from the first export that has them, and elements found in
+// several exports are written once.
+func encodeInputs(e *health.Encoder, names []string, filters *filter.Filter, anonymizer *anonymize.Anonymizer, counts *xmlCounts) error {
+	seen := make(map[[sha256.Size]byte]bool)
+	var haveMe, haveDate, prolog bool
+
+	// each export is closed once read, not when every export is merged
+	encode := func(name string) error {
+		file, err := input.Open(name)
+		if err != nil {
+			return fmt.Errorf("open: %w", err)
+		}
+		defer file.Close()
+
+		scanner := pipeline.NewScanner(file)
+		if !filters.IsZero() {
+			scanner.Filter = filters.Keep
+		}
+		for {
+			element, err := scanner.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+
+			if element.Name == "ExportDate" {
+				var date health.ExportDate
+				if err := xml.Unmarshal(element.Data, &date); err != nil {
+					return fmt.Errorf("%s: ExportDate: %w", name, err)
+				}
+				if !haveDate && date.Value != nil {
+					e.ExportDate, haveDate = date.Value, true
+				}
+				continue
+			}
+
+			value := health.NewElement(element.Name)
+			if value == nil {
+				counts.unknown[element.Name]++
+				continue
+			}
+			if err := xml.Unmarshal(element.Data, value); err != nil {
+				return fmt.Errorf("%s: %s %d: %w", name, element.Name, element.Seq, err)
+			}
+			if me, ok := value.(*health.Me); ok {
+				if !haveMe {
+					e.Me, haveMe = *me, true
+				}
+				continue
+			}
+
+			if len(names) > 1 {
+				sum := sha256.Sum256(element.Data)
+				if seen[sum] {
+					counts.duplicates++
+					continue
+				}
+				seen[sum] = true
+			}
+			if anonymizer != nil && !anonymizer.Element(value) {
+				continue
+			}
+			if !prolog {
+				// the prolog is written with the first element
+				anonymizeXML(e, anonymizer)
+				prolog = true
+			}
+			if err := e.Encode(value); err != nil {
+				return err
+			}
+			counts.written++
+		}
+
+		return nil
+	}
+
+	for _, name := range names {
+		if err := encode(name); err != nil {
+			return err
+		}
+	}
+	if !prolog {
+		anonymizeXML(e, anonymizer)
+	}
+
+	return nil
+}
+
+func runExportXML(ctx context.Context, args []string) error {
+	var options Options
+	var inputs stringsValue
+	var outputName string
+	var filters filter.Filter
+	var anonymizeFlags anonymizeOptions
+	var name string
+
+	fs := newFlagSet("export")
+	options.register(fs)
+	registerPerson(fs, &name)
+	anonymizeFlags.register(fs)
+	fs.Var(&inputs, "input", "read the elements from an export instead of the database (repeatable, to merge exports)")
+	fs.StringVar(&outputName, "output", "-", "output file (- for stdout)")
+	registerFilter(fs, &filters)
+	fs.Parse(args)
+
+	anonymizer, err := anonymizeFlags.anonymizer(personName(name))
+	if err != nil {
+		return fmt.Errorf("anonymizer: %w", err)
+	}
+
+	out, err := createOutput(outputName)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	e := health.NewEncoder(out)
+	counts := xmlCounts{unknown: make(map[string]int)}
+
+	if len(inputs) > 0 {
+		if err := encodeInputs(e, inputs, &filters, anonymizer, &counts); err != nil {
+			return err
+		}
+	} else {
+		db, err := options.connect(ctx)
+		if err != nil {
+			return fmt.Errorf("connect: %w", err)
+		}
+		defer db.Close()
+		personID, err := lookupPerson(ctx, db, name)
+		if err != nil {
+			return err
+		}
+
+		store := export.Store{Pool: db, PersonID: personID}
+		if e.Me, err = store.Me(ctx); err != nil {
+			return fmt.Errorf("Me: %w", err)
+		}
+		anonymizeXML(e, anonymizer)
+		err = store.Elements(ctx, &filters, func(element any) error {
+			if anonymizer != nil && !anonymizer.Element(element) {
+				return nil
+			}
+			counts.written++
+			return e.Encode(element)
+		})
+		if err != nil {
+			return fmt.Errorf("Elements: %w", err)
+		}
+	}
+
+	if err := e.Close(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	// the export may be on stdout
+	report := os.Stdout
+	if outputName == "-" {
+		report = os.Stderr
+	}
+	fmt.Fprintf(report, "wrote %d elements\n", counts.written)
+	if counts.duplicates > 0 {
+		fmt.Fprintf(report, "skipped %d elements found in several exports\n", counts.duplicates)
+	}
+	names := make([]string, 0, len(counts.unknown))
+	for name := range counts.unknown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(report, "skipped %d %s elements, which the DTD does not declare\n", counts.unknown[name], name)
+	}
+	if anonymizer != nil {
+		anonymizer.Report().WriteTo(report)
+	}
+
+	return nil
+}
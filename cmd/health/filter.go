@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"github.com/lsmoura/health/pkg/filter"
+	"time"
+)
+
+// timeValue is a flag holding a date parsed by filter.ParseTime.
+type timeValue struct {
+	t **time.Time
+}
+
+func (v timeValue) String() string {
+	if v.t == nil || *v.t == nil {
+		return ""
+	}
+
+	return (*v.t).Format(time.RFC3339)
+}
+
+func (v timeValue) Set(s string) error {
+	t, err := filter.ParseTime(s, time.Now().Truncate(time.Second))
+	if err != nil {
+		return err
+	}
+	*v.t = &t
+	return nil
+}
+
+func registerFilter(fs *flag.FlagSet, f *filter.Filter) {
+	fs.Var(&f.RecordTypes.Include, "include-type", "import only elements whose type matches a glob, or contains a /regexp/ match (repeatable)")
+	fs.Var(&f.RecordTypes.Exclude, "exclude-type", "skip elements whose type matches a glob, or contains a /regexp/ match (repeatable)")
+	fs.Var(&f.WorkoutTypes.Include, "include-workout", "import only workouts whose activity type matches (repeatable)")
+	fs.Var(&f.WorkoutTypes.Exclude, "exclude-workout", "skip workouts whose activity type matches (repeatable)")
+	fs.Var(&f.Sources.Include, "include-source", "import only elements whose source name matches (repeatable)")
+	fs.Var(&f.Sources.Exclude, "exclude-source", "skip elements whose source name matches (repeatable)")
+	fs.Var(&f.Devices.Include, "include-device", "import only elements whose device matches (repeatable)")
+	fs.Var(&f.Devices.Exclude, "exclude-device", "skip elements whose device matches (repeatable)")
+	fs.Var(timeValue{&f.Since}, "since", "import only elements starting at or after a date, or a duration ago such as 90d")
+	fs.Var(timeValue{&f.Until}, "until", "import only elements starting before a date, or a duration ago")
+}
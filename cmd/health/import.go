@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/lsmoura/health/pkg/filter"
+	"github.com/lsmoura/health/pkg/importer"
+	"github.com/lsmoura/health/pkg/input"
+	"github.com/lsmoura/health/pkg/person"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// showProgress prints how much of the input has been consumed until the
+// returned function is called.
+func showProgress(r *input.Reader) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	report := func() {
+		read, total := r.Progress()
+		if total > 0 {
+			fmt.Printf("read %s/%s (%.1f%%)\t\r", formatBytes(read), formatBytes(total), float64(read)*100/float64(total))
+		} else {
+			fmt.Printf("read %s\t\r", formatBytes(read))
+		}
+	}
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				report()
+				fmt.Println()
+				return
+			case <-ticker.C:
+				report()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func runImport(ctx context.Context, args []string) error {
+	var options Options
+	var inputName string
+	var workers, batchSize int
+	var applySchema, dryRunEnabled bool
+	var dryRunFlags dryRunOptions
+	var filters filter.Filter
+	var timeZone string
+	var outputFlags outputOptions
+	var anonymizeFlags anonymizeOptions
+	var name string
+
+	fs := newFlagSet("import")
+	options.register(fs)
+	registerPerson(fs, &name)
+	fs.StringVar(&inputName, "input", "export.xml", "input file, optionally gzip, zstd or bzip2 compressed (- for stdin)")
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "number of goroutines decoding elements")
+	fs.IntVar(&batchSize, "batch-size", 10000, "rows per COPY batch")
+	fs.BoolVar(&applySchema, "apply-schema", false, "apply schema before importing (this will recreate all tables)")
+	fs.BoolVar(&dryRunEnabled, "dry-run", false, "report what would be imported without touching the database, like validate")
+	outputFlags.register(fs)
+	dryRunFlags.register(fs)
+	anonymizeFlags.register(fs)
+	registerFilter(fs, &filters)
+	registerTimeZone(fs, &timeZone)
+	fs.Parse(args)
+
+	if dryRunEnabled {
+		return dryRun(ctx, inputName, workers, &filters, dryRunFlags)
+	}
+	anonymizer, err := anonymizeFlags.anonymizer(personName(name))
+	if err != nil {
+		return fmt.Errorf("anonymizer: %w", err)
+	}
+	if outputFlags.output != "" {
+		return writeOutput(ctx, inputName, workers, &filters, anonymizer, outputFlags)
+	}
+
+	file, err := input.Open(inputName)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	defer file.Close()
+
+	db, err := options.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+
+	if applySchema {
+		if err := applySchemaTo(ctx, db); err != nil {
+			return err
+		}
+	}
+	personID, err := person.Ensure(ctx, db, personName(name))
+	if err != nil {
+		return fmt.Errorf("person.Ensure: %w", err)
+	}
+
+	imp := importer.Importer{
+		Pool:      db,
+		PersonID:  personID,
+		Workers:   workers,
+		BatchSize: batchSize,
+		Input:     inputName,
+		Log:       os.Stdout,
+	}
+	if !filters.IsZero() {
+		imp.Filter = &filters
+	}
+	imp.Anonymizer = anonymizer
+	if file.IsStdin() {
+		fmt.Println("reading from stdin, skipping clinical records and electrocardiograms")
+	} else {
+		imp.ExportDir = os.DirFS(filepath.Dir(inputName))
+	}
+
+	fmt.Printf("importing data of %s (%s, %d workers)...\n", personName(name), file.Compression, workers)
+	stopProgress := showProgress(file)
+	err = imp.Import(ctx, file)
+	stopProgress()
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	if anonymizer != nil {
+		anonymizer.Report().WriteTo(os.Stdout)
+	}
+
+	if err := deduplicate(ctx, db, &options, personID); err != nil {
+		return fmt.Errorf("deduplicate: %w", err)
+	}
+	if err := analyzeSleep(ctx, db, &options, personID, sleepOptions{timeZone: timeZone}); err != nil {
+		return fmt.Errorf("analyzeSleep: %w", err)
+	}
+	if err := rollUp(ctx, db, &options, personID, timeZone); err != nil {
+		return fmt.Errorf("rollUp: %w", err)
+	}
+	if err := analyzeTraining(ctx, db, &options, personID, trainingOptions{timeZone: timeZone}); err != nil {
+		return fmt.Errorf("analyzeTraining: %w", err)
+	}
+
+	return nil
+}
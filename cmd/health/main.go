@@ -2,15 +2,10 @@ package main
 
 import (
 	"context"
-	"encoding/xml"
 	"flag"
 	"fmt"
-	"github.com/jackc/pgx/v5"
-	"github.com/lsmoura/health/pkg/dbfieldvalues"
-	"github.com/lsmoura/health/pkg/health"
 	"log"
 	"os"
-	"strconv"
 	"strings"
 )
 
@@ -20,150 +15,67 @@ var (
 	date    = "unknown"
 )
 
-func connect(ctx context.Context, dbURL string) (*pgx.Conn, error) {
-	conn, err := pgx.Connect(ctx, dbURL)
-	if err != nil {
-		return nil, fmt.Errorf("pgx.Connect: %w", err)
-	}
-
-	return conn, nil
+type command struct {
+	name        string
+	synopsis    string
+	description string
+	run         func(ctx context.Context, args []string) error
 }
 
-func insertType(ctx context.Context, conn *pgx.Conn, tableName string, data []any) error {
-	if len(data) == 0 {
-		fmt.Println("No data to insert in", tableName)
-		return nil
+var commands []command
+
+func init() {
+	commands = []command{
+		{"import", "[options]", "import an export into the database", runImport},
+		{"schema", "apply|print|diff|rls [options]", "manage the database schema and its row level security", runSchema},
+		{"persons", "list|role|remove [options]", "manage the persons of the database", runPersons},
+		{"stats", "[options]", "show what is stored in the database", runStats},
+		{"export", "[workouts|xml|fhir|omh] [options]", "export a table, workouts as GPX, TCX and FIT files, an export.xml, FHIR resources or Open mHealth data points", runExport},
+		{"validate", "[options]", "check an export without touching the database", runValidate},
+		{"dedup", "[options]", "rebuild the deduplicated records and workouts", runDedup},
+		{"sleep", "[options]", "rebuild the nightly sleep sessions", runSleep},
+		{"rollup", "[options]", "rebuild the daily and weekly metrics of the latest import", runRollup},
+		{"training", "[options]", "rebuild the heart rate zones of workouts and the training load", runTraining},
+		{"serve", "[options]", "serve the imported data as a JSON API", runServe},
+		{"config", "show [options]", "show the connection settings and where they come from", runConfig},
+		{"version", "", "show version and exit", runVersion},
+		{"help", "[command]", "show help about a command", runHelp},
 	}
-	columns := dbfieldvalues.Fields(data[0], "id")
-
-	var workoutData [][]any
-	for i, workout := range data {
-		values, err := dbfieldvalues.Values(workout, "id")
-		if err != nil {
-			return fmt.Errorf("dbfieldvalues.Values: %w", err)
-		}
-
-		workoutData = append(workoutData, values)
-
-		fmt.Printf("inserting fields in %s %d/%d\t\r", tableName, i, len(data))
-	}
-
-	copyCount, err := conn.CopyFrom(
-		ctx,
-		pgx.Identifier{tableName},
-		columns,
-		pgx.CopyFromRows(workoutData),
-	)
-
-	if err != nil {
-		return fmt.Errorf("db.CopyFrom: %w", err)
-	}
-
-	fmt.Printf("Copied %d rows\n", copyCount)
-
-	return nil
-}
-
-func toInterfaceArray[T any](data []T) []any {
-	result := make([]any, len(data))
-	for i, item := range data {
-		result[i] = item
-	}
-
-	return result
 }
 
-func insert(ctx context.Context, db *pgx.Conn, health *health.HealthData) error {
-	fmt.Printf("Inserting %d records\n", len(health.Records))
-
-	insertList := []struct {
-		tableName string
-		indexName string
-		data      []any
-	}{
-		{"records", "records_id_seq", toInterfaceArray(health.Records)},
-		{"correlations", "", toInterfaceArray(health.Correlations)},
-		{"workouts", "workouts_id_seq", toInterfaceArray(health.Workouts)},
-		{"activity_summaries", "", toInterfaceArray(health.ActivitySummary)},
-		{"clinical_records", "", toInterfaceArray(health.ClinicalRecord)},
-		{"audiograms", "", toInterfaceArray(health.Audiogram)},
-		{"vision_prescriptions", "", toInterfaceArray(health.VisionPrescription)},
-	}
-
-	for _, insert := range insertList {
-		if _, err := db.Exec(ctx, "DELETE FROM "+insert.tableName); err != nil {
-			return fmt.Errorf("DELETE FROM %s: %w", insert.tableName, err)
-		}
-		if insert.indexName != "" {
-			if _, err := db.Exec(ctx, "ALTER SEQUENCE "+insert.indexName+" RESTART WITH 1"); err != nil {
-				return fmt.Errorf("ALTER SEQUENCE %s RESTART WITH 1: %w", insert.indexName, err)
-			}
-		}
-		if err := insertType(ctx, db, insert.tableName, insert.data); err != nil {
-			return fmt.Errorf("insertRecords: %w", err)
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
 		}
 	}
 
-	return nil
-}
-
-type Options struct {
-	Help bool
-
-	Input string // defaults to export.xml
-
-	DBHost   string // defaults to localhost
-	DBUser   string // defaults to postgres
-	DBPort   int    // defaults to 5432
-	DBPass   string // defaults to no password
-	DBSSL    bool   // defaults to false
-	Database string // defaults to health
-
-	Version     bool
-	ApplySchema bool
+	return command{}, false
 }
 
-func (o Options) DBURL() string {
-	sb := strings.Builder{}
-	sb.WriteString("postgres://")
-	sb.WriteString(o.DBUser)
-	if o.DBPass != "" {
-		sb.WriteString(":")
-		sb.WriteString(o.DBPass)
-	}
-	sb.WriteString("@")
-	sb.WriteString(o.DBHost)
-	sb.WriteString(":")
-	sb.WriteString(strconv.Itoa(o.DBPort))
-	sb.WriteString("/")
-	sb.WriteString(o.Database)
-	if !o.DBSSL {
-		sb.WriteString("?sslmode=disable")
+// newFlagSet returns the flag set of a command, with a usage message built
+// from its synopsis and description.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		cmd, _ := findCommand(strings.Fields(name)[0])
+		fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n\n%s\n\nOptions:\n", os.Args[0], name, cmd.synopsis, cmd.description)
+		fs.PrintDefaults()
 	}
 
-	return sb.String()
+	return fs
 }
 
-func getOptions() Options {
-	var options Options
-
-	flag.BoolVar(&options.Help, "help", false, "show help")
-	flag.BoolVar(&options.Version, "version", false, "show version and exit")
-
-	flag.BoolVar(&options.ApplySchema, "apply-schema", false, "apply schema (this will recreate all tables. It should be used on the first run.)")
-	flag.StringVar(&options.Input, "input", "export.xml", "input file")
-	flag.StringVar(&options.DBHost, "dbhost", "localhost", "database host")
-	flag.StringVar(&options.DBUser, "dbuser", "postgres", "database user")
-	flag.IntVar(&options.DBPort, "dbport", 5432, "database port")
-	flag.StringVar(&options.DBPass, "dbpass", "", "database password")
-	flag.BoolVar(&options.DBSSL, "dbssl", false, "database ssl")
-	flag.StringVar(&options.Database, "database", "health", "database name")
-
-	flag.Usage = usage
-
-	flag.Parse()
+// parseSubcommand parses the flags of commands such as "schema apply", which
+// take a subcommand before or after their options.
+func parseSubcommand(fs *flag.FlagSet, args []string) string {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		fs.Parse(args[1:])
+		return args[0]
+	}
 
-	return options
+	fs.Parse(args)
+	return fs.Arg(0)
 }
 
 func printVersion() {
@@ -172,60 +84,60 @@ func printVersion() {
 
 func usage() {
 	printVersion()
-	fmt.Printf("Usage: %s [options]\n", os.Args[0])
-	flag.PrintDefaults()
+	fmt.Printf("Usage: %s <command> [options]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Printf("  %-10s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Printf("\nRun '%s help <command>' for the options of a command.\n", os.Args[0])
 }
 
-func main() {
-	options := getOptions()
-
-	if options.Version {
-		printVersion()
-		return
-	}
+func runVersion(ctx context.Context, args []string) error {
+	printVersion()
+	return nil
+}
 
-	if options.Help {
-		flag.Usage()
-		return
+func runHelp(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "help" {
+		usage()
+		return nil
 	}
 
-	file, err := os.Open("export.xml")
-	if err != nil {
-		log.Panicf("open: %v\n", err)
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
 	}
-	decoder := xml.NewDecoder(file)
 
-	ctx := context.Background()
-
-	db, err := connect(ctx, options.DBURL())
-	if err != nil {
-		log.Panicf("connect: %v\n", err)
-	}
-	defer db.Close(ctx)
+	// every command prints its usage and exits on -help
+	return cmd.run(ctx, []string{"-help"})
+}
 
-	if err := db.Ping(ctx); err != nil {
-		log.Panicf("ping: %v\n", err)
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 {
+		usage()
+		return
 	}
 
-	if options.ApplySchema {
-		fmt.Println("applying schema...")
-		schema, err := health.Schema()
-		if err != nil {
-			log.Panicf("cannot read schema: %v\n", err)
-		}
-		if _, err := db.Exec(ctx, schema); err != nil {
-			log.Panicf("cannot apply schema: %v\n", err)
+	switch args[0] {
+	case "-version", "--version":
+		args[0] = "version"
+	case "-help", "--help", "-h":
+		args[0] = "help"
+	default:
+		if strings.HasPrefix(args[0], "-") {
+			// flags without a command, as accepted by earlier versions
+			fmt.Println("no command given, assuming import")
+			args = append([]string{"import"}, args...)
 		}
 	}
 
-	var data health.HealthData
-	fmt.Println("decoding data...")
-	if err := decoder.Decode(&data); err != nil {
-		log.Panicf("decode error: %v\n", err)
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		usage()
+		os.Exit(2)
 	}
 
-	fmt.Println("inserting data...")
-	if err := insert(ctx, db, &data); err != nil {
-		log.Panicf("insert error: %v\n", err)
+	if err := cmd.run(context.Background(), args[1:]); err != nil {
+		log.Panicf("%s: %v\n", cmd.name, err)
 	}
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lsmoura/health/pkg/config"
+	"os"
+	"strconv"
+)
+
+// Options holds the connection settings shared by every command that talks
+// to the database. They are resolved together with the config file, the
+// HEALTH_* environment variables and libpq's own sources by resolve.
+type Options struct {
+	ConfigFile string
+	DSN        string
+
+	DBHost    string
+	DBUser    string
+	DBPort    int
+	DBPass    string
+	DBSSL     bool
+	DBService string
+	Database  string
+
+	fs *flag.FlagSet
+}
+
+// envNames maps the connection flags to the HEALTH_* environment variables
+// that can replace them.
+var envNames = map[string]string{
+	"dsn":       "HEALTH_DSN",
+	"dbhost":    "HEALTH_DBHOST",
+	"dbuser":    "HEALTH_DBUSER",
+	"dbport":    "HEALTH_DBPORT",
+	"dbpass":    "HEALTH_DBPASS",
+	"dbssl":     "HEALTH_DBSSL",
+	"dbservice": "HEALTH_DBSERVICE",
+	"database":  "HEALTH_DATABASE",
+}
+
+func (o *Options) register(fs *flag.FlagSet) {
+	o.fs = fs
+	fs.StringVar(&o.ConfigFile, "config", "", "config file, YAML or TOML (default $HEALTH_CONFIG or "+config.DefaultPath()+")")
+	fs.StringVar(&o.DSN, "dsn", "", "connection string, as a URL or libpq keyword/value pairs")
+	fs.StringVar(&o.DBHost, "dbhost", "", "database host (default localhost)")
+	fs.StringVar(&o.DBUser, "dbuser", "", "database user (default postgres)")
+	fs.IntVar(&o.DBPort, "dbport", 0, "database port (default 5432)")
+	fs.StringVar(&o.DBPass, "dbpass", "", "database password (prefer HEALTH_DBPASS, PGPASSWORD or ~/.pgpass)")
+	fs.BoolVar(&o.DBSSL, "dbssl", false, "database ssl")
+	fs.StringVar(&o.DBService, "dbservice", "", "service name from pg_service.conf")
+	fs.StringVar(&o.Database, "database", "", "database name (default health)")
+}
+
+func sslMode(enabled bool) string {
+	if enabled {
+		return "require"
+	}
+
+	return "disable"
+}
+
+// flagSource returns the connection flags that were given explicitly.
+func (o *Options) flagSource() config.Source {
+	source := config.Source{Name: "command line", Values: make(map[string]string)}
+	o.fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "dsn":
+			source.DSN = o.DSN
+		case "dbhost":
+			source.Values[config.Host] = o.DBHost
+		case "dbuser":
+			source.Values[config.User] = o.DBUser
+		case "dbport":
+			source.Values[config.Port] = strconv.Itoa(o.DBPort)
+		case "dbpass":
+			source.Values[config.Password] = o.DBPass
+		case "dbssl":
+			source.Values[config.SSLMode] = sslMode(o.DBSSL)
+		case "dbservice":
+			source.Values[config.Service] = o.DBService
+		case "database":
+			source.Values[config.DBName] = o.Database
+		}
+	})
+
+	return source
+}
+
+func envSource() (config.Source, error) {
+	source := config.Source{
+		Name: "HEALTH_* environment variables",
+		DSN:  os.Getenv(envNames["dsn"]),
+		Values: map[string]string{
+			config.Host:     os.Getenv(envNames["dbhost"]),
+			config.User:     os.Getenv(envNames["dbuser"]),
+			config.Port:     os.Getenv(envNames["dbport"]),
+			config.Password: os.Getenv(envNames["dbpass"]),
+			config.Service:  os.Getenv(envNames["dbservice"]),
+			config.DBName:   os.Getenv(envNames["database"]),
+		},
+	}
+
+	if value := os.Getenv(envNames["dbssl"]); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return source, fmt.Errorf("%s: %w", envNames["dbssl"], err)
+		}
+		source.Values[config.SSLMode] = sslMode(enabled)
+	}
+
+	return source, nil
+}
+
+// loadFile reads the config file given by -config or HEALTH_CONFIG, or the
+// default one if it exists.
+func (o *Options) loadFile() (*config.File, error) {
+	path, explicit := o.ConfigFile, o.ConfigFile != ""
+	if !explicit {
+		path = os.Getenv("HEALTH_CONFIG")
+		explicit = path != ""
+	}
+	if !explicit {
+		path = config.DefaultPath()
+	}
+
+	file, err := config.Load(path, explicit)
+	if err != nil {
+		return nil, fmt.Errorf("config.Load: %w", err)
+	}
+
+	return file, nil
+}
+
+// resolve merges, from the lowest to the highest priority, the config file,
+// the HEALTH_* environment variables and the command line flags.
+func (o *Options) resolve() (*config.Connection, error) {
+	file, err := o.loadFile()
+	if err != nil {
+		return nil, err
+	}
+	env, err := envSource()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []config.Source{env, o.flagSource()}
+	if file.Path != "" {
+		sources = append([]config.Source{file.Source()}, sources...)
+	}
+
+	home, _ := os.UserHomeDir()
+	resolver := config.Resolver{Getenv: os.Getenv, HomeDir: home}
+
+	return resolver.Resolve(sources...)
+}
+
+// connect opens a pool and makes sure the database can be reached.
+func (o *Options) connect(ctx context.Context) (*pgxpool.Pool, error) {
+	connection, err := o.resolve()
+	if err != nil {
+		return nil, fmt.Errorf("resolve: %w", err)
+	}
+
+	pool, err := pgxpool.New(ctx, connection.ConnString())
+	if err != nil {
+		return nil, fmt.Errorf("pgxpool.New: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("ping: %w", err)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/lsmoura/health/pkg/anonymize"
+	"github.com/lsmoura/health/pkg/filter"
+	"github.com/lsmoura/health/pkg/importer"
+	"github.com/lsmoura/health/pkg/influx"
+	"github.com/lsmoura/health/pkg/input"
+	"github.com/lsmoura/health/pkg/openmetrics"
+	"github.com/lsmoura/health/pkg/pipeline"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// outputOptions are the flags of import writing to a file instead of the
+// database.
+type outputOptions struct {
+	output    string
+	precision string
+}
+
+func (o *outputOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.output, "output", "", "write the records to openmetrics:FILE or influx:FILE instead of the database (- for stdout, an http URL for influx)")
+	fs.StringVar(&o.precision, "precision", "ns", "timestamp precision of the influx output: ns, us, ms or s")
+}
+
+// outputSink is a sink writing to a file, flushed once the export is decoded.
+type outputSink interface {
+	pipeline.Sink
+	Flush() error
+}
+
+// openMetricsSink writes the samples of an openmetrics.Writer when flushed,
+// since metric families must be written at once.
+type openMetricsSink struct {
+	*openmetrics.Writer
+	out io.Writer
+}
+
+func (s openMetricsSink) Flush() error {
+	_, err := s.WriteTo(s.out)
+	return err
+}
+
+// httpOutput streams what is written to it in the body of a POST request,
+// which is checked on Close.
+type httpOutput struct {
+	*io.PipeWriter
+	done chan error
+
+	once sync.Once
+	err  error
+}
+
+func postOutput(ctx context.Context, target string, contentType string) (*httpOutput, error) {
+	r, w := io.Pipe()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, r)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	out := &httpOutput{PipeWriter: w, done: make(chan error, 1)}
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			r.CloseWithError(err)
+			out.done <- err
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("POST %s", resp.Status)
+			if body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024)); len(bytes.TrimSpace(body)) > 0 {
+				err = fmt.Errorf("POST %s: %s", resp.Status, bytes.TrimSpace(body))
+			}
+		}
+		r.CloseWithError(err)
+		out.done <- err
+	}()
+
+	return out, nil
+}
+
+// CloseWithError ends the body, aborting the request when err is not nil,
+// and returns the error of the request.
+func (o *httpOutput) CloseWithError(err error) error {
+	o.once.Do(func() {
+		o.PipeWriter.CloseWithError(err)
+		o.err = <-o.done
+	})
+
+	return o.err
+}
+
+func (o *httpOutput) Close() error {
+	return o.CloseWithError(nil)
+}
+
+// influxTarget adds the precision to the query of a write URL that does not
+// set one.
+func influxTarget(target string, precision influx.Precision) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("url.Parse: %w", err)
+	}
+	query := u.Query()
+	if query.Get("precision") == "" {
+		query.Set("precision", string(precision))
+		u.RawQuery = query.Encode()
+	}
+
+	return u.String(), nil
+}
+
+// writeOutput decodes an export into a file instead of the database. The
+// output is FORMAT:FILE, FILE being - for stdout.
+func writeOutput(ctx context.Context, inputName string, workers int, filters *filter.Filter, anonymizer *anonymize.Anonymizer, options outputOptions) (err error) {
+	format, name, ok := strings.Cut(options.output, ":")
+	if !ok || name == "" {
+		return fmt.Errorf("invalid output %q, expected FORMAT:FILE", options.output)
+	}
+	if format != "openmetrics" && format != "influx" {
+		return fmt.Errorf("unknown output format %q", format)
+	}
+	precision, err := influx.ParsePrecision(options.precision)
+	if err != nil {
+		return err
+	}
+
+	file, err := input.Open(inputName)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	defer file.Close()
+
+	var out io.WriteCloser
+	if format == "influx" && (strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")) {
+		var target string
+		if target, err = influxTarget(name, precision); err != nil {
+			return err
+		}
+		var post *httpOutput
+		if post, err = postOutput(ctx, target, "text/plain; charset=utf-8"); err != nil {
+			return err
+		}
+		// a failed import must not send what was decoded so far
+		defer func() { post.CloseWithError(err) }()
+		out = post
+	} else {
+		out, err = createOutput(name)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	var sink outputSink
+	switch format {
+	case "openmetrics":
+		sink = openMetricsSink{openmetrics.NewWriter(importer.Tables()), out}
+	case "influx":
+		sink = influx.NewWriter(out, importer.Tables(), precision)
+	}
+
+	// reports would end up in the middle of the output
+	log := os.Stdout
+	if name == "-" {
+		log = os.Stderr
+	}
+
+	imp := importer.Importer{Workers: workers, Anonymizer: anonymizer, Log: log}
+	if !filters.IsZero() {
+		imp.Filter = filters
+	}
+	if !file.IsStdin() {
+		imp.ExportDir = os.DirFS(filepath.Dir(inputName))
+	}
+
+	// progress would end up in the middle of the output
+	stopProgress := func() {}
+	if name != "-" {
+		stopProgress = showProgress(file)
+	}
+	err = imp.Decode(ctx, pipeline.NewScanner(file), sink, nil)
+	stopProgress()
+	if err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+
+	if err := sink.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	if anonymizer != nil {
+		anonymizer.Report().WriteTo(log)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lsmoura/health/pkg/person"
+	"os"
+	"text/tabwriter"
+)
+
+// registerPerson adds the -person flag of the commands reading or writing
+// the rows of a person.
+func registerPerson(fs *flag.FlagSet, name *string) {
+	fs.StringVar(name, "person", "", "person whose rows are read or written (default $HEALTH_PERSON, else "+person.DefaultName+")")
+}
+
+// personName returns the person given as a flag, else the one of
+// HEALTH_PERSON, else the default one.
+func personName(name string) string {
+	if name == "" {
+		name = os.Getenv("HEALTH_PERSON")
+	}
+	if name == "" {
+		name = person.DefaultName
+	}
+
+	return name
+}
+
+// lookupPerson returns the id of the person given as a flag, who must have
+// been imported.
+func lookupPerson(ctx context.Context, db *pgxpool.Pool, name string) (int64, error) {
+	id, err := person.Lookup(ctx, db, personName(name))
+	if errors.Is(err, person.ErrNotFound) {
+		return 0, fmt.Errorf("%w, import their export with -person first", err)
+	}
+
+	return id, err
+}
+
+func runPersons(ctx context.Context, args []string) error {
+	var options Options
+	var name, role string
+
+	fs := newFlagSet("persons")
+	options.register(fs)
+	registerPerson(fs, &name)
+	fs.StringVar(&role, "role", "", "database role seeing the rows of the person with row level security (empty for none)")
+	subcommand := parseSubcommand(fs, args)
+
+	switch subcommand {
+	case "list", "role", "remove":
+	default:
+		fs.Usage()
+		return fmt.Errorf("expected list, role or remove, got %q", subcommand)
+	}
+
+	db, err := options.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+
+	if subcommand == "list" {
+		return listPersons(ctx, db)
+	}
+
+	id, err := lookupPerson(ctx, db, name)
+	if err != nil {
+		return err
+	}
+
+	if subcommand == "role" {
+		var value *string
+		if role != "" {
+			value = &role
+		}
+		return person.SetRole(ctx, db, id, value)
+	}
+
+	counts, err := person.Remove(ctx, db, id)
+	if err != nil {
+		return fmt.Errorf("person.Remove: %w", err)
+	}
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	fmt.Printf("Removed %s and %d rows from %d tables\n", personName(name), total, len(counts))
+
+	return nil
+}
+
+func listPersons(ctx context.Context, db *pgxpool.Pool) error {
+	persons, err := person.List(ctx, db)
+	if err != nil {
+		return fmt.Errorf("person.List: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tROLE\tRECORDS\tWORKOUTS\tCREATED")
+	for _, p := range persons {
+		var records, workouts int64
+		err := db.QueryRow(ctx, `
+			SELECT (SELECT COUNT(*) FROM records WHERE person_id = $1),
+			       (SELECT COUNT(*) FROM workouts WHERE person_id = $1)`, p.ID).Scan(&records, &workouts)
+		if err != nil {
+			return fmt.Errorf("count %s: %w", p.Name, err)
+		}
+		role := "-"
+		if p.Role != nil {
+			role = *p.Role
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", p.Name, role, records, workouts, p.CreatedAt.Format("2006-01-02"))
+	}
+
+	return w.Flush()
+}
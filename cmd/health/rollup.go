@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lsmoura/health/pkg/config"
+	"github.com/lsmoura/health/pkg/dedup"
+	"github.com/lsmoura/health/pkg/rollup"
+	"time"
+)
+
+func registerTimeZone(fs *flag.FlagSet, timeZone *string) {
+	fs.StringVar(timeZone, "time-zone", "", "time zone of the records without one (default from the config file, else local)")
+}
+
+// loadLocation returns the time zone given as a flag, else the one of the
+// config file, else the local one.
+func loadLocation(file *config.File, timeZone string) (*time.Location, error) {
+	if timeZone == "" {
+		timeZone = file.TimeZone
+	}
+	if timeZone == "" {
+		return time.Local, nil
+	}
+
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("time.LoadLocation: %w", err)
+	}
+
+	return location, nil
+}
+
+// rollUp rebuilds the daily and weekly metrics of a person for the days of
+// their records.
+func rollUp(ctx context.Context, db *pgxpool.Pool, options *Options, personID int64, timeZone string) error {
+	file, err := options.loadFile()
+	if err != nil {
+		return err
+	}
+	location, err := loadLocation(file, timeZone)
+	if err != nil {
+		return err
+	}
+
+	roller := rollup.Roller{Pool: db, PersonID: personID, Location: location, Cumulative: dedup.Cumulative}
+	return roller.Run(ctx)
+}
+
+func runRollup(ctx context.Context, args []string) error {
+	var options Options
+	var timeZone, name string
+
+	fs := newFlagSet("rollup")
+	options.register(fs)
+	registerPerson(fs, &name)
+	registerTimeZone(fs, &timeZone)
+	fs.Parse(args)
+
+	db, err := options.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+	personID, err := lookupPerson(ctx, db, name)
+	if err != nil {
+		return err
+	}
+
+	return rollUp(ctx, db, &options, personID, timeZone)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lsmoura/health/pkg/health"
+)
+
+func applySchemaTo(ctx context.Context, db *pgxpool.Pool) error {
+	fmt.Println("applying schema...")
+	schema, err := health.Schema()
+	if err != nil {
+		return fmt.Errorf("cannot read schema: %w", err)
+	}
+	if _, err := db.Exec(ctx, schema); err != nil {
+		return fmt.Errorf("cannot apply schema: %w", err)
+	}
+
+	return nil
+}
+
+// applyPolicies enables the row level security policies restricting every
+// table to the rows of the persons of the current database role.
+func applyPolicies(ctx context.Context, db *pgxpool.Pool) error {
+	fmt.Println("applying row level security policies...")
+	policies, err := health.Policies()
+	if err != nil {
+		return fmt.Errorf("cannot read policies: %w", err)
+	}
+	if _, err := db.Exec(ctx, policies); err != nil {
+		return fmt.Errorf("cannot apply policies: %w", err)
+	}
+
+	return nil
+}
+
+// databaseTables reads the columns of every table of the current schema.
+func databaseTables(ctx context.Context, db *pgxpool.Pool) ([]health.Table, error) {
+	rows, err := db.Query(ctx, `
+		SELECT table_name, column_name, data_type, is_nullable = 'NO'
+		FROM information_schema.columns
+		WHERE table_schema = current_schema()
+		ORDER BY table_name, ordinal_position`)
+	if err != nil {
+		return nil, fmt.Errorf("db.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []health.Table
+	for rows.Next() {
+		var tableName string
+		var column health.Column
+		if err := rows.Scan(&tableName, &column.Name, &column.Type, &column.NotNull); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+
+		if len(tables) == 0 || tables[len(tables)-1].Name != tableName {
+			tables = append(tables, health.Table{Name: tableName})
+		}
+		tables[len(tables)-1].Columns = append(tables[len(tables)-1].Columns, column)
+	}
+
+	return tables, rows.Err()
+}
+
+func runSchema(ctx context.Context, args []string) error {
+	var options Options
+
+	fs := newFlagSet("schema")
+	options.register(fs)
+	subcommand := parseSubcommand(fs, args)
+
+	switch subcommand {
+	case "print":
+		schema, err := health.Schema()
+		if err != nil {
+			return fmt.Errorf("cannot read schema: %w", err)
+		}
+		fmt.Println(schema)
+		return nil
+	case "apply", "diff", "rls":
+	default:
+		fs.Usage()
+		return fmt.Errorf("expected apply, print, diff or rls, got %q", subcommand)
+	}
+
+	db, err := options.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+
+	if subcommand == "apply" {
+		return applySchemaTo(ctx, db)
+	}
+	if subcommand == "rls" {
+		return applyPolicies(ctx, db)
+	}
+
+	expected, err := health.SchemaTables()
+	if err != nil {
+		return fmt.Errorf("health.SchemaTables: %w", err)
+	}
+	actual, err := databaseTables(ctx, db)
+	if err != nil {
+		return fmt.Errorf("databaseTables: %w", err)
+	}
+
+	diff := health.DiffSchema(expected, actual)
+	for _, line := range diff {
+		fmt.Println(line)
+	}
+	if len(diff) > 0 {
+		return errors.New("database schema differs from schema.sql, run 'health schema apply' to recreate it")
+	}
+	fmt.Println("database schema is up to date")
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lsmoura/health/pkg/api"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+)
+
+func runServe(ctx context.Context, args []string) error {
+	var options Options
+	var listen, name string
+
+	fs := newFlagSet("serve")
+	options.register(fs)
+	registerPerson(fs, &name)
+	fs.StringVar(&listen, "listen", "localhost:8080", "address to listen on")
+	fs.Parse(args)
+
+	db, err := options.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+	personID, err := lookupPerson(ctx, db, name)
+	if err != nil {
+		return err
+	}
+
+	server := api.Server{Pool: db, PersonID: personID}
+	httpServer := &http.Server{
+		Addr:              listen,
+		Handler:           server.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("listening on http://%s\n", listen)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("ListenAndServe: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lsmoura/health/pkg/dedup"
+	"github.com/lsmoura/health/pkg/sleep"
+	"time"
+)
+
+const defaultDayBoundary = "12h"
+
+// sleepOptions are the sleep settings given as flags, which take precedence
+// over the config file.
+type sleepOptions struct {
+	dayBoundary string
+	timeZone    string
+}
+
+// analyzeSleep rebuilds the sleep rows of a person with the sleep settings
+// and the source priority of the config file.
+func analyzeSleep(ctx context.Context, db *pgxpool.Pool, options *Options, personID int64, flags sleepOptions) error {
+	file, err := options.loadFile()
+	if err != nil {
+		return err
+	}
+	priority, err := dedup.ParsePriority(file.Priority)
+	if err != nil {
+		return fmt.Errorf("dedup.ParsePriority: %w", err)
+	}
+
+	dayBoundary := defaultDayBoundary
+	for _, value := range []string{file.Sleep.DayBoundary, flags.dayBoundary} {
+		if value != "" {
+			dayBoundary = value
+		}
+	}
+	boundary, err := time.ParseDuration(dayBoundary)
+	if err != nil {
+		return fmt.Errorf("invalid day boundary: %w", err)
+	}
+
+	location, err := loadLocation(file, flags.timeZone)
+	if err != nil {
+		return err
+	}
+
+	analyzer := sleep.Analyzer{
+		Pool:     db,
+		PersonID: personID,
+		Options: sleep.Options{
+			DayBoundary: boundary,
+			Location:    location,
+			Rank:        func(source string) int { return priority.Rank(sleep.RecordType, source) },
+		},
+	}
+	return analyzer.Run(ctx)
+}
+
+func runSleep(ctx context.Context, args []string) error {
+	var options Options
+	var flags sleepOptions
+	var name string
+
+	fs := newFlagSet("sleep")
+	options.register(fs)
+	registerPerson(fs, &name)
+	fs.StringVar(&flags.dayBoundary, "day-boundary", "", "time of day at which nights are split (default "+defaultDayBoundary+")")
+	registerTimeZone(fs, &flags.timeZone)
+	fs.Parse(args)
+
+	db, err := options.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+	personID, err := lookupPerson(ctx, db, name)
+	if err != nil {
+		return err
+	}
+
+	return analyzeSleep(ctx, db, &options, personID, flags)
+}
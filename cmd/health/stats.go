@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/lsmoura/health/pkg/importer"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func runStats(ctx context.Context, args []string) error {
+	var options Options
+	var name string
+
+	fs := newFlagSet("stats")
+	options.register(fs)
+	registerPerson(fs, &name)
+	fs.Parse(args)
+
+	db, err := options.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+	personID, err := lookupPerson(ctx, db, name)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tROWS")
+	for _, table := range importer.TableNames() {
+		var count int64
+		query := "SELECT COUNT(*) FROM " + pgx.Identifier{table}.Sanitize() + " WHERE person_id = $1"
+		if err := db.QueryRow(ctx, query, personID).Scan(&count); err != nil {
+			return fmt.Errorf("count %s: %w", table, err)
+		}
+		fmt.Fprintf(w, "%s\t%d\n", table, count)
+	}
+	w.Flush()
+
+	rows, err := db.Query(ctx, `
+		SELECT type, COUNT(*), MIN(start_date), MAX(start_date)
+		FROM records
+		WHERE person_id = $1
+		GROUP BY type
+		ORDER BY type`, personID)
+	if err != nil {
+		return fmt.Errorf("db.Query: %w", err)
+	}
+	defer rows.Close()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RECORD TYPE\tROWS\tFIRST\tLAST")
+	for rows.Next() {
+		var recordType string
+		var count int64
+		var first, last time.Time
+		if err := rows.Scan(&recordType, &count, &first, &last); err != nil {
+			return fmt.Errorf("rows.Scan: %w", err)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", recordType, count, first.Format("2006-01-02"), last.Format("2006-01-02"))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return w.Flush()
+}
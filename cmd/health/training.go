@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lsmoura/health/pkg/training"
+)
+
+// trainingOptions are the training settings given as flags, which take
+// precedence over the config file.
+type trainingOptions struct {
+	maxHR     float64
+	restingHR float64
+	karvonen  bool
+	timeZone  string
+}
+
+// analyzeTraining rebuilds the heart rate zones and training load of a
+// person.
+func analyzeTraining(ctx context.Context, db *pgxpool.Pool, options *Options, personID int64, flags trainingOptions) error {
+	file, err := options.loadFile()
+	if err != nil {
+		return err
+	}
+	location, err := loadLocation(file, flags.timeZone)
+	if err != nil {
+		return err
+	}
+
+	settings := training.Options{
+		MaxHR:     file.Training.MaxHR,
+		RestingHR: file.Training.RestingHR,
+		Karvonen:  file.Training.Karvonen || flags.karvonen,
+		Location:  location,
+	}
+	if flags.maxHR != 0 {
+		settings.MaxHR = flags.maxHR
+	}
+	if flags.restingHR != 0 {
+		settings.RestingHR = flags.restingHR
+	}
+
+	analyzer := training.Analyzer{Pool: db, PersonID: personID, Options: settings}
+	return analyzer.Run(ctx)
+}
+
+func runTraining(ctx context.Context, args []string) error {
+	var options Options
+	var flags trainingOptions
+	var name string
+
+	fs := newFlagSet("training")
+	options.register(fs)
+	registerPerson(fs, &name)
+	fs.Float64Var(&flags.maxHR, "max-hr", 0, "max heart rate (default 220 - age)")
+	fs.Float64Var(&flags.restingHR, "resting-hr", 0, "resting heart rate (default the average of the resting heart rate records)")
+	fs.BoolVar(&flags.karvonen, "karvonen", false, "put zones at percentages of the heart rate reserve instead of the max heart rate")
+	registerTimeZone(fs, &flags.timeZone)
+	fs.Parse(args)
+
+	db, err := options.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+	personID, err := lookupPerson(ctx, db, name)
+	if err != nil {
+		return err
+	}
+
+	return analyzeTraining(ctx, db, &options, personID, flags)
+}
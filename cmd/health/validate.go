@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/lsmoura/health/pkg/filter"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/importer"
+	"github.com/lsmoura/health/pkg/input"
+	"github.com/lsmoura/health/pkg/pipeline"
+	"github.com/lsmoura/health/pkg/validate"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+)
+
+// dryRunOptions are the flags shared by validate and import -dry-run.
+type dryRunOptions struct {
+	format string
+	strict bool
+}
+
+func (o *dryRunOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.format, "format", "table", "report format: table or json")
+	fs.BoolVar(&o.strict, "strict", false, "fail when the export does not match its DTD")
+}
+
+func formatDate(report validate.TableSummary) (string, string) {
+	if report.FirstDate == nil {
+		return "-", "-"
+	}
+
+	return report.FirstDate.Format("2006-01-02"), report.LastDate.Format("2006-01-02")
+}
+
+func printCounts(w io.Writer, title string, tables []validate.TableSummary, values func(validate.TableSummary) []validate.Count) {
+	fmt.Fprintf(w, "\nTABLE\t%s\tROWS\n", title)
+	for _, table := range tables {
+		for _, count := range values(table) {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", table.Name, count.Value, count.Rows)
+		}
+	}
+}
+
+func printReport(report *validate.Report) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tROWS\tFIRST\tLAST")
+	for _, table := range report.Tables {
+		first, last := formatDate(table)
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", table.Name, table.Rows, first, last)
+	}
+	printCounts(w, "TYPE", report.Tables, func(t validate.TableSummary) []validate.Count { return t.Types })
+	printCounts(w, "SOURCE", report.Tables, func(t validate.TableSummary) []validate.Count { return t.Sources })
+	printCounts(w, "DEVICE", report.Tables, func(t validate.TableSummary) []validate.Count { return t.Devices })
+
+	if len(report.Violations) > 0 {
+		fmt.Fprintln(w, "\nNOT NULL VIOLATION\tROWS\tIDS")
+		for _, violation := range report.Violations {
+			ids := make([]string, len(violation.IDs))
+			for i, id := range violation.IDs {
+				ids[i] = fmt.Sprint(id)
+			}
+			fmt.Fprintf(w, "%s.%s\t%d\t%s\n", violation.Table, violation.Column, violation.Rows, strings.Join(ids, ","))
+		}
+	}
+
+	if len(report.DTDIssues) > 0 {
+		fmt.Fprintln(w, "\nDTD ISSUE\tELEMENTS")
+		for _, issue := range report.DTDIssues {
+			fmt.Fprintf(w, "%s\t%d\n", issue.Issue, issue.Count)
+		}
+	}
+
+	return w.Flush()
+}
+
+// dryRun decodes an export without touching the database and reports what
+// an import would write.
+func dryRun(ctx context.Context, inputName string, workers int, filters *filter.Filter, options dryRunOptions) error {
+	if options.format != "table" && options.format != "json" {
+		return fmt.Errorf("unknown format %q", options.format)
+	}
+
+	schema, err := health.SchemaTables()
+	if err != nil {
+		return fmt.Errorf("health.SchemaTables: %w", err)
+	}
+
+	file, err := input.Open(inputName)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	defer file.Close()
+
+	imp := importer.Importer{Workers: workers, Log: os.Stdout}
+	if !filters.IsZero() {
+		imp.Filter = filters
+	}
+	if !file.IsStdin() {
+		imp.ExportDir = os.DirFS(filepath.Dir(inputName))
+	}
+
+	summary := validate.NewSummary(importer.Tables(), schema)
+	scanner := pipeline.NewScanner(file)
+
+	// progress would end up in the middle of the json
+	stopProgress := func() {}
+	if options.format == "table" {
+		stopProgress = showProgress(file)
+	} else {
+		imp.Log = os.Stderr
+	}
+	err = imp.Decode(ctx, scanner, summary, summary.Checker(scanner))
+	stopProgress()
+	if err != nil {
+		return fmt.Errorf("invalid export: %w", err)
+	}
+
+	report := summary.Report()
+	report.Filter = imp.Filter
+	if options.format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = printReport(report)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(report.Violations) > 0 {
+		return fmt.Errorf("%d columns would violate NOT NULL constraints", len(report.Violations))
+	}
+	if options.strict && len(report.DTDIssues) > 0 {
+		return fmt.Errorf("the export does not match its DTD (%d issues)", len(report.DTDIssues))
+	}
+
+	return nil
+}
+
+func runValidate(ctx context.Context, args []string) error {
+	var inputName string
+	var workers int
+	var options dryRunOptions
+	var filters filter.Filter
+
+	fs := newFlagSet("validate")
+	fs.StringVar(&inputName, "input", "export.xml", "input file, optionally gzip, zstd or bzip2 compressed (- for stdin)")
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "number of goroutines decoding elements")
+	options.register(fs)
+	registerFilter(fs, &filters)
+	fs.Parse(args)
+
+	return dryRun(ctx, inputName, workers, &filters, options)
+}
@@ -0,0 +1,298 @@
+package activity
+
+import (
+	"github.com/lsmoura/health/pkg/route"
+	"github.com/lsmoura/health/pkg/training"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxHeartRateAge is how long a heart rate sample is assigned to the
+// trackpoints that follow it.
+const maxHeartRateAge = 2 * time.Minute
+
+// Event types of the workout events used as laps.
+const (
+	SegmentEvent = "HKWorkoutEventTypeSegment"
+	LapEvent     = "HKWorkoutEventTypeLap"
+)
+
+// Trackpoint is a point of an activity, with a position when the workout
+// has a route.
+type Trackpoint struct {
+	Time        time.Time
+	HasPosition bool
+	Latitude    float64
+	Longitude   float64
+	Elevation   *float64 // meters
+	Speed       *float64 // meters per second
+	Distance    float64  // meters since the start
+	HeartRate   *float64 // beats per minute
+}
+
+// Lap is a part of an activity.
+type Lap struct {
+	Start            time.Time
+	End              time.Time
+	Distance         float64 // meters
+	AverageHeartRate *float64
+	MaxHeartRate     *float64
+	Points           []Trackpoint
+}
+
+// Duration is the elapsed time of the lap.
+func (l Lap) Duration() time.Duration {
+	return l.End.Sub(l.Start)
+}
+
+// Activity is a workout with its trackpoints and laps.
+type Activity struct {
+	ID     int64
+	Type   string // workout activity type, like HKWorkoutActivityTypeRunning
+	Source string
+	Start  time.Time
+	End    time.Time
+
+	Distance         *float64 // meters
+	Energy           *float64 // kilocalories
+	AverageHeartRate *float64
+	MaxHeartRate     *float64
+
+	Laps   []Lap
+	Points []Trackpoint
+}
+
+// Duration is the elapsed time of the activity.
+func (a *Activity) Duration() time.Duration {
+	return a.End.Sub(a.Start)
+}
+
+// HasRoute tells whether the trackpoints have positions.
+func (a *Activity) HasRoute() bool {
+	for _, p := range a.Points {
+		if p.HasPosition {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Event is a workout event.
+type Event struct {
+	Type     string
+	Date     time.Time
+	Duration time.Duration
+}
+
+// Sport is the name of an activity type in the formats activities are
+// exported to.
+type Sport struct {
+	Name string // lowercase, as used in GPX files
+	TCX  string // Running, Biking or Other
+	FIT  uint8  // sport of the FIT profile
+}
+
+var sports = map[string]Sport{
+	"Running":                       {"running", "Running", 1},
+	"Cycling":                       {"cycling", "Biking", 2},
+	"HandCycling":                   {"cycling", "Biking", 2},
+	"Elliptical":                    {"fitness_equipment", "Other", 4},
+	"StairClimbing":                 {"fitness_equipment", "Other", 4},
+	"Swimming":                      {"swimming", "Other", 5},
+	"Basketball":                    {"basketball", "Other", 6},
+	"Soccer":                        {"soccer", "Other", 7},
+	"Tennis":                        {"tennis", "Other", 8},
+	"AmericanFootball":              {"american_football", "Other", 9},
+	"TraditionalStrengthTraining":   {"training", "Other", 10},
+	"FunctionalStrengthTraining":    {"training", "Other", 10},
+	"HighIntensityIntervalTraining": {"training", "Other", 10},
+	"Walking":                       {"walking", "Other", 11},
+	"CrossCountrySkiing":            {"cross_country_skiing", "Other", 12},
+	"DownhillSkiing":                {"alpine_skiing", "Other", 13},
+	"Snowboarding":                  {"snowboarding", "Other", 14},
+	"Rowing":                        {"rowing", "Other", 15},
+	"Climbing":                      {"mountaineering", "Other", 16},
+	"Hiking":                        {"hiking", "Other", 17},
+	"Paddling":                      {"paddling", "Other", 19},
+}
+
+// Sport returns the sport of the activity type, generic for the types
+// without one.
+func (a *Activity) Sport() Sport {
+	if sport, ok := sports[strings.TrimPrefix(a.Type, "HKWorkoutActivityType")]; ok {
+		return sport
+	}
+
+	return Sport{"generic", "Other", 0}
+}
+
+// trackpoints merges the route with the heart rate samples: route points
+// take the last heart rate of the two minutes before them, and without a
+// route every heart rate sample is a trackpoint.
+func trackpoints(points []route.Point, heartRates []training.HeartRate) []Trackpoint {
+	sort.Slice(heartRates, func(i, j int) bool { return heartRates[i].Time.Before(heartRates[j].Time) })
+
+	var timed []route.Point
+	for _, p := range points {
+		if p.Time != nil {
+			timed = append(timed, p)
+		}
+	}
+	sort.SliceStable(timed, func(i, j int) bool { return timed[i].Time.Before(*timed[j].Time) })
+
+	var out []Trackpoint
+	var previous *route.Point
+	for n := range timed {
+		p := &timed[n]
+		t := Trackpoint{
+			Time:        *p.Time,
+			HasPosition: true,
+			Latitude:    p.Latitude,
+			Longitude:   p.Longitude,
+			Elevation:   p.Elevation,
+			Speed:       p.Speed,
+		}
+		if previous != nil {
+			t.Distance = out[len(out)-1].Distance + route.Distance(*previous, *p)
+		}
+		previous = p
+		out = append(out, t)
+	}
+
+	if len(out) == 0 {
+		for _, hr := range heartRates {
+			bpm := hr.BPM
+			out = append(out, Trackpoint{Time: hr.Time, HeartRate: &bpm})
+		}
+		return out
+	}
+
+	next := 0
+	for n := range out {
+		for next < len(heartRates) && !heartRates[next].Time.After(out[n].Time) {
+			next++
+		}
+		if next == 0 {
+			continue
+		}
+		if hr := heartRates[next-1]; out[n].Time.Sub(hr.Time) <= maxHeartRateAge {
+			bpm := hr.BPM
+			out[n].HeartRate = &bpm
+		}
+	}
+
+	return out
+}
+
+// lapBounds returns the periods of the laps: the segment events that do not
+// overlap each other, or the lap events, or the whole activity.
+func lapBounds(start, end time.Time, events []Event) [][2]time.Time {
+	for _, kind := range []string{SegmentEvent, LapEvent} {
+		var candidates []Event
+		for _, e := range events {
+			if e.Type == kind && e.Duration > 0 {
+				candidates = append(candidates, e)
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			if !a.Date.Equal(b.Date) {
+				return a.Date.Before(b.Date)
+			}
+			return a.Duration < b.Duration
+		})
+
+		var bounds [][2]time.Time
+		for _, e := range candidates {
+			lapEnd := e.Date.Add(e.Duration)
+			if n := len(bounds); n > 0 && e.Date.Before(bounds[n-1][1]) {
+				continue
+			}
+			bounds = append(bounds, [2]time.Time{e.Date, lapEnd})
+		}
+		if len(bounds) > 0 {
+			return bounds
+		}
+	}
+
+	return [][2]time.Time{{start, end}}
+}
+
+// newLap gathers the trackpoints from start until end, included for the
+// last lap. The distance of the lap starts from the point before it.
+func newLap(start, end time.Time, points []Trackpoint, last bool) Lap {
+	lap := Lap{Start: start, End: end}
+	from := -1.0
+	var sum, count float64
+	for _, p := range points {
+		if p.Time.Before(start) {
+			from = p.Distance
+			continue
+		}
+		if p.Time.After(end) || (!last && p.Time.Equal(end)) {
+			break
+		}
+		if from < 0 {
+			from = p.Distance
+		}
+		lap.Points = append(lap.Points, p)
+		lap.Distance = p.Distance - from
+		if p.HeartRate != nil {
+			sum += *p.HeartRate
+			count++
+			if lap.MaxHeartRate == nil || *p.HeartRate > *lap.MaxHeartRate {
+				max := *p.HeartRate
+				lap.MaxHeartRate = &max
+			}
+		}
+	}
+	if count > 0 {
+		average := sum / count
+		lap.AverageHeartRate = &average
+	}
+
+	return lap
+}
+
+// Build fills the trackpoints and laps of an activity from its route, the
+// heart rate samples of its period and its events. The totals that are
+// not set yet are computed from the trackpoints.
+func (a *Activity) Build(points []route.Point, heartRates []training.HeartRate, events []Event) {
+	a.Points = trackpoints(points, heartRates)
+
+	// laps follow each other from the first to the last trackpoint or the
+	// start to the end of the activity, so every trackpoint is in a lap
+	start, end := a.Start, a.End
+	if n := len(a.Points); n > 0 {
+		if a.Points[0].Time.Before(start) {
+			start = a.Points[0].Time
+		}
+		if a.Points[n-1].Time.After(end) {
+			end = a.Points[n-1].Time
+		}
+	}
+	bounds := lapBounds(start, end, events)
+	bounds[0][0] = start
+	for n := 0; n+1 < len(bounds); n++ {
+		bounds[n][1] = bounds[n+1][0]
+	}
+	bounds[len(bounds)-1][1] = end
+
+	a.Laps = nil
+	for n, b := range bounds {
+		a.Laps = append(a.Laps, newLap(b[0], b[1], a.Points, n == len(bounds)-1))
+	}
+
+	whole := newLap(start, end, a.Points, true)
+	if a.Distance == nil && a.HasRoute() {
+		a.Distance = &whole.Distance
+	}
+	if a.AverageHeartRate == nil {
+		a.AverageHeartRate = whole.AverageHeartRate
+	}
+	if a.MaxHeartRate == nil {
+		a.MaxHeartRate = whole.MaxHeartRate
+	}
+}
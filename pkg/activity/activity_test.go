@@ -0,0 +1,226 @@
+package activity
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"github.com/lsmoura/health/pkg/route"
+	"github.com/lsmoura/health/pkg/training"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2022, 1, 1, 17, 0, 0, 0, time.UTC)
+
+func at(seconds int) time.Time {
+	return start.Add(time.Duration(seconds) * time.Second)
+}
+
+func point(seconds int, longitude float64) route.Point {
+	t := at(seconds)
+	elevation := 10.0
+	return route.Point{Time: &t, Latitude: 0, Longitude: longitude, Elevation: &elevation}
+}
+
+// testActivity is a ten minute run along the equator, where 0.001 degree of
+// longitude is about 111 meters.
+func testActivity() *Activity {
+	energy := 100.0
+	a := &Activity{ID: 7, Type: "HKWorkoutActivityTypeRunning", Source: "Watch", Start: at(0), End: at(600), Energy: &energy}
+	points := []route.Point{point(300, 0.002), point(0, 0), point(150, 0.001), point(600, 0.003)}
+	heartRates := []training.HeartRate{{Time: at(-10), BPM: 100}, {Time: at(140), BPM: 140}, {Time: at(550), BPM: 160}}
+	events := []Event{
+		{Type: SegmentEvent, Date: at(0), Duration: 5 * time.Minute},
+		{Type: SegmentEvent, Date: at(0), Duration: 8 * time.Minute}, // a mile, overlapping
+		{Type: SegmentEvent, Date: at(300), Duration: 5 * time.Minute},
+		{Type: "HKWorkoutEventTypePause", Date: at(200)},
+	}
+	a.Build(points, heartRates, events)
+	return a
+}
+
+func bpm(p *float64) float64 {
+	if p == nil {
+		return -1
+	}
+	return *p
+}
+
+func TestBuild(t *testing.T) {
+	a := testActivity()
+
+	if len(a.Points) != 4 {
+		t.Fatalf("expected 4 points, got %d", len(a.Points))
+	}
+	heartRates := make([]float64, len(a.Points))
+	for i, p := range a.Points {
+		heartRates[i] = bpm(p.HeartRate)
+	}
+	// the sample of 140s is too old for the point of 300s
+	if expected := []float64{100, 140, -1, 160}; !reflect.DeepEqual(heartRates, expected) {
+		t.Errorf("expected heart rates %v, got %v", expected, heartRates)
+	}
+	if d := a.Points[3].Distance; math.Abs(d-333.6) > 0.5 {
+		t.Errorf("unexpected distance %v", d)
+	}
+	if a.Distance == nil || *a.Distance != a.Points[3].Distance {
+		t.Errorf("expected the distance of the route, got %v", a.Distance)
+	}
+	if bpm(a.AverageHeartRate) != 400.0/3 || bpm(a.MaxHeartRate) != 160 {
+		t.Errorf("unexpected heart rates %v, %v", bpm(a.AverageHeartRate), bpm(a.MaxHeartRate))
+	}
+
+	if len(a.Laps) != 2 {
+		t.Fatalf("expected 2 laps, got %d", len(a.Laps))
+	}
+	first, second := a.Laps[0], a.Laps[1]
+	if !first.End.Equal(at(300)) || len(first.Points) != 2 || len(second.Points) != 2 {
+		t.Errorf("unexpected laps %+v", a.Laps)
+	}
+	if math.Abs(first.Distance+second.Distance-a.Points[3].Distance) > 1e-9 {
+		t.Errorf("lap distances %v and %v do not add up", first.Distance, second.Distance)
+	}
+	if bpm(second.MaxHeartRate) != 160 || bpm(first.AverageHeartRate) != 120 {
+		t.Errorf("unexpected lap heart rates %v, %v", bpm(second.MaxHeartRate), bpm(first.AverageHeartRate))
+	}
+}
+
+func TestBuildWithoutRoute(t *testing.T) {
+	a := &Activity{Type: "HKWorkoutActivityTypeYoga", Start: at(0), End: at(60)}
+	a.Build(nil, []training.HeartRate{{Time: at(30), BPM: 90}, {Time: at(10), BPM: 80}}, nil)
+
+	if a.HasRoute() || len(a.Points) != 2 || bpm(a.Points[0].HeartRate) != 80 {
+		t.Errorf("unexpected points %+v", a.Points)
+	}
+	if a.Distance != nil || len(a.Laps) != 1 || len(a.Laps[0].Points) != 2 {
+		t.Errorf("unexpected activity %+v", a)
+	}
+	if sport := a.Sport(); sport.Name != "generic" || sport.TCX != "Other" {
+		t.Errorf("unexpected sport %+v", sport)
+	}
+}
+
+func TestWriteGPX(t *testing.T) {
+	var out bytes.Buffer
+	if err := testActivity().WriteGPX(&out); err != nil {
+		t.Fatalf("WriteGPX: %v", err)
+	}
+
+	var doc struct {
+		Type   string `xml:"trk>type"`
+		Points []struct {
+			Lat  float64 `xml:"lat,attr"`
+			Lon  float64 `xml:"lon,attr"`
+			Time string  `xml:"time"`
+			HR   *int    `xml:"extensions>TrackPointExtension>hr"`
+		} `xml:"trk>trkseg>trkpt"`
+	}
+	if err := xml.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("xml.Unmarshal: %v\n%s", err, out.String())
+	}
+	if doc.Type != "running" || len(doc.Points) != 4 {
+		t.Fatalf("unexpected track %+v", doc)
+	}
+	if p := doc.Points[1]; p.Lon != 0.001 || p.Time != "2022-01-01T17:02:30Z" || p.HR == nil || *p.HR != 140 {
+		t.Errorf("unexpected trackpoint %+v", p)
+	}
+	if !strings.Contains(out.String(), `xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1"`) {
+		t.Errorf("missing the TrackPointExtension namespace:\n%s", out.String())
+	}
+}
+
+func TestWriteTCX(t *testing.T) {
+	var out bytes.Buffer
+	if err := testActivity().WriteTCX(&out); err != nil {
+		t.Fatalf("WriteTCX: %v", err)
+	}
+
+	var doc struct {
+		Activity struct {
+			Sport string `xml:"Sport,attr"`
+			Laps  []struct {
+				StartTime string  `xml:"StartTime,attr"`
+				Seconds   float64 `xml:"TotalTimeSeconds"`
+				Calories  int     `xml:"Calories"`
+				Points    []struct {
+					Latitude  *float64 `xml:"Position>LatitudeDegrees"`
+					Distance  float64  `xml:"DistanceMeters"`
+					HeartRate *int     `xml:"HeartRateBpm>Value"`
+				} `xml:"Track>Trackpoint"`
+			} `xml:"Lap"`
+		} `xml:"Activities>Activity"`
+	}
+	if err := xml.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("xml.Unmarshal: %v\n%s", err, out.String())
+	}
+	if doc.Activity.Sport != "Running" || len(doc.Activity.Laps) != 2 {
+		t.Fatalf("unexpected activity %+v", doc)
+	}
+	lap := doc.Activity.Laps[1]
+	if lap.StartTime != "2022-01-01T17:05:00Z" || lap.Seconds != 300 || lap.Calories != 50 || len(lap.Points) != 2 {
+		t.Errorf("unexpected lap %+v", lap)
+	}
+	if p := lap.Points[1]; p.Latitude == nil || p.HeartRate == nil || *p.HeartRate != 160 || p.Distance < 300 {
+		t.Errorf("unexpected trackpoint %+v", p)
+	}
+}
+
+func TestWriteFIT(t *testing.T) {
+	var out bytes.Buffer
+	if err := testActivity().WriteFIT(&out); err != nil {
+		t.Fatalf("WriteFIT: %v", err)
+	}
+	data := out.Bytes()
+
+	if len(data) < 16 || data[0] != 14 || string(data[8:12]) != ".FIT" {
+		t.Fatalf("invalid header % x", data[:14])
+	}
+	size := int(binary.LittleEndian.Uint32(data[4:]))
+	if size != len(data)-16 {
+		t.Fatalf("header announces %d bytes of data, got %d", size, len(data)-16)
+	}
+	if crc := fitCRC(0, data[:12]); crc != binary.LittleEndian.Uint16(data[12:]) {
+		t.Errorf("invalid header CRC")
+	}
+	// the CRC of a file followed by its CRC is zero
+	if crc := fitCRC(0, data); crc != 0 {
+		t.Errorf("invalid file CRC %x", crc)
+	}
+
+	// walk the messages and count them by global number
+	type definition struct {
+		global uint16
+		size   int
+	}
+	definitions := make(map[byte]definition)
+	counts := make(map[uint16]int)
+	records := data[14 : 14+size]
+	for len(records) > 0 {
+		header := records[0]
+		local := header & 0x0F
+		if header&0x40 != 0 {
+			fields := int(records[5])
+			d := definition{global: binary.LittleEndian.Uint16(records[3:])}
+			for i := 0; i < fields; i++ {
+				d.size += int(records[6+3*i+1])
+			}
+			definitions[local] = d
+			records = records[6+3*fields:]
+			continue
+		}
+		d, ok := definitions[local]
+		if !ok {
+			t.Fatalf("data message of undefined local type %d", local)
+		}
+		counts[d.global]++
+		records = records[1+d.size:]
+	}
+
+	expected := map[uint16]int{fitFileID: 1, fitEvent: 2, fitRecord: 4, fitLap: 2, fitSession: 1, fitActivity: 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected messages %v, got %v", expected, counts)
+	}
+}
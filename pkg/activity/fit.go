@@ -0,0 +1,252 @@
+package activity
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// fitEpoch is the origin of FIT timestamps.
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// FIT profile version written in the file header, 21.40.
+const fitProfileVersion = 2140
+
+// Base types of FIT fields.
+const (
+	fitEnum    = 0x00
+	fitUint8   = 0x02
+	fitUint16  = 0x84
+	fitSint32  = 0x85
+	fitUint32  = 0x86
+	fitUint32z = 0x8C
+)
+
+// Global numbers of the FIT messages written.
+const (
+	fitFileID   = 0
+	fitSession  = 18
+	fitLap      = 19
+	fitRecord   = 20
+	fitEvent    = 21
+	fitActivity = 34
+)
+
+type fitField struct {
+	number   uint8
+	baseType uint8
+	value    any // uint8, uint16, int32 or uint32
+}
+
+func (f fitField) size() uint8 {
+	switch f.value.(type) {
+	case uint8:
+		return 1
+	case uint16:
+		return 2
+	}
+	return 4
+}
+
+// fitEncoder writes FIT messages, defining a local message type the first
+// time a global message is written with a set of fields. There are fewer
+// sets than the 16 local types.
+type fitEncoder struct {
+	data        bytes.Buffer
+	definitions map[string]uint8
+}
+
+func (e *fitEncoder) write(global uint16, fields ...fitField) {
+	key := string([]byte{byte(global), byte(global >> 8)})
+	for _, f := range fields {
+		key += string([]byte{f.number, f.size(), f.baseType})
+	}
+
+	local, ok := e.definitions[key]
+	if !ok {
+		local = uint8(len(e.definitions))
+		e.definitions[key] = local
+
+		e.data.WriteByte(0x40 | local)
+		e.data.WriteByte(0) // reserved
+		e.data.WriteByte(0) // little endian
+		binary.Write(&e.data, binary.LittleEndian, global)
+		e.data.WriteByte(uint8(len(fields)))
+		for _, f := range fields {
+			e.data.Write([]byte{f.number, f.size(), f.baseType})
+		}
+	}
+
+	e.data.WriteByte(local)
+	for _, f := range fields {
+		binary.Write(&e.data, binary.LittleEndian, f.value)
+	}
+}
+
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+// fitCRC computes the CRC of FIT files.
+func fitCRC(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		tmp := fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[b&0xF]
+
+		tmp = fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[(b>>4)&0xF]
+	}
+
+	return crc
+}
+
+func fitTime(t time.Time) uint32 {
+	return uint32(t.Sub(fitEpoch) / time.Second)
+}
+
+// fitSemicircles converts degrees to the unit of FIT positions.
+func fitSemicircles(degrees float64) int32 {
+	return int32(math.Round(degrees * (1 << 31) / 180))
+}
+
+// fitScaled converts a value to a FIT field of the given scale, or to the
+// invalid value of the field when it is missing or out of range.
+func fitScaled(value *float64, scale, offset float64, invalid uint32) uint32 {
+	if value == nil {
+		return invalid
+	}
+	scaled := math.Round((*value + offset) * scale)
+	if scaled < 0 || scaled >= float64(invalid) {
+		return invalid
+	}
+
+	return uint32(scaled)
+}
+
+func fitBPM(bpm *float64) uint8 {
+	return uint8(fitScaled(bpm, 1, 0, math.MaxUint8))
+}
+
+func fitDuration(d time.Duration) uint32 {
+	seconds := d.Seconds()
+	return fitScaled(&seconds, 1000, 0, math.MaxUint32)
+}
+
+func fitDistance(meters float64) uint32 {
+	return fitScaled(&meters, 100, 0, math.MaxUint32)
+}
+
+// WriteFIT writes the activity as a FIT activity file, with a record per
+// trackpoint, a lap message per lap and a single session.
+func (a *Activity) WriteFIT(w io.Writer) error {
+	e := fitEncoder{definitions: make(map[string]uint8)}
+	sport := a.Sport().FIT
+	start, end := fitTime(a.Start), fitTime(a.End)
+
+	e.write(fitFileID,
+		fitField{0, fitEnum, uint8(4)},        // type: activity
+		fitField{1, fitUint16, uint16(255)},   // manufacturer: development
+		fitField{2, fitUint16, uint16(0)},     // product
+		fitField{3, fitUint32z, uint32(a.ID)}, // serial number
+		fitField{4, fitUint32, start},         // time created
+	)
+	e.write(fitEvent,
+		fitField{253, fitUint32, start},
+		fitField{0, fitEnum, uint8(0)}, // timer
+		fitField{1, fitEnum, uint8(0)}, // start
+	)
+
+	for _, p := range a.Points {
+		latitude, longitude := int32(math.MaxInt32), int32(math.MaxInt32)
+		distance := uint32(math.MaxUint32)
+		if p.HasPosition {
+			latitude, longitude = fitSemicircles(p.Latitude), fitSemicircles(p.Longitude)
+			distance = fitDistance(p.Distance)
+		}
+		e.write(fitRecord,
+			fitField{253, fitUint32, fitTime(p.Time)},
+			fitField{0, fitSint32, latitude},
+			fitField{1, fitSint32, longitude},
+			fitField{2, fitUint16, uint16(fitScaled(p.Elevation, 5, 500, math.MaxUint16))},
+			fitField{3, fitUint8, fitBPM(p.HeartRate)},
+			fitField{5, fitUint32, distance},
+			fitField{6, fitUint16, uint16(fitScaled(p.Speed, 1000, 0, math.MaxUint16))},
+		)
+	}
+
+	e.write(fitEvent,
+		fitField{253, fitUint32, end},
+		fitField{0, fitEnum, uint8(0)}, // timer
+		fitField{1, fitEnum, uint8(4)}, // stop all
+	)
+
+	for n, lap := range a.Laps {
+		e.write(fitLap,
+			fitField{254, fitUint16, uint16(n)}, // message index
+			fitField{253, fitUint32, fitTime(lap.End)},
+			fitField{0, fitEnum, uint8(9)}, // lap
+			fitField{1, fitEnum, uint8(1)}, // stop
+			fitField{2, fitUint32, fitTime(lap.Start)},
+			fitField{7, fitUint32, fitDuration(lap.Duration())},
+			fitField{8, fitUint32, fitDuration(lap.Duration())},
+			fitField{9, fitUint32, fitDistance(lap.Distance)},
+			fitField{11, fitUint16, uint16(a.lapCalories(lap))},
+			fitField{15, fitUint8, fitBPM(lap.AverageHeartRate)},
+			fitField{16, fitUint8, fitBPM(lap.MaxHeartRate)},
+			fitField{25, fitEnum, sport},
+		)
+	}
+
+	distance := uint32(math.MaxUint32)
+	if a.Distance != nil {
+		distance = fitDistance(*a.Distance)
+	}
+	e.write(fitSession,
+		fitField{254, fitUint16, uint16(0)}, // message index
+		fitField{253, fitUint32, end},
+		fitField{0, fitEnum, uint8(8)}, // session
+		fitField{1, fitEnum, uint8(1)}, // stop
+		fitField{2, fitUint32, start},
+		fitField{5, fitEnum, sport},
+		fitField{7, fitUint32, fitDuration(a.Duration())},
+		fitField{8, fitUint32, fitDuration(a.Duration())},
+		fitField{9, fitUint32, distance},
+		fitField{11, fitUint16, uint16(fitScaled(a.Energy, 1, 0, math.MaxUint16))},
+		fitField{16, fitUint8, fitBPM(a.AverageHeartRate)},
+		fitField{17, fitUint8, fitBPM(a.MaxHeartRate)},
+		fitField{25, fitUint16, uint16(0)}, // first lap index
+		fitField{26, fitUint16, uint16(len(a.Laps))},
+	)
+	e.write(fitActivity,
+		fitField{253, fitUint32, end},
+		fitField{0, fitUint32, fitDuration(a.Duration())},
+		fitField{1, fitUint16, uint16(1)}, // sessions
+		fitField{2, fitEnum, uint8(0)},    // manual
+		fitField{3, fitEnum, uint8(26)},   // activity
+		fitField{4, fitEnum, uint8(1)},    // stop
+	)
+
+	header := make([]byte, 14)
+	header[0] = 14
+	header[1] = 0x20 // protocol 2.0
+	binary.LittleEndian.PutUint16(header[2:], fitProfileVersion)
+	binary.LittleEndian.PutUint32(header[4:], uint32(e.data.Len()))
+	copy(header[8:], ".FIT")
+	binary.LittleEndian.PutUint16(header[12:], fitCRC(0, header[:12]))
+
+	crc := fitCRC(fitCRC(0, header), e.data.Bytes())
+	trailer := []byte{byte(crc), byte(crc >> 8)}
+
+	for _, b := range [][]byte{header, e.data.Bytes(), trailer} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package activity
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type gpxTrackpoint struct {
+	Lat       float64  `xml:"lat,attr"`
+	Lon       float64  `xml:"lon,attr"`
+	Elevation *float64 `xml:"ele,omitempty"`
+	Time      string   `xml:"time"`
+	HeartRate *int     `xml:"extensions>gpxtpx:TrackPointExtension>gpxtpx:hr,omitempty"`
+}
+
+type gpxFile struct {
+	XMLName      xml.Name        `xml:"gpx"`
+	Version      string          `xml:"version,attr"`
+	Creator      string          `xml:"creator,attr"`
+	Namespace    string          `xml:"xmlns,attr"`
+	TPXNamespace string          `xml:"xmlns:gpxtpx,attr"`
+	Time         string          `xml:"metadata>time"`
+	Name         string          `xml:"trk>name"`
+	Type         string          `xml:"trk>type"`
+	Trackpoints  []gpxTrackpoint `xml:"trk>trkseg>trkpt"`
+}
+
+// Creator names the program in the files written.
+const Creator = "health"
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func roundedBPM(bpm *float64) *int {
+	if bpm == nil {
+		return nil
+	}
+	rounded := int(*bpm + 0.5)
+	return &rounded
+}
+
+// Name is the title of the activity in the files written.
+func (a *Activity) Name() string {
+	return fmt.Sprintf("%s %s", a.Start.Format("2006-01-02 15:04"), a.Sport().Name)
+}
+
+// WriteGPX writes the trackpoints with a position as a GPX 1.1 track, with
+// the heart rate in Garmin's TrackPointExtension.
+func (a *Activity) WriteGPX(w io.Writer) error {
+	doc := gpxFile{
+		Version:      "1.1",
+		Creator:      Creator,
+		Namespace:    "http://www.topografix.com/GPX/1/1",
+		TPXNamespace: "http://www.garmin.com/xmlschemas/TrackPointExtension/v1",
+		Time:         formatTime(a.Start),
+		Name:         a.Name(),
+		Type:         a.Sport().Name,
+	}
+	for _, p := range a.Points {
+		if !p.HasPosition {
+			continue
+		}
+		doc.Trackpoints = append(doc.Trackpoints, gpxTrackpoint{
+			Lat:       p.Latitude,
+			Lon:       p.Longitude,
+			Elevation: p.Elevation,
+			Time:      formatTime(p.Time),
+			HeartRate: roundedBPM(p.HeartRate),
+		})
+	}
+
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", " ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("xml.Encode: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
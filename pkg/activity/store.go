@@ -0,0 +1,231 @@
+package activity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lsmoura/health/pkg/filter"
+	"github.com/lsmoura/health/pkg/route"
+	"github.com/lsmoura/health/pkg/training"
+	"github.com/lsmoura/health/pkg/units"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Load for an unknown workout.
+var ErrNotFound = errors.New("workout not found")
+
+// Loader reads the activities of a person from the workouts, their
+// statistics, events and route points, and the deduplicated heart rate
+// records.
+type Loader struct {
+	Pool     *pgxpool.Pool
+	PersonID int64
+}
+
+// Selection picks workouts by activity type and start date.
+type Selection struct {
+	Types filter.List
+	Since *time.Time
+	Until *time.Time
+}
+
+// IDs lists the selected workouts, by start date.
+func (l *Loader) IDs(ctx context.Context, selection Selection) ([]int64, error) {
+	rows, err := l.Pool.Query(ctx, `
+		SELECT id, workout_activity_type
+		FROM workouts
+		WHERE person_id = $1 AND start_date IS NOT NULL AND end_date IS NOT NULL
+		  AND ($2::TIMESTAMPTZ IS NULL OR start_date >= $2)
+		  AND ($3::TIMESTAMPTZ IS NULL OR start_date < $3)
+		ORDER BY start_date, id`, l.PersonID, selection.Since, selection.Until)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var kind string
+		if err := rows.Scan(&id, &kind); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		if selection.Types.Keep(kind) {
+			ids = append(ids, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return ids, nil
+}
+
+// converted parses a value of the workouts table and converts it to unit.
+func converted(value, from *string, to string) *float64 {
+	if value == nil || from == nil {
+		return nil
+	}
+	parsed, err := strconv.ParseFloat(*value, 64)
+	if err != nil {
+		return nil
+	}
+	out, err := units.Convert(parsed, *from, to)
+	if err != nil {
+		return nil
+	}
+
+	return &out
+}
+
+// statistics sets the totals of the activity from its workout statistics.
+func (l *Loader) statistics(ctx context.Context, a *Activity) error {
+	rows, err := l.Pool.Query(ctx, `
+		SELECT type, average, maximum, sum, unit
+		FROM workout_statistics
+		WHERE workout_id = $1`, a.ID)
+	if err != nil {
+		return fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind string
+		var average, maximum, sum *float64
+		var unit *string
+		if err := rows.Scan(&kind, &average, &maximum, &sum, &unit); err != nil {
+			return fmt.Errorf("rows.Scan: %w", err)
+		}
+
+		switch {
+		case kind == training.HeartRateType:
+			a.AverageHeartRate, a.MaxHeartRate = average, maximum
+		case kind == "HKQuantityTypeIdentifierActiveEnergyBurned" && sum != nil && unit != nil:
+			if kcal, err := units.Convert(*sum, *unit, "kcal"); err == nil {
+				a.Energy = &kcal
+			}
+		case strings.HasPrefix(kind, "HKQuantityTypeIdentifierDistance") && sum != nil && unit != nil:
+			if meters, err := units.Convert(*sum, *unit, "m"); err == nil {
+				a.Distance = &meters
+			}
+		}
+	}
+
+	return rows.Err()
+}
+
+func (l *Loader) events(ctx context.Context, id int64) ([]Event, error) {
+	rows, err := l.Pool.Query(ctx, `
+		SELECT type, date, duration_seconds
+		FROM workout_events
+		WHERE workout_id = $1 AND date IS NOT NULL
+		ORDER BY date`, id)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		var seconds *float64
+		if err := rows.Scan(&e.Type, &e.Date, &seconds); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		if seconds != nil {
+			e.Duration = time.Duration(*seconds * float64(time.Second))
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+func (l *Loader) points(ctx context.Context, id int64) ([]route.Point, error) {
+	rows, err := l.Pool.Query(ctx, `
+		SELECT seq, time, latitude, longitude, elevation, speed
+		FROM workout_route_points
+		WHERE workout_id = $1
+		ORDER BY seq`, id)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var points []route.Point
+	for rows.Next() {
+		p := route.Point{WorkoutID: id}
+		if err := rows.Scan(&p.Seq, &p.Time, &p.Latitude, &p.Longitude, &p.Elevation, &p.Speed); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		points = append(points, p)
+	}
+
+	return points, rows.Err()
+}
+
+func (l *Loader) heartRates(ctx context.Context, a *Activity) ([]training.HeartRate, error) {
+	rows, err := l.Pool.Query(ctx, `
+		SELECT start_date, value
+		FROM records_deduplicated
+		WHERE person_id = $1 AND type = $2 AND start_date >= $3 AND start_date <= $4
+		ORDER BY start_date`, l.PersonID, training.HeartRateType, a.Start, a.End)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []training.HeartRate
+	for rows.Next() {
+		var s training.HeartRate
+		if err := rows.Scan(&s.Time, &s.BPM); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		samples = append(samples, s)
+	}
+
+	return samples, rows.Err()
+}
+
+// Load reads a workout and builds its activity.
+func (l *Loader) Load(ctx context.Context, id int64) (*Activity, error) {
+	a := &Activity{ID: id}
+	var distance, distanceUnit, energy, energyUnit *string
+	err := l.Pool.QueryRow(ctx, `
+		SELECT workout_activity_type, source_name, start_date, end_date,
+		       total_distance, total_distance_unit, total_energy_burned, total_energy_burned_unit
+		FROM workouts
+		WHERE id = $1 AND person_id = $2 AND start_date IS NOT NULL AND end_date IS NOT NULL`, id, l.PersonID,
+	).Scan(&a.Type, &a.Source, &a.Start, &a.End, &distance, &distanceUnit, &energy, &energyUnit)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("workout %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pool.QueryRow: %w", err)
+	}
+	a.Distance = converted(distance, distanceUnit, "m")
+	a.Energy = converted(energy, energyUnit, "kcal")
+
+	if err := l.statistics(ctx, a); err != nil {
+		return nil, fmt.Errorf("statistics: %w", err)
+	}
+	events, err := l.events(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("events: %w", err)
+	}
+	points, err := l.points(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("points: %w", err)
+	}
+	heartRates, err := l.heartRates(ctx, a)
+	if err != nil {
+		return nil, fmt.Errorf("heartRates: %w", err)
+	}
+
+	a.Build(points, heartRates, events)
+	return a, nil
+}
@@ -0,0 +1,113 @@
+package activity
+
+import (
+	"encoding/xml"
+	"io"
+	"math"
+)
+
+type tcxValue struct {
+	Value int `xml:"Value"`
+}
+
+func tcxBPM(bpm *float64) *tcxValue {
+	if rounded := roundedBPM(bpm); rounded != nil {
+		return &tcxValue{*rounded}
+	}
+	return nil
+}
+
+type tcxPosition struct {
+	Latitude  float64 `xml:"LatitudeDegrees"`
+	Longitude float64 `xml:"LongitudeDegrees"`
+}
+
+type tcxTrackpoint struct {
+	Time      string       `xml:"Time"`
+	Position  *tcxPosition `xml:"Position,omitempty"`
+	Altitude  *float64     `xml:"AltitudeMeters,omitempty"`
+	Distance  *float64     `xml:"DistanceMeters,omitempty"`
+	HeartRate *tcxValue    `xml:"HeartRateBpm,omitempty"`
+}
+
+type tcxLap struct {
+	StartTime        string          `xml:"StartTime,attr"`
+	TotalTimeSeconds float64         `xml:"TotalTimeSeconds"`
+	Distance         float64         `xml:"DistanceMeters"`
+	Calories         int             `xml:"Calories"`
+	AverageHeartRate *tcxValue       `xml:"AverageHeartRateBpm,omitempty"`
+	MaxHeartRate     *tcxValue       `xml:"MaximumHeartRateBpm,omitempty"`
+	Intensity        string          `xml:"Intensity"`
+	TriggerMethod    string          `xml:"TriggerMethod"`
+	Trackpoints      []tcxTrackpoint `xml:"Track>Trackpoint,omitempty"`
+}
+
+type tcxFile struct {
+	XMLName   xml.Name `xml:"TrainingCenterDatabase"`
+	Namespace string   `xml:"xmlns,attr"`
+	Activity  struct {
+		Sport   string   `xml:"Sport,attr"`
+		ID      string   `xml:"Id"`
+		Laps    []tcxLap `xml:"Lap"`
+		Creator struct {
+			Type string `xml:"xsi:type,attr"`
+			Name string `xml:"Name"`
+		} `xml:"Creator"`
+	} `xml:"Activities>Activity"`
+	XSINamespace string `xml:"xmlns:xsi,attr"`
+}
+
+// lapCalories shares the energy of the activity between laps by duration,
+// since TCX requires calories for every lap.
+func (a *Activity) lapCalories(lap Lap) int {
+	if a.Energy == nil || a.Duration() <= 0 {
+		return 0
+	}
+
+	return int(math.Round(*a.Energy * lap.Duration().Seconds() / a.Duration().Seconds()))
+}
+
+// WriteTCX writes the activity as a Garmin Training Center file, with a Lap
+// per lap of the activity.
+func (a *Activity) WriteTCX(w io.Writer) error {
+	doc := tcxFile{
+		Namespace:    "http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2",
+		XSINamespace: "http://www.w3.org/2001/XMLSchema-instance",
+	}
+	doc.Activity.Sport = a.Sport().TCX
+	doc.Activity.ID = formatTime(a.Start)
+	doc.Activity.Creator.Type = "Device_t"
+	doc.Activity.Creator.Name = a.Source
+
+	hasRoute := a.HasRoute()
+	for _, lap := range a.Laps {
+		out := tcxLap{
+			StartTime:        formatTime(lap.Start),
+			TotalTimeSeconds: lap.Duration().Seconds(),
+			Distance:         lap.Distance,
+			Calories:         a.lapCalories(lap),
+			AverageHeartRate: tcxBPM(lap.AverageHeartRate),
+			MaxHeartRate:     tcxBPM(lap.MaxHeartRate),
+			Intensity:        "Active",
+			TriggerMethod:    "Manual",
+		}
+		for _, p := range lap.Points {
+			t := tcxTrackpoint{
+				Time:      formatTime(p.Time),
+				Altitude:  p.Elevation,
+				HeartRate: tcxBPM(p.HeartRate),
+			}
+			if p.HasPosition {
+				t.Position = &tcxPosition{p.Latitude, p.Longitude}
+			}
+			if hasRoute {
+				distance := p.Distance
+				t.Distance = &distance
+			}
+			out.Trackpoints = append(out.Trackpoints, t)
+		}
+		doc.Activity.Laps = append(doc.Activity.Laps, out)
+	}
+
+	return writeXML(w, doc)
+}
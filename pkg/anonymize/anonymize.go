@@ -0,0 +1,387 @@
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/lsmoura/health/pkg/ecg"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/route"
+	"io"
+	"math"
+	mathrand "math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const week = 7 * 24 * time.Hour
+
+// Options configures an Anonymizer.
+type Options struct {
+	// Salt keys the pseudonyms and the time offset. The same salt and
+	// person always give the same results. A random salt is used when it
+	// is empty.
+	Salt []byte
+
+	// Person is who the export belongs to: each person has their own
+	// time offset.
+	Person string
+
+	// MaxWeeks bounds the time offset, 52 weeks by default.
+	MaxWeeks int
+
+	// Jitter is how far route start and end points are moved, in meters,
+	// 500 by default.
+	Jitter float64
+}
+
+// Anonymizer rewrites elements so they can be shared without identifying
+// the person they belong to:
+//
+//   - dates are shifted by a whole number of weeks, which keeps weekdays and
+//     times of day;
+//   - dates of birth are generalized to their year;
+//   - source names and devices are replaced by keyed hashes, so samples of a
+//     source are still grouped;
+//   - clinical records and vision prescriptions are dropped;
+//   - routes are reduced to their start and end points, moved at random.
+//
+// An Anonymizer is safe for concurrent use.
+type Anonymizer struct {
+	salt      []byte
+	offset    time.Duration
+	jitter    float64
+	randomKey bool
+
+	mu      sync.Mutex
+	rand    *mathrand.Rand
+	report  Report
+	sources map[string]bool // distinct source names replaced
+	devices map[string]bool // distinct devices replaced
+}
+
+func New(options Options) (*Anonymizer, error) {
+	a := &Anonymizer{salt: options.Salt, jitter: options.Jitter}
+	if len(a.salt) == 0 {
+		a.salt = make([]byte, 32)
+		if _, err := rand.Read(a.salt); err != nil {
+			return nil, fmt.Errorf("rand.Read: %w", err)
+		}
+		a.randomKey = true
+	}
+	if a.jitter == 0 {
+		a.jitter = 500
+	}
+	maxWeeks := options.MaxWeeks
+	if maxWeeks <= 0 {
+		maxWeeks = 52
+	}
+
+	// a non zero number of weeks, earlier or later
+	sum := a.sum("offset", options.Person)
+	weeks := 1 + int64(binary.BigEndian.Uint64(sum[:8])%uint64(maxWeeks))
+	if sum[8]&1 == 1 {
+		weeks = -weeks
+	}
+	a.offset = time.Duration(weeks) * week
+	a.rand = mathrand.New(mathrand.NewSource(int64(binary.BigEndian.Uint64(a.sum("jitter", options.Person)[:8]))))
+	a.report = Report{Dropped: make(map[string]int)}
+	a.sources, a.devices = make(map[string]bool), make(map[string]bool)
+
+	return a, nil
+}
+
+func (a *Anonymizer) sum(kind, value string) []byte {
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte(kind + "\x00" + value))
+	return mac.Sum(nil)
+}
+
+// pseudonym returns a keyed hash of value, such as "source-0a1b2c3d4e5f".
+func (a *Anonymizer) pseudonym(kind, value string) string {
+	return kind + "-" + hex.EncodeToString(a.sum(kind, value)[:6])
+}
+
+// Time shifts a date by the offset of the person.
+func (a *Anonymizer) Time(t time.Time) time.Time {
+	return t.Add(a.offset)
+}
+
+func (a *Anonymizer) count(fn func(r *Report)) {
+	a.mu.Lock()
+	fn(&a.report)
+	a.mu.Unlock()
+}
+
+func (a *Anonymizer) healthTime(t *health.HealthTime) {
+	if t == nil {
+		return
+	}
+	*t = health.HealthTime(a.Time(time.Time(*t)))
+	a.count(func(r *Report) { r.Times++ })
+}
+
+// layoutTime shifts a date stored as a string in layout. Dates that do not
+// parse are removed rather than leaked.
+func (a *Anonymizer) layoutTime(value *string, layout string) {
+	if value == nil || *value == "" {
+		return
+	}
+	t, err := time.Parse(layout, *value)
+	if err != nil {
+		*value = ""
+		return
+	}
+	*value = a.Time(t).Format(layout)
+	a.count(func(r *Report) { r.Times++ })
+}
+
+func (a *Anonymizer) source(name *string) {
+	if name == nil || *name == "" {
+		return
+	}
+	original := *name
+	*name = a.pseudonym("source", original)
+	a.mu.Lock()
+	a.sources[original] = true
+	a.mu.Unlock()
+}
+
+func (a *Anonymizer) device(device *string) {
+	if device == nil || *device == "" {
+		return
+	}
+	original := *device
+	*device = a.pseudonym("device", original)
+	a.mu.Lock()
+	a.devices[original] = true
+	a.mu.Unlock()
+}
+
+// birthYear generalizes a date of birth, 2006-01-02, to its year.
+func (a *Anonymizer) birthYear(date *string) {
+	if date == nil || *date == "" {
+		return
+	}
+	if len(*date) >= 4 {
+		*date = (*date)[:4]
+	} else {
+		*date = ""
+	}
+	a.count(func(r *Report) { r.BirthDates++ })
+}
+
+func (a *Anonymizer) record(r *health.Record) {
+	a.source(&r.SourceName)
+	a.device(r.Device)
+	a.healthTime(r.CreationDate)
+	a.healthTime(r.StartDate)
+	a.healthTime(r.EndDate)
+}
+
+// Element anonymizes an element decoded from an export, a pointer to one of
+// the types of the health package, in place. It returns false for elements
+// that must be dropped.
+func (a *Anonymizer) Element(element any) bool {
+	switch e := element.(type) {
+	case *health.Me:
+		a.birthYear(e.DateOfBirth)
+	case *health.Record:
+		a.record(e)
+	case *health.Correlation:
+		a.source(&e.SourceName)
+		a.device(&e.Device)
+		a.healthTime(e.CreationDate)
+		a.healthTime(e.StartDate)
+		a.healthTime(e.EndDate)
+		for n := range e.Records {
+			a.record(&e.Records[n])
+		}
+	case *health.Workout:
+		a.source(&e.SourceName)
+		a.device(&e.Device)
+		a.healthTime(e.CreationDate)
+		a.healthTime(e.StartDate)
+		a.healthTime(e.EndDate)
+		for n := range e.WorkoutEvent {
+			a.layoutTime(&e.WorkoutEvent[n].Date, health.TimeLayout)
+		}
+		for n := range e.WorkoutStatistics {
+			a.healthTime(e.WorkoutStatistics[n].StartDate)
+			a.healthTime(e.WorkoutStatistics[n].EndDate)
+		}
+		for n := range e.WorkoutRoute {
+			r := &e.WorkoutRoute[n]
+			a.source(&r.SourceName)
+			a.device(&r.Device)
+			a.layoutTime(&r.CreationDate, health.TimeLayout)
+			a.layoutTime(&r.StartDate, health.TimeLayout)
+			a.layoutTime(&r.EndDate, health.TimeLayout)
+			// the route files hold the coordinates, and are named after their date
+			files := len(r.FileReference)
+			r.FileReference = nil
+			a.count(func(r *Report) { r.RouteFiles += files })
+		}
+	case *health.ActivitySummary:
+		a.layoutTime(e.DateComponents, "2006-01-02")
+	case *health.Audiogram:
+		a.source(&e.SourceName)
+		a.device(e.Device)
+		a.healthTime(e.CreationDate)
+		a.healthTime(e.StartDate)
+		a.healthTime(e.EndDate)
+	case *health.ClinicalRecord:
+		a.count(func(r *Report) { r.Dropped["ClinicalRecord"]++ })
+		return false
+	case *health.VisionPrescription:
+		a.count(func(r *Report) { r.Dropped["VisionPrescription"]++ })
+		return false
+	}
+
+	return true
+}
+
+// Recording anonymizes an electrocardiogram: its name is removed, and its
+// file, named after its date, gets a pseudonym.
+func (a *Anonymizer) Recording(r *ecg.Recording) {
+	if r.Name != "" {
+		r.Name = ""
+		a.count(func(r *Report) { r.Names++ })
+	}
+	a.birthYear(&r.DateOfBirth)
+	a.device(&r.Device)
+	if r.FileName != "" {
+		r.FileName = a.pseudonym("ecg", r.FileName) + ".csv"
+	}
+	if r.RecordedDate != nil {
+		shifted := a.Time(*r.RecordedDate)
+		r.RecordedDate = &shifted
+		a.count(func(r *Report) { r.Times++ })
+	}
+}
+
+// metersPerDegree is the length of a degree of latitude.
+const metersPerDegree = 111320
+
+// jitterPoint moves a point by up to a.jitter meters in a random direction.
+func (a *Anonymizer) jitterPoint(p *route.Point) {
+	a.mu.Lock()
+	distance := a.jitter * math.Sqrt(a.rand.Float64())
+	angle := 2 * math.Pi * a.rand.Float64()
+	a.mu.Unlock()
+
+	p.Latitude += distance * math.Cos(angle) / metersPerDegree
+	p.Longitude += distance * math.Sin(angle) / (metersPerDegree * math.Max(math.Cos(p.Latitude*math.Pi/180), 0.01))
+}
+
+// Route keeps the start and end points of a route, moved at random and
+// stripped of everything but their position and shifted time.
+func (a *Anonymizer) Route(points []route.Point) []route.Point {
+	if len(points) == 0 {
+		return nil
+	}
+
+	ends := []route.Point{points[0]}
+	if len(points) > 1 {
+		ends = append(ends, points[len(points)-1])
+	}
+	for n := range ends {
+		p := route.Point{WorkoutID: ends[n].WorkoutID, Seq: n, Latitude: ends[n].Latitude, Longitude: ends[n].Longitude}
+		if ends[n].Time != nil {
+			shifted := a.Time(*ends[n].Time)
+			p.Time = &shifted
+		}
+		a.jitterPoint(&p)
+		ends[n] = p
+	}
+
+	dropped := len(points) - len(ends)
+	a.count(func(r *Report) {
+		r.RoutePoints += dropped
+		r.RouteEnds += len(ends)
+	})
+
+	return ends
+}
+
+// Report tells what an Anonymizer transformed.
+type Report struct {
+	Times       int            // dates shifted
+	Sources     int            // distinct source names replaced
+	Devices     int            // distinct devices replaced
+	BirthDates  int            // dates of birth generalized to their year
+	Names       int            // names removed
+	Dropped     map[string]int // elements dropped, by name
+	RouteFiles  int            // route file references removed
+	RoutePoints int            // route points dropped
+	RouteEnds   int            // route start and end points moved
+
+	// RandomKey is set when no salt was given: pseudonyms and offsets then
+	// differ from an anonymization to the next.
+	RandomKey bool
+}
+
+// Report returns what was transformed so far.
+func (a *Anonymizer) Report() *Report {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	r := a.report
+	r.Dropped = make(map[string]int, len(a.report.Dropped))
+	for name, n := range a.report.Dropped {
+		r.Dropped[name] = n
+	}
+	r.Sources, r.Devices = len(a.sources), len(a.devices)
+	r.RandomKey = a.randomKey
+	return &r
+}
+
+// WriteTo writes the report, a line per transformation. The offset itself
+// is not written, since it would undo the shift.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	var lines []string
+	add := func(format string, args ...any) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	add("anonymized: shifted %d dates by a whole number of weeks", r.Times)
+	add("anonymized: replaced %d source names and %d devices by pseudonyms", r.Sources, r.Devices)
+	if r.BirthDates > 0 {
+		add("anonymized: generalized %d dates of birth to their year", r.BirthDates)
+	}
+	if r.Names > 0 {
+		add("anonymized: removed %d names", r.Names)
+	}
+	names := make([]string, 0, len(r.Dropped))
+	for name := range r.Dropped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add("anonymized: dropped %d %s elements", r.Dropped[name], name)
+	}
+	if r.RouteFiles > 0 {
+		add("anonymized: removed %d route file references", r.RouteFiles)
+	}
+	if r.RoutePoints > 0 || r.RouteEnds > 0 {
+		add("anonymized: dropped %d route points, moved %d route start and end points", r.RoutePoints, r.RouteEnds)
+	}
+	if r.RandomKey {
+		add("anonymized: no salt given, pseudonyms and the time offset will differ next time")
+	}
+
+	var written int64
+	for _, line := range lines {
+		n, err := fmt.Fprintln(w, line)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
@@ -0,0 +1,184 @@
+package anonymize
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/lsmoura/health/pkg/ecg"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/route"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newAnonymizer(t *testing.T, person string) *Anonymizer {
+	t.Helper()
+
+	a, err := New(Options{Salt: []byte("secret"), Person: person})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return a
+}
+
+func TestTime(t *testing.T) {
+	at := time.Date(2022, 3, 1, 8, 30, 0, 0, time.FixedZone("", -3*3600))
+	a, b := newAnonymizer(t, "jane"), newAnonymizer(t, "jane")
+
+	shifted := a.Time(at)
+	if shifted.Equal(at) || !shifted.Equal(b.Time(at)) {
+		t.Errorf("expected the same shift for the same salt and person, got %v and %v", shifted, b.Time(at))
+	}
+	if shifted.Weekday() != at.Weekday() || shifted.Hour() != 8 || shifted.Minute() != 30 {
+		t.Errorf("expected the weekday and time of day to be kept, got %v", shifted)
+	}
+	if d := shifted.Sub(at); d%week != 0 || d > 52*week || d < -52*week {
+		t.Errorf("expected a shift of whole weeks within a year, got %v", d)
+	}
+
+	offsets := make(map[time.Duration]bool)
+	for _, person := range []string{"jane", "john", "alex", "sam"} {
+		offsets[newAnonymizer(t, person).offset] = true
+	}
+	if len(offsets) == 1 {
+		t.Errorf("expected people to have their own offset")
+	}
+}
+
+func TestElement(t *testing.T) {
+	const data = `<HealthData>
+ <Me HKCharacteristicTypeIdentifierDateOfBirth="1985-06-01"/>
+ <Record type="HKQuantityTypeIdentifierHeartRate" sourceName="Jane's Watch" device="&lt;&lt;HKDevice: 0x1&gt;, name:Apple Watch&gt;" unit="count/min" value="62" startDate="2022-03-01 08:00:00 -0300" endDate="2022-03-01 08:00:00 -0300"/>
+ <Workout workoutActivityType="HKWorkoutActivityTypeRunning" sourceName="Jane's Watch" startDate="2022-03-02 07:00:00 -0300" endDate="2022-03-02 07:30:00 -0300">
+  <WorkoutEvent type="HKWorkoutEventTypePause" date="2022-03-02 07:10:00 -0300"/>
+  <WorkoutRoute sourceName="Jane's Watch" startDate="2022-03-02 07:00:00 -0300" endDate="2022-03-02 07:30:00 -0300">
+   <FileReference path="/workout-routes/route_2022-03-02_7.00am.gpx"/>
+  </WorkoutRoute>
+ </Workout>
+ <ActivitySummary dateComponents="2022-03-02"/>
+ <ClinicalRecord type="HKClinicalTypeIdentifierLabResultRecord" identifier="lab-1" sourceName="Hospital"/>
+ <VisionPrescription type="HKVisionPrescriptionTypeGlasses" dateIssued="2022-03-01 08:00:00 -0300"/>
+</HealthData>`
+	var export health.HealthData
+	if err := xml.Unmarshal([]byte(data), &export); err != nil {
+		t.Fatalf("xml.Unmarshal: %v", err)
+	}
+	a := newAnonymizer(t, "jane")
+
+	a.Element(&export.Me)
+	if *export.Me.DateOfBirth != "1985" {
+		t.Errorf("expected the year of birth, got %q", *export.Me.DateOfBirth)
+	}
+
+	r := &export.Records[0]
+	if !a.Element(r) {
+		t.Fatalf("expected the record to be kept")
+	}
+	if r.SourceName != a.pseudonym("source", "Jane's Watch") || !strings.HasPrefix(r.SourceName, "source-") || !strings.HasPrefix(*r.Device, "device-") {
+		t.Errorf("expected pseudonyms, got %q and %q", r.SourceName, *r.Device)
+	}
+	if start := time.Time(*r.StartDate); start.Weekday() != time.Tuesday || start.Hour() != 8 || start.Month() == time.March && start.Year() == 2022 {
+		t.Errorf("unexpected start date %v", start)
+	}
+
+	w := &export.Workouts[0]
+	a.Element(w)
+	if w.SourceName != r.SourceName {
+		t.Errorf("expected the same pseudonym for the same source, got %q and %q", w.SourceName, r.SourceName)
+	}
+	event, _ := time.Parse(health.TimeLayout, w.WorkoutEvent[0].Date)
+	if !event.Equal(a.Time(time.Date(2022, 3, 2, 10, 10, 0, 0, time.UTC))) {
+		t.Errorf("unexpected event date %v", event)
+	}
+	if route := w.WorkoutRoute[0]; route.FileReference != nil || route.StartDate == "2022-03-02 07:00:00 -0300" {
+		t.Errorf("unexpected route %+v", route)
+	}
+
+	summary := &export.ActivitySummary[0]
+	a.Element(summary)
+	if day, err := time.Parse("2006-01-02", *summary.DateComponents); err != nil || day.Weekday() != time.Wednesday || day.Year() == 2022 && day.Month() == time.March {
+		t.Errorf("unexpected activity summary date %q", *summary.DateComponents)
+	}
+
+	if a.Element(&export.ClinicalRecord[0]) || a.Element(&export.VisionPrescription[0]) {
+		t.Errorf("expected clinical records and vision prescriptions to be dropped")
+	}
+
+	report := a.Report()
+	if report.Times != 8 || report.Sources != 1 || report.Devices != 1 || report.BirthDates != 1 || report.RouteFiles != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if report.Dropped["ClinicalRecord"] != 1 || report.Dropped["VisionPrescription"] != 1 {
+		t.Errorf("unexpected dropped elements %v", report.Dropped)
+	}
+}
+
+func TestRecording(t *testing.T) {
+	recorded := time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC)
+	r := ecg.Recording{FileName: "ecg_2022-03-01.csv", Name: "Jane Doe", DateOfBirth: "1985-06-01", RecordedDate: &recorded, Device: "Watch"}
+	a := newAnonymizer(t, "jane")
+	a.Recording(&r)
+
+	if r.Name != "" || r.DateOfBirth != "1985" || strings.Contains(r.FileName, "2022") || r.Device == "Watch" {
+		t.Errorf("unexpected recording %+v", r)
+	}
+	if !r.RecordedDate.Equal(a.Time(recorded)) || recorded.Month() != time.March {
+		t.Errorf("unexpected recorded date %v", r.RecordedDate)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	at := time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC)
+	elevation := 10.0
+	var points []route.Point
+	for n := 0; n < 5; n++ {
+		when := at.Add(time.Duration(n) * time.Minute)
+		points = append(points, route.Point{WorkoutID: 7, Seq: n, Time: &when, Latitude: 37.33, Longitude: -122.03 + float64(n)*0.001, Elevation: &elevation})
+	}
+
+	a := newAnonymizer(t, "jane")
+	ends := a.Route(points)
+	if len(ends) != 2 {
+		t.Fatalf("expected the start and end points, got %v", ends)
+	}
+	for n, original := range []route.Point{points[0], points[4]} {
+		p := ends[n]
+		if p.WorkoutID != 7 || p.Seq != n || p.Elevation != nil || !p.Time.Equal(a.Time(*original.Time)) {
+			t.Errorf("unexpected point %+v", p)
+		}
+		dy := (p.Latitude - original.Latitude) * metersPerDegree
+		dx := (p.Longitude - original.Longitude) * metersPerDegree * math.Cos(original.Latitude*math.Pi/180)
+		if moved := math.Hypot(dx, dy); moved == 0 || moved > 501 {
+			t.Errorf("expected a move of at most 500 m, got %.1f m", moved)
+		}
+	}
+
+	if len(a.Route(nil)) != 0 || len(a.Route(points[:1])) != 1 {
+		t.Errorf("unexpected routes of less than two points")
+	}
+	report := a.Report()
+	if report.RoutePoints != 3 || report.RouteEnds != 3 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestReport(t *testing.T) {
+	report := Report{Times: 3, Sources: 2, Devices: 1, BirthDates: 1, Dropped: map[string]int{"VisionPrescription": 1, "ClinicalRecord": 2}, RoutePoints: 10, RouteEnds: 2, RandomKey: true}
+
+	var out bytes.Buffer
+	if _, err := report.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	expected := `anonymized: shifted 3 dates by a whole number of weeks
+anonymized: replaced 2 source names and 1 devices by pseudonyms
+anonymized: generalized 1 dates of birth to their year
+anonymized: dropped 2 ClinicalRecord elements
+anonymized: dropped 1 VisionPrescription elements
+anonymized: dropped 10 route points, moved 2 route start and end points
+anonymized: no salt given, pseudonyms and the time offset will differ next time
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lsmoura/health/pkg/dbfieldvalues"
+	"github.com/lsmoura/health/pkg/filter"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLimit and MaxLimit bound the number of rows of a page.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Server serves the imported tables of a person as JSON. Rows are objects
+// keyed by their column names.
+type Server struct {
+	Pool     *pgxpool.Pool
+	PersonID int64
+
+	// Now is used for relative dates such as from=7d. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Handler returns the routes of the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/records", s.serve(http.MethodGet, s.records))
+	mux.HandleFunc("/workouts", s.serve(http.MethodGet, s.workouts))
+	mux.HandleFunc("/workouts/", s.serve(http.MethodGet, s.workout))
+	mux.HandleFunc("/daily/", s.serve(http.MethodGet, s.daily))
+	mux.HandleFunc("/sleep", s.serve(http.MethodGet, s.sleep))
+	mux.HandleFunc("/types", s.serve(http.MethodGet, s.types))
+
+	// Grafana JSON datasource, with http://host/grafana as URL
+	mux.HandleFunc("/grafana", s.serve(http.MethodGet, s.grafanaHealth))
+	mux.HandleFunc("/grafana/", s.serve(http.MethodGet, s.grafanaHealth))
+	mux.HandleFunc("/grafana/search", s.serve(http.MethodPost, s.grafanaSearch))
+	mux.HandleFunc("/grafana/query", s.serve(http.MethodPost, s.grafanaQuery))
+	mux.HandleFunc("/grafana/annotations", s.serve(http.MethodPost, s.grafanaAnnotations))
+	mux.HandleFunc("/grafana/tag-keys", s.serve(http.MethodPost, s.grafanaTagKeys))
+	mux.HandleFunc("/grafana/tag-values", s.serve(http.MethodPost, s.grafanaTagValues))
+
+	return mux
+}
+
+// statusError is an error reported to the client with its status.
+type statusError struct {
+	status  int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+func errorf(status int, format string, args ...any) error {
+	return &statusError{status, fmt.Sprintf(format, args...)}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("json.Encode: %v", err)
+	}
+}
+
+// serve turns a function returning the response body into a handler of the
+// requests of a method.
+func (s *Server) serve(method string, handle func(r *http.Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+
+		body, err := handle(r)
+		var statusErr *statusError
+		switch {
+		case errors.As(err, &statusErr):
+			writeJSON(w, statusErr.status, map[string]string{"error": statusErr.message})
+		case err != nil:
+			log.Printf("%s: %v", r.URL.Path, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		default:
+			writeJSON(w, http.StatusOK, body)
+		}
+	}
+}
+
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Page is a page of rows. NextCursor, when not empty, is the cursor
+// parameter of the next page.
+type Page struct {
+	Data       []map[string]any `json:"data"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// encodeCursor encodes the key of the last row of a page.
+func encodeCursor(key ...any) string {
+	data, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor decodes a cursor into the fields of the key.
+func decodeCursor(cursor string, key ...any) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return errorf(http.StatusBadRequest, "invalid cursor")
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil || len(raw) != len(key) {
+		return errorf(http.StatusBadRequest, "invalid cursor")
+	}
+	for i := range key {
+		if err := json.Unmarshal(raw[i], key[i]); err != nil {
+			return errorf(http.StatusBadRequest, "invalid cursor")
+		}
+	}
+
+	return nil
+}
+
+// query builds the WHERE clause of a query from the parameters of a request.
+type query struct {
+	conditions []string
+	args       []any
+}
+
+// where adds a condition, where %s is the placeholder of value.
+func (q *query) where(condition string, value any) {
+	q.args = append(q.args, value)
+	q.conditions = append(q.conditions, fmt.Sprintf(condition, "$"+strconv.Itoa(len(q.args))))
+}
+
+// personQuery starts a query with the condition selecting the rows of the
+// person.
+func (s *Server) personQuery() query {
+	var q query
+	q.where("person_id = %s", s.PersonID)
+	return q
+}
+
+func (q *query) String() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// limit parses the limit parameter.
+func limit(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return DefaultLimit, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, errorf(http.StatusBadRequest, "invalid limit %q", value)
+	}
+	if n > MaxLimit {
+		n = MaxLimit
+	}
+	return n, nil
+}
+
+// timeRange adds the from (inclusive) and to (exclusive) parameters, dates
+// as accepted by filter.ParseTime, as conditions on column.
+func (s *Server) timeRange(r *http.Request, q *query, column string) error {
+	for _, bound := range []struct{ param, condition string }{{"from", ">= %s"}, {"to", "< %s"}} {
+		value := r.URL.Query().Get(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := filter.ParseTime(value, s.now())
+		if err != nil {
+			return errorf(http.StatusBadRequest, "invalid %s: %v", bound.param, err)
+		}
+		q.where(column+" "+bound.condition, t)
+	}
+
+	return nil
+}
+
+// columns lists the columns of the rows of type T, for a SELECT.
+func columns[T any](omit ...string) string {
+	var row T
+	fields := dbfieldvalues.Fields(row, omit...)
+	for i, field := range fields {
+		fields[i] = pgx.Identifier{field}.Sanitize()
+	}
+	return strings.Join(fields, ", ")
+}
+
+// scan reads rows selected with columns[T].
+func scan[T any](rows pgx.Rows, omit ...string) ([]T, error) {
+	defer rows.Close()
+
+	var out []T
+	for rows.Next() {
+		var row T
+		pointers, err := dbfieldvalues.Pointers(&row, omit...)
+		if err != nil {
+			return nil, err
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		out = append(out, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return out, nil
+}
+
+// selectRows runs "SELECT <columns of T> FROM ..." with the rest of the
+// query.
+func selectRows[T any](ctx context.Context, pool *pgxpool.Pool, omit []string, rest string, args ...any) ([]T, error) {
+	rows, err := pool.Query(ctx, "SELECT "+columns[T](omit...)+" FROM "+rest, args...)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+
+	return scan[T](rows, omit...)
+}
+
+// objects maps rows to objects keyed by their column names.
+func objects[T any](rows []T, omit ...string) ([]map[string]any, error) {
+	out := make([]map[string]any, len(rows))
+	for i, row := range rows {
+		m, err := dbfieldvalues.Map(row, omit...)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = m
+	}
+
+	return out, nil
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lsmoura/health/pkg/dedup"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/importer"
+	"github.com/lsmoura/health/pkg/person"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	day := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	cursor := encodeCursor(day, "count")
+
+	var gotDay time.Time
+	var gotUnit string
+	if err := decodeCursor(cursor, &gotDay, &gotUnit); err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+	if !gotDay.Equal(day) || gotUnit != "count" {
+		t.Errorf("expected %s and count, got %s and %s", day, gotDay, gotUnit)
+	}
+
+	var id int64
+	for _, invalid := range []string{"!", encodeCursor(1, 2), encodeCursor("a")} {
+		if err := decodeCursor(invalid, &id); err == nil {
+			t.Errorf("decodeCursor(%q): expected an error", invalid)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	var q query
+	if q.String() != "" {
+		t.Errorf("expected no WHERE clause, got %q", q.String())
+	}
+
+	q.where("type = %s", "steps")
+	q.where("start_date >= %s", 1)
+	if expected := " WHERE type = $1 AND start_date >= $2"; q.String() != expected {
+		t.Errorf("expected %q, got %q", expected, q.String())
+	}
+	if len(q.args) != 2 {
+		t.Errorf("expected 2 arguments, got %d", len(q.args))
+	}
+
+	s := Server{PersonID: 3}
+	q = s.personQuery()
+	q.where("type = %s", "steps")
+	if expected := " WHERE person_id = $1 AND type = $2"; q.String() != expected || q.args[0] != int64(3) {
+		t.Errorf("expected %q for person 3, got %q with %v", expected, q.String(), q.args)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	tests := []struct {
+		query string
+		limit int
+		ok    bool
+	}{
+		{"", DefaultLimit, true},
+		{"limit=10", 10, true},
+		{"limit=100000", MaxLimit, true},
+		{"limit=0", 0, false},
+		{"limit=ten", 0, false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/records?"+test.query, nil)
+		n, err := limit(r)
+		if n != test.limit || (err == nil) != test.ok {
+			t.Errorf("%s: expected %d (ok %v), got %d (%v)", test.query, test.limit, test.ok, n, err)
+		}
+	}
+}
+
+const export = `<?xml version="1.0" encoding="UTF-8"?>
+<HealthData locale="en_US">
+ <Record type="HKQuantityTypeIdentifierStepCount" sourceName="iPhone" unit="count" value="10" startDate="2022-01-01 10:00:00 -0500" endDate="2022-01-01 10:05:00 -0500"/>
+ <Record type="HKQuantityTypeIdentifierStepCount" sourceName="iPhone" unit="count" value="20" startDate="2022-01-01 11:00:00 -0500" endDate="2022-01-01 11:05:00 -0500"/>
+ <Record type="HKQuantityTypeIdentifierHeartRate" sourceName="Watch" unit="count/min" value="120" startDate="2022-01-01 12:10:00 -0500" endDate="2022-01-01 12:10:00 -0500"/>
+ <Workout workoutActivityType="HKWorkoutActivityTypeRunning" duration="30" durationUnit="min" sourceName="Watch" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500">
+  <WorkoutEvent type="HKWorkoutEventTypePause" date="2022-01-01 12:10:00 -0500"/>
+  <WorkoutStatistics type="HKQuantityTypeIdentifierHeartRate" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500" average="142.5" unit="count/min"/>
+  <WorkoutRoute sourceName="Watch" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500">
+   <FileReference path="/workout-routes/route_1.gpx"/>
+  </WorkoutRoute>
+ </Workout>
+</HealthData>
+`
+
+const gpx = `<gpx><trk><trkseg>
+ <trkpt lon="-122.03" lat="37.33"><time>2022-01-01T17:00:00Z</time></trkpt>
+ <trkpt lon="-122.02" lat="37.33"><time>2022-01-01T17:01:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+
+// testServer imports and deduplicates export into the database of
+// HEALTH_TEST_DSN, which is recreated from the schema, so it must be a
+// throwaway database.
+func testServer(t *testing.T) *Server {
+	dsn := os.Getenv("HEALTH_TEST_DSN")
+	if dsn == "" {
+		t.Skip("HEALTH_TEST_DSN is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("pgxpool.New: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	schema, err := health.Schema()
+	if err != nil {
+		t.Fatalf("health.Schema: %v", err)
+	}
+	if _, err := pool.Exec(ctx, schema); err != nil {
+		t.Fatalf("apply schema: %v", err)
+	}
+	personID, err := person.Ensure(ctx, pool, person.DefaultName)
+	if err != nil {
+		t.Fatalf("person.Ensure: %v", err)
+	}
+	imp := importer.Importer{
+		Pool:      pool,
+		PersonID:  personID,
+		ExportDir: fstest.MapFS{"workout-routes/route_1.gpx": {Data: []byte(gpx)}},
+		Workers:   2,
+		BatchSize: 100,
+	}
+	if err := imp.Import(ctx, strings.NewReader(export)); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	priority, err := dedup.ParsePriority(nil)
+	if err != nil {
+		t.Fatalf("dedup.ParsePriority: %v", err)
+	}
+	deduplicator := dedup.Deduplicator{Pool: pool, PersonID: personID, Priority: priority}
+	if err := deduplicator.Run(ctx); err != nil {
+		t.Fatalf("Deduplicator.Run: %v", err)
+	}
+
+	return &Server{Pool: pool, PersonID: personID}
+}
+
+func get(t *testing.T, handler http.Handler, url string, v any) int {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("%s: json.Unmarshal: %v", url, err)
+	}
+	return w.Code
+}
+
+func TestServer(t *testing.T) {
+	handler := testServer(t).Handler()
+
+	var page struct {
+		Data       []map[string]any `json:"data"`
+		NextCursor string           `json:"next_cursor"`
+	}
+	if code := get(t, handler, "/records?type=HKQuantityTypeIdentifierStepCount&limit=1", &page); code != http.StatusOK {
+		t.Fatalf("/records: expected 200, got %d", code)
+	}
+	if len(page.Data) != 1 || page.Data[0]["value"] != "10" || page.NextCursor == "" {
+		t.Fatalf("unexpected first page %v", page)
+	}
+	cursor := page.NextCursor
+	page.NextCursor = ""
+	get(t, handler, "/records?type=HKQuantityTypeIdentifierStepCount&limit=1&cursor="+cursor, &page)
+	if len(page.Data) != 1 || page.Data[0]["value"] != "20" || page.NextCursor != "" {
+		t.Errorf("unexpected last page %v", page)
+	}
+
+	get(t, handler, "/records?from=2022-01-01T11:30:00-05:00", &page)
+	if len(page.Data) != 1 || page.Data[0]["type"] != "HKQuantityTypeIdentifierHeartRate" {
+		t.Errorf("expected the heart rate record, got %v", page.Data)
+	}
+
+	var workout map[string]any
+	if code := get(t, handler, "/workouts/1", &workout); code != http.StatusOK {
+		t.Fatalf("/workouts/1: expected 200, got %d", code)
+	}
+	if workout["workout_activity_type"] != "HKWorkoutActivityTypeRunning" {
+		t.Errorf("unexpected workout %v", workout)
+	}
+	if statistics, _ := workout["statistics"].([]any); len(statistics) != 1 {
+		t.Errorf("expected 1 statistic, got %v", workout["statistics"])
+	}
+	if events, _ := workout["events"].([]any); len(events) != 1 {
+		t.Errorf("expected 1 event, got %v", workout["events"])
+	}
+	points, _ := workout["route"].([]any)
+	if len(points) != 2 {
+		t.Fatalf("expected 2 route points, got %v", workout["route"])
+	}
+	if point, _ := points[1].(map[string]any); point["seq"] != float64(1) || point["longitude"] != -122.02 {
+		t.Errorf("unexpected route point %v", points[1])
+	}
+
+	var body map[string]any
+	if code := get(t, handler, "/workouts/40", &body); code != http.StatusNotFound {
+		t.Errorf("/workouts/40: expected 404, got %d", code)
+	}
+	if code := get(t, handler, "/records?from=soon", &body); code != http.StatusBadRequest {
+		t.Errorf("invalid from: expected 400, got %d", code)
+	}
+
+	var types Types
+	get(t, handler, "/types", &types)
+	if len(types.Records) != 2 || types.Records[1].Count != 2 || len(types.Workouts) != 1 {
+		t.Errorf("unexpected types %+v", types)
+	}
+}
@@ -0,0 +1,462 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lsmoura/health/pkg/dedup"
+	"github.com/lsmoura/health/pkg/units"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// This file implements the Grafana JSON datasource protocol. Targets are
+// record types, whose values are bucketed by the interval of the panel, and
+// workout activity types, whose durations in minutes are. Annotations are
+// workouts and sleep sessions.
+
+const workoutPrefix = "HKWorkoutActivityType"
+
+// Aggregations a target can ask for in its payload.
+var aggregations = map[string]bool{"sum": true, "avg": true, "min": true, "max": true, "count": true}
+
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type grafanaFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// grafanaTarget is a query of a panel. Payload may set the aggregation of
+// the buckets and the unit to convert values to.
+type grafanaTarget struct {
+	Target  string `json:"target"`
+	RefID   string `json:"refId"`
+	Type    string `json:"type"` // timeserie or table
+	Payload struct {
+		Aggregation string `json:"aggregation"`
+		Unit        string `json:"unit"`
+	} `json:"payload"`
+}
+
+type grafanaQuery struct {
+	Range         grafanaRange    `json:"range"`
+	IntervalMs    int64           `json:"intervalMs"`
+	MaxDataPoints int64           `json:"maxDataPoints"`
+	Targets       []grafanaTarget `json:"targets"`
+	AdhocFilters  []grafanaFilter `json:"adhocFilters"`
+}
+
+type timeSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"` // value, time in ms
+}
+
+type tableColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type table struct {
+	Type    string        `json:"type"`
+	Columns []tableColumn `json:"columns"`
+	Rows    [][2]float64  `json:"rows"`
+}
+
+type annotation struct {
+	Annotation json.RawMessage `json:"annotation,omitempty"`
+	Time       int64           `json:"time"`
+	TimeEnd    int64           `json:"timeEnd"`
+	Title      string          `json:"title"`
+	Text       string          `json:"text"`
+	Tags       []string        `json:"tags"`
+}
+
+type tag struct {
+	Type string `json:"type,omitempty"`
+	Text string `json:"text"`
+}
+
+func decodeBody(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return errorf(http.StatusBadRequest, "invalid body: %v", err)
+	}
+	return nil
+}
+
+func milliseconds(t time.Time) float64 {
+	return float64(t.UnixMilli())
+}
+
+// grafanaHealth answers the connection test of the datasource.
+func (s *Server) grafanaHealth(r *http.Request) (any, error) {
+	if r.URL.Path != "/grafana" && r.URL.Path != "/grafana/" {
+		return nil, errorf(http.StatusNotFound, "not found")
+	}
+	if err := s.Pool.Ping(r.Context()); err != nil {
+		return nil, fmt.Errorf("pool.Ping: %w", err)
+	}
+
+	return map[string]string{"status": "ok"}, nil
+}
+
+// grafanaSearch lists the record and workout types containing the target.
+func (s *Server) grafanaSearch(r *http.Request) (any, error) {
+	var body struct {
+		Target string `json:"target"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.Pool.Query(r.Context(), `
+		SELECT DISTINCT type FROM records_deduplicated WHERE person_id = $1
+		UNION
+		SELECT DISTINCT workout_activity_type FROM workouts_deduplicated WHERE person_id = $1
+		ORDER BY 1`, s.PersonID)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	search := strings.ToLower(body.Target)
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		if strings.Contains(strings.ToLower(name), search) {
+			names = append(names, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return names, nil
+}
+
+// bucket is the aggregate of the values of a unit over an interval.
+type bucket struct {
+	time  time.Time
+	unit  string
+	sum   float64
+	min   float64
+	max   float64
+	count int64
+}
+
+// merge adds b, converted to unit, to the bucket.
+func (a *bucket) merge(b bucket, unit string) error {
+	// the sum is converted through the mean, since units such as degF have an
+	// offset that applies once per value
+	var sum float64
+	if b.count > 0 {
+		mean, err := units.Convert(b.sum/float64(b.count), b.unit, unit)
+		if err != nil {
+			return err
+		}
+		sum = mean * float64(b.count)
+	}
+	min, err := units.Convert(b.min, b.unit, unit)
+	if err != nil {
+		return err
+	}
+	max, err := units.Convert(b.max, b.unit, unit)
+	if err != nil {
+		return err
+	}
+
+	if a.count == 0 || min < a.min {
+		a.min = min
+	}
+	if a.count == 0 || max > a.max {
+		a.max = max
+	}
+	a.sum += sum
+	a.count += b.count
+	return nil
+}
+
+func (a bucket) value(aggregation string) float64 {
+	switch aggregation {
+	case "sum":
+		return a.sum
+	case "min":
+		return a.min
+	case "max":
+		return a.max
+	case "count":
+		return float64(a.count)
+	}
+	return a.sum / float64(a.count)
+}
+
+// interval returns the bucket size of a query.
+func (q grafanaQuery) interval() time.Duration {
+	interval := time.Duration(q.IntervalMs) * time.Millisecond
+	if interval <= 0 && q.MaxDataPoints > 0 {
+		interval = q.Range.To.Sub(q.Range.From) / time.Duration(q.MaxDataPoints)
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// buckets selects the buckets of a target, per unit.
+func (s *Server) buckets(r *http.Request, q grafanaQuery, target string) ([]bucket, error) {
+	var sql string
+	where := query{args: []any{q.interval().Seconds()}} // $1, the bucket size
+	where.where("person_id = %s", s.PersonID)
+
+	if strings.HasPrefix(target, workoutPrefix) {
+		where.where("workout_activity_type = %s", target)
+		sql = `
+			SELECT to_timestamp(floor(extract(epoch FROM start_date) / $1) * $1) AS bucket, 'min',
+				SUM(v), MIN(v), MAX(v), COUNT(*)
+			FROM (SELECT start_date, source_name, extract(epoch FROM end_date - start_date) / 60 AS v
+				FROM workouts_deduplicated %s) w`
+	} else {
+		where.where("type = %s", target)
+		sql = `
+			SELECT to_timestamp(floor(extract(epoch FROM start_date) / $1) * $1) AS bucket, COALESCE(unit, ''),
+				SUM(value), MIN(value), MAX(value), COUNT(*)
+			FROM records_deduplicated %s`
+	}
+	where.where("start_date >= %s", q.Range.From)
+	where.where("start_date < %s", q.Range.To)
+	for _, filter := range q.AdhocFilters {
+		if filter.Key != "source" {
+			return nil, errorf(http.StatusBadRequest, "unknown filter key %q", filter.Key)
+		}
+		switch filter.Operator {
+		case "=":
+			where.where("source_name = %s", filter.Value)
+		case "!=":
+			where.where("source_name <> %s", filter.Value)
+		default:
+			return nil, errorf(http.StatusBadRequest, "unknown filter operator %q", filter.Operator)
+		}
+	}
+
+	rows, err := s.Pool.Query(r.Context(), fmt.Sprintf(sql, where.String())+" GROUP BY 1, 2 ORDER BY 1", where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []bucket
+	for rows.Next() {
+		var b bucket
+		if err := rows.Scan(&b.time, &b.unit, &b.sum, &b.min, &b.max, &b.count); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		buckets = append(buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// series merges the buckets of every unit into the unit of the target, or
+// the first unit found.
+func series(buckets []bucket, unit, aggregation string) ([][2]float64, error) {
+	if unit == "" && len(buckets) > 0 {
+		unit = buckets[0].unit
+	}
+
+	merged := make(map[time.Time]*bucket)
+	var times []time.Time
+	for _, b := range buckets {
+		m, ok := merged[b.time]
+		if !ok {
+			m = &bucket{time: b.time, unit: unit}
+			merged[b.time] = m
+			times = append(times, b.time)
+		}
+		if err := m.merge(b, unit); err != nil {
+			return nil, errorf(http.StatusBadRequest, "%v", err)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	points := make([][2]float64, 0, len(times))
+	for _, t := range times {
+		if v := merged[t].value(aggregation); !math.IsNaN(v) {
+			points = append(points, [2]float64{v, milliseconds(t)})
+		}
+	}
+
+	return points, nil
+}
+
+// grafanaQuery returns the series of every target.
+func (s *Server) grafanaQuery(r *http.Request) (any, error) {
+	var q grafanaQuery
+	if err := decodeBody(r, &q); err != nil {
+		return nil, err
+	}
+
+	results := []any{}
+	for _, target := range q.Targets {
+		if target.Target == "" {
+			continue
+		}
+		aggregation := target.Payload.Aggregation
+		if aggregation == "" {
+			aggregation = "avg"
+			if dedup.Cumulative[target.Target] || strings.HasPrefix(target.Target, workoutPrefix) {
+				aggregation = "sum"
+			}
+		}
+		if !aggregations[aggregation] {
+			return nil, errorf(http.StatusBadRequest, "unknown aggregation %q", aggregation)
+		}
+
+		buckets, err := s.buckets(r, q, target.Target)
+		if err != nil {
+			return nil, err
+		}
+		points, err := series(buckets, target.Payload.Unit, aggregation)
+		if err != nil {
+			return nil, err
+		}
+
+		if target.Type == "table" {
+			// rows follow the columns, while datapoints are [value, time]
+			rows := make([][2]float64, len(points))
+			for i, p := range points {
+				rows[i] = [2]float64{p[1], p[0]}
+			}
+			results = append(results, table{
+				Type:    "table",
+				Columns: []tableColumn{{"Time", "time"}, {target.Target, "number"}},
+				Rows:    rows,
+			})
+			continue
+		}
+		results = append(results, timeSeries{Target: target.Target, Datapoints: points})
+	}
+
+	return results, nil
+}
+
+// grafanaAnnotations returns workouts, or sleep sessions when the query of
+// the annotation is "sleep". A workout query can be restricted to a type:
+// "workouts:HKWorkoutActivityTypeRunning".
+func (s *Server) grafanaAnnotations(r *http.Request) (any, error) {
+	var body struct {
+		Range      grafanaRange    `json:"range"`
+		Annotation json.RawMessage `json:"annotation"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+	var settings struct {
+		Query string `json:"query"`
+	}
+	json.Unmarshal(body.Annotation, &settings)
+
+	var sql string
+	var args []any
+	switch kind, param, _ := strings.Cut(strings.TrimSpace(settings.Query), ":"); kind {
+	case "sleep":
+		sql = `
+			SELECT bed_time, wake_time, 'Sleep', source_name,
+				format('%s asleep, %s%% efficiency', (asleep_seconds * INTERVAL '1 second')::TEXT, round((efficiency * 100)::NUMERIC))
+			FROM sleep_sessions
+			WHERE person_id = $1 AND wake_time >= $2 AND bed_time < $3
+			ORDER BY bed_time`
+		args = []any{s.PersonID, body.Range.From, body.Range.To}
+	case "", "workouts":
+		sql = `
+			SELECT start_date, end_date, workout_activity_type, source_name,
+				format('%s minutes', round((extract(epoch FROM end_date - start_date) / 60)::NUMERIC))
+			FROM workouts_deduplicated
+			WHERE person_id = $1 AND end_date >= $2 AND start_date < $3 AND ($4 = '' OR workout_activity_type = $4)
+			ORDER BY start_date`
+		args = []any{s.PersonID, body.Range.From, body.Range.To, param}
+	default:
+		return nil, errorf(http.StatusBadRequest, "unknown annotation query %q", settings.Query)
+	}
+
+	rows, err := s.Pool.Query(r.Context(), sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	annotations := []annotation{}
+	for rows.Next() {
+		var start, end time.Time
+		var title, source, text string
+		if err := rows.Scan(&start, &end, &title, &source, &text); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		annotations = append(annotations, annotation{
+			Annotation: body.Annotation,
+			Time:       int64(milliseconds(start)),
+			TimeEnd:    int64(milliseconds(end)),
+			Title:      strings.TrimPrefix(title, workoutPrefix),
+			Text:       text,
+			Tags:       []string{title, source},
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return annotations, nil
+}
+
+// grafanaTagKeys lists the keys of the ad hoc filters.
+func (s *Server) grafanaTagKeys(r *http.Request) (any, error) {
+	return []tag{{Type: "string", Text: "source"}}, nil
+}
+
+// grafanaTagValues lists the values of an ad hoc filter key.
+func (s *Server) grafanaTagValues(r *http.Request) (any, error) {
+	var body struct {
+		Key string `json:"key"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+	if body.Key != "source" {
+		return nil, errorf(http.StatusBadRequest, "unknown tag key %q", body.Key)
+	}
+
+	rows, err := s.Pool.Query(r.Context(), `
+		SELECT DISTINCT source_name FROM records_deduplicated WHERE person_id = $1
+		UNION
+		SELECT DISTINCT source_name FROM workouts_deduplicated WHERE person_id = $1
+		ORDER BY 1`, s.PersonID)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	values := []tag{}
+	for rows.Next() {
+		var value tag
+		if err := rows.Scan(&value.Text); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return values, nil
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSeries(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2022, 1, 1, hour, 0, 0, 0, time.UTC) }
+	const lb = 75 / 0.45359237 // 75 kg
+	buckets := []bucket{
+		{time: at(1), unit: "kg", sum: 150, min: 70, max: 80, count: 2},
+		{time: at(0), unit: "kg", sum: 70, min: 70, max: 70, count: 1},
+		{time: at(1), unit: "lb", sum: lb, min: lb, max: lb, count: 1},
+	}
+
+	tests := []struct {
+		unit, aggregation string
+		expected          [][2]float64
+	}{
+		{"", "avg", [][2]float64{{70, milliseconds(at(0))}, {75, milliseconds(at(1))}}},
+		{"", "max", [][2]float64{{70, milliseconds(at(0))}, {80, milliseconds(at(1))}}},
+		{"", "count", [][2]float64{{1, milliseconds(at(0))}, {3, milliseconds(at(1))}}},
+		{"g", "sum", [][2]float64{{70000, milliseconds(at(0))}, {225000, milliseconds(at(1))}}},
+	}
+	for _, test := range tests {
+		points, err := series(buckets, test.unit, test.aggregation)
+		if err != nil {
+			t.Errorf("%s %s: %v", test.unit, test.aggregation, err)
+			continue
+		}
+		for i := range points {
+			points[i][0] = float64(int64(points[i][0]*1e6+0.5)) / 1e6
+		}
+		if !reflect.DeepEqual(points, test.expected) {
+			t.Errorf("%s %s: expected %v, got %v", test.unit, test.aggregation, test.expected, points)
+		}
+	}
+
+	if _, err := series(buckets, "km", "avg"); err == nil {
+		t.Errorf("expected an error converting kg to km")
+	}
+
+	// the offset of degF applies to every value, not to their sum
+	temperatures := []bucket{{time: at(0), unit: "degF", sum: 2 * 98.6, min: 98.6, max: 98.6, count: 2}}
+	for aggregation, expected := range map[string]float64{"avg": 37, "sum": 74, "min": 37} {
+		points, err := series(temperatures, "degC", aggregation)
+		if err != nil {
+			t.Fatalf("degC %s: %v", aggregation, err)
+		}
+		if len(points) != 1 || math.Abs(points[0][0]-expected) > 1e-9 {
+			t.Errorf("degC %s: expected %v, got %v", aggregation, expected, points)
+		}
+	}
+}
+
+func TestInterval(t *testing.T) {
+	from := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		q        grafanaQuery
+		expected time.Duration
+	}{
+		{grafanaQuery{IntervalMs: 3600000}, time.Hour},
+		{grafanaQuery{Range: grafanaRange{from, from.Add(100 * time.Hour)}, MaxDataPoints: 100}, time.Hour},
+		{grafanaQuery{IntervalMs: 10}, time.Second},
+	}
+	for _, test := range tests {
+		if got := test.q.interval(); got != test.expected {
+			t.Errorf("%+v: expected %s, got %s", test.q, test.expected, got)
+		}
+	}
+}
+
+func post(t *testing.T, handler http.Handler, url string, body, v any) int {
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, url, bytes.NewReader(data)))
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("%s: json.Unmarshal: %v", url, err)
+	}
+	return w.Code
+}
+
+func TestGrafana(t *testing.T) {
+	handler := testServer(t).Handler()
+
+	var names []string
+	post(t, handler, "/grafana/search", map[string]string{"target": "step"}, &names)
+	if !reflect.DeepEqual(names, []string{"HKQuantityTypeIdentifierStepCount"}) {
+		t.Errorf("unexpected search results %v", names)
+	}
+
+	query := map[string]any{
+		"range":      map[string]string{"from": "2022-01-01T00:00:00Z", "to": "2022-01-02T00:00:00Z"},
+		"intervalMs": 86400000,
+		"targets":    []map[string]string{{"target": "HKQuantityTypeIdentifierStepCount", "refId": "A"}},
+	}
+	var results []timeSeries
+	if code := post(t, handler, "/grafana/query", query, &results); code != http.StatusOK {
+		t.Fatalf("/grafana/query: expected 200, got %d", code)
+	}
+	if len(results) != 1 || len(results[0].Datapoints) != 1 || results[0].Datapoints[0][0] != 30 {
+		t.Errorf("expected 30 steps, got %v", results)
+	}
+
+	query["targets"] = []map[string]string{{"target": "HKQuantityTypeIdentifierStepCount", "refId": "A", "type": "table"}}
+	var tables []table
+	if code := post(t, handler, "/grafana/query", query, &tables); code != http.StatusOK {
+		t.Fatalf("/grafana/query table: expected 200, got %d", code)
+	}
+	day := milliseconds(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	if len(tables) != 1 || len(tables[0].Rows) != 1 || tables[0].Rows[0] != [2]float64{day, 30} {
+		t.Errorf("expected a row of 30 steps on 2022-01-01, got %v", tables)
+	}
+
+	var annotations []annotation
+	post(t, handler, "/grafana/annotations", map[string]any{"range": query["range"], "annotation": map[string]string{"query": "workouts"}}, &annotations)
+	if len(annotations) != 1 || annotations[0].Title != "Running" {
+		t.Errorf("unexpected annotations %v", annotations)
+	}
+
+	var tags []tag
+	post(t, handler, "/grafana/tag-values", map[string]string{"key": "source"}, &tags)
+	if len(tags) != 2 {
+		t.Errorf("expected 2 sources, got %v", tags)
+	}
+}
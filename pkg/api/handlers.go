@@ -0,0 +1,330 @@
+package api
+
+import (
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/route"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date is a DATE column, marshalled as "2006-01-02".
+type Date time.Time
+
+func (d *Date) Scan(src any) error {
+	t, ok := src.(time.Time)
+	if !ok {
+		return fmt.Errorf("Date: cannot scan %T", src)
+	}
+	*d = Date(t)
+	return nil
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + time.Time(d).Format("2006-01-02") + `"`), nil
+}
+
+// DailyMetric is a row of daily_metrics.
+type DailyMetric struct {
+	Day      Date      `db:"day"`
+	Type     string    `db:"type"`
+	Unit     string    `db:"unit"`
+	Samples  int       `db:"samples"`
+	Sum      *float64  `db:"sum"`
+	Min      *float64  `db:"min"`
+	Avg      *float64  `db:"avg"`
+	Max      *float64  `db:"max"`
+	Last     *float64  `db:"last"`
+	LastDate time.Time `db:"last_date"`
+}
+
+// SleepSession is a row of sleep_sessions.
+type SleepSession struct {
+	ID                 int64     `db:"id"`
+	Night              Date      `db:"night"`
+	SourceName         string    `db:"source_name"`
+	BedTime            time.Time `db:"bed_time"`
+	WakeTime           time.Time `db:"wake_time"`
+	InBedSeconds       int       `db:"in_bed_seconds"`
+	AsleepSeconds      int       `db:"asleep_seconds"`
+	AwakeSeconds       int       `db:"awake_seconds"`
+	CoreSeconds        int       `db:"core_seconds"`
+	DeepSeconds        int       `db:"deep_seconds"`
+	REMSeconds         int       `db:"rem_seconds"`
+	UnspecifiedSeconds int       `db:"unspecified_seconds"`
+	Awakenings         int       `db:"awakenings"`
+	Efficiency         float64   `db:"efficiency"`
+}
+
+// SleepStage is a row of sleep_stages.
+type SleepStage struct {
+	SessionID       int64     `db:"session_id"`
+	RecordID        int64     `db:"record_id"`
+	Stage           string    `db:"stage"`
+	StartDate       time.Time `db:"start_date"`
+	EndDate         time.Time `db:"end_date"`
+	DurationSeconds int       `db:"duration_seconds"`
+}
+
+// idPage selects a page of a table keyed by id, of rows of type T.
+func idPage[T any](s *Server, r *http.Request, table string, q *query, omit []string, id func(T) int64) (*Page, error) {
+	n, err := limit(r)
+	if err != nil {
+		return nil, err
+	}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		var after int64
+		if err := decodeCursor(cursor, &after); err != nil {
+			return nil, err
+		}
+		q.where("id > %s", after)
+	}
+
+	rows, err := selectRows[T](r.Context(), s.Pool, omit, table+q.String()+" ORDER BY id LIMIT "+strconv.Itoa(n+1), q.args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{}
+	if len(rows) > n {
+		rows = rows[:n]
+		page.NextCursor = encodeCursor(id(rows[n-1]))
+	}
+	if page.Data, err = objects(rows, omit...); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// records serves /records?type=&source=&from=&to=.
+func (s *Server) records(r *http.Request) (any, error) {
+	q := s.personQuery()
+	if value := r.URL.Query().Get("type"); value != "" {
+		q.where("type = %s", value)
+	}
+	if value := r.URL.Query().Get("source"); value != "" {
+		q.where("source_name = %s", value)
+	}
+	if err := s.timeRange(r, &q, "start_date"); err != nil {
+		return nil, err
+	}
+
+	return idPage(s, r, "records", &q, nil, func(record health.Record) int64 { return record.ID })
+}
+
+// workoutDetails are the workout columns replaced by their own tables.
+var workoutDetails = []string{"workout_statistics", "workout_events"}
+
+// workouts serves /workouts?type=&source=&from=&to=.
+func (s *Server) workouts(r *http.Request) (any, error) {
+	q := s.personQuery()
+	if value := r.URL.Query().Get("type"); value != "" {
+		q.where("workout_activity_type = %s", value)
+	}
+	if value := r.URL.Query().Get("source"); value != "" {
+		q.where("source_name = %s", value)
+	}
+	if err := s.timeRange(r, &q, "start_date"); err != nil {
+		return nil, err
+	}
+
+	return idPage(s, r, "workouts", &q, workoutDetails, func(workout health.Workout) int64 { return workout.ID })
+}
+
+// workout serves /workouts/{id}, with its statistics, events and route.
+func (s *Server) workout(r *http.Request) (any, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/workouts/"), 10, 64)
+	if err != nil {
+		return nil, errorf(http.StatusNotFound, "not found")
+	}
+
+	omit := []string{"workout_statistics", "workout_events", "workout_routes"}
+	workouts, err := selectRows[health.Workout](r.Context(), s.Pool, nil, "workouts WHERE id = $1 AND person_id = $2", id, s.PersonID)
+	if err != nil {
+		return nil, err
+	}
+	if len(workouts) == 0 {
+		return nil, errorf(http.StatusNotFound, "workout %d not found", id)
+	}
+	workout, err := objects(workouts, omit...)
+	if err != nil {
+		return nil, err
+	}
+
+	statistics, err := selectRows[health.WorkoutStatisticsRow](r.Context(), s.Pool, nil,
+		"workout_statistics WHERE workout_id = $1 ORDER BY type", id)
+	if err != nil {
+		return nil, err
+	}
+	events, err := selectRows[health.WorkoutEventRow](r.Context(), s.Pool, nil,
+		"workout_events WHERE workout_id = $1 ORDER BY date", id)
+	if err != nil {
+		return nil, err
+	}
+	points, err := selectRows[route.Point](r.Context(), s.Pool, nil,
+		"workout_route_points WHERE workout_id = $1 ORDER BY seq", id)
+	if err != nil {
+		return nil, err
+	}
+
+	out := workout[0]
+	if out["statistics"], err = objects(statistics); err != nil {
+		return nil, err
+	}
+	if out["events"], err = objects(events); err != nil {
+		return nil, err
+	}
+	if out["route"], err = objects(points, "workout_id"); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// daily serves /daily/{type}?unit=&from=&to=.
+func (s *Server) daily(r *http.Request) (any, error) {
+	kind := strings.TrimPrefix(r.URL.Path, "/daily/")
+	if kind == "" {
+		return nil, errorf(http.StatusNotFound, "not found")
+	}
+	n, err := limit(r)
+	if err != nil {
+		return nil, err
+	}
+
+	q := s.personQuery()
+	q.where("type = %s", kind)
+	if value := r.URL.Query().Get("unit"); value != "" {
+		q.where("unit = %s", value)
+	}
+	if err := s.timeRange(r, &q, "day"); err != nil {
+		return nil, err
+	}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		var day time.Time
+		var unit string
+		if err := decodeCursor(cursor, &day, &unit); err != nil {
+			return nil, err
+		}
+		q.args = append(q.args, day, unit)
+		q.conditions = append(q.conditions, fmt.Sprintf("(day, unit) > ($%d, $%d)", len(q.args)-1, len(q.args)))
+	}
+
+	rows, err := selectRows[DailyMetric](r.Context(), s.Pool, nil,
+		"daily_metrics"+q.String()+" ORDER BY day, unit LIMIT "+strconv.Itoa(n+1), q.args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{}
+	if len(rows) > n {
+		rows = rows[:n]
+		last := rows[n-1]
+		page.NextCursor = encodeCursor(time.Time(last.Day), last.Unit)
+	}
+	if page.Data, err = objects(rows); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// sleep serves /sleep?from=&to=, with the stages of every session.
+func (s *Server) sleep(r *http.Request) (any, error) {
+	q := s.personQuery()
+	if err := s.timeRange(r, &q, "night"); err != nil {
+		return nil, err
+	}
+
+	page, err := idPage(s, r, "sleep_sessions", &q, nil, func(session SleepSession) int64 { return session.ID })
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Data) == 0 {
+		return page, nil
+	}
+
+	ids := make([]int64, len(page.Data))
+	for i, session := range page.Data {
+		ids[i] = session["id"].(int64)
+	}
+	stages, err := selectRows[SleepStage](r.Context(), s.Pool, nil,
+		"sleep_stages WHERE session_id = ANY($1) ORDER BY start_date", ids)
+	if err != nil {
+		return nil, err
+	}
+
+	bySession := make(map[int64][]SleepStage)
+	for _, stage := range stages {
+		bySession[stage.SessionID] = append(bySession[stage.SessionID], stage)
+	}
+	for _, session := range page.Data {
+		if session["stages"], err = objects(bySession[session["id"].(int64)], "session_id"); err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+// TypeCount describes the rows of a record or workout type.
+type TypeCount struct {
+	Type      string    `json:"type"`
+	Units     []string  `json:"units,omitempty"`
+	Count     int64     `json:"count"`
+	FirstDate time.Time `json:"first_date"`
+	LastDate  time.Time `json:"last_date"`
+}
+
+// Types lists the record and workout types in the database.
+type Types struct {
+	Records  []TypeCount `json:"records"`
+	Workouts []TypeCount `json:"workouts"`
+}
+
+func collectTypes(rows pgx.Rows, err error) ([]TypeCount, error) {
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []TypeCount{}
+	for rows.Next() {
+		var c TypeCount
+		if err := rows.Scan(&c.Type, &c.Units, &c.Count, &c.FirstDate, &c.LastDate); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return counts, nil
+}
+
+// types serves /types.
+func (s *Server) types(r *http.Request) (any, error) {
+	var types Types
+	var err error
+
+	types.Records, err = collectTypes(s.Pool.Query(r.Context(), `
+		SELECT type, array_remove(array_agg(DISTINCT unit), NULL), COUNT(*), MIN(start_date), MAX(start_date)
+		FROM records WHERE person_id = $1 GROUP BY type ORDER BY type`, s.PersonID))
+	if err != nil {
+		return nil, fmt.Errorf("records: %w", err)
+	}
+	types.Workouts, err = collectTypes(s.Pool.Query(r.Context(), `
+		SELECT workout_activity_type, ARRAY[]::TEXT[], COUNT(*), MIN(start_date), MAX(start_date)
+		FROM workouts WHERE person_id = $1 AND start_date IS NOT NULL
+		GROUP BY workout_activity_type ORDER BY workout_activity_type`, s.PersonID))
+	if err != nil {
+		return nil, fmt.Errorf("workouts: %w", err)
+	}
+
+	return types, nil
+}
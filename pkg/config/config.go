@@ -0,0 +1,170 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Database holds the connection settings of a config file.
+type Database struct {
+	DSN      string     `yaml:"dsn" toml:"dsn"`
+	Host     string     `yaml:"host" toml:"host"`
+	Port     PortNumber `yaml:"port" toml:"port"`
+	User     string     `yaml:"user" toml:"user"`
+	Password string     `yaml:"password" toml:"password"`
+	Name     string     `yaml:"name" toml:"name"`
+	SSLMode  string     `yaml:"sslmode" toml:"sslmode"`
+	Service  string     `yaml:"service" toml:"service"`
+}
+
+// PortNumber is a port, written as a number or a string.
+type PortNumber string
+
+func (p *PortNumber) UnmarshalTOML(value any) error {
+	switch v := value.(type) {
+	case int64:
+		*p = PortNumber(strconv.FormatInt(v, 10))
+	case string:
+		*p = PortNumber(v)
+	default:
+		return fmt.Errorf("invalid port %v", value)
+	}
+	return nil
+}
+
+func (p *PortNumber) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("invalid port at line %d", node.Line)
+	}
+	*p = PortNumber(node.Value)
+	return nil
+}
+
+// File is the content of a config file:
+//
+//	database:
+//	  host: db.example.com
+//	  user: health
+//	  name: health
+//	  sslmode: require
+//	priority:
+//	  default: ["*Watch*", "*iPhone*"]
+//	  HKQuantityTypeIdentifierStepCount: ["Jane's Apple Watch", "*"]
+//	time_zone: Europe/Paris
+//	sleep:
+//	  day_boundary: 12h
+//	training:
+//	  max_hr: 185
+//	  karvonen: true
+//
+// Files ending in .toml are read as TOML instead, with the same keys:
+//
+//	time_zone = "Europe/Paris"
+//
+//	[database]
+//	host = "db.example.com"
+//	user = "health"
+//
+//	[priority]
+//	default = ["*Watch*", "*iPhone*"]
+type File struct {
+	Path     string   `yaml:"-" toml:"-"`
+	Database Database `yaml:"database" toml:"database"`
+
+	// Priority lists the sources of each type, from the preferred one, for
+	// deduplication.
+	Priority map[string][]string `yaml:"priority" toml:"priority"`
+
+	// TimeZone is used for the records without HKTimeZone, instead of the
+	// local one.
+	TimeZone string `yaml:"time_zone" toml:"time_zone"`
+
+	Sleep    Sleep    `yaml:"sleep" toml:"sleep"`
+	Training Training `yaml:"training" toml:"training"`
+}
+
+// Sleep configures how sleep records are grouped into nights.
+type Sleep struct {
+	DayBoundary string `yaml:"day_boundary" toml:"day_boundary"` // a duration after midnight, such as 12h
+}
+
+// Training configures heart rate zones. Zero heart rates are estimated.
+type Training struct {
+	MaxHR     float64 `yaml:"max_hr" toml:"max_hr"`
+	RestingHR float64 `yaml:"resting_hr" toml:"resting_hr"`
+	Karvonen  bool    `yaml:"karvonen" toml:"karvonen"`
+}
+
+// DefaultPath returns $XDG_CONFIG_HOME/health/config.yaml, which usually is
+// ~/.config/health/config.yaml, or config.toml when only that one exists.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	path := filepath.Join(dir, "health", "config.yaml")
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		if _, err := os.Stat(filepath.Join(dir, "health", "config.toml")); err == nil {
+			return filepath.Join(dir, "health", "config.toml")
+		}
+	}
+
+	return path
+}
+
+// Load reads a config file, as TOML when its name ends in .toml and as YAML
+// otherwise. A missing file is only an error when the path was given
+// explicitly.
+func Load(path string, explicit bool) (*File, error) {
+	file := &File{Path: path}
+	if path == "" {
+		return file, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		file.Path = ""
+		return file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		if err := toml.Unmarshal(data, file); err != nil {
+			return nil, fmt.Errorf("toml.Unmarshal %s: %w", path, err)
+		}
+		return file, nil
+	}
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("yaml.Unmarshal %s: %w", path, err)
+	}
+
+	return file, nil
+}
+
+// Source returns the connection settings of the file.
+func (f *File) Source() Source {
+	db := f.Database
+	return Source{
+		Name: "config file " + f.Path,
+		DSN:  db.DSN,
+		Values: map[string]string{
+			Host:     db.Host,
+			Port:     string(db.Port),
+			User:     db.User,
+			Password: db.Password,
+			DBName:   db.Name,
+			SSLMode:  db.SSLMode,
+			Service:  db.Service,
+		},
+	}
+}
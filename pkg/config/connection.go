@@ -0,0 +1,333 @@
+package config
+
+import (
+	"fmt"
+	"github.com/jackc/pgpassfile"
+	"github.com/jackc/pgservicefile"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// libpq keywords of the settings we resolve.
+const (
+	Host     = "host"
+	Port     = "port"
+	User     = "user"
+	Password = "password"
+	DBName   = "dbname"
+	SSLMode  = "sslmode"
+	Service  = "service"
+)
+
+var keywords = []string{Host, Port, User, Password, DBName, SSLMode, Service}
+
+// Defaults are used for the settings that no source, including the libpq
+// environment variables and service file, provides.
+var Defaults = map[string]string{
+	Host:    "localhost",
+	Port:    "5432",
+	User:    "postgres",
+	DBName:  "health",
+	SSLMode: "disable",
+}
+
+// libpqEnv maps each keyword to the environment variable libpq reads it
+// from.
+var libpqEnv = map[string]string{
+	Host:     "PGHOST",
+	Port:     "PGPORT",
+	User:     "PGUSER",
+	Password: "PGPASSWORD",
+	DBName:   "PGDATABASE",
+	SSLMode:  "PGSSLMODE",
+	Service:  "PGSERVICE",
+}
+
+// Source is a layer of connection settings, such as the command line or a
+// config file. DSN is a full connection string, either a URL or libpq
+// keyword/value pairs; Values override the parts of it they set.
+type Source struct {
+	Name   string
+	DSN    string
+	Values map[string]string
+}
+
+// Setting is a resolved connection setting and where it came from.
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+
+	// inConnString is false for settings libpq picks up by itself, from
+	// its environment variables, service file or password file.
+	inConnString bool
+}
+
+// Connection is the result of resolving every source.
+type Connection struct {
+	Settings []Setting
+}
+
+// Resolver resolves connection settings. Getenv and HomeDir are fields so
+// tests do not depend on the environment.
+type Resolver struct {
+	Getenv  func(string) string
+	HomeDir string
+}
+
+// parseDSN splits a URL or keyword/value connection string into keywords.
+func parseDSN(dsn string) (map[string]string, error) {
+	values := make(map[string]string)
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("url.Parse: %w", err)
+		}
+		if u.User != nil {
+			values[User] = u.User.Username()
+			if password, ok := u.User.Password(); ok {
+				values[Password] = password
+			}
+		}
+		if strings.Contains(u.Host, ",") {
+			// multiple hosts are passed as is
+			values[Host] = u.Host
+		} else if u.Host != "" {
+			values[Host] = u.Hostname()
+			values[Port] = u.Port()
+		}
+		values[DBName] = strings.TrimPrefix(u.Path, "/")
+		for key, v := range u.Query() {
+			values[key] = v[0]
+		}
+	} else {
+		var err error
+		values, err = parseKeywordValues(dsn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for key, value := range values {
+		if value == "" {
+			delete(values, key)
+		}
+	}
+
+	return values, nil
+}
+
+// parseKeywordValues parses "host=localhost password='it\'s'" strings.
+func parseKeywordValues(dsn string) (map[string]string, error) {
+	values := make(map[string]string)
+	s := strings.TrimSpace(dsn)
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid dsn: missing '=' after %q", s)
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " ")
+
+		var value strings.Builder
+		if strings.HasPrefix(s, "'") {
+			i := 1
+			for ; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+					value.WriteByte(s[i])
+					continue
+				}
+				if s[i] == '\'' {
+					break
+				}
+				value.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("invalid dsn: unterminated quoted value for %s", key)
+			}
+			s = s[i+1:]
+		} else {
+			end := strings.IndexByte(s, ' ')
+			if end < 0 {
+				end = len(s)
+			}
+			value.WriteString(s[:end])
+			s = s[end:]
+		}
+
+		values[key] = value.String()
+		s = strings.TrimSpace(s)
+	}
+
+	return values, nil
+}
+
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+func (r Resolver) serviceSettings(service string) (map[string]string, string) {
+	path := r.Getenv("PGSERVICEFILE")
+	if path == "" && r.HomeDir != "" {
+		path = filepath.Join(r.HomeDir, ".pg_service.conf")
+	}
+
+	file, err := pgservicefile.ReadServicefile(path)
+	if err != nil {
+		return nil, path
+	}
+	s, err := file.GetService(service)
+	if err != nil {
+		return nil, path
+	}
+
+	return s.Settings, path
+}
+
+// Resolve merges the sources, from the lowest to the highest priority.
+// Settings that none of them provide are left to libpq when it can find
+// them in its environment variables or service file, and take the value in
+// Defaults otherwise.
+func (r Resolver) Resolve(sources ...Source) (*Connection, error) {
+	resolved := make(map[string]Setting)
+	set := func(key, value, source string) {
+		if value != "" {
+			resolved[key] = Setting{Key: key, Value: value, Source: source, inConnString: true}
+		}
+	}
+
+	for _, source := range sources {
+		if source.DSN != "" {
+			values, err := parseDSN(source.DSN)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", source.Name, err)
+			}
+			for key, value := range values {
+				set(key, value, source.Name+" (dsn)")
+			}
+		}
+		for key, value := range source.Values {
+			set(key, value, source.Name)
+		}
+	}
+
+	service := resolved[Service].Value
+	if service == "" {
+		service = r.Getenv("PGSERVICE")
+	}
+	var serviceValues map[string]string
+	var servicePath string
+	if service != "" {
+		serviceValues, servicePath = r.serviceSettings(service)
+		if serviceValues == nil {
+			return nil, fmt.Errorf("service %q not found in %s", service, servicePath)
+		}
+	}
+
+	for _, key := range keywords {
+		if _, ok := resolved[key]; ok {
+			continue
+		}
+
+		serviceKey := key
+		if key == DBName {
+			serviceKey = "dbname"
+		}
+		switch {
+		case serviceValues[serviceKey] != "":
+			resolved[key] = Setting{Key: key, Value: serviceValues[serviceKey], Source: fmt.Sprintf("service %s in %s", service, servicePath)}
+		case r.Getenv(libpqEnv[key]) != "":
+			resolved[key] = Setting{Key: key, Value: r.Getenv(libpqEnv[key]), Source: libpqEnv[key] + " environment variable"}
+		case Defaults[key] != "":
+			resolved[key] = Setting{Key: key, Value: Defaults[key], Source: "default", inConnString: true}
+		}
+	}
+
+	if _, ok := resolved[Password]; !ok {
+		if password, path := r.pgpass(resolved); password != "" {
+			resolved[Password] = Setting{Key: Password, Value: password, Source: path}
+		}
+	}
+
+	connection := &Connection{}
+	for _, key := range keywords {
+		if setting, ok := resolved[key]; ok {
+			connection.Settings = append(connection.Settings, setting)
+			delete(resolved, key)
+		}
+	}
+	// extra parameters from a dsn, such as connect_timeout
+	for _, key := range sortedKeys(resolved) {
+		connection.Settings = append(connection.Settings, resolved[key])
+	}
+
+	return connection, nil
+}
+
+func (r Resolver) pgpass(resolved map[string]Setting) (string, string) {
+	path := r.Getenv("PGPASSFILE")
+	if path == "" && r.HomeDir != "" {
+		path = filepath.Join(r.HomeDir, ".pgpass")
+	}
+
+	file, err := pgpassfile.ReadPassfile(path)
+	if err != nil {
+		return "", ""
+	}
+
+	password := file.FindPassword(resolved[Host].Value, resolved[Port].Value, resolved[DBName].Value, resolved[User].Value)
+	return password, path
+}
+
+func sortedKeys(m map[string]Setting) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Get returns the resolved value of a setting.
+func (c *Connection) Get(key string) string {
+	for _, setting := range c.Settings {
+		if setting.Key == key {
+			return setting.Value
+		}
+	}
+
+	return ""
+}
+
+// ConnString returns the settings as libpq keyword/value pairs. Settings
+// that libpq reads by itself are left out so it applies them the same way
+// it always does.
+func (c *Connection) ConnString() string {
+	var parts []string
+	for _, setting := range c.Settings {
+		if setting.inConnString {
+			parts = append(parts, setting.Key+"="+quote(setting.Value))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Redacted returns the settings with the password hidden.
+func (c *Connection) Redacted() []Setting {
+	settings := make([]Setting, len(c.Settings))
+	copy(settings, c.Settings)
+	for i := range settings {
+		if settings[i].Key == Password {
+			settings[i].Value = "********"
+		}
+	}
+
+	return settings
+}
@@ -150,3 +150,89 @@ func Values(in any, omitFields ...string) ([]any, error) {
 
 	return values, nil
 }
+
+// Pointers returns pointers to the fields of the struct in points to, in
+// the order of Fields, so a row selected with those columns can be scanned
+// into it.
+func Pointers(in any, omitFields ...string) ([]any, error) {
+	v := reflect.ValueOf(in)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dbfieldvalues: expected pointer to struct, got %T", in)
+	}
+	v = v.Elem()
+
+	omitMap := make(map[string]any)
+	for _, omitField := range omitFields {
+		omitMap[omitField] = nil
+	}
+
+	t := v.Type()
+	var pointers []any
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldName := field.Name
+
+		if field.Anonymous {
+			inner, err := Pointers(v.Field(i).Addr().Interface(), omitFields...)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %v: %w", field.Name, err)
+			}
+			pointers = append(pointers, inner...)
+			continue
+		}
+
+		if name, options, ok := fieldToTags(field); ok {
+			if name == "-" {
+				continue
+			}
+
+			if strings.Contains(options, "inline") {
+				inner, err := Pointers(v.Field(i).Addr().Interface(), omitFields...)
+				if err != nil {
+					return nil, fmt.Errorf("parsing %v: %w", field.Name, err)
+				}
+				pointers = append(pointers, inner...)
+				continue
+			}
+
+			if name != "" {
+				fieldName = name
+			}
+		}
+
+		if _, ok := omitMap[fieldName]; ok {
+			continue
+		}
+		pointers = append(pointers, v.Field(i).Addr().Interface())
+	}
+
+	return pointers, nil
+}
+
+// Map returns the fields of a struct keyed by their column name. Unlike
+// Values, json fields are left as is, to be marshalled with the map.
+func Map(in any, omitFields ...string) (map[string]any, error) {
+	v := reflect.ValueOf(in)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dbfieldvalues: expected struct, got %T", in)
+	}
+	if !v.CanAddr() {
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		v = copied
+	}
+
+	out := make(map[string]any)
+	pointers, err := Pointers(v.Addr().Interface(), omitFields...)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range Fields(v.Interface(), omitFields...) {
+		out[name] = reflect.ValueOf(pointers[i]).Elem().Interface()
+	}
+
+	return out, nil
+}
@@ -162,3 +162,44 @@ func TestValues(t *testing.T) {
 		}
 	}
 }
+
+func TestPointers(t *testing.T) {
+	type FooStruct struct {
+		Foo string `db:"foo"`
+	}
+	var row struct {
+		FooStruct
+		A   *int      `db:"a"`
+		B   string    `db:"-"`
+		Bar FooStruct `db:"bar,json"`
+	}
+
+	pointers, err := Pointers(&row)
+	if err != nil {
+		t.Fatalf("Pointers: %v", err)
+	}
+	if len(pointers) != 3 {
+		t.Fatalf("expected 3 pointers, got %d", len(pointers))
+	}
+
+	*pointers[0].(*string) = "fooValue"
+	a := 1
+	*pointers[1].(**int) = &a
+	*pointers[2].(*FooStruct) = FooStruct{Foo: "barValue"}
+	if row.Foo != "fooValue" || row.A != &a || row.Bar.Foo != "barValue" {
+		t.Errorf("unexpected row %#v", row)
+	}
+
+	if _, err := Pointers(row); err == nil {
+		t.Errorf("expected an error for a struct that is not a pointer")
+	}
+
+	m, err := Map(row)
+	if err != nil {
+		t.Fatalf("Map: %v", err)
+	}
+	expected := map[string]any{"foo": "fooValue", "a": &a, "bar": FooStruct{Foo: "barValue"}}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map: expected %#v, got %#v", expected, m)
+	}
+}
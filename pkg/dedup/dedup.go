@@ -0,0 +1,218 @@
+package dedup
+
+import (
+	"fmt"
+	"github.com/lsmoura/health/pkg/filter"
+	"sort"
+	"time"
+)
+
+// DefaultPriority is used for the types without a priority list: the watch
+// first, then the phone, then every other source.
+var DefaultPriority = []string{"*Watch*", "*iPhone*"}
+
+// Cumulative lists the types whose values add up, like steps. Their samples
+// are prorated by the time no higher priority source covers; samples of
+// other types are kept or dropped whole.
+var Cumulative = map[string]bool{
+	"HKQuantityTypeIdentifierStepCount":                  true,
+	"HKQuantityTypeIdentifierDistanceWalkingRunning":     true,
+	"HKQuantityTypeIdentifierDistanceCycling":            true,
+	"HKQuantityTypeIdentifierDistanceSwimming":           true,
+	"HKQuantityTypeIdentifierDistanceWheelchair":         true,
+	"HKQuantityTypeIdentifierDistanceDownhillSnowSports": true,
+	"HKQuantityTypeIdentifierActiveEnergyBurned":         true,
+	"HKQuantityTypeIdentifierBasalEnergyBurned":          true,
+	"HKQuantityTypeIdentifierFlightsClimbed":             true,
+	"HKQuantityTypeIdentifierAppleExerciseTime":          true,
+	"HKQuantityTypeIdentifierAppleStandTime":             true,
+	"HKQuantityTypeIdentifierPushCount":                  true,
+	"HKQuantityTypeIdentifierSwimmingStrokeCount":        true,
+	"HKQuantityTypeIdentifierNikeFuel":                   true,
+	"HKQuantityTypeIdentifierDietaryEnergyConsumed":      true,
+	"HKQuantityTypeIdentifierDietaryWater":               true,
+	"HKQuantityTypeIdentifierTimeInDaylight":             true,
+}
+
+// Priority orders the sources of each type. A source ranks at the first
+// pattern it matches; sources matching none rank after every pattern.
+type Priority struct {
+	Default filter.Patterns
+	Types   map[string]filter.Patterns
+}
+
+// ParsePriority parses priority lists keyed by type, where the "default" key
+// applies to every type without its own list.
+func ParsePriority(lists map[string][]string) (Priority, error) {
+	priority := Priority{Types: make(map[string]filter.Patterns)}
+	parse := func(patterns []string) (filter.Patterns, error) {
+		var out filter.Patterns
+		for _, s := range patterns {
+			if err := out.Set(s); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+
+	var err error
+	if priority.Default, err = parse(DefaultPriority); err != nil {
+		return priority, err
+	}
+	for key, patterns := range lists {
+		parsed, err := parse(patterns)
+		if err != nil {
+			return priority, fmt.Errorf("priority %s: %w", key, err)
+		}
+		if key == "default" {
+			priority.Default = parsed
+		} else {
+			priority.Types[key] = parsed
+		}
+	}
+
+	return priority, nil
+}
+
+// Rank returns the rank of a source for a type, 0 being the preferred one.
+func (p Priority) Rank(sampleType, source string) int {
+	patterns, ok := p.Types[sampleType]
+	if !ok {
+		patterns = p.Default
+	}
+	for i, pattern := range patterns {
+		if pattern.Match(source) {
+			return i
+		}
+	}
+
+	return len(patterns)
+}
+
+// Sample is a record or a workout with its source.
+type Sample struct {
+	ID     int64
+	Source string
+	Start  time.Time
+	End    time.Time
+	Value  float64
+}
+
+// Result is a sample that is kept, with the part of it that is counted.
+type Result struct {
+	ID       int64
+	Value    float64
+	Fraction float64
+}
+
+type interval struct {
+	start, end time.Time
+}
+
+// coverage is a sorted list of disjoint intervals.
+type coverage []interval
+
+// covered returns how long [start, end) is covered, and whether start is
+// covered at all, for samples without a duration.
+func (c coverage) covered(start, end time.Time) (time.Duration, bool) {
+	i := sort.Search(len(c), func(i int) bool { return c[i].end.After(start) })
+	at := i < len(c) && !c[i].start.After(start)
+
+	var total time.Duration
+	for ; i < len(c) && c[i].start.Before(end); i++ {
+		from, to := c[i].start, c[i].end
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		total += to.Sub(from)
+	}
+
+	return total, at
+}
+
+// merge adds the intervals of samples to the coverage.
+func (c coverage) merge(samples []Sample) coverage {
+	all := append(coverage(nil), c...)
+	for _, s := range samples {
+		if s.End.After(s.Start) {
+			all = append(all, interval{s.Start, s.End})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].start.Before(all[j].start) })
+
+	var merged coverage
+	for _, in := range all {
+		if n := len(merged); n > 0 && !in.start.After(merged[n-1].end) {
+			if in.end.After(merged[n-1].end) {
+				merged[n-1].end = in.end
+			}
+			continue
+		}
+		merged = append(merged, in)
+	}
+
+	return merged
+}
+
+// Deduplicate resolves the overlapping samples of a type the way HealthKit
+// statistics do: the time covered by a source hides the samples of the
+// sources ranked after it. Sources of a same rank, such as two phones or
+// apps matching no pattern, are ordered by name, so every source has its
+// own position and only the samples of a source never hide each other.
+// Cumulative samples that are partly hidden keep the value of the part
+// that is not; other samples are dropped as soon as they overlap.
+func Deduplicate(samples []Sample, rank func(source string) int, cumulative bool) []Result {
+	type position struct {
+		rank   int
+		source string
+	}
+	bySource := make(map[position][]Sample)
+	var positions []position
+	for _, s := range samples {
+		p := position{rank(s.Source), s.Source}
+		if _, ok := bySource[p]; !ok {
+			positions = append(positions, p)
+		}
+		bySource[p] = append(bySource[p], s)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].rank != positions[j].rank {
+			return positions[i].rank < positions[j].rank
+		}
+		return positions[i].source < positions[j].source
+	})
+
+	var results []Result
+	var covered coverage
+	for _, p := range positions {
+		for _, s := range bySource[p] {
+			duration := s.End.Sub(s.Start)
+			hidden, startHidden := covered.covered(s.Start, s.End)
+
+			fraction := 1.0
+			switch {
+			case duration <= 0:
+				if startHidden {
+					fraction = 0
+				}
+			case !cumulative:
+				if hidden > 0 {
+					fraction = 0
+				}
+			default:
+				fraction = float64(duration-hidden) / float64(duration)
+			}
+
+			if fraction > 0 {
+				results = append(results, Result{ID: s.ID, Value: s.Value * fraction, Fraction: fraction})
+			}
+		}
+		covered = covered.merge(bySource[p])
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+	return results
+}
@@ -0,0 +1,107 @@
+package dedup
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func at(minutes int) time.Time {
+	return time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC).Add(time.Duration(minutes) * time.Minute)
+}
+
+func TestDeduplicate(t *testing.T) {
+	priority, err := ParsePriority(map[string][]string{
+		"HKQuantityTypeIdentifierStepCount": {"Watch", "iPhone"},
+	})
+	if err != nil {
+		t.Fatalf("ParsePriority: %v", err)
+	}
+	rank := func(source string) int { return priority.Rank("HKQuantityTypeIdentifierStepCount", source) }
+
+	samples := []Sample{
+		{ID: 1, Source: "iPhone", Start: at(0), End: at(10), Value: 100}, // half hidden by 3
+		{ID: 2, Source: "iPhone", Start: at(20), End: at(30), Value: 50}, // fully hidden by 4
+		{ID: 3, Source: "Watch", Start: at(5), End: at(15), Value: 80},
+		{ID: 4, Source: "Watch", Start: at(18), End: at(32), Value: 70},
+		{ID: 5, Source: "Watch", Start: at(10), End: at(12), Value: 10}, // same rank as 3
+		{ID: 6, Source: "Scale", Start: at(40), End: at(40), Value: 1},  // no overlap
+		{ID: 7, Source: "Scale", Start: at(25), End: at(25), Value: 1},  // hidden by 4
+	}
+
+	expected := []Result{
+		{ID: 1, Value: 50, Fraction: 0.5},
+		{ID: 3, Value: 80, Fraction: 1},
+		{ID: 4, Value: 70, Fraction: 1},
+		{ID: 5, Value: 10, Fraction: 1},
+		{ID: 6, Value: 1, Fraction: 1},
+	}
+	if got := Deduplicate(samples, rank, true); !reflect.DeepEqual(got, expected) {
+		t.Errorf("cumulative: expected %v, got %v", expected, got)
+	}
+
+	// samples that cannot be prorated are dropped when they overlap
+	expected = []Result{
+		{ID: 3, Value: 80, Fraction: 1},
+		{ID: 4, Value: 70, Fraction: 1},
+		{ID: 5, Value: 10, Fraction: 1},
+		{ID: 6, Value: 1, Fraction: 1},
+	}
+	if got := Deduplicate(samples, rank, false); !reflect.DeepEqual(got, expected) {
+		t.Errorf("discrete: expected %v, got %v", expected, got)
+	}
+}
+
+func TestDeduplicateUnmatchedSources(t *testing.T) {
+	priority, err := ParsePriority(nil)
+	if err != nil {
+		t.Fatalf("ParsePriority: %v", err)
+	}
+	rank := func(source string) int { return priority.Rank("HKQuantityTypeIdentifierStepCount", source) }
+
+	// neither source matches a pattern: the first by name hides the other
+	samples := []Sample{
+		{ID: 1, Source: "Pedometer++", Start: at(0), End: at(10), Value: 100},
+		{ID: 2, Source: "Fitbit", Start: at(5), End: at(15), Value: 80},
+		{ID: 3, Source: "Pedometer++", Start: at(20), End: at(30), Value: 40},
+	}
+	expected := []Result{
+		{ID: 1, Value: 50, Fraction: 0.5},
+		{ID: 2, Value: 80, Fraction: 1},
+		{ID: 3, Value: 40, Fraction: 1},
+	}
+	if got := Deduplicate(samples, rank, true); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestRank(t *testing.T) {
+	priority, err := ParsePriority(map[string][]string{
+		"default":                           {"Oura"},
+		"HKQuantityTypeIdentifierStepCount": {"*Watch*", "/^Jane.s iPhone$/"},
+	})
+	if err != nil {
+		t.Fatalf("ParsePriority: %v", err)
+	}
+
+	tests := []struct {
+		sampleType string
+		source     string
+		rank       int
+	}{
+		{"HKQuantityTypeIdentifierStepCount", "Jane's Apple Watch", 0},
+		{"HKQuantityTypeIdentifierStepCount", "Jane's iPhone", 1},
+		{"HKQuantityTypeIdentifierStepCount", "Oura", 2},
+		{"HKQuantityTypeIdentifierHeartRate", "Oura", 0},
+		{"HKQuantityTypeIdentifierHeartRate", "Jane's Apple Watch", 1},
+	}
+	for _, test := range tests {
+		if got := priority.Rank(test.sampleType, test.source); got != test.rank {
+			t.Errorf("Rank(%s, %s): expected %d, got %d", test.sampleType, test.source, test.rank, got)
+		}
+	}
+
+	if _, err := ParsePriority(map[string][]string{"default": {"/(/"}}); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
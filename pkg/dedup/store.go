@@ -0,0 +1,168 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"strconv"
+)
+
+// WorkoutType is the key of the priority list used for workouts.
+const WorkoutType = "HKWorkoutTypeIdentifier"
+
+// Deduplicator rebuilds the records_deduplicated and workouts_deduplicated
+// tables from the records and workouts of a person.
+type Deduplicator struct {
+	Pool     *pgxpool.Pool
+	PersonID int64
+	Priority Priority
+}
+
+// row is a record with the columns copied to records_deduplicated.
+type row struct {
+	Sample
+	kind string
+	unit *string
+}
+
+func (d *Deduplicator) copy(ctx context.Context, table string, columns []string, rows [][]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	_, err := d.Pool.CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromRows(rows))
+	if err != nil {
+		return fmt.Errorf("CopyFrom %s: %w", table, err)
+	}
+
+	return nil
+}
+
+// flush deduplicates the samples of a type and copies the ones kept.
+func (d *Deduplicator) flush(ctx context.Context, kind string, rows []row) (int64, error) {
+	samples := make([]Sample, len(rows))
+	byID := make(map[int64]row, len(rows))
+	for i, r := range rows {
+		samples[i] = r.Sample
+		byID[r.ID] = r
+	}
+
+	rank := func(source string) int { return d.Priority.Rank(kind, source) }
+	results := Deduplicate(samples, rank, Cumulative[kind])
+
+	out := make([][]any, len(results))
+	for i, result := range results {
+		r := byID[result.ID]
+		out[i] = []any{r.ID, d.PersonID, r.kind, r.Source, r.unit, r.Start, r.End, result.Value, result.Fraction}
+	}
+	columns := []string{"record_id", "person_id", "type", "source_name", "unit", "start_date", "end_date", "value", "fraction"}
+
+	return int64(len(out)), d.copy(ctx, "records_deduplicated", columns, out)
+}
+
+func (d *Deduplicator) records(ctx context.Context) (int64, error) {
+	rows, err := d.Pool.Query(ctx, `
+		SELECT id, type, source_name, unit, value, start_date, end_date
+		FROM records
+		WHERE person_id = $1 AND type LIKE 'HKQuantityTypeIdentifier%' AND value IS NOT NULL
+		ORDER BY type, start_date`, d.PersonID)
+	if err != nil {
+		return 0, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var total int64
+	var current string
+	var batch []row
+	for rows.Next() {
+		var r row
+		var value string
+		if err := rows.Scan(&r.ID, &r.kind, &r.Source, &r.unit, &value, &r.Start, &r.End); err != nil {
+			return total, fmt.Errorf("rows.Scan: %w", err)
+		}
+		if r.Value, err = strconv.ParseFloat(value, 64); err != nil {
+			continue
+		}
+
+		if r.kind != current && len(batch) > 0 {
+			n, err := d.flush(ctx, current, batch)
+			if err != nil {
+				return total, err
+			}
+			total += n
+			batch = batch[:0]
+		}
+		current = r.kind
+		batch = append(batch, r)
+	}
+	if err := rows.Err(); err != nil {
+		return total, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	n, err := d.flush(ctx, current, batch)
+	return total + n, err
+}
+
+func (d *Deduplicator) workouts(ctx context.Context) (int64, error) {
+	rows, err := d.Pool.Query(ctx, `
+		SELECT id, workout_activity_type, source_name, start_date, end_date
+		FROM workouts
+		WHERE person_id = $1 AND start_date IS NOT NULL AND end_date IS NOT NULL`, d.PersonID)
+	if err != nil {
+		return 0, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	kinds := make(map[int64]string)
+	var samples []Sample
+	for rows.Next() {
+		var s Sample
+		var kind string
+		if err := rows.Scan(&s.ID, &kind, &s.Source, &s.Start, &s.End); err != nil {
+			return 0, fmt.Errorf("rows.Scan: %w", err)
+		}
+		kinds[s.ID] = kind
+		samples = append(samples, s)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	sources := make(map[int64]Sample, len(samples))
+	for _, s := range samples {
+		sources[s.ID] = s
+	}
+
+	rank := func(source string) int { return d.Priority.Rank(WorkoutType, source) }
+	results := Deduplicate(samples, rank, false)
+	out := make([][]any, len(results))
+	for i, result := range results {
+		s := sources[result.ID]
+		out[i] = []any{s.ID, d.PersonID, kinds[s.ID], s.Source, s.Start, s.End}
+	}
+	columns := []string{"workout_id", "person_id", "workout_activity_type", "source_name", "start_date", "end_date"}
+
+	return int64(len(out)), d.copy(ctx, "workouts_deduplicated", columns, out)
+}
+
+// Run replaces the rows of the person in the deduplicated tables.
+func (d *Deduplicator) Run(ctx context.Context) error {
+	for _, table := range []string{"records_deduplicated", "workouts_deduplicated"} {
+		if _, err := d.Pool.Exec(ctx, "DELETE FROM "+table+" WHERE person_id = $1", d.PersonID); err != nil {
+			return fmt.Errorf("DELETE FROM %s: %w", table, err)
+		}
+	}
+
+	records, err := d.records(ctx)
+	if err != nil {
+		return fmt.Errorf("records: %w", err)
+	}
+	workouts, err := d.workouts(ctx)
+	if err != nil {
+		return fmt.Errorf("workouts: %w", err)
+	}
+
+	fmt.Printf("Kept %d records and %d workouts after deduplication\n", records, workouts)
+	return nil
+}
@@ -0,0 +1,248 @@
+package dtd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Attribute is an attribute declared by an ATTLIST.
+type Attribute struct {
+	Name     string
+	Values   []string // allowed values of an enumerated attribute
+	Required bool
+}
+
+// Element is an element declared by an ELEMENT, with the attributes of its
+// ATTLIST.
+type Element struct {
+	Name       string
+	Empty      bool
+	Any        bool
+	Children   map[string]bool
+	Attributes map[string]Attribute
+
+	required []string // in declaration order
+}
+
+// DTD is the internal subset of a DOCTYPE. Only element names and
+// attributes are checked: the order and the number of children in a content
+// model are not.
+type DTD struct {
+	Root     string
+	Elements map[string]*Element
+}
+
+// Issue is a difference between an element and its declaration.
+type Issue struct {
+	Element string `json:"element"`
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	return i.Element + ": " + i.Message
+}
+
+var (
+	declPattern    = regexp.MustCompile(`(?s)<!(ELEMENT|ATTLIST)\s+(\S+)\s*(.*?)>`)
+	commentPattern = regexp.MustCompile(`(?s)<!--.*?-->`)
+	namePattern    = regexp.MustCompile(`[A-Za-z_][\w.:-]*`)
+)
+
+// Parse parses a DOCTYPE directive, as returned by xml.Decoder, such as
+// `DOCTYPE HealthData [<!ELEMENT ...>]`.
+func Parse(doctype string) (*DTD, error) {
+	doctype = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(doctype), "DOCTYPE"))
+	root, subset, ok := strings.Cut(doctype, "[")
+	if !ok {
+		return nil, errors.New("dtd: no internal subset")
+	}
+
+	d := &DTD{Root: strings.TrimSpace(root), Elements: make(map[string]*Element)}
+	element := func(name string) *Element {
+		if d.Elements[name] == nil {
+			d.Elements[name] = &Element{Name: name, Children: make(map[string]bool), Attributes: make(map[string]Attribute)}
+		}
+		return d.Elements[name]
+	}
+
+	subset = commentPattern.ReplaceAllString(subset, " ")
+	for _, match := range declPattern.FindAllStringSubmatch(subset, -1) {
+		e := element(match[2])
+		switch match[1] {
+		case "ELEMENT":
+			content := strings.TrimSpace(match[3])
+			switch content {
+			case "EMPTY":
+				e.Empty = true
+			case "ANY":
+				e.Any = true
+			default:
+				for _, name := range namePattern.FindAllString(content, -1) {
+					e.Children[name] = true
+				}
+			}
+		case "ATTLIST":
+			attributes, err := parseAttributes(match[3])
+			if err != nil {
+				return nil, fmt.Errorf("dtd: ATTLIST %s: %w", match[2], err)
+			}
+			for _, attribute := range attributes {
+				e.Attributes[attribute.Name] = attribute
+				if attribute.Required {
+					e.required = append(e.required, attribute.Name)
+				}
+			}
+		}
+	}
+	if d.Root == "" || d.Elements[d.Root] == nil {
+		return nil, fmt.Errorf("dtd: root element %q is not declared", d.Root)
+	}
+
+	return d, nil
+}
+
+// fields splits an ATTLIST into words, keeping enumerations and quoted
+// default values together.
+func fields(s string) ([]string, error) {
+	var out []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		end := strings.IndexAny(s, " \t\r\n")
+		switch s[0] {
+		case '(':
+			end = strings.IndexByte(s, ')') + 1
+		case '"', '\'':
+			end = strings.IndexByte(s[1:], s[0]) + 2
+		}
+		if end <= 0 {
+			if s[0] == '(' || s[0] == '"' || s[0] == '\'' {
+				return nil, fmt.Errorf("unterminated %q", s)
+			}
+			end = len(s)
+		}
+		out = append(out, s[:end])
+		s = s[end:]
+	}
+
+	return out, nil
+}
+
+func parseAttributes(s string) ([]Attribute, error) {
+	words, err := fields(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var attributes []Attribute
+	for i := 0; i < len(words); {
+		if i+2 >= len(words) {
+			return nil, fmt.Errorf("incomplete declaration %v", words[i:])
+		}
+		attribute := Attribute{Name: words[i]}
+		if kind := words[i+1]; strings.HasPrefix(kind, "(") {
+			for _, value := range strings.Split(strings.Trim(kind, "()"), "|") {
+				attribute.Values = append(attribute.Values, strings.TrimSpace(value))
+			}
+		}
+		i += 2
+
+		switch words[i] {
+		case "#REQUIRED":
+			attribute.Required = true
+		case "#FIXED":
+			i++ // the fixed value follows
+		}
+		i++
+		attributes = append(attributes, attribute)
+	}
+
+	return attributes, nil
+}
+
+func (e *Element) allows(child string) bool {
+	return e.Any || e.Children[child]
+}
+
+// Validate checks a child of the root element, given as its raw bytes.
+func (d *DTD) Validate(data []byte) ([]Issue, error) {
+	var issues []Issue
+	stack := []*Element{d.Elements[d.Root]}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return issues, nil
+		}
+		if err != nil {
+			return issues, fmt.Errorf("decoder.Token: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			parent := stack[len(stack)-1]
+			if parent != nil && !parent.allows(name) {
+				parentName := parent.Name
+				if parent.Empty {
+					issues = append(issues, Issue{parentName, "EMPTY element has a child " + name})
+				} else {
+					issues = append(issues, Issue{parentName, "unexpected child " + name})
+				}
+			}
+
+			e := d.Elements[name]
+			stack = append(stack, e)
+			if e == nil {
+				issues = append(issues, Issue{name, "element is not declared"})
+				continue
+			}
+			issues = append(issues, e.check(t.Attr)...)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+func (e *Element) check(attrs []xml.Attr) []Issue {
+	var issues []Issue
+	seen := make(map[string]bool, len(attrs))
+	for _, attr := range attrs {
+		name := attr.Name.Local
+		if attr.Name.Space != "" {
+			name = attr.Name.Space + ":" + name
+		}
+		seen[name] = true
+
+		declared, ok := e.Attributes[name]
+		if !ok {
+			issues = append(issues, Issue{e.Name, "undeclared attribute " + name})
+			continue
+		}
+		if len(declared.Values) > 0 && !contains(declared.Values, attr.Value) {
+			issues = append(issues, Issue{e.Name, fmt.Sprintf("attribute %s is not one of %s", name, strings.Join(declared.Values, "|"))})
+		}
+	}
+
+	for _, name := range e.required {
+		if !seen[name] {
+			issues = append(issues, Issue{e.Name, "missing required attribute " + name})
+		}
+	}
+
+	return issues
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
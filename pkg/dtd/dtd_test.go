@@ -0,0 +1,111 @@
+package dtd
+
+import (
+	"reflect"
+	"testing"
+)
+
+const doctype = `DOCTYPE HealthData [
+<!-- HealthKit Export Version: 11 -->
+<!ELEMENT HealthData (ExportDate,Me,(Record|Workout)*)>
+<!ATTLIST HealthData
+  locale CDATA #REQUIRED
+>
+<!ELEMENT Record ((MetadataEntry|HeartRateVariabilityMetadataList)*)>
+<!ATTLIST Record
+  type       CDATA #REQUIRED
+  unit       CDATA #IMPLIED
+  sourceName CDATA #REQUIRED
+  startDate  CDATA #REQUIRED
+>
+<!ELEMENT MetadataEntry EMPTY>
+<!ATTLIST MetadataEntry
+  key   CDATA #REQUIRED
+  value CDATA #REQUIRED
+>
+<!ELEMENT Workout (WorkoutEvent*)>
+<!ATTLIST Workout
+  workoutActivityType CDATA #REQUIRED
+  indoor (yes|no) "no"
+  version CDATA #FIXED "1"
+>
+]`
+
+func TestParse(t *testing.T) {
+	d, err := Parse(doctype)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if d.Root != "HealthData" {
+		t.Errorf("expected root HealthData, got %q", d.Root)
+	}
+	if !d.Elements["MetadataEntry"].Empty {
+		t.Errorf("expected MetadataEntry to be EMPTY")
+	}
+	if children := d.Elements["Record"].Children; !children["MetadataEntry"] || !children["HeartRateVariabilityMetadataList"] {
+		t.Errorf("unexpected Record children %v", children)
+	}
+
+	expected := map[string]Attribute{
+		"workoutActivityType": {Name: "workoutActivityType", Required: true},
+		"indoor":              {Name: "indoor", Values: []string{"yes", "no"}},
+		"version":             {Name: "version"},
+	}
+	if got := d.Elements["Workout"].Attributes; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected Workout attributes %v, got %v", expected, got)
+	}
+
+	if _, err := Parse("DOCTYPE HealthData"); err == nil {
+		t.Errorf("expected an error without an internal subset")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	d, err := Parse(doctype)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	tests := []struct {
+		data     string
+		expected []Issue
+	}{
+		{
+			data: `<Record type="t" sourceName="s" startDate="d"><MetadataEntry key="k" value="v"/></Record>`,
+		},
+		{
+			data: `<Record type="t" device="d"><MetadataEntry key="k"><Extra/></MetadataEntry></Record>`,
+			expected: []Issue{
+				{"Record", "undeclared attribute device"},
+				{"Record", "missing required attribute sourceName"},
+				{"Record", "missing required attribute startDate"},
+				{"MetadataEntry", "missing required attribute value"},
+				{"MetadataEntry", "EMPTY element has a child Extra"},
+				{"Extra", "element is not declared"},
+			},
+		},
+		{
+			data: `<Workout workoutActivityType="running" indoor="maybe"><Record type="t" sourceName="s" startDate="d"/></Workout>`,
+			expected: []Issue{
+				{"Workout", "attribute indoor is not one of yes|no"},
+				{"Workout", "unexpected child Record"},
+			},
+		},
+		{
+			data:     `<MetadataEntry key="k" value="v"/>`,
+			expected: []Issue{{"HealthData", "unexpected child MetadataEntry"}},
+		},
+	}
+
+	for _, test := range tests {
+		issues, err := d.Validate([]byte(test.data))
+		if err != nil {
+			t.Errorf("Validate(%s): %v", test.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(issues, test.expected) {
+			t.Errorf("Validate(%s): expected %v, got %v", test.data, test.expected, issues)
+		}
+	}
+}
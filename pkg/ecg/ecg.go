@@ -0,0 +1,163 @@
+package ecg
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecordType is the type of the Record that accompanies every ECG file.
+const RecordType = "HKDataTypeIdentifierElectrocardiogram"
+
+// Recording is the header block of an ecg_*.csv file.
+type Recording struct {
+	ID              int64      `db:"id"`
+	FileName        string     `db:"file_name"`
+	Name            string     `db:"name"`
+	DateOfBirth     string     `db:"date_of_birth"`
+	RecordedDate    *time.Time `db:"recorded_date"`
+	Classification  string     `db:"classification"`
+	Symptoms        string     `db:"symptoms"`
+	SoftwareVersion string     `db:"software_version"`
+	Device          string     `db:"device"`
+	SampleRate      float64    `db:"sample_rate"` // hertz
+	Lead            string     `db:"lead"`
+	Unit            string     `db:"unit"`
+
+	Samples []float32 `db:"-"`
+}
+
+// Samples holds the voltage series of a recording.
+type Samples struct {
+	RecordingID int64     `db:"recording_id"`
+	Samples     []float32 `db:"samples"`
+}
+
+const recordedDateLayout = "2006-01-02 15:04:05 -0700"
+
+func (r *Recording) setHeader(key, value string) error {
+	switch key {
+	case "Name":
+		r.Name = value
+	case "Date of Birth":
+		r.DateOfBirth = value
+	case "Recorded Date":
+		t, err := time.Parse(recordedDateLayout, value)
+		if err != nil {
+			return fmt.Errorf("time.Parse: %w", err)
+		}
+		r.RecordedDate = &t
+	case "Classification":
+		r.Classification = value
+	case "Symptoms":
+		r.Symptoms = value
+	case "Software Version":
+		r.SoftwareVersion = value
+	case "Device":
+		r.Device = value
+	case "Sample Rate":
+		// e.g. "512 hertz"
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			return fmt.Errorf("empty sample rate")
+		}
+		rate, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return fmt.Errorf("strconv.ParseFloat: %w", err)
+		}
+		r.SampleRate = rate
+	case "Lead":
+		r.Lead = value
+	case "Unit":
+		r.Unit = value
+	}
+
+	return nil
+}
+
+// Parse reads an ECG file as exported by the Health app: a block of
+// "key,value" header lines, followed by one voltage sample per line.
+func Parse(in io.Reader) (*Recording, error) {
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+
+	var recording Recording
+	for {
+		line, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv.Read: %w", err)
+		}
+		if len(line) == 0 || strings.TrimSpace(line[0]) == "" {
+			continue
+		}
+
+		key := strings.TrimSpace(line[0])
+		if sample, err := strconv.ParseFloat(key, 32); err == nil {
+			recording.Samples = append(recording.Samples, float32(sample))
+			continue
+		}
+		if len(recording.Samples) > 0 {
+			return nil, fmt.Errorf("unexpected line after samples: %q", strings.Join(line, ","))
+		}
+
+		var value string
+		if len(line) > 1 {
+			value = strings.TrimSpace(line[1])
+		}
+		if err := recording.setHeader(key, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	if recording.RecordedDate == nil {
+		return nil, fmt.Errorf("ecg: missing recorded date")
+	}
+
+	return &recording, nil
+}
+
+// Load parses every electrocardiograms/ecg_*.csv file of an export
+// directory. Files that cannot be parsed are skipped, and returned in
+// skipped with their error.
+func Load(fsys fs.FS) (recordings []Recording, skipped []error, err error) {
+	files, err := fs.Glob(fsys, "electrocardiograms/ecg_*.csv")
+	if err != nil {
+		return nil, nil, fmt.Errorf("fs.Glob: %w", err)
+	}
+
+	for _, file := range files {
+		recording, err := loadFile(fsys, file)
+		if err != nil {
+			skipped = append(skipped, fmt.Errorf("%s: %w", file, err))
+			continue
+		}
+		recordings = append(recordings, *recording)
+	}
+
+	return recordings, skipped, nil
+}
+
+func loadFile(fsys fs.FS, file string) (*Recording, error) {
+	f, err := fsys.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	recording, err := Parse(f)
+	if err != nil {
+		return nil, err
+	}
+	recording.FileName = path.Base(file)
+
+	return recording, nil
+}
@@ -0,0 +1,92 @@
+package ecg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+const sample = `Name,Jane Appleseed
+Date of Birth,"Jan 2, 1980"
+Recorded Date,2021-03-01 10:20:30 -0500
+Classification,Sinus Rhythm
+Symptoms,
+Software Version,1.90
+Device,"Watch6,1"
+Sample Rate,512 hertz
+Lead,Lead I
+Unit,µV
+
+-12.5
+0
+13.25
+`
+
+func TestParse(t *testing.T) {
+	recording, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	expectedDate := time.Date(2021, 3, 1, 15, 20, 30, 0, time.UTC)
+	if recording.RecordedDate == nil || !recording.RecordedDate.Equal(expectedDate) {
+		t.Errorf("expected recorded date %v, got %v", expectedDate, recording.RecordedDate)
+	}
+
+	tests := []struct {
+		field    string
+		got      any
+		expected any
+	}{
+		{"Name", recording.Name, "Jane Appleseed"},
+		{"DateOfBirth", recording.DateOfBirth, "Jan 2, 1980"},
+		{"Classification", recording.Classification, "Sinus Rhythm"},
+		{"Symptoms", recording.Symptoms, ""},
+		{"SoftwareVersion", recording.SoftwareVersion, "1.90"},
+		{"Device", recording.Device, "Watch6,1"},
+		{"SampleRate", recording.SampleRate, 512.0},
+		{"Lead", recording.Lead, "Lead I"},
+		{"Unit", recording.Unit, "µV"},
+		{"Samples", recording.Samples, []float32{-12.5, 0, 13.25}},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.expected) {
+			t.Errorf("%s: expected %#v, got %#v", test.field, test.expected, test.got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"Name,Jane\n1\n2\n",                                       // no recorded date
+		"Recorded Date,yesterday\n",                               // bad date
+		"Recorded Date,2021-03-01 10:20:30 -0500\n1\nName,Jane\n", // header after samples
+	}
+
+	for _, test := range tests {
+		if _, err := Parse(strings.NewReader(test)); err == nil {
+			t.Errorf("Parse(%q): expected error", test)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"electrocardiograms/ecg_2021-03-01.csv": {Data: []byte(sample)},
+		"electrocardiograms/ecg_2021-03-02.csv": {Data: []byte("Name,Jane\n0.5\n")},
+		"electrocardiograms/notes.txt":          {Data: []byte("ignored")},
+	}
+
+	recordings, skipped, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(recordings) != 1 || recordings[0].FileName != "ecg_2021-03-01.csv" {
+		t.Errorf("unexpected recordings %#v", recordings)
+	}
+	if len(skipped) != 1 || !strings.HasPrefix(skipped[0].Error(), "electrocardiograms/ecg_2021-03-02.csv: ") {
+		t.Errorf("expected the file without recorded date to be skipped, got %v", skipped)
+	}
+}
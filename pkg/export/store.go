@@ -0,0 +1,236 @@
+package export
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lsmoura/health/pkg/dbfieldvalues"
+	"github.com/lsmoura/health/pkg/filter"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/sleep"
+	"strings"
+	"time"
+)
+
+// Store reads the imported elements of a person back from their tables, so
+// they can be written as an export.xml or converted to other formats.
+type Store struct {
+	Pool     *pgxpool.Pool
+	PersonID int64
+}
+
+// columns lists the columns of the rows of type T, for a SELECT.
+func columns[T any]() string {
+	var row T
+	fields := dbfieldvalues.Fields(row)
+	for i, field := range fields {
+		fields[i] = pgx.Identifier{field}.Sanitize()
+	}
+	return strings.Join(fields, ", ")
+}
+
+// each calls fn with every row of "SELECT <columns of T> FROM <rest>".
+func each[T any](ctx context.Context, pool *pgxpool.Pool, fn func(*T) error, rest string, args ...any) error {
+	rows, err := pool.Query(ctx, "SELECT "+columns[T]()+" FROM "+rest, args...)
+	if err != nil {
+		return fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row := new(T)
+		pointers, err := dbfieldvalues.Pointers(row)
+		if err != nil {
+			return err
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return fmt.Errorf("rows.Scan: %w", err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return nil
+}
+
+// errStop ends each after the first row.
+var errStop = errors.New("stop")
+
+// Me returns the characteristics of the user, which are empty when the me
+// table is.
+func (s *Store) Me(ctx context.Context) (health.Me, error) {
+	var me health.Me
+	err := each(ctx, s.Pool, func(row *health.Me) error {
+		me = *row
+		return errStop
+	}, "me WHERE person_id = $1", s.PersonID)
+	if err != nil && !errors.Is(err, errStop) {
+		return health.Me{}, err
+	}
+
+	return me, nil
+}
+
+func attr(name, value string) xml.Attr {
+	return xml.Attr{Name: xml.Name{Local: name}, Value: value}
+}
+
+func optionalAttr(attrs []xml.Attr, name string, value *string) []xml.Attr {
+	if value == nil || *value == "" {
+		return attrs
+	}
+	return append(attrs, attr(name, *value))
+}
+
+func timeAttr(attrs []xml.Attr, name string, value *health.HealthTime) []xml.Attr {
+	if value == nil {
+		return attrs
+	}
+	a, _ := value.MarshalXMLAttr(xml.Name{Local: name})
+	return append(attrs, a)
+}
+
+// Attrs returns the name of an element and the attributes filter.Filter
+// selects elements by, so elements read from the database are filtered like
+// the elements of an export.
+func Attrs(element any) (string, []xml.Attr) {
+	switch e := element.(type) {
+	case *health.Record:
+		attrs := []xml.Attr{attr("type", e.Type), attr("sourceName", e.SourceName)}
+		attrs = optionalAttr(attrs, "device", e.Device)
+		return "Record", timeAttr(attrs, "startDate", e.StartDate)
+	case *health.Correlation:
+		attrs := []xml.Attr{attr("type", e.Type), attr("sourceName", e.SourceName)}
+		attrs = optionalAttr(attrs, "device", &e.Device)
+		return "Correlation", timeAttr(attrs, "startDate", e.StartDate)
+	case *health.Workout:
+		attrs := []xml.Attr{attr("workoutActivityType", e.WorkoutActivityType), attr("sourceName", e.SourceName)}
+		attrs = optionalAttr(attrs, "device", &e.Device)
+		return "Workout", timeAttr(attrs, "startDate", e.StartDate)
+	case *health.ActivitySummary:
+		return "ActivitySummary", optionalAttr(nil, "dateComponents", e.DateComponents)
+	case *health.ClinicalRecord:
+		return "ClinicalRecord", optionalAttr(nil, "sourceName", e.SourceName)
+	case *health.Audiogram:
+		attrs := []xml.Attr{attr("type", e.Type), attr("sourceName", e.SourceName)}
+		attrs = optionalAttr(attrs, "device", e.Device)
+		return "Audiogram", timeAttr(attrs, "startDate", e.StartDate)
+	case *health.VisionPrescription:
+		return "VisionPrescription", []xml.Attr{attr("type", e.Type)}
+	}
+
+	return "", nil
+}
+
+// window selects rows of a person of the given types, all of them when
+// types is empty, starting at or after since and before until, when they are
+// set.
+const window = `
+	WHERE person_id = $1
+	  AND (cardinality($2::TEXT[]) = 0 OR type = ANY($2))
+	  AND ($3::TIMESTAMPTZ IS NULL OR start_date >= $3)
+	  AND ($4::TIMESTAMPTZ IS NULL OR start_date < $4)
+	ORDER BY start_date`
+
+// Records calls fn with the records of types, by start date.
+func (s *Store) Records(ctx context.Context, types []string, since, until *time.Time, fn func(*health.Record) error) error {
+	if types == nil {
+		types = []string{}
+	}
+	return each(ctx, s.Pool, fn, "records"+window, s.PersonID, types, since, until)
+}
+
+// Correlations calls fn with the correlations of types, by start date.
+func (s *Store) Correlations(ctx context.Context, types []string, since, until *time.Time, fn func(*health.Correlation) error) error {
+	if types == nil {
+		types = []string{}
+	}
+	return each(ctx, s.Pool, fn, "correlations"+window, s.PersonID, types, since, until)
+}
+
+// Workouts calls fn with the workouts starting at or after since and before
+// until, when they are set, by start date.
+func (s *Store) Workouts(ctx context.Context, since, until *time.Time, fn func(*health.Workout) error) error {
+	return each(ctx, s.Pool, fn, `workouts
+		WHERE person_id = $1
+		  AND ($2::TIMESTAMPTZ IS NULL OR start_date >= $2)
+		  AND ($3::TIMESTAMPTZ IS NULL OR start_date < $3)
+		ORDER BY start_date, id`, s.PersonID, since, until)
+}
+
+// SleepSessions calls fn with the sessions of the sleep_sessions table, as
+// built by "health sleep", going to bed at or after since and before until.
+// Their fragments and stages are not read.
+func (s *Store) SleepSessions(ctx context.Context, since, until *time.Time, fn func(*sleep.Session) error) error {
+	rows, err := s.Pool.Query(ctx, `
+		SELECT night, source_name, bed_time, wake_time, asleep_seconds, awakenings, efficiency
+		FROM sleep_sessions
+		WHERE person_id = $1
+		  AND ($2::TIMESTAMPTZ IS NULL OR bed_time >= $2)
+		  AND ($3::TIMESTAMPTZ IS NULL OR bed_time < $3)
+		ORDER BY bed_time, id`, s.PersonID, since, until)
+	if err != nil {
+		return fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var session sleep.Session
+		var asleep int64
+		if err := rows.Scan(&session.Night, &session.Source, &session.BedTime, &session.WakeTime, &asleep, &session.Awakenings, &session.Efficiency); err != nil {
+			return fmt.Errorf("rows.Scan: %w", err)
+		}
+		session.Asleep = time.Duration(asleep) * time.Second
+		if err := fn(&session); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return nil
+}
+
+// Elements calls fn with the elements kept by f, a nil filter keeping them
+// all, as pointers to the types of the health package. Elements come table
+// by table, in the order of an export.
+func (s *Store) Elements(ctx context.Context, f *filter.Filter, fn func(element any) error) error {
+	keep := func(element any) error {
+		if !f.IsZero() && !f.Keep(Attrs(element)) {
+			return nil
+		}
+		return fn(element)
+	}
+
+	if err := each(ctx, s.Pool, func(r *health.Record) error { return keep(r) }, "records WHERE person_id = $1 ORDER BY id", s.PersonID); err != nil {
+		return fmt.Errorf("records: %w", err)
+	}
+	if err := each(ctx, s.Pool, func(c *health.Correlation) error { return keep(c) }, "correlations WHERE person_id = $1 ORDER BY start_date, type", s.PersonID); err != nil {
+		return fmt.Errorf("correlations: %w", err)
+	}
+	if err := each(ctx, s.Pool, func(w *health.Workout) error { return keep(w) }, "workouts WHERE person_id = $1 ORDER BY id", s.PersonID); err != nil {
+		return fmt.Errorf("workouts: %w", err)
+	}
+	if err := each(ctx, s.Pool, func(a *health.ActivitySummary) error { return keep(a) }, "activity_summaries WHERE person_id = $1 ORDER BY date_components", s.PersonID); err != nil {
+		return fmt.Errorf("activity_summaries: %w", err)
+	}
+	if err := each(ctx, s.Pool, func(c *health.ClinicalRecord) error { return keep(c) }, "clinical_records WHERE person_id = $1 ORDER BY received_date, identifier", s.PersonID); err != nil {
+		return fmt.Errorf("clinical_records: %w", err)
+	}
+	if err := each(ctx, s.Pool, func(a *health.Audiogram) error { return keep(a) }, "audiograms WHERE person_id = $1 ORDER BY start_date", s.PersonID); err != nil {
+		return fmt.Errorf("audiograms: %w", err)
+	}
+	if err := each(ctx, s.Pool, func(v *health.VisionPrescription) error { return keep(v) }, "vision_prescriptions WHERE person_id = $1 ORDER BY date_issued", s.PersonID); err != nil {
+		return fmt.Errorf("vision_prescriptions: %w", err)
+	}
+
+	return nil
+}
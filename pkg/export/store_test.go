@@ -0,0 +1,54 @@
+package export
+
+import (
+	"github.com/lsmoura/health/pkg/filter"
+	"github.com/lsmoura/health/pkg/health"
+	"testing"
+	"time"
+)
+
+func TestAttrs(t *testing.T) {
+	start := health.HealthTime(time.Date(2022, 1, 1, 8, 0, 0, 0, time.FixedZone("", -3*3600)))
+	device := "<<HKDevice: 0x283a9c0a0>, name:Apple Watch>"
+	record := &health.Record{Type: "HKQuantityTypeIdentifierHeartRate", SourceName: "Watch", Device: &device, StartDate: &start}
+	workout := &health.Workout{WorkoutActivityType: "HKWorkoutActivityTypeRunning", SourceName: "Phone", StartDate: &start}
+	day := "2022-01-02"
+	summary := &health.ActivitySummary{DateComponents: &day}
+
+	since := time.Date(2022, 1, 1, 11, 0, 0, 0, time.UTC)
+	until := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC) // before the day, whatever the local time zone
+	tests := []struct {
+		name     string
+		filter   filter.Filter
+		element  any
+		expected bool
+	}{
+		{"record type", filter.Filter{RecordTypes: filter.List{Include: patterns("*HeartRate")}}, record, true},
+		{"excluded record type", filter.Filter{RecordTypes: filter.List{Exclude: patterns("*HeartRate")}}, record, false},
+		{"record types do not apply to workouts", filter.Filter{RecordTypes: filter.List{Include: patterns("*Steps")}}, workout, true},
+		{"workout type", filter.Filter{WorkoutTypes: filter.List{Include: patterns("*Cycling")}}, workout, false},
+		{"device name", filter.Filter{Devices: filter.List{Include: patterns("name:Apple Watch")}}, record, true},
+		{"workout without a device", filter.Filter{Devices: filter.List{Include: patterns("name:Apple Watch")}}, workout, true},
+		{"source", filter.Filter{Sources: filter.List{Exclude: patterns("Phone")}}, workout, false},
+		{"start date, with its offset", filter.Filter{Since: &since}, record, true},
+		{"before the window", filter.Filter{Since: &since, Until: &since}, record, false},
+		{"day of a summary", filter.Filter{Until: &until}, summary, false},
+	}
+
+	for _, test := range tests {
+		name, attrs := Attrs(test.element)
+		if got := test.filter.Keep(name, attrs); got != test.expected {
+			t.Errorf("%s: expected %v, got %v (%s %v)", test.name, test.expected, got, name, attrs)
+		}
+	}
+}
+
+func patterns(values ...string) filter.Patterns {
+	var out filter.Patterns
+	for _, value := range values {
+		if err := out.Set(value); err != nil {
+			panic(err)
+		}
+	}
+	return out
+}
@@ -0,0 +1,172 @@
+package fhir
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Writer writes the resources of the export.
+type Writer interface {
+	Write(r Resource) error
+	Close() error
+}
+
+type BundleRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type BundleEntry struct {
+	Resource Resource      `json:"resource"`
+	Request  BundleRequest `json:"request"`
+}
+
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Entry        []BundleEntry `json:"entry"`
+}
+
+func newEncoder(w io.Writer) *json.Encoder {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder
+}
+
+// BundleWriter writes transaction bundles of at most Size entries, one per
+// line. Entries PUT their resource at its id, so a bundle sent twice does
+// not duplicate its resources.
+type BundleWriter struct {
+	Size    int
+	Bundles int // bundles written
+
+	encoder *json.Encoder
+	entries []BundleEntry
+}
+
+func NewBundleWriter(w io.Writer, size int) *BundleWriter {
+	return &BundleWriter{Size: size, encoder: newEncoder(w)}
+}
+
+func (b *BundleWriter) Write(r Resource) error {
+	b.entries = append(b.entries, BundleEntry{Resource: r, Request: BundleRequest{Method: "PUT", URL: r.Ref()}})
+	if len(b.entries) >= b.Size {
+		return b.flush()
+	}
+
+	return nil
+}
+
+func (b *BundleWriter) flush() error {
+	if len(b.entries) == 0 {
+		return nil
+	}
+	if err := b.encoder.Encode(Bundle{ResourceType: "Bundle", Type: "transaction", Entry: b.entries}); err != nil {
+		return fmt.Errorf("json.Encode: %w", err)
+	}
+	b.entries = b.entries[:0]
+	b.Bundles++
+
+	return nil
+}
+
+// Close writes the last bundle. It does not close the underlying writer.
+func (b *BundleWriter) Close() error {
+	return b.flush()
+}
+
+type bulkFile struct {
+	file    *os.File
+	w       *bufio.Writer
+	encoder *json.Encoder
+	count   int
+}
+
+// BulkOutput is a file listed by the manifest of a bulk export.
+type BulkOutput struct {
+	Type  string `json:"type"`
+	URL   string `json:"url"`
+	Count int    `json:"count"`
+}
+
+// BulkManifest is the manifest of a bulk export, as returned by the status
+// endpoint of a FHIR Bulk Data server.
+type BulkManifest struct {
+	TransactionTime     string       `json:"transactionTime"`
+	Request             string       `json:"request"`
+	RequiresAccessToken bool         `json:"requiresAccessToken"`
+	Output              []BulkOutput `json:"output"`
+	Error               []BulkOutput `json:"error"`
+}
+
+// BulkWriter writes resources in the FHIR Bulk Data format: an NDJSON file
+// per resource type in Dir, such as Observation.ndjson, listed by
+// manifest.json.
+type BulkWriter struct {
+	Dir     string
+	Request string // the request recorded in the manifest
+
+	transactionTime time.Time
+	files           map[string]*bulkFile
+}
+
+func NewBulkWriter(dir, request string) *BulkWriter {
+	return &BulkWriter{Dir: dir, Request: request, transactionTime: time.Now(), files: make(map[string]*bulkFile)}
+}
+
+func (b *BulkWriter) Write(r Resource) error {
+	resourceType, _, _ := strings.Cut(r.Ref(), "/")
+	f, ok := b.files[resourceType]
+	if !ok {
+		file, err := os.Create(filepath.Join(b.Dir, resourceType+".ndjson"))
+		if err != nil {
+			return fmt.Errorf("os.Create: %w", err)
+		}
+		w := bufio.NewWriter(file)
+		f = &bulkFile{file: file, w: w, encoder: newEncoder(w)}
+		b.files[resourceType] = f
+	}
+
+	if err := f.encoder.Encode(r); err != nil {
+		return fmt.Errorf("json.Encode: %w", err)
+	}
+	f.count++
+
+	return nil
+}
+
+// Close closes the files and writes the manifest.
+func (b *BulkWriter) Close() error {
+	manifest := BulkManifest{
+		TransactionTime: b.transactionTime.Format(time.RFC3339),
+		Request:         b.Request,
+		Output:          []BulkOutput{},
+		Error:           []BulkOutput{},
+	}
+	for resourceType, f := range b.files {
+		if err := f.w.Flush(); err != nil {
+			return err
+		}
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		manifest.Output = append(manifest.Output, BulkOutput{Type: resourceType, URL: resourceType + ".ndjson", Count: f.count})
+	}
+	sort.Slice(manifest.Output, func(i, j int) bool {
+		return manifest.Output[i].Type < manifest.Output[j].Type
+	})
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(b.Dir, "manifest.json"), append(data, '\n'), 0o644)
+}
@@ -0,0 +1,268 @@
+package fhir
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/units"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Code systems of the resources written by the export.
+const (
+	LOINC               = "http://loinc.org"
+	UCUM                = "http://unitsofmeasure.org"
+	ObservationCategory = "http://terminology.hl7.org/CodeSystem/observation-category"
+)
+
+// Resource is a resource written by the export.
+type Resource interface {
+	// Ref returns the relative reference of the resource, such as
+	// "Observation/<id>".
+	Ref() string
+}
+
+// Patient is the R4 Patient written from Me.
+type Patient struct {
+	ResourceType string `json:"resourceType"`
+	ID           string `json:"id"`
+	Gender       string `json:"gender,omitempty"`
+	BirthDate    string `json:"birthDate,omitempty"`
+}
+
+func (p *Patient) Ref() string {
+	return "Patient/" + p.ID
+}
+
+// Component is a component of an observation, such as the systolic pressure
+// of a blood pressure.
+type Component struct {
+	Code          CodeableConcept `json:"code"`
+	ValueQuantity *Quantity       `json:"valueQuantity,omitempty"`
+}
+
+// ObservationResource is an R4 Observation written from a record or a
+// correlation.
+type ObservationResource struct {
+	ResourceType      string            `json:"resourceType"`
+	ID                string            `json:"id"`
+	Status            string            `json:"status"`
+	Category          []CodeableConcept `json:"category"`
+	Code              CodeableConcept   `json:"code"`
+	Subject           Reference         `json:"subject"`
+	EffectiveDateTime string            `json:"effectiveDateTime,omitempty"`
+	EffectivePeriod   *Period           `json:"effectivePeriod,omitempty"`
+	ValueQuantity     *Quantity         `json:"valueQuantity,omitempty"`
+	Component         []Component       `json:"component,omitempty"`
+	Device            *Reference        `json:"device,omitempty"`
+}
+
+func (o *ObservationResource) Ref() string {
+	return "Observation/" + o.ID
+}
+
+var genders = map[string]string{
+	"HKBiologicalSexFemale": "female",
+	"HKBiologicalSexMale":   "male",
+	"HKBiologicalSexOther":  "other",
+	"HKBiologicalSexNotSet": "unknown",
+}
+
+// NewPatient returns the patient described by me.
+func NewPatient(id string, me health.Me) *Patient {
+	p := &Patient{ResourceType: "Patient", ID: id}
+	if me.BiologicalSex != nil {
+		p.Gender = genders[*me.BiologicalSex]
+	}
+	if me.DateOfBirth != nil {
+		if _, err := time.Parse("2006-01-02", *me.DateOfBirth); err == nil {
+			p.BirthDate = *me.DateOfBirth
+		}
+	}
+
+	return p
+}
+
+// vitalSign maps a quantity type to a LOINC code and a UCUM unit. convert
+// converts a value from the unit of the record, and fails on units it does
+// not know.
+type vitalSign struct {
+	code     string
+	display  string
+	category string
+	unit     string
+	convert  func(value float64, unit string) (float64, bool)
+}
+
+// convertTo converts between the units of the units package.
+func convertTo(to string) func(float64, string) (float64, bool) {
+	return func(value float64, from string) (float64, bool) {
+		converted, err := units.Convert(value, from, to)
+		return converted, err == nil
+	}
+}
+
+// scaled accepts a single unit, and scales its values.
+func scaled(unit string, scale float64) func(float64, string) (float64, bool) {
+	return func(value float64, from string) (float64, bool) {
+		return value * scale, from == unit
+	}
+}
+
+// glucose converts a blood glucose to mg/dL, from mg/dL or from the mmol/L
+// units of HealthKit, which carry the molar mass: "mmol<180.15588>/L".
+func glucose(value float64, unit string) (float64, bool) {
+	if unit == "mg/dL" {
+		return value, true
+	}
+	if strings.HasPrefix(unit, "mmol<") && strings.HasSuffix(unit, ">/L") {
+		molarMass, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(unit, "mmol<"), ">/L"), 64)
+		if err == nil {
+			return value * molarMass / 10, true
+		}
+	}
+
+	return 0, false
+}
+
+var vitalSigns = map[string]vitalSign{
+	"HKQuantityTypeIdentifierHeartRate":        {"8867-4", "Heart rate", "vital-signs", "/min", scaled("count/min", 1)},
+	"HKQuantityTypeIdentifierRespiratoryRate":  {"9279-1", "Respiratory rate", "vital-signs", "/min", scaled("count/min", 1)},
+	"HKQuantityTypeIdentifierBodyMass":         {"29463-7", "Body weight", "vital-signs", "kg", convertTo("kg")},
+	"HKQuantityTypeIdentifierHeight":           {"8302-2", "Body height", "vital-signs", "cm", convertTo("cm")},
+	"HKQuantityTypeIdentifierBodyMassIndex":    {"39156-5", "Body mass index (BMI) [Ratio]", "vital-signs", "kg/m2", scaled("count", 1)},
+	"HKQuantityTypeIdentifierOxygenSaturation": {"59408-5", "Oxygen saturation in Arterial blood by Pulse oximetry", "vital-signs", "%", scaled("%", 100)},
+	"HKQuantityTypeIdentifierBodyTemperature":  {"8310-5", "Body temperature", "vital-signs", "Cel", convertTo("degC")},
+	"HKQuantityTypeIdentifierBloodGlucose":     {"2339-0", "Glucose [Mass/volume] in Blood", "laboratory", "mg/dL", glucose},
+}
+
+// Blood pressure codes.
+const (
+	bloodPressureCode = "85354-9"
+	systolicCode      = "8480-6"
+	diastolicCode     = "8462-4"
+)
+
+// ObservationTypes lists the record types written as observations.
+func ObservationTypes() []string {
+	types := make([]string, 0, len(vitalSigns))
+	for kind := range vitalSigns {
+		types = append(types, kind)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+func loinc(code, display string) CodeableConcept {
+	return CodeableConcept{Coding: []Coding{{System: LOINC, Code: code, Display: display}}, Text: display}
+}
+
+func category(code string) []CodeableConcept {
+	display := map[string]string{"vital-signs": "Vital Signs", "laboratory": "Laboratory"}[code]
+	return []CodeableConcept{{Coding: []Coding{{System: ObservationCategory, Code: code, Display: display}}}}
+}
+
+func quantity(value float64, unit string) *Quantity {
+	return &Quantity{Value: &value, Unit: unit, System: UCUM, Code: unit}
+}
+
+// resourceID derives a logical id from what identifies a sample, so the
+// same sample keeps its id across imports and exports.
+func resourceID(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+func formatTime(t *health.HealthTime) string {
+	return time.Time(*t).Format(time.RFC3339)
+}
+
+// instant formats a time for resourceID, whatever its offset.
+func instant(t *health.HealthTime) string {
+	return time.Time(*t).UTC().Format(time.RFC3339Nano)
+}
+
+// newObservation returns an observation of the patient, effective at start,
+// or over the period to end when it is later.
+func newObservation(id, patient string, code CodeableConcept, start, end *health.HealthTime, source, device string) *ObservationResource {
+	o := &ObservationResource{
+		ResourceType: "Observation",
+		ID:           id,
+		Status:       "final",
+		Code:         code,
+		Subject:      Reference{Reference: "Patient/" + patient},
+	}
+	if end != nil && time.Time(*end).After(time.Time(*start)) {
+		o.EffectivePeriod = &Period{Start: formatTime(start), End: formatTime(end)}
+	} else {
+		o.EffectiveDateTime = formatTime(start)
+	}
+
+	display := health.DeviceName(device)
+	if display == "" {
+		display = source
+	}
+	if display != "" {
+		o.Device = &Reference{Display: display}
+	}
+
+	return o
+}
+
+// RecordObservation returns the observation of a record, if its type is
+// one of ObservationTypes and its value can be converted to the unit of the
+// observation.
+func RecordObservation(r *health.Record, patient string) (*ObservationResource, bool) {
+	sign, ok := vitalSigns[r.Type]
+	if !ok || r.StartDate == nil || r.Value == nil {
+		return nil, false
+	}
+	value, err := strconv.ParseFloat(*r.Value, 64)
+	if err != nil {
+		return nil, false
+	}
+	var unit, device string
+	if r.Unit != nil {
+		unit = *r.Unit
+	}
+	if r.Device != nil {
+		device = *r.Device
+	}
+	converted, ok := sign.convert(value, unit)
+	if !ok {
+		return nil, false
+	}
+
+	id := resourceID(r.Type, r.SourceName, instant(r.StartDate), *r.Value, unit)
+	o := newObservation(id, patient, loinc(sign.code, sign.display), r.StartDate, r.EndDate, r.SourceName, device)
+	o.Category = category(sign.category)
+	o.ValueQuantity = quantity(converted, sign.unit)
+
+	return o, true
+}
+
+// BloodPressureObservation returns a blood pressure correlation as an
+// observation with a systolic and a diastolic component.
+func BloodPressureObservation(c *health.Correlation, patient string) (*ObservationResource, bool) {
+	if c.Type != health.BloodPressureType || c.StartDate == nil {
+		return nil, false
+	}
+	reading := c.BloodPressure()
+	if reading.Systolic == nil || reading.Diastolic == nil {
+		return nil, false
+	}
+
+	id := resourceID(c.Type, c.SourceName, instant(c.StartDate))
+	o := newObservation(id, patient, loinc(bloodPressureCode, "Blood pressure panel with all children optional"), c.StartDate, c.EndDate, c.SourceName, c.Device)
+	o.Category = category("vital-signs")
+	o.Component = []Component{
+		{Code: loinc(systolicCode, "Systolic blood pressure"), ValueQuantity: quantity(*reading.Systolic, "mm[Hg]")},
+		{Code: loinc(diastolicCode, "Diastolic blood pressure"), ValueQuantity: quantity(*reading.Diastolic, "mm[Hg]")},
+	}
+
+	return o, true
+}
@@ -0,0 +1,204 @@
+package fhir
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/lsmoura/health/pkg/health"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func record(t *testing.T, kind, unit, value, start, end string) *health.Record {
+	t.Helper()
+
+	var unitAttr bytes.Buffer
+	xml.EscapeText(&unitAttr, []byte(unit))
+	data := `<Record type="` + kind + `" sourceName="Scale" unit="` + unitAttr.String() + `" value="` + value + `" startDate="` + start + `" endDate="` + end + `"/>`
+	var r health.Record
+	if err := xml.Unmarshal([]byte(data), &r); err != nil {
+		t.Fatalf("xml.Unmarshal: %v", err)
+	}
+	return &r
+}
+
+func TestRecordObservation(t *testing.T) {
+	const at = "2022-01-01 08:00:00 -0300"
+	tests := []struct {
+		kind, unit, value string
+		code              string
+		expected          float64
+		expectedUnit      string
+	}{
+		{"HKQuantityTypeIdentifierHeartRate", "count/min", "62", "8867-4", 62, "/min"},
+		{"HKQuantityTypeIdentifierBodyMass", "lb", "154.3", "29463-7", 69.989, "kg"},
+		{"HKQuantityTypeIdentifierHeight", "m", "1.75", "8302-2", 175, "cm"},
+		{"HKQuantityTypeIdentifierOxygenSaturation", "%", "0.97", "59408-5", 97, "%"},
+		{"HKQuantityTypeIdentifierBloodGlucose", "mmol<180.1558800000541>/L", "5.5", "2339-0", 99.086, "mg/dL"},
+		{"HKQuantityTypeIdentifierBloodGlucose", "mg/dL", "99", "2339-0", 99, "mg/dL"},
+		{"HKQuantityTypeIdentifierBodyTemperature", "degF", "98.6", "8310-5", 37, "Cel"},
+	}
+
+	for _, test := range tests {
+		o, ok := RecordObservation(record(t, test.kind, test.unit, test.value, at, at), "p1")
+		if !ok {
+			t.Errorf("%s: expected an observation", test.kind)
+			continue
+		}
+		if coding := o.Code.Primary(); coding.System != LOINC || coding.Code != test.code {
+			t.Errorf("%s: unexpected code %+v", test.kind, coding)
+		}
+		q := o.ValueQuantity
+		if q == nil || math.Abs(*q.Value-test.expected) > 0.001 || q.Code != test.expectedUnit || q.System != UCUM {
+			t.Errorf("%s: unexpected quantity %+v", test.kind, q)
+		}
+		if o.EffectiveDateTime != "2022-01-01T08:00:00-03:00" || o.Subject.Reference != "Patient/p1" || o.Device.Display != "Scale" {
+			t.Errorf("%s: unexpected observation %+v", test.kind, o)
+		}
+	}
+
+	for _, r := range []*health.Record{
+		record(t, "HKQuantityTypeIdentifierStepCount", "count", "100", at, at),
+		record(t, "HKQuantityTypeIdentifierHeartRate", "count/s", "1", at, at),
+		record(t, "HKQuantityTypeIdentifierBodyMass", "kg", "heavy", at, at),
+	} {
+		if o, ok := RecordObservation(r, "p1"); ok {
+			t.Errorf("unexpected observation %+v", o)
+		}
+	}
+
+	// ids do not depend on the offset of the dates
+	a, _ := RecordObservation(record(t, "HKQuantityTypeIdentifierHeartRate", "count/min", "62", at, "2022-01-01 08:05:00 -0300"), "p1")
+	b, _ := RecordObservation(record(t, "HKQuantityTypeIdentifierHeartRate", "count/min", "62", "2022-01-01 11:00:00 +0000", at), "p1")
+	if a.ID != b.ID || len(a.ID) != 32 {
+		t.Errorf("expected the same id, got %q and %q", a.ID, b.ID)
+	}
+	if a.EffectivePeriod == nil || a.EffectivePeriod.End != "2022-01-01T08:05:00-03:00" || a.EffectiveDateTime != "" {
+		t.Errorf("expected a period, got %+v", a)
+	}
+}
+
+func TestBloodPressureObservation(t *testing.T) {
+	data := `<Correlation type="HKCorrelationTypeIdentifierBloodPressure" sourceName="Cuff" device="&lt;&lt;HKDevice: 0x1&gt;, name:Cuff&gt;" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:00:00 -0300">
+  <Record type="HKQuantityTypeIdentifierBloodPressureDiastolic" sourceName="Cuff" unit="mmHg" value="80" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:00:00 -0300"/>
+  <Record type="HKQuantityTypeIdentifierBloodPressureSystolic" sourceName="Cuff" unit="mmHg" value="120" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:00:00 -0300"/>
+</Correlation>`
+	var c health.Correlation
+	if err := xml.Unmarshal([]byte(data), &c); err != nil {
+		t.Fatalf("xml.Unmarshal: %v", err)
+	}
+
+	o, ok := BloodPressureObservation(&c, "p1")
+	if !ok {
+		t.Fatalf("expected an observation")
+	}
+	if o.Code.Primary().Code != "85354-9" || o.ValueQuantity != nil || len(o.Component) != 2 || o.Device.Display != "name:Cuff" {
+		t.Fatalf("unexpected observation %+v", o)
+	}
+	systolic, diastolic := o.Component[0], o.Component[1]
+	if systolic.Code.Primary().Code != "8480-6" || *systolic.ValueQuantity.Value != 120 || systolic.ValueQuantity.Code != "mm[Hg]" {
+		t.Errorf("unexpected systolic component %+v", systolic)
+	}
+	if diastolic.Code.Primary().Code != "8462-4" || *diastolic.ValueQuantity.Value != 80 {
+		t.Errorf("unexpected diastolic component %+v", diastolic)
+	}
+
+	c.Records = c.Records[:1]
+	if _, ok := BloodPressureObservation(&c, "p1"); ok {
+		t.Errorf("expected no observation without a systolic pressure")
+	}
+}
+
+func TestNewPatient(t *testing.T) {
+	birth, sex := "1985-06-01", "HKBiologicalSexFemale"
+	p := NewPatient("p1", health.Me{DateOfBirth: &birth, BiologicalSex: &sex})
+	if expected := (&Patient{ResourceType: "Patient", ID: "p1", Gender: "female", BirthDate: "1985-06-01"}); !reflect.DeepEqual(p, expected) {
+		t.Errorf("expected %+v, got %+v", expected, p)
+	}
+	if p := NewPatient("p1", health.Me{}); p.Gender != "" || p.BirthDate != "" {
+		t.Errorf("unexpected patient %+v", p)
+	}
+}
+
+func TestBundleWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := NewBundleWriter(&out, 2)
+	for _, r := range []Resource{&Patient{ResourceType: "Patient", ID: "p1"}, &ObservationResource{ResourceType: "Observation", ID: "o1"}, &ObservationResource{ResourceType: "Observation", ID: "o2"}} {
+		if err := w.Write(r); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || w.Bundles != 2 {
+		t.Fatalf("expected 2 bundles, got %d:\n%s", w.Bundles, out.String())
+	}
+	var bundle struct {
+		ResourceType string
+		Type         string
+		Entry        []struct {
+			Resource struct{ ResourceType, ID string }
+			Request  BundleRequest
+		}
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &bundle); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if bundle.ResourceType != "Bundle" || bundle.Type != "transaction" || len(bundle.Entry) != 2 {
+		t.Fatalf("unexpected bundle %+v", bundle)
+	}
+	if entry := bundle.Entry[1]; entry.Resource.ID != "o1" || entry.Request != (BundleRequest{Method: "PUT", URL: "Observation/o1"}) {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+}
+
+func TestBulkWriter(t *testing.T) {
+	dir := t.TempDir()
+	w := NewBulkWriter(dir, "health export fhir -format bulk")
+	for _, r := range []Resource{&ObservationResource{ResourceType: "Observation", ID: "o1"}, &Patient{ResourceType: "Patient", ID: "p1"}, &ObservationResource{ResourceType: "Observation", ID: "o2"}} {
+		if err := w.Write(r); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		t.Fatalf("os.ReadFile: %v", err)
+	}
+	var manifest BulkManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	expected := []BulkOutput{{Type: "Observation", URL: "Observation.ndjson", Count: 2}, {Type: "Patient", URL: "Patient.ndjson", Count: 1}}
+	if !reflect.DeepEqual(manifest.Output, expected) || manifest.Request == "" || manifest.TransactionTime == "" {
+		t.Errorf("unexpected manifest %s", data)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "Observation.ndjson"))
+	if err != nil {
+		t.Fatalf("os.Open: %v", err)
+	}
+	defer file.Close()
+	var ids []string
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		resourceType, id, err := ParseHeader(scanner.Bytes())
+		if err != nil || resourceType != "Observation" {
+			t.Fatalf("unexpected line %s: %v", scanner.Text(), err)
+		}
+		ids = append(ids, id)
+	}
+	if !reflect.DeepEqual(ids, []string{"o1", "o2"}) {
+		t.Errorf("unexpected observations %v", ids)
+	}
+}
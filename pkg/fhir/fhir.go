@@ -0,0 +1,128 @@
+package fhir
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Resource types that are normalized into their own tables. MedicationOrder is
+// the DSTU2 name for what R4 calls MedicationRequest.
+const (
+	TypeObservation         = "Observation"
+	TypeCondition           = "Condition"
+	TypeMedicationRequest   = "MedicationRequest"
+	TypeMedicationOrder     = "MedicationOrder"
+	TypeMedicationStatement = "MedicationStatement"
+	TypeImmunization        = "Immunization"
+	TypeAllergyIntolerance  = "AllergyIntolerance"
+	TypeProcedure           = "Procedure"
+	TypeDiagnosticReport    = "DiagnosticReport"
+)
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// Primary returns the first coding of the concept, falling back to its text
+// as the display value when no coding is present.
+func (c *CodeableConcept) Primary() Coding {
+	if c == nil {
+		return Coding{}
+	}
+	for _, coding := range c.Coding {
+		if coding.Code != "" {
+			if coding.Display == "" {
+				coding.Display = c.Text
+			}
+			return coding
+		}
+	}
+
+	return Coding{Display: c.Text}
+}
+
+type Quantity struct {
+	Value      *float64 `json:"value,omitempty"`
+	Comparator string   `json:"comparator,omitempty"`
+	Unit       string   `json:"unit,omitempty"`
+	System     string   `json:"system,omitempty"`
+	Code       string   `json:"code,omitempty"`
+}
+
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+// Concept holds an element that is a plain code string in DSTU2 and a
+// CodeableConcept in R4, such as Condition.clinicalStatus.
+type Concept struct {
+	CodeableConcept
+}
+
+func (c *Concept) UnmarshalJSON(data []byte) error {
+	var code string
+	if err := json.Unmarshal(data, &code); err == nil {
+		c.Coding = []Coding{{Code: code}}
+		return nil
+	}
+
+	return json.Unmarshal(data, &c.CodeableConcept)
+}
+
+// header is the part shared by every resource.
+type header struct {
+	ResourceType string `json:"resourceType"`
+	ID           string `json:"id"`
+}
+
+// ParseHeader returns the resource type and logical id of a FHIR resource.
+func ParseHeader(data []byte) (string, string, error) {
+	var h header
+	if err := json.Unmarshal(data, &h); err != nil {
+		return "", "", fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	if h.ResourceType == "" {
+		return "", "", fmt.Errorf("fhir: missing resourceType")
+	}
+
+	return h.ResourceType, h.ID, nil
+}
+
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// ParseDate parses a FHIR date, dateTime or instant. Partial dates resolve to
+// the first instant they cover. Empty or unparseable values return nil.
+func ParseDate(value string) *time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t
+		}
+	}
+
+	return nil
+}
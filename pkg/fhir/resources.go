@@ -0,0 +1,441 @@
+package fhir
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// Key identifies the ClinicalRecord a resource was loaded from.
+type Key struct {
+	Identifier  string `db:"identifier"`
+	FhirVersion string `db:"fhir_version"`
+	ResourceID  string `db:"resource_id"`
+}
+
+type Code struct {
+	CodeSystem string `db:"code_system"`
+	Code       string `db:"code"`
+	Display    string `db:"display"`
+}
+
+func codeOf(c *CodeableConcept) Code {
+	primary := c.Primary()
+	return Code{CodeSystem: primary.System, Code: primary.Code, Display: primary.Display}
+}
+
+// ClinicalResource is the raw resource as found in the export.
+type ClinicalResource struct {
+	Key
+	ResourceType string `db:"resource_type"`
+	FilePath     string `db:"file_path"`
+	Resource     []byte `db:"resource"`
+}
+
+type Observation struct {
+	Key
+	Code
+	Status        string     `db:"status"`
+	Category      string     `db:"category"`
+	ValueNumeric  *float64   `db:"value_numeric"`
+	ValueUnit     string     `db:"value_unit"`
+	ValueText     string     `db:"value_text"`
+	ReferenceLow  *float64   `db:"reference_low"`
+	ReferenceHigh *float64   `db:"reference_high"`
+	EffectiveDate *time.Time `db:"effective_date"`
+	Issued        *time.Time `db:"issued"`
+}
+
+type Condition struct {
+	Key
+	Code
+	ClinicalStatus     string     `db:"clinical_status"`
+	VerificationStatus string     `db:"verification_status"`
+	OnsetDate          *time.Time `db:"onset_date"`
+	RecordedDate       *time.Time `db:"recorded_date"`
+}
+
+type Medication struct {
+	Key
+	Code
+	ResourceType   string     `db:"resource_type"`
+	Status         string     `db:"status"`
+	Dosage         string     `db:"dosage"`
+	AuthoredDate   *time.Time `db:"authored_date"`
+	EffectiveStart *time.Time `db:"effective_start"`
+	EffectiveEnd   *time.Time `db:"effective_end"`
+}
+
+type Immunization struct {
+	Key
+	Code
+	Status         string     `db:"status"`
+	OccurrenceDate *time.Time `db:"occurrence_date"`
+}
+
+type Allergy struct {
+	Key
+	Code
+	ClinicalStatus string     `db:"clinical_status"`
+	Criticality    string     `db:"criticality"`
+	OnsetDate      *time.Time `db:"onset_date"`
+	RecordedDate   *time.Time `db:"recorded_date"`
+}
+
+type Procedure struct {
+	Key
+	Code
+	Status         string     `db:"status"`
+	PerformedStart *time.Time `db:"performed_start"`
+	PerformedEnd   *time.Time `db:"performed_end"`
+}
+
+type DiagnosticReport struct {
+	Key
+	Code
+	Status        string     `db:"status"`
+	Category      string     `db:"category"`
+	Conclusion    string     `db:"conclusion"`
+	EffectiveDate *time.Time `db:"effective_date"`
+	Issued        *time.Time `db:"issued"`
+}
+
+// Resources accumulates the raw and normalized rows of every loaded resource.
+type Resources struct {
+	Raw               []ClinicalResource
+	Observations      []Observation
+	Conditions        []Condition
+	Medications       []Medication
+	Immunizations     []Immunization
+	Allergies         []Allergy
+	Procedures        []Procedure
+	DiagnosticReports []DiagnosticReport
+}
+
+// concepts decodes an element that is a single CodeableConcept in DSTU2 and
+// an array of them in R4 (e.g. Observation.category).
+func concepts(raw json.RawMessage) []CodeableConcept {
+	if len(raw) == 0 {
+		return nil
+	}
+	var list []CodeableConcept
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+	var single CodeableConcept
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []CodeableConcept{single}
+	}
+
+	return nil
+}
+
+func firstCode(raw json.RawMessage) string {
+	list := concepts(raw)
+	if len(list) == 0 {
+		return ""
+	}
+	primary := list[0].Primary()
+	if primary.Code != "" {
+		return primary.Code
+	}
+
+	return primary.Display
+}
+
+func firstDate(values ...string) *time.Time {
+	for _, value := range values {
+		if t := ParseDate(value); t != nil {
+			return t
+		}
+	}
+
+	return nil
+}
+
+type dosage struct {
+	Text string `json:"text"`
+}
+
+func dosageText(list []dosage) string {
+	if len(list) == 0 {
+		return ""
+	}
+
+	return list[0].Text
+}
+
+// Add parses a resource loaded from a ClinicalRecord and appends it to the
+// raw list, plus the matching typed list when its type is one we normalize.
+func (r *Resources) Add(identifier, fhirVersion, filePath string, data []byte) error {
+	resourceType, id, err := ParseHeader(data)
+	if err != nil {
+		return fmt.Errorf("ParseHeader: %w", err)
+	}
+
+	key := Key{Identifier: identifier, FhirVersion: fhirVersion, ResourceID: id}
+	r.Raw = append(r.Raw, ClinicalResource{
+		Key:          key,
+		ResourceType: resourceType,
+		FilePath:     filePath,
+		Resource:     data,
+	})
+
+	switch resourceType {
+	case TypeObservation:
+		err = r.addObservation(key, data)
+	case TypeCondition:
+		err = r.addCondition(key, data)
+	case TypeMedicationRequest, TypeMedicationOrder, TypeMedicationStatement:
+		err = r.addMedication(key, resourceType, data)
+	case TypeImmunization:
+		err = r.addImmunization(key, data)
+	case TypeAllergyIntolerance:
+		err = r.addAllergy(key, data)
+	case TypeProcedure:
+		err = r.addProcedure(key, data)
+	case TypeDiagnosticReport:
+		err = r.addDiagnosticReport(key, data)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", resourceType, id, err)
+	}
+
+	return nil
+}
+
+func (r *Resources) addObservation(key Key, data []byte) error {
+	var in struct {
+		Status               string           `json:"status"`
+		Category             json.RawMessage  `json:"category"`
+		Code                 *CodeableConcept `json:"code"`
+		ValueQuantity        *Quantity        `json:"valueQuantity"`
+		ValueString          string           `json:"valueString"`
+		ValueCodeableConcept *CodeableConcept `json:"valueCodeableConcept"`
+		EffectiveDateTime    string           `json:"effectiveDateTime"`
+		EffectivePeriod      Period           `json:"effectivePeriod"`
+		Issued               string           `json:"issued"`
+		ReferenceRange       []struct {
+			Low  *Quantity `json:"low"`
+			High *Quantity `json:"high"`
+		} `json:"referenceRange"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	row := Observation{
+		Key:           key,
+		Code:          codeOf(in.Code),
+		Status:        in.Status,
+		Category:      firstCode(in.Category),
+		ValueText:     in.ValueString,
+		EffectiveDate: firstDate(in.EffectiveDateTime, in.EffectivePeriod.Start),
+		Issued:        ParseDate(in.Issued),
+	}
+	if in.ValueQuantity != nil {
+		row.ValueNumeric = in.ValueQuantity.Value
+		row.ValueUnit = in.ValueQuantity.Unit
+		if row.ValueUnit == "" {
+			row.ValueUnit = in.ValueQuantity.Code
+		}
+	}
+	if in.ValueCodeableConcept != nil && row.ValueText == "" {
+		row.ValueText = in.ValueCodeableConcept.Primary().Display
+	}
+	if len(in.ReferenceRange) > 0 {
+		if low := in.ReferenceRange[0].Low; low != nil {
+			row.ReferenceLow = low.Value
+		}
+		if high := in.ReferenceRange[0].High; high != nil {
+			row.ReferenceHigh = high.Value
+		}
+	}
+
+	r.Observations = append(r.Observations, row)
+	return nil
+}
+
+func (r *Resources) addCondition(key Key, data []byte) error {
+	var in struct {
+		Code               *CodeableConcept `json:"code"`
+		ClinicalStatus     *Concept         `json:"clinicalStatus"`
+		VerificationStatus *Concept         `json:"verificationStatus"`
+		OnsetDateTime      string           `json:"onsetDateTime"`
+		OnsetPeriod        Period           `json:"onsetPeriod"`
+		RecordedDate       string           `json:"recordedDate"`
+		DateRecorded       string           `json:"dateRecorded"` // DSTU2
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	row := Condition{
+		Key:          key,
+		Code:         codeOf(in.Code),
+		OnsetDate:    firstDate(in.OnsetDateTime, in.OnsetPeriod.Start),
+		RecordedDate: firstDate(in.RecordedDate, in.DateRecorded),
+	}
+	if in.ClinicalStatus != nil {
+		row.ClinicalStatus = in.ClinicalStatus.Primary().Code
+	}
+	if in.VerificationStatus != nil {
+		row.VerificationStatus = in.VerificationStatus.Primary().Code
+	}
+
+	r.Conditions = append(r.Conditions, row)
+	return nil
+}
+
+func (r *Resources) addMedication(key Key, resourceType string, data []byte) error {
+	var in struct {
+		Status                    string           `json:"status"`
+		MedicationCodeableConcept *CodeableConcept `json:"medicationCodeableConcept"`
+		MedicationReference       *Reference       `json:"medicationReference"`
+		AuthoredOn                string           `json:"authoredOn"`
+		DateWritten               string           `json:"dateWritten"`  // DSTU2 MedicationOrder
+		DateAsserted              string           `json:"dateAsserted"` // MedicationStatement
+		EffectiveDateTime         string           `json:"effectiveDateTime"`
+		EffectivePeriod           Period           `json:"effectivePeriod"`
+		DosageInstruction         []dosage         `json:"dosageInstruction"`
+		Dosage                    []dosage         `json:"dosage"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	row := Medication{
+		Key:            key,
+		Code:           codeOf(in.MedicationCodeableConcept),
+		ResourceType:   resourceType,
+		Status:         in.Status,
+		AuthoredDate:   firstDate(in.AuthoredOn, in.DateWritten, in.DateAsserted),
+		EffectiveStart: firstDate(in.EffectiveDateTime, in.EffectivePeriod.Start),
+		EffectiveEnd:   ParseDate(in.EffectivePeriod.End),
+	}
+	if row.Display == "" && in.MedicationReference != nil {
+		row.Display = in.MedicationReference.Display
+	}
+	row.Dosage = dosageText(in.DosageInstruction)
+	if row.Dosage == "" {
+		row.Dosage = dosageText(in.Dosage)
+	}
+
+	r.Medications = append(r.Medications, row)
+	return nil
+}
+
+func (r *Resources) addImmunization(key Key, data []byte) error {
+	var in struct {
+		Status             string           `json:"status"`
+		VaccineCode        *CodeableConcept `json:"vaccineCode"`
+		OccurrenceDateTime string           `json:"occurrenceDateTime"`
+		Date               string           `json:"date"` // DSTU2
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	r.Immunizations = append(r.Immunizations, Immunization{
+		Key:            key,
+		Code:           codeOf(in.VaccineCode),
+		Status:         in.Status,
+		OccurrenceDate: firstDate(in.OccurrenceDateTime, in.Date),
+	})
+	return nil
+}
+
+func (r *Resources) addAllergy(key Key, data []byte) error {
+	var in struct {
+		Code           *CodeableConcept `json:"code"`
+		Substance      *CodeableConcept `json:"substance"` // DSTU2
+		ClinicalStatus *Concept         `json:"clinicalStatus"`
+		Status         string           `json:"status"` // DSTU2
+		Criticality    string           `json:"criticality"`
+		OnsetDateTime  string           `json:"onsetDateTime"`
+		Onset          string           `json:"onset"` // DSTU2
+		RecordedDate   string           `json:"recordedDate"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	concept := in.Code
+	if concept == nil {
+		concept = in.Substance
+	}
+	row := Allergy{
+		Key:            key,
+		Code:           codeOf(concept),
+		ClinicalStatus: in.Status,
+		Criticality:    in.Criticality,
+		OnsetDate:      firstDate(in.OnsetDateTime, in.Onset),
+		RecordedDate:   ParseDate(in.RecordedDate),
+	}
+	if in.ClinicalStatus != nil {
+		row.ClinicalStatus = in.ClinicalStatus.Primary().Code
+	}
+
+	r.Allergies = append(r.Allergies, row)
+	return nil
+}
+
+func (r *Resources) addProcedure(key Key, data []byte) error {
+	var in struct {
+		Status            string           `json:"status"`
+		Code              *CodeableConcept `json:"code"`
+		PerformedDateTime string           `json:"performedDateTime"`
+		PerformedPeriod   Period           `json:"performedPeriod"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	r.Procedures = append(r.Procedures, Procedure{
+		Key:            key,
+		Code:           codeOf(in.Code),
+		Status:         in.Status,
+		PerformedStart: firstDate(in.PerformedDateTime, in.PerformedPeriod.Start),
+		PerformedEnd:   ParseDate(in.PerformedPeriod.End),
+	})
+	return nil
+}
+
+func (r *Resources) addDiagnosticReport(key Key, data []byte) error {
+	var in struct {
+		Status            string           `json:"status"`
+		Category          json.RawMessage  `json:"category"`
+		Code              *CodeableConcept `json:"code"`
+		Conclusion        string           `json:"conclusion"`
+		EffectiveDateTime string           `json:"effectiveDateTime"`
+		EffectivePeriod   Period           `json:"effectivePeriod"`
+		Issued            string           `json:"issued"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	r.DiagnosticReports = append(r.DiagnosticReports, DiagnosticReport{
+		Key:           key,
+		Code:          codeOf(in.Code),
+		Status:        in.Status,
+		Category:      firstCode(in.Category),
+		Conclusion:    in.Conclusion,
+		EffectiveDate: firstDate(in.EffectiveDateTime, in.EffectivePeriod.Start),
+		Issued:        ParseDate(in.Issued),
+	})
+	return nil
+}
+
+// LoadFile reads the resource a ClinicalRecord points at. path is the
+// record's resourceFilePath, which is rooted at the export directory.
+func (r *Resources) LoadFile(fsys fs.FS, identifier, fhirVersion, path string) error {
+	data, err := fs.ReadFile(fsys, strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return fmt.Errorf("fs.ReadFile: %w", err)
+	}
+
+	return r.Add(identifier, fhirVersion, path, data)
+}
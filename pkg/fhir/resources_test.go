@@ -0,0 +1,134 @@
+package fhir
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected *time.Time
+	}{
+		{in: "", expected: nil},
+		{in: "garbage", expected: nil},
+		{in: "2019", expected: ptr(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))},
+		{in: "2019-05", expected: ptr(time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC))},
+		{in: "2019-05-12", expected: ptr(time.Date(2019, 5, 12, 0, 0, 0, 0, time.UTC))},
+		{in: "2019-05-12T10:20:30Z", expected: ptr(time.Date(2019, 5, 12, 10, 20, 30, 0, time.UTC))},
+	}
+
+	for _, test := range tests {
+		got := ParseDate(test.in)
+		if (got == nil) != (test.expected == nil) || (got != nil && !got.Equal(*test.expected)) {
+			t.Errorf("ParseDate(%q): expected %v, got %v", test.in, test.expected, got)
+		}
+	}
+}
+
+func TestAddObservation(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "DSTU2",
+			data: `{
+				"resourceType": "Observation",
+				"id": "obs-1",
+				"status": "final",
+				"category": {"coding": [{"code": "laboratory"}]},
+				"code": {"coding": [{"system": "http://loinc.org", "code": "2345-7", "display": "Glucose"}]},
+				"valueQuantity": {"value": 95, "unit": "mg/dL"},
+				"referenceRange": [{"low": {"value": 70}, "high": {"value": 99}}],
+				"effectiveDateTime": "2019-05-12T10:20:30Z"
+			}`,
+		},
+		{
+			name: "R4",
+			data: `{
+				"resourceType": "Observation",
+				"id": "obs-1",
+				"status": "final",
+				"category": [{"coding": [{"code": "laboratory"}]}],
+				"code": {"coding": [{"system": "http://loinc.org", "code": "2345-7"}], "text": "Glucose"},
+				"valueQuantity": {"value": 95, "code": "mg/dL"},
+				"referenceRange": [{"low": {"value": 70}, "high": {"value": 99}}],
+				"effectiveDateTime": "2019-05-12T10:20:30Z"
+			}`,
+		},
+	}
+
+	for _, test := range tests {
+		var resources Resources
+		if err := resources.Add("id-1", "1.0.2", "/clinical-records/a.json", []byte(test.data)); err != nil {
+			t.Errorf("%s: Add: %v", test.name, err)
+			continue
+		}
+		if len(resources.Raw) != 1 || len(resources.Observations) != 1 {
+			t.Errorf("%s: expected 1 raw and 1 observation, got %d and %d", test.name, len(resources.Raw), len(resources.Observations))
+			continue
+		}
+
+		obs := resources.Observations[0]
+		if obs.ResourceID != "obs-1" || obs.Code.Code != "2345-7" || obs.Display != "Glucose" || obs.Category != "laboratory" {
+			t.Errorf("%s: unexpected coding %#v", test.name, obs)
+		}
+		if obs.ValueNumeric == nil || *obs.ValueNumeric != 95 || obs.ValueUnit != "mg/dL" {
+			t.Errorf("%s: unexpected value %v %q", test.name, obs.ValueNumeric, obs.ValueUnit)
+		}
+		if obs.ReferenceLow == nil || *obs.ReferenceLow != 70 || obs.ReferenceHigh == nil || *obs.ReferenceHigh != 99 {
+			t.Errorf("%s: unexpected reference range", test.name)
+		}
+		if obs.EffectiveDate == nil {
+			t.Errorf("%s: missing effective date", test.name)
+		}
+	}
+}
+
+func TestAddConditionStatus(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected string
+	}{
+		{
+			// DSTU2 uses a plain code
+			data:     `{"resourceType": "Condition", "id": "c", "clinicalStatus": "active"}`,
+			expected: "active",
+		},
+		{
+			// R4 uses a CodeableConcept
+			data:     `{"resourceType": "Condition", "id": "c", "clinicalStatus": {"coding": [{"code": "resolved"}]}}`,
+			expected: "resolved",
+		},
+	}
+
+	for _, test := range tests {
+		var resources Resources
+		if err := resources.Add("id", "", "", []byte(test.data)); err != nil {
+			t.Errorf("Add(%s): %v", test.data, err)
+			continue
+		}
+		if got := resources.Conditions[0].ClinicalStatus; got != test.expected {
+			t.Errorf("Add(%s): expected %q, got %q", test.data, test.expected, got)
+		}
+	}
+}
+
+func TestAddUnknownType(t *testing.T) {
+	var resources Resources
+	if err := resources.Add("id", "", "", []byte(`{"resourceType": "Patient", "id": "p"}`)); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if len(resources.Raw) != 1 {
+		t.Errorf("expected raw resource to be kept, got %d", len(resources.Raw))
+	}
+
+	if err := resources.Add("id", "", "", []byte(`{"id": "p"}`)); err == nil {
+		t.Errorf("expected error for resource without resourceType")
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
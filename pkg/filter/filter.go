@@ -0,0 +1,249 @@
+package filter
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/lsmoura/health/pkg/health"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pattern is a glob matching a whole value, where * matches any run of
+// characters and ? a single one, or a regular expression between slashes
+// matching any part of it unless anchored: "/^HK.*HeartRate$/".
+type Pattern struct {
+	raw string
+	re  *regexp.Regexp
+}
+
+func ParsePattern(s string) (Pattern, error) {
+	expr := "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(s)) + "$"
+	if len(s) > 1 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") {
+		expr = s[1 : len(s)-1]
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Pattern{}, fmt.Errorf("invalid pattern %q: %w", s, err)
+	}
+
+	return Pattern{raw: s, re: re}, nil
+}
+
+func (p Pattern) Match(s string) bool {
+	return p.re.MatchString(s)
+}
+
+func (p Pattern) String() string {
+	return p.raw
+}
+
+func (p Pattern) MarshalText() ([]byte, error) {
+	return []byte(p.raw), nil
+}
+
+func (p *Pattern) UnmarshalText(text []byte) error {
+	parsed, err := ParsePattern(string(text))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// Patterns is a list of patterns. It implements flag.Value, so a flag can
+// be repeated to add patterns.
+type Patterns []Pattern
+
+func (p *Patterns) String() string {
+	if p == nil {
+		return ""
+	}
+
+	raw := make([]string, len(*p))
+	for i, pattern := range *p {
+		raw[i] = pattern.raw
+	}
+	return strings.Join(raw, " ")
+}
+
+func (p *Patterns) Set(s string) error {
+	pattern, err := ParsePattern(s)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, pattern)
+	return nil
+}
+
+// List keeps the values matching one of Include, or every value when
+// Include is empty, unless they match one of Exclude.
+type List struct {
+	Include Patterns `json:"include,omitempty"`
+	Exclude Patterns `json:"exclude,omitempty"`
+}
+
+func (l List) IsZero() bool {
+	return len(l.Include) == 0 && len(l.Exclude) == 0
+}
+
+func (l List) Keep(value string) bool {
+	kept := len(l.Include) == 0
+	for _, pattern := range l.Include {
+		if pattern.Match(value) {
+			kept = true
+			break
+		}
+	}
+	if !kept {
+		return false
+	}
+
+	for _, pattern := range l.Exclude {
+		if pattern.Match(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ActivitySummaryType is the type that activity summaries, which have no
+// type attribute, are matched as by RecordTypes.
+const ActivitySummaryType = "HKActivitySummaryTypeIdentifier"
+
+// Filter selects the elements of an export to import. WorkoutTypes apply to
+// workouts and RecordTypes to every other element with a type, such as
+// records, correlations and audiograms, and to activity summaries as
+// ActivitySummaryType. Sources, devices and the date window apply to every
+// element with a sourceName, device or startDate attribute. Devices are
+// matched against their health.DeviceName.
+type Filter struct {
+	RecordTypes  List       `json:"record_types,omitempty"`
+	WorkoutTypes List       `json:"workout_types,omitempty"`
+	Sources      List       `json:"sources,omitempty"`
+	Devices      List       `json:"devices,omitempty"`
+	Since        *time.Time `json:"since,omitempty"` // inclusive
+	Until        *time.Time `json:"until,omitempty"` // exclusive
+}
+
+// MarshalJSON leaves out the lists without patterns.
+func (f Filter) MarshalJSON() ([]byte, error) {
+	nonEmpty := func(l List) *List {
+		if l.IsZero() {
+			return nil
+		}
+		return &l
+	}
+
+	return json.Marshal(struct {
+		RecordTypes  *List      `json:"record_types,omitempty"`
+		WorkoutTypes *List      `json:"workout_types,omitempty"`
+		Sources      *List      `json:"sources,omitempty"`
+		Devices      *List      `json:"devices,omitempty"`
+		Since        *time.Time `json:"since,omitempty"`
+		Until        *time.Time `json:"until,omitempty"`
+	}{nonEmpty(f.RecordTypes), nonEmpty(f.WorkoutTypes), nonEmpty(f.Sources), nonEmpty(f.Devices), f.Since, f.Until})
+}
+
+// IsZero reports whether the filter keeps everything.
+func (f *Filter) IsZero() bool {
+	return f == nil || (f.RecordTypes.IsZero() && f.WorkoutTypes.IsZero() &&
+		f.Sources.IsZero() && f.Devices.IsZero() && f.Since == nil && f.Until == nil)
+}
+
+// KeepTime reports whether t is within the date window.
+func (f *Filter) KeepTime(t time.Time) bool {
+	if f.Since != nil && t.Before(*f.Since) {
+		return false
+	}
+	if f.Until != nil && !t.Before(*f.Until) {
+		return false
+	}
+
+	return true
+}
+
+func attr(attrs []xml.Attr, name string) (string, bool) {
+	for _, a := range attrs {
+		if a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// Keep reports whether a top-level element should be imported, from its
+// name and attributes only, so it can be skipped before being read.
+func (f *Filter) Keep(name string, attrs []xml.Attr) bool {
+	switch name {
+	case "Workout":
+		if value, ok := attr(attrs, "workoutActivityType"); ok && !f.WorkoutTypes.Keep(value) {
+			return false
+		}
+	case "ActivitySummary":
+		if !f.RecordTypes.Keep(ActivitySummaryType) {
+			return false
+		}
+	default:
+		if value, ok := attr(attrs, "type"); ok && !f.RecordTypes.Keep(value) {
+			return false
+		}
+	}
+	if value, ok := attr(attrs, "sourceName"); ok && !f.Sources.Keep(value) {
+		return false
+	}
+	if value, ok := attr(attrs, "device"); ok && !f.Devices.Keep(health.DeviceName(value)) {
+		return false
+	}
+
+	if f.Since != nil || f.Until != nil {
+		value, ok := attr(attrs, "startDate")
+		if !ok {
+			value, ok = attr(attrs, "dateComponents") // activity summaries
+		}
+		if !ok {
+			return true
+		}
+		t, err := parseDate(value)
+		if err != nil {
+			return true // invalid dates are reported by the decoder
+		}
+		return f.KeepTime(t)
+	}
+
+	return true
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range []string{health.TimeLayout, time.RFC3339, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// ParseTime parses a date as found in an export, RFC 3339, a local
+// "2006-01-02" day, or a duration before now such as "90d" or "12h".
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if t, err := parseDate(s); err == nil {
+		return t, nil
+	}
+
+	if strings.HasSuffix(s, "d") {
+		if n, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
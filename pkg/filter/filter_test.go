@@ -0,0 +1,133 @@
+package filter
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		match   bool
+	}{
+		{"HKQuantityTypeIdentifierHeartRate", "HKQuantityTypeIdentifierHeartRate", true},
+		{"HKQuantityTypeIdentifierHeartRate", "HKQuantityTypeIdentifierHeartRateVariabilitySDNN", false},
+		{"*HeartRate*", "HKQuantityTypeIdentifierHeartRateVariabilitySDNN", true},
+		{"Jane?s Watch", "Jane's Watch", true},
+		{"a.b", "axb", false},
+		{"/^HKCategory.*Sleep/", "HKCategoryTypeIdentifierSleepAnalysis", true},
+		{"/Sleep$/", "HKCategoryTypeIdentifierSleepAnalysis", false},
+		{"/HeartRate/", "HKQuantityTypeIdentifierRestingHeartRate", true},
+		{"/^HK.*HeartRate$/", "HKQuantityTypeIdentifierRestingHeartRate", true},
+		{"/^HK.*HeartRate$/", "HKQuantityTypeIdentifierHeartRateVariabilitySDNN", false},
+	}
+
+	for _, test := range tests {
+		pattern, err := ParsePattern(test.pattern)
+		if err != nil {
+			t.Errorf("ParsePattern(%q): %v", test.pattern, err)
+			continue
+		}
+		if got := pattern.Match(test.value); got != test.match {
+			t.Errorf("%q.Match(%q): expected %t, got %t", test.pattern, test.value, test.match, got)
+		}
+	}
+
+	if _, err := ParsePattern("/(/"); err == nil {
+		t.Errorf("expected an error for an invalid regexp")
+	}
+}
+
+func attrs(pairs ...string) []xml.Attr {
+	var out []xml.Attr
+	for i := 0; i < len(pairs); i += 2 {
+		out = append(out, xml.Attr{Name: xml.Name{Local: pairs[i]}, Value: pairs[i+1]})
+	}
+	return out
+}
+
+func TestKeep(t *testing.T) {
+	since := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	var f Filter
+	f.RecordTypes.Include.Set("*HeartRate")
+	f.RecordTypes.Include.Set("*Sleep*")
+	f.Sources.Exclude.Set("/^Test/")
+	f.Devices.Include.Set("*Apple Watch*")
+	f.Since = &since
+
+	tests := []struct {
+		name  string
+		attrs []xml.Attr
+		keep  bool
+	}{
+		{"Record", attrs("type", "HKQuantityTypeIdentifierHeartRate", "startDate", "2022-03-01 10:00:00 -0500"), true},
+		{"Record", attrs("type", "HKQuantityTypeIdentifierStepCount", "startDate", "2022-03-01 10:00:00 -0500"), false},
+		{"Record", attrs("type", "HKQuantityTypeIdentifierHeartRate", "startDate", "2021-12-31 10:00:00 -0500"), false},
+		{"Record", attrs("type", "HKCategoryTypeIdentifierSleepAnalysis", "sourceName", "TestApp"), false},
+		{"Record", attrs("type", "HKQuantityTypeIdentifierHeartRate", "device", "<<HKDevice: 0x1>, name:Apple Watch, model:Watch>"), true},
+		{"Record", attrs("type", "HKQuantityTypeIdentifierHeartRate", "device", "<<HKDevice: 0x2>, name:iPhone, model:iPhone>"), false},
+		// record type filters apply to every element but workouts
+		{"Workout", attrs("workoutActivityType", "HKWorkoutActivityTypeRunning", "startDate", "2022-03-01 10:00:00 -0500"), true},
+		{"Correlation", attrs("type", "HKCorrelationTypeIdentifierBloodPressure", "startDate", "2022-03-01 10:00:00 -0500"), false},
+		{"Audiogram", attrs("type", "HKDataTypeIdentifierAudiogram", "startDate", "2022-03-01 10:00:00 -0500"), false},
+		{"ActivitySummary", attrs("dateComponents", "2022-06-01"), false},
+		{"Me", nil, true},
+	}
+
+	for _, test := range tests {
+		if got := f.Keep(test.name, test.attrs); got != test.keep {
+			t.Errorf("Keep(%s %v): expected %t, got %t", test.name, test.attrs, test.keep, got)
+		}
+	}
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	expected := `{"record_types":{"include":["*HeartRate","*Sleep*"]},"sources":{"exclude":["/^Test/"]},"devices":{"include":["*Apple Watch*"]},"since":"2022-01-01T00:00:00Z"}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+
+	var summaries Filter
+	summaries.RecordTypes.Include.Set(ActivitySummaryType)
+	if !summaries.Keep("ActivitySummary", attrs("dateComponents", "2022-06-01")) {
+		t.Errorf("expected activity summaries to be kept by their type")
+	}
+
+	var empty *Filter
+	if !empty.IsZero() || f.IsZero() {
+		t.Errorf("unexpected IsZero")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2022, 6, 30, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Time
+	}{
+		{"2022-01-02", time.Date(2022, 1, 2, 0, 0, 0, 0, time.Local)},
+		{"2022-01-02T03:04:05Z", time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"90d", now.AddDate(0, 0, -90)},
+		{"12h", now.Add(-12 * time.Hour)},
+	}
+
+	for _, test := range tests {
+		got, err := ParseTime(test.value, now)
+		if err != nil {
+			t.Errorf("ParseTime(%q): %v", test.value, err)
+			continue
+		}
+		if !got.Equal(test.expected) {
+			t.Errorf("ParseTime(%q): expected %s, got %s", test.value, test.expected, got)
+		}
+	}
+
+	if _, err := ParseTime("yesterday", now); err == nil {
+		t.Errorf("expected an error")
+	}
+}
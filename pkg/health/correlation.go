@@ -0,0 +1,176 @@
+package health
+
+import (
+	"github.com/lsmoura/health/pkg/metadata"
+	"github.com/lsmoura/health/pkg/units"
+	"strconv"
+	"strings"
+)
+
+// Correlation types with their own table.
+const (
+	BloodPressureType = "HKCorrelationTypeIdentifierBloodPressure"
+	FoodType          = "HKCorrelationTypeIdentifierFood"
+)
+
+// BloodPressureReading is a blood pressure correlation, stored in the
+// blood_pressure_readings table. Pulse is the heart rate measured with it,
+// when the correlation holds one or the source recorded one at the same
+// time.
+type BloodPressureReading struct {
+	SourceName string      `db:"source_name"`
+	Device     *string     `db:"device"`
+	StartDate  *HealthTime `db:"start_date"`
+	EndDate    *HealthTime `db:"end_date"`
+	TimeZone   *string     `db:"time_zone"`
+	Systolic   *float64    `db:"systolic"`  // mmHg
+	Diastolic  *float64    `db:"diastolic"` // mmHg
+	Pulse      *float64    `db:"pulse"`     // count/min
+}
+
+// Nutrient is a dietary record of a food correlation.
+type Nutrient struct {
+	Type  string  `json:"type"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+}
+
+// Meal is a food correlation with its dietary records pivoted into
+// columns, stored in the meals table. Nutrients without a column are only
+// in Nutrients, which lists every dietary record.
+type Meal struct {
+	SourceName string      `db:"source_name"`
+	Device     *string     `db:"device"`
+	StartDate  *HealthTime `db:"start_date"`
+	EndDate    *HealthTime `db:"end_date"`
+	TimeZone   *string     `db:"time_zone"`
+	Food       *string     `db:"food"` // HKFoodType
+	Meal       *string     `db:"meal"` // breakfast, lunch... when the source says
+
+	EnergyKcal     *float64 `db:"energy_kcal"`
+	ProteinG       *float64 `db:"protein_g"`
+	CarbohydratesG *float64 `db:"carbohydrates_g"`
+	FatTotalG      *float64 `db:"fat_total_g"`
+	FatSaturatedG  *float64 `db:"fat_saturated_g"`
+	FiberG         *float64 `db:"fiber_g"`
+	SugarG         *float64 `db:"sugar_g"`
+	SodiumMg       *float64 `db:"sodium_mg"`
+	CholesterolMg  *float64 `db:"cholesterol_mg"`
+	CaffeineMg     *float64 `db:"caffeine_mg"`
+	WaterML        *float64 `db:"water_ml"`
+
+	Nutrients []Nutrient `db:"nutrients,json"`
+}
+
+func recordValue(r Record) (float64, bool) {
+	if r.Value == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(*r.Value, 64)
+	return v, err == nil
+}
+
+func recordUnit(r Record) string {
+	if r.Unit == nil {
+		return ""
+	}
+	return *r.Unit
+}
+
+// BloodPressure returns the reading of a blood pressure correlation.
+func (c *Correlation) BloodPressure() BloodPressureReading {
+	reading := BloodPressureReading{
+		SourceName: c.SourceName,
+		StartDate:  c.StartDate,
+		EndDate:    c.EndDate,
+		TimeZone:   lookupText(c.Metadata, metadata.TimeZone),
+	}
+	if c.Device != "" {
+		device := c.Device
+		reading.Device = &device
+	}
+
+	for _, r := range c.Records {
+		value, ok := recordValue(r)
+		if !ok {
+			continue
+		}
+		switch r.Type {
+		case "HKQuantityTypeIdentifierBloodPressureSystolic":
+			reading.Systolic = &value
+		case "HKQuantityTypeIdentifierBloodPressureDiastolic":
+			reading.Diastolic = &value
+		case "HKQuantityTypeIdentifierHeartRate":
+			reading.Pulse = &value
+		}
+	}
+
+	return reading
+}
+
+// mealKey reports whether a metadata key names the meal of a food, like
+// the "meal" or "Meal" keys of nutrition apps.
+func mealKey(key string) bool {
+	return strings.Contains(strings.ToLower(key), "meal")
+}
+
+// Meal returns the meal of a food correlation.
+func (c *Correlation) Meal() Meal {
+	meal := Meal{
+		SourceName: c.SourceName,
+		StartDate:  c.StartDate,
+		EndDate:    c.EndDate,
+		TimeZone:   lookupText(c.Metadata, metadata.TimeZone),
+		Food:       lookupText(c.Metadata, metadata.FoodType),
+	}
+	if c.Device != "" {
+		device := c.Device
+		meal.Device = &device
+	}
+	for _, entry := range c.Metadata {
+		if mealKey(entry.Key) && entry.Value != "" {
+			value := entry.Value
+			meal.Meal = &value
+			break
+		}
+	}
+
+	columns := map[string]struct {
+		field **float64
+		unit  string
+	}{
+		"HKQuantityTypeIdentifierDietaryEnergyConsumed": {&meal.EnergyKcal, "kcal"},
+		"HKQuantityTypeIdentifierDietaryProtein":        {&meal.ProteinG, "g"},
+		"HKQuantityTypeIdentifierDietaryCarbohydrates":  {&meal.CarbohydratesG, "g"},
+		"HKQuantityTypeIdentifierDietaryFatTotal":       {&meal.FatTotalG, "g"},
+		"HKQuantityTypeIdentifierDietaryFatSaturated":   {&meal.FatSaturatedG, "g"},
+		"HKQuantityTypeIdentifierDietaryFiber":          {&meal.FiberG, "g"},
+		"HKQuantityTypeIdentifierDietarySugar":          {&meal.SugarG, "g"},
+		"HKQuantityTypeIdentifierDietarySodium":         {&meal.SodiumMg, "mg"},
+		"HKQuantityTypeIdentifierDietaryCholesterol":    {&meal.CholesterolMg, "mg"},
+		"HKQuantityTypeIdentifierDietaryCaffeine":       {&meal.CaffeineMg, "mg"},
+		"HKQuantityTypeIdentifierDietaryWater":          {&meal.WaterML, "mL"},
+	}
+	for _, r := range c.Records {
+		value, ok := recordValue(r)
+		if !ok {
+			continue
+		}
+		meal.Nutrients = append(meal.Nutrients, Nutrient{Type: r.Type, Value: value, Unit: recordUnit(r)})
+
+		column, ok := columns[r.Type]
+		if !ok {
+			continue
+		}
+		converted, err := units.Convert(value, recordUnit(r), column.unit)
+		if err != nil {
+			continue
+		}
+		if *column.field != nil {
+			converted += **column.field // several records of a same nutrient
+		}
+		*column.field = &converted
+	}
+
+	return meal
+}
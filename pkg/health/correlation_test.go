@@ -0,0 +1,74 @@
+package health
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+const bloodPressureXML = `<Correlation type="HKCorrelationTypeIdentifierBloodPressure" sourceName="Cuff" startDate="2022-01-01 08:00:00 -0500" endDate="2022-01-01 08:00:00 -0500">
+  <MetadataEntry key="HKTimeZone" value="America/New_York"/>
+  <Record type="HKQuantityTypeIdentifierBloodPressureDiastolic" sourceName="Cuff" unit="mmHg" value="80" startDate="2022-01-01 08:00:00 -0500" endDate="2022-01-01 08:00:00 -0500"/>
+  <Record type="HKQuantityTypeIdentifierBloodPressureSystolic" sourceName="Cuff" unit="mmHg" value="120" startDate="2022-01-01 08:00:00 -0500" endDate="2022-01-01 08:00:00 -0500"/>
+</Correlation>`
+
+const foodXML = `<Correlation type="HKCorrelationTypeIdentifierFood" sourceName="Tracker" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:00:00 -0500">
+  <MetadataEntry key="HKFoodType" value="Pasta"/>
+  <MetadataEntry key="Meal" value="Lunch"/>
+  <Record type="HKQuantityTypeIdentifierDietaryEnergyConsumed" sourceName="Tracker" unit="kJ" value="2092" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:00:00 -0500"/>
+  <Record type="HKQuantityTypeIdentifierDietaryProtein" sourceName="Tracker" unit="g" value="20" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:00:00 -0500"/>
+  <Record type="HKQuantityTypeIdentifierDietarySodium" sourceName="Tracker" unit="g" value="0.5" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:00:00 -0500"/>
+  <Record type="HKQuantityTypeIdentifierDietaryIron" sourceName="Tracker" unit="mg" value="3" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:00:00 -0500"/>
+</Correlation>`
+
+func TestBloodPressure(t *testing.T) {
+	var correlation Correlation
+	if err := xml.Unmarshal([]byte(bloodPressureXML), &correlation); err != nil {
+		t.Fatalf("xml.Unmarshal: %v", err)
+	}
+
+	reading := correlation.BloodPressure()
+	if reading.Systolic == nil || *reading.Systolic != 120 || reading.Diastolic == nil || *reading.Diastolic != 80 {
+		t.Errorf("unexpected reading %#v", reading)
+	}
+	if reading.Pulse != nil || reading.Device != nil {
+		t.Errorf("expected no pulse and no device, got %#v", reading)
+	}
+	if reading.TimeZone == nil || *reading.TimeZone != "America/New_York" {
+		t.Errorf("expected the time zone, got %v", reading.TimeZone)
+	}
+}
+
+func TestMeal(t *testing.T) {
+	var correlation Correlation
+	if err := xml.Unmarshal([]byte(foodXML), &correlation); err != nil {
+		t.Fatalf("xml.Unmarshal: %v", err)
+	}
+
+	meal := correlation.Meal()
+	if meal.Food == nil || *meal.Food != "Pasta" || meal.Meal == nil || *meal.Meal != "Lunch" {
+		t.Errorf("unexpected food %v and meal %v", meal.Food, meal.Meal)
+	}
+
+	tests := []struct {
+		name     string
+		value    *float64
+		expected float64
+	}{
+		{"energy", meal.EnergyKcal, 500},
+		{"protein", meal.ProteinG, 20},
+		{"sodium", meal.SodiumMg, 500},
+	}
+	for _, test := range tests {
+		if test.value == nil || *test.value < test.expected-1e-9 || *test.value > test.expected+1e-9 {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, test.value)
+		}
+	}
+	if meal.FatTotalG != nil {
+		t.Errorf("expected no fat, got %v", *meal.FatTotalG)
+	}
+
+	// nutrients without a column are kept
+	if len(meal.Nutrients) != 4 || meal.Nutrients[3] != (Nutrient{"HKQuantityTypeIdentifierDietaryIron", 3, "mg"}) {
+		t.Errorf("unexpected nutrients %v", meal.Nutrients)
+	}
+}
@@ -0,0 +1,17 @@
+package health
+
+import "strings"
+
+// DeviceName strips the object address from the device descriptions of an
+// export, "<<HKDevice: 0x283a9c0a0>, name:Apple Watch, model:Watch>", so a
+// device is always described the same way.
+func DeviceName(device string) string {
+	device = strings.TrimSpace(device)
+	if strings.HasPrefix(device, "<<HKDevice:") {
+		if _, rest, ok := strings.Cut(device, ">, "); ok {
+			return strings.TrimSuffix(rest, ">")
+		}
+	}
+
+	return device
+}
@@ -0,0 +1,215 @@
+package health
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+//go:embed export.dtd
+var exportDTD string
+
+// Doctype is the DOCTYPE written at the top of every export, declaring the
+// elements and attributes of types.go.
+var Doctype = "<!DOCTYPE HealthData [\n" + exportDTD + "]>\n"
+
+// DefaultLocale is the locale of the exports written without one.
+const DefaultLocale = "en_US"
+
+// NewElement returns a pointer to the zero value of a top-level element, or
+// nil when the element is not one of the types of this package.
+func NewElement(name string) any {
+	switch name {
+	case "Me":
+		return &Me{}
+	case "Record":
+		return &Record{}
+	case "Correlation":
+		return &Correlation{}
+	case "Workout":
+		return &Workout{}
+	case "ActivitySummary":
+		return &ActivitySummary{}
+	case "ClinicalRecord":
+		return &ClinicalRecord{}
+	case "Audiogram":
+		return &Audiogram{}
+	case "VisionPrescription":
+		return &VisionPrescription{}
+	}
+
+	return nil
+}
+
+func elementName(v any) (string, bool) {
+	switch v.(type) {
+	case *Record, Record:
+		return "Record", true
+	case *Correlation, Correlation:
+		return "Correlation", true
+	case *Workout, Workout:
+		return "Workout", true
+	case *ActivitySummary, ActivitySummary:
+		return "ActivitySummary", true
+	case *ClinicalRecord, ClinicalRecord:
+		return "ClinicalRecord", true
+	case *Audiogram, Audiogram:
+		return "Audiogram", true
+	case *VisionPrescription, VisionPrescription:
+		return "VisionPrescription", true
+	}
+
+	return "", false
+}
+
+// Encoder writes an export.xml, one top-level element at a time, so rows can
+// be streamed from the database. The prolog, with the DOCTYPE, ExportDate and
+// Me, is written before the first element, from the fields set by then.
+type Encoder struct {
+	Locale     string      // DefaultLocale when empty
+	ExportDate *HealthTime // now when nil
+	Me         Me
+
+	w       *bufio.Writer
+	encoder *xml.Encoder
+	started bool
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	buffered := bufio.NewWriter(w)
+	encoder := xml.NewEncoder(buffered)
+	encoder.Indent("", " ")
+
+	return &Encoder{w: buffered, encoder: encoder}
+}
+
+// characteristic returns the value of a characteristic of Me, which the DTD
+// requires even when it is not set.
+func characteristic(value *string) *string {
+	if value == nil {
+		empty := ""
+		return &empty
+	}
+
+	return value
+}
+
+func (e *Encoder) start() error {
+	e.started = true
+
+	locale := e.Locale
+	if locale == "" {
+		locale = DefaultLocale
+	}
+	exportDate := e.ExportDate
+	if exportDate == nil {
+		now := HealthTime(time.Now().Truncate(time.Second))
+		exportDate = &now
+	}
+	me := Me{
+		DateOfBirth:                 characteristic(e.Me.DateOfBirth),
+		BiologicalSex:               characteristic(e.Me.BiologicalSex),
+		BloodType:                   characteristic(e.Me.BloodType),
+		FitzpatrickSkinType:         characteristic(e.Me.FitzpatrickSkinType),
+		CardioFitnessMedicationsUse: characteristic(e.Me.CardioFitnessMedicationsUse),
+	}
+
+	e.w.WriteString(xml.Header)
+	e.w.WriteString(Doctype)
+	root := xml.StartElement{Name: xml.Name{Local: "HealthData"}, Attr: []xml.Attr{{Name: xml.Name{Local: "locale"}, Value: locale}}}
+	if err := e.encoder.EncodeToken(root); err != nil {
+		return fmt.Errorf("EncodeToken: %w", err)
+	}
+	if err := e.encoder.EncodeElement(ExportDate{Value: exportDate}, xml.StartElement{Name: xml.Name{Local: "ExportDate"}}); err != nil {
+		return fmt.Errorf("EncodeElement: %w", err)
+	}
+	if err := e.encoder.EncodeElement(me, xml.StartElement{Name: xml.Name{Local: "Me"}}); err != nil {
+		return fmt.Errorf("EncodeElement: %w", err)
+	}
+
+	return nil
+}
+
+// Encode writes a top-level element: a Record, Correlation, Workout,
+// ActivitySummary, ClinicalRecord, Audiogram or VisionPrescription, or a
+// pointer to one.
+func (e *Encoder) Encode(v any) error {
+	name, ok := elementName(v)
+	if !ok {
+		return fmt.Errorf("health: cannot encode %T as an element", v)
+	}
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+
+	if err := e.encoder.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+		return fmt.Errorf("EncodeElement: %w", err)
+	}
+
+	return nil
+}
+
+// Close ends the document and flushes it. It does not close the underlying
+// writer.
+func (e *Encoder) Close() error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+
+	if err := e.encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: "HealthData"}}); err != nil {
+		return fmt.Errorf("EncodeToken: %w", err)
+	}
+	if err := e.encoder.Flush(); err != nil {
+		return fmt.Errorf("Flush: %w", err)
+	}
+	e.w.WriteString("\n")
+
+	return e.w.Flush()
+}
+
+// Encode writes data as an export.xml.
+func Encode(w io.Writer, data *HealthData) error {
+	e := NewEncoder(w)
+	e.Locale = data.Locale
+	e.ExportDate = data.ExportDate.Value
+	e.Me = data.Me
+
+	elements := make([]any, 0, len(data.Records)+len(data.Correlations)+len(data.Workouts)+
+		len(data.ActivitySummary)+len(data.ClinicalRecord)+len(data.Audiogram)+len(data.VisionPrescription))
+	for i := range data.Records {
+		elements = append(elements, &data.Records[i])
+	}
+	for i := range data.Correlations {
+		elements = append(elements, &data.Correlations[i])
+	}
+	for i := range data.Workouts {
+		elements = append(elements, &data.Workouts[i])
+	}
+	for i := range data.ActivitySummary {
+		elements = append(elements, &data.ActivitySummary[i])
+	}
+	for i := range data.ClinicalRecord {
+		elements = append(elements, &data.ClinicalRecord[i])
+	}
+	for i := range data.Audiogram {
+		elements = append(elements, &data.Audiogram[i])
+	}
+	for i := range data.VisionPrescription {
+		elements = append(elements, &data.VisionPrescription[i])
+	}
+
+	for _, element := range elements {
+		if err := e.Encode(element); err != nil {
+			return err
+		}
+	}
+
+	return e.Close()
+}
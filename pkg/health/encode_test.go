@@ -0,0 +1,172 @@
+package health
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"github.com/lsmoura/health/pkg/dtd"
+	"github.com/lsmoura/health/pkg/pipeline"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const exportXML = `<?xml version="1.0" encoding="UTF-8"?>
+<HealthData locale="pt_BR">
+ <ExportDate value="2022-01-03 09:00:00 -0300"/>
+ <Me HKCharacteristicTypeIdentifierDateOfBirth="1985-06-01" HKCharacteristicTypeIdentifierBiologicalSex="HKBiologicalSexFemale" HKCharacteristicTypeIdentifierBloodType="HKBloodTypeNotSet" HKCharacteristicTypeIdentifierFitzpatrickSkinType="HKFitzpatrickSkinTypeNotSet" HKCharacteristicTypeIdentifierCardioFitnessMedicationsUse="None"/>
+ <Record type="HKQuantityTypeIdentifierHeartRate" sourceName="Watch &amp; Co" sourceVersion="8.1" device="&lt;&lt;HKDevice: 0x283a9c0a0&gt;, name:Apple Watch&gt;" unit="count/min" creationDate="2022-01-01 08:01:00 -0300" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:00:00 -0300" value="62">
+  <MetadataEntry key="HKMetadataKeyHeartRateMotionContext" value="1"/>
+ </Record>
+ <Record type="HKQuantityTypeIdentifierHeartRateVariabilitySDNN" sourceName="Watch" unit="ms" startDate="2022-01-01 08:00:00 +0100" endDate="2022-01-01 08:01:00 +0100" value="45.5">
+  <HeartRateVariabilityMetadataList>
+   <InstantaneousBeatsPerMinute bpm="61" time="8:00:01.07 AM"/>
+   <InstantaneousBeatsPerMinute bpm="63" time="8:00:02.02 AM"/>
+  </HeartRateVariabilityMetadataList>
+ </Record>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="Watch" startDate="2022-01-01 23:00:00 -0300" endDate="2022-01-02 06:00:00 -0300" value="HKCategoryValueSleepAnalysisAsleepCore"/>
+ <Correlation type="HKCorrelationTypeIdentifierBloodPressure" sourceName="Cuff" device="Cuff 2" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:00:00 -0300">
+  <MetadataEntry key="HKTimeZone" value="America/Sao_Paulo"/>
+  <Record type="HKQuantityTypeIdentifierBloodPressureSystolic" sourceName="Cuff" unit="mmHg" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:00:00 -0300" value="120"/>
+ </Correlation>
+ <Workout workoutActivityType="HKWorkoutActivityTypeRunning" duration="30.5" durationUnit="min" totalDistance="5.2" totalDistanceUnit="km" sourceName="Watch" startDate="2022-01-01 17:00:00 -0300" endDate="2022-01-01 17:30:30 -0300">
+  <MetadataEntry key="HKIndoorWorkout" value="0"/>
+  <WorkoutEvent type="HKWorkoutEventTypeSegment" date="2022-01-01 17:00:00 -0300" duration="5.5" durationUnit="min">
+   <MetadataEntry key="HKLapLength" value="1000 m"/>
+  </WorkoutEvent>
+  <WorkoutEvent type="HKWorkoutEventTypePause" date="2022-01-01 17:10:00 -0300"/>
+  <WorkoutRoute sourceName="Watch" startDate="2022-01-01 17:00:00 -0300" endDate="2022-01-01 17:30:30 -0300">
+   <FileReference path="/workout-routes/route_2022-01-01_5.30pm.gpx"/>
+  </WorkoutRoute>
+  <WorkoutStatistics type="HKQuantityTypeIdentifierHeartRate" startDate="2022-01-01 17:00:00 -0300" endDate="2022-01-01 17:30:30 -0300" average="150" minimum="90" maximum="175" unit="count/min"/>
+ </Workout>
+ <ActivitySummary dateComponents="2022-01-01" activeEnergyBurned="512.5" activeEnergyBurnedGoal="500" activeEnergyBurnedUnit="kcal" appleExerciseTime="42" appleStandHours="11"/>
+ <ClinicalRecord type="HKClinicalTypeIdentifierLabResultRecord" identifier="lab-1" sourceName="Hospital" sourceURL="https://example.org/fhir" fhirVersion="4.0.1" receivedDate="2022-01-02 10:00:00 -0300" resourceFilePath="/clinical-records/lab-1.json"/>
+ <Audiogram type="HKDataTypeIdentifierAudiogram" sourceName="Hearing" startDate="2022-01-02 10:00:00 -0300" endDate="2022-01-02 10:10:00 -0300">
+  <SensitivityPoint frequencyValue="1000" frequencyUnit="Hz" leftEarValue="15" leftEarUnit="dBHL"/>
+ </Audiogram>
+ <VisionPrescription type="HKVisionPrescriptionTypeGlasses" dateIssued="2021-12-01 00:00:00 -0300" brand="Lenses">
+  <RightEye sphere="-1.25" sphereUnit="D" axis="90" axisUnit="deg"/>
+  <LeftEye sphere="-1.5" sphereUnit="D"/>
+  <Attachment identifier="scan"/>
+ </VisionPrescription>
+</HealthData>
+`
+
+func parseExport(t *testing.T, data []byte) HealthData {
+	t.Helper()
+
+	var parsed HealthData
+	if err := xml.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("xml.Unmarshal: %v\n%s", err, data)
+	}
+
+	return parsed
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	parsed := parseExport(t, []byte(exportXML))
+	if len(parsed.Records) != 3 || len(parsed.Workouts) != 1 || parsed.ExportDate.Value == nil {
+		t.Fatalf("unexpected export %+v", parsed)
+	}
+
+	var out bytes.Buffer
+	if err := Encode(&out, &parsed); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	reparsed := parseExport(t, out.Bytes())
+	if !reflect.DeepEqual(parsed, reparsed) {
+		t.Errorf("the export changed after a round trip:\n%#v\n%#v\n%s", parsed, reparsed, out.String())
+	}
+
+	// a second round trip writes the same bytes
+	var again bytes.Buffer
+	if err := Encode(&again, &reparsed); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if again.String() != out.String() {
+		t.Errorf("the output changed after a second round trip:\n%s\n%s", out.String(), again.String())
+	}
+
+	for _, expected := range []string{
+		`<HealthData locale="pt_BR">`,
+		`<ExportDate value="2022-01-03 09:00:00 -0300">`,
+		`startDate="2022-01-01 08:00:00 +0100"`,
+		`sourceName="Watch &amp; Co"`,
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %s in:\n%s", expected, out.String())
+		}
+	}
+	if strings.Contains(out.String(), `sourceVersion=""`) || strings.Contains(out.String(), "<ID>") {
+		t.Errorf("unexpected empty attributes or fields:\n%s", out.String())
+	}
+}
+
+func TestEncodeValidates(t *testing.T) {
+	parsed := parseExport(t, []byte(exportXML))
+
+	var out bytes.Buffer
+	if err := Encode(&out, &parsed); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	scanner := pipeline.NewScanner(&out)
+	var d *dtd.DTD
+	var names []string
+	for {
+		e, err := scanner.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if d == nil {
+			if d, err = dtd.Parse(scanner.Doctype()); err != nil {
+				t.Fatalf("dtd.Parse: %v", err)
+			}
+		}
+
+		names = append(names, e.Name)
+		issues, err := d.Validate(e.Data)
+		if err != nil {
+			t.Fatalf("Validate: %v", err)
+		}
+		if len(issues) > 0 {
+			t.Errorf("%s does not match the DTD: %v", e.Name, issues)
+		}
+	}
+
+	expected := []string{"ExportDate", "Me", "Record", "Record", "Record", "Correlation", "Workout", "ActivitySummary", "ClinicalRecord", "Audiogram", "VisionPrescription"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected elements %v, got %v", expected, names)
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	var out bytes.Buffer
+	e := NewEncoder(&out)
+	if err := e.Encode(Record{Type: "HKQuantityTypeIdentifierStepCount", SourceName: "Phone", Value: ptr("12")}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := e.Encode(&Me{}); err == nil {
+		t.Errorf("expected an error encoding Me as an element")
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	parsed := parseExport(t, out.Bytes())
+	if parsed.Locale != DefaultLocale || parsed.ExportDate.Value == nil || len(parsed.Records) != 1 {
+		t.Errorf("unexpected export %+v", parsed)
+	}
+	// the DTD requires every characteristic
+	if parsed.Me.BloodType == nil || *parsed.Me.BloodType != "" {
+		t.Errorf("expected empty characteristics, got %+v", parsed.Me)
+	}
+	if !strings.HasPrefix(out.String(), xml.Header+"<!DOCTYPE HealthData [\n") {
+		t.Errorf("expected the DOCTYPE after the header:\n%s", out.String())
+	}
+}
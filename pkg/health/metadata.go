@@ -0,0 +1,109 @@
+package health
+
+import "github.com/lsmoura/health/pkg/metadata"
+
+// Entities whose metadata is stored in the metadata table.
+const (
+	EntityRecord             = "record"
+	EntityWorkout            = "workout"
+	EntityCorrelation        = "correlation"
+	EntityWorkoutEvent       = "workout_event"
+	EntityWorkoutRoute       = "workout_route"
+	EntityAudiogram          = "audiogram"
+	EntityVisionPrescription = "vision_prescription"
+)
+
+// nestedIDs is the number of ids of the events, or routes, of a workout.
+const nestedIDs = 1000000
+
+// NestedID returns the id of the n-th (0-based) event or route of a
+// workout, which stays the same across imports of the same export. The
+// workout id is entity_id / 1000000.
+func NestedID(workoutID int64, n int) int64 {
+	return workoutID*nestedIDs + int64(n)
+}
+
+// MetadataRow is a parsed metadata entry of an entity, stored in the
+// metadata table.
+type MetadataRow struct {
+	Entity       string   `db:"entity"`
+	EntityID     int64    `db:"entity_id"`
+	Key          string   `db:"key"`
+	ValueText    string   `db:"value_text"`
+	ValueNumeric *float64 `db:"value_numeric"`
+	Unit         *string  `db:"unit"`
+}
+
+func MetadataRows(entity string, entityID int64, entries []MetadataEntry) []MetadataRow {
+	rows := make([]MetadataRow, len(entries))
+	for i, entry := range entries {
+		value := metadata.Parse(entry.Key, entry.Value)
+		rows[i] = MetadataRow{
+			Entity:       entity,
+			EntityID:     entityID,
+			Key:          entry.Key,
+			ValueText:    value.Text,
+			ValueNumeric: value.Numeric,
+		}
+		if value.Unit != "" {
+			rows[i].Unit = &value.Unit
+		}
+	}
+
+	return rows
+}
+
+func lookup(entries []MetadataEntry, key string) (metadata.Value, bool) {
+	for _, entry := range entries {
+		if entry.Key == key {
+			return metadata.Parse(entry.Key, entry.Value), true
+		}
+	}
+
+	return metadata.Value{}, false
+}
+
+func lookupBool(entries []MetadataEntry, key string) *bool {
+	value, ok := lookup(entries, key)
+	if !ok {
+		return nil
+	}
+	b, ok := value.Bool()
+	if !ok {
+		return nil
+	}
+
+	return &b
+}
+
+func lookupText(entries []MetadataEntry, key string) *string {
+	value, ok := lookup(entries, key)
+	if !ok || value.Text == "" {
+		return nil
+	}
+
+	return &value.Text
+}
+
+// PromoteMetadata copies the most used metadata entries into their own
+// columns.
+func (r *Record) PromoteMetadata() {
+	r.WasUserEntered = lookupBool(r.Metadata, metadata.WasUserEntered)
+	r.TimeZone = lookupText(r.Metadata, metadata.TimeZone)
+}
+
+// PromoteMetadata copies the most used metadata entries into their own
+// columns.
+func (w *Workout) PromoteMetadata() {
+	w.Indoor = lookupBool(w.Metadata, metadata.IndoorWorkout)
+	w.TimeZone = lookupText(w.Metadata, metadata.TimeZone)
+
+	if value, ok := lookup(w.Metadata, metadata.ElevationAscended); ok {
+		if meters, ok := value.Meters(); ok {
+			w.ElevationAscended = &meters
+		}
+	}
+	if value, ok := lookup(w.Metadata, metadata.AverageMETs); ok {
+		w.AverageMETs = value.Numeric
+	}
+}
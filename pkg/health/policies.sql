@@ -0,0 +1,26 @@
+-- Row level security: a database role only sees the rows of the persons
+-- whose role it is. Policies do not apply to superusers, nor to the owner
+-- of the tables, which keeps importing with the role that applied the
+-- schema. Recreating the tables with the schema removes the policies.
+ALTER TABLE persons ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS person_rows ON persons;
+CREATE POLICY person_rows ON persons USING (role = current_user);
+
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOR t IN
+        SELECT c.table_name
+        FROM information_schema.columns c
+        JOIN information_schema.tables USING (table_schema, table_name)
+        WHERE c.table_schema = current_schema()
+          AND c.column_name = 'person_id'
+          AND table_type = 'BASE TABLE'
+    LOOP
+        EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY', t);
+        EXECUTE format('DROP POLICY IF EXISTS person_rows ON %I', t);
+        EXECUTE format('CREATE POLICY person_rows ON %I USING (person_id IN (SELECT id FROM persons WHERE role = current_user))', t);
+    END LOOP;
+END
+$$;
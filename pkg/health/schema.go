@@ -1,8 +1,13 @@
 package health
 
-import "embed"
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"strings"
+)
 
-//go:embed schema.sql
+//go:embed schema.sql policies.sql
 var f embed.FS
 
 func Schema() (string, error) {
@@ -12,4 +17,173 @@ func Schema() (string, error) {
 	}
 
 	return string(data), nil
-}
\ No newline at end of file
+}
+
+// Policies returns the row level security policies that restrict every
+// table to the rows of the persons of the current database role.
+func Policies() (string, error) {
+	data, err := f.ReadFile("policies.sql")
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// Column is a column declared in schema.sql.
+type Column struct {
+	Name    string
+	Type    string // as found in information_schema.columns.data_type
+	NotNull bool
+}
+
+// Table is a table declared in schema.sql.
+type Table struct {
+	Name    string
+	Columns []Column
+}
+
+// Column returns the named column.
+func (t Table) Column(name string) (Column, bool) {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+
+	return Column{}, false
+}
+
+// dataTypes maps the types used in schema.sql to the names reported by
+// information_schema.
+var dataTypes = map[string]string{
+	"serial":  "integer",
+	"decimal": "numeric",
+}
+
+func normalizeType(declared string) string {
+	declared = strings.ToLower(declared)
+	if strings.HasSuffix(declared, "[]") {
+		return "ARRAY"
+	}
+	if name, ok := dataTypes[declared]; ok {
+		return name
+	}
+
+	return declared
+}
+
+var constraintKeywords = []string{" not null", " primary key", " default ", " references ", " unique"}
+
+func parseColumn(line string) Column {
+	name, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	lower := strings.ToLower(rest)
+
+	end := len(rest)
+	for _, keyword := range constraintKeywords {
+		if i := strings.Index(" "+lower, keyword); i >= 0 && i < end {
+			end = i
+		}
+	}
+
+	return Column{
+		Name:    name,
+		Type:    normalizeType(strings.TrimSpace(rest[:end])),
+		NotNull: strings.Contains(lower, "not null") || strings.Contains(lower, "primary key"),
+	}
+}
+
+// ParseSchema lists the tables created by a schema. It only understands the
+// subset of SQL used by schema.sql: one column per line and no table level
+// constraints.
+func ParseSchema(schema string) ([]Table, error) {
+	var tables []Table
+	var current *Table
+
+	scanner := bufio.NewScanner(strings.NewReader(schema))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "--"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if current == nil {
+			const prefix = "CREATE TABLE IF NOT EXISTS "
+			if strings.HasPrefix(line, prefix) {
+				name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, prefix), "("))
+				tables = append(tables, Table{Name: name})
+				current = &tables[len(tables)-1]
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, ")") {
+			current = nil
+			continue
+		}
+		current.Columns = append(current.Columns, parseColumn(strings.TrimSuffix(line, ",")))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanner.Err: %w", err)
+	}
+	if current != nil {
+		return nil, fmt.Errorf("schema: unterminated table %s", current.Name)
+	}
+
+	return tables, nil
+}
+
+// SchemaTables parses the embedded schema.
+func SchemaTables() ([]Table, error) {
+	schema, err := Schema()
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseSchema(schema)
+}
+
+// DiffSchema describes how the actual tables differ from the expected ones.
+// Tables that only exist in actual are ignored, as they may belong to
+// another application.
+func DiffSchema(expected, actual []Table) []string {
+	existing := make(map[string]Table, len(actual))
+	for _, table := range actual {
+		existing[table.Name] = table
+	}
+
+	var diff []string
+	for _, want := range expected {
+		got, ok := existing[want.Name]
+		if !ok {
+			diff = append(diff, fmt.Sprintf("missing table %s", want.Name))
+			continue
+		}
+
+		for _, column := range want.Columns {
+			gotColumn, ok := got.Column(column.Name)
+			if !ok {
+				diff = append(diff, fmt.Sprintf("missing column %s.%s %s", want.Name, column.Name, column.Type))
+				continue
+			}
+			if gotColumn.Type != column.Type {
+				diff = append(diff, fmt.Sprintf("column %s.%s is %s, expected %s", want.Name, column.Name, gotColumn.Type, column.Type))
+			}
+			if gotColumn.NotNull != column.NotNull {
+				diff = append(diff, fmt.Sprintf("column %s.%s has NOT NULL=%t, expected %t", want.Name, column.Name, gotColumn.NotNull, column.NotNull))
+			}
+		}
+		for _, column := range got.Columns {
+			if _, ok := want.Column(column.Name); !ok {
+				diff = append(diff, fmt.Sprintf("unexpected column %s.%s", want.Name, column.Name))
+			}
+		}
+	}
+
+	return diff
+}
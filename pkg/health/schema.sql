@@ -1,14 +1,4 @@
 DROP TYPE IF EXISTS workout_statistics_t;
-CREATE TYPE workout_statistics_t AS (
-    type       CHARACTER VARYING,
-    start_date TIMESTAMP WITH TIME ZONE,
-    end_date   TIMESTAMP WITH TIME ZONE,
-    average    CHARACTER VARYING,
-    minimum    CHARACTER VARYING,
-    maximum    CHARACTER VARYING,
-    sum        DECIMAL,
-    unit       CHARACTER VARYING
-);
 
 DROP TYPE IF EXISTS metadata_t;
 CREATE TYPE metadata_t AS (
@@ -16,9 +6,66 @@ CREATE TYPE metadata_t AS (
     value CHARACTER VARYING
 );
 
+-- the people whose exports are imported. Every other table has a person_id
+-- column referencing them, so removing a person removes their rows. role is
+-- the database role that sees the rows of the person once the row level
+-- security policies of policies.sql are applied.
+DROP TABLE IF EXISTS persons CASCADE;
+CREATE TABLE IF NOT EXISTS persons (
+    id         SERIAL PRIMARY KEY,
+    name       CHARACTER VARYING NOT NULL,
+    role       CHARACTER VARYING,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS persons_name_idx ON persons (name);
+
+-- health_person is the id of the person named by the health.person setting,
+-- else of the default person, for queries scoped with
+-- WHERE person_id = health_person().
+CREATE OR REPLACE FUNCTION health_person() RETURNS INTEGER AS $$
+    SELECT id FROM persons
+    WHERE name = coalesce(nullif(current_setting('health.person', true), ''), 'default')
+$$ LANGUAGE sql STABLE;
+
+DROP TABLE IF EXISTS imports;
+CREATE TABLE IF NOT EXISTS imports (
+    id          SERIAL PRIMARY KEY,
+    person_id   INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    started_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE, -- null while running or if it failed
+    input       CHARACTER VARYING,
+    filters     JSONB, -- null for a full import
+    row_counts  JSONB
+);
+
+DROP TABLE IF EXISTS me;
+CREATE TABLE IF NOT EXISTS me (
+    person_id                      INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    date_of_birth                  CHARACTER VARYING, -- 2006-01-02
+    biological_sex                 CHARACTER VARYING, -- HKBiologicalSexFemale...
+    blood_type                     CHARACTER VARYING,
+    fitzpatrick_skin_type          CHARACTER VARYING,
+    cardio_fitness_medications_use CHARACTER VARYING
+);
+
+DROP TABLE IF EXISTS metadata;
+CREATE TABLE IF NOT EXISTS metadata (
+    person_id     INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    entity        CHARACTER VARYING NOT NULL, -- record, workout, correlation, workout_event, workout_route, audiogram or vision_prescription
+    entity_id     BIGINT NOT NULL,
+    key           CHARACTER VARYING NOT NULL,
+    value_text    CHARACTER VARYING NOT NULL,
+    value_numeric DOUBLE PRECISION,
+    unit          CHARACTER VARYING
+);
+CREATE INDEX IF NOT EXISTS metadata_entity_idx ON metadata (entity, entity_id);
+CREATE INDEX IF NOT EXISTS metadata_key_idx ON metadata (key);
+CREATE INDEX IF NOT EXISTS metadata_person_id_idx ON metadata (person_id);
+
 DROP TABLE IF EXISTS records;
 CREATE TABLE IF NOT EXISTS records (
     id             SERIAL PRIMARY KEY,
+    person_id      INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
     type           CHARACTER VARYING NOT NULL,
     unit           CHARACTER VARYING,
     value          CHARACTER VARYING,
@@ -28,13 +75,93 @@ CREATE TABLE IF NOT EXISTS records (
     creation_date  TIMESTAMP WITH TIME ZONE,
     start_date     TIMESTAMP WITH TIME ZONE NOT NULL,
     end_date       TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    was_user_entered BOOLEAN,           -- HKWasUserEntered
+    time_zone        CHARACTER VARYING, -- HKTimeZone
+
     metadata       JSONB,
     hrv            JSONB
 );
+CREATE INDEX IF NOT EXISTS records_type_idx ON records (person_id, type, id);
+
+-- records without the samples hidden by a source with a higher priority,
+-- see pkg/dedup. value is the part of the record that is not hidden.
+DROP TABLE IF EXISTS records_deduplicated;
+CREATE TABLE IF NOT EXISTS records_deduplicated (
+    record_id   INTEGER PRIMARY KEY,
+    person_id   INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    type        CHARACTER VARYING NOT NULL,
+    source_name CHARACTER VARYING NOT NULL,
+    unit        CHARACTER VARYING,
+    start_date  TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_date    TIMESTAMP WITH TIME ZONE NOT NULL,
+    value       DOUBLE PRECISION NOT NULL,
+    fraction    DOUBLE PRECISION NOT NULL
+);
+CREATE INDEX IF NOT EXISTS records_deduplicated_type_idx ON records_deduplicated (person_id, type, start_date);
+
+DROP TABLE IF EXISTS correlations;
+CREATE TABLE IF NOT EXISTS correlations (
+    id             SERIAL PRIMARY KEY,
+    person_id      INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    type           CHARACTER VARYING NOT NULL,
+    source_name    CHARACTER VARYING NOT NULL,
+    source_version CHARACTER VARYING,
+    device         CHARACTER VARYING,
+    creation_date  TIMESTAMP WITH TIME ZONE,
+    start_date     TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_date       TIMESTAMP WITH TIME ZONE NOT NULL,
+    metadata       JSONB,
+    records        JSONB
+);
+
+-- HKCorrelationTypeIdentifierBloodPressure correlations
+DROP TABLE IF EXISTS blood_pressure_readings;
+CREATE TABLE IF NOT EXISTS blood_pressure_readings (
+    person_id   INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    source_name CHARACTER VARYING NOT NULL,
+    device      CHARACTER VARYING,
+    start_date  TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_date    TIMESTAMP WITH TIME ZONE NOT NULL,
+    time_zone   CHARACTER VARYING, -- HKTimeZone
+    systolic    DOUBLE PRECISION,  -- mmHg
+    diastolic   DOUBLE PRECISION,  -- mmHg
+    pulse       DOUBLE PRECISION   -- count/min, from the correlation or a heart rate record of the source
+);
+CREATE INDEX IF NOT EXISTS blood_pressure_readings_start_date_idx ON blood_pressure_readings (person_id, start_date);
+
+-- HKCorrelationTypeIdentifierFood correlations, with their dietary records
+-- converted to the unit of their column. nutrients lists every dietary
+-- record as {type, value, unit}.
+DROP TABLE IF EXISTS meals;
+CREATE TABLE IF NOT EXISTS meals (
+    person_id       INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    source_name     CHARACTER VARYING NOT NULL,
+    device          CHARACTER VARYING,
+    start_date      TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_date        TIMESTAMP WITH TIME ZONE NOT NULL,
+    time_zone       CHARACTER VARYING, -- HKTimeZone
+    food            CHARACTER VARYING, -- HKFoodType
+    meal            CHARACTER VARYING, -- from a "meal" metadata key
+    energy_kcal     DOUBLE PRECISION,
+    protein_g       DOUBLE PRECISION,
+    carbohydrates_g DOUBLE PRECISION,
+    fat_total_g     DOUBLE PRECISION,
+    fat_saturated_g DOUBLE PRECISION,
+    fiber_g         DOUBLE PRECISION,
+    sugar_g         DOUBLE PRECISION,
+    sodium_mg       DOUBLE PRECISION,
+    cholesterol_mg  DOUBLE PRECISION,
+    caffeine_mg     DOUBLE PRECISION,
+    water_ml        DOUBLE PRECISION,
+    nutrients       JSONB
+);
+CREATE INDEX IF NOT EXISTS meals_start_date_idx ON meals (person_id, start_date);
 
 DROP TABLE IF EXISTS workouts;
 CREATE TABLE IF NOT EXISTS workouts (
     id                       SERIAL PRIMARY KEY,
+    person_id                INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
     workout_activity_type    CHARACTER VARYING NOT NULL,
     duration                 DECIMAL,
     duration_unit            CHARACTER VARYING,
@@ -49,14 +176,188 @@ CREATE TABLE IF NOT EXISTS workouts (
     start_date               TIMESTAMP WITH TIME ZONE,
     end_date                 TIMESTAMP WITH TIME ZONE,
 
+    indoor             BOOLEAN,           -- HKIndoorWorkout
+    time_zone          CHARACTER VARYING, -- HKTimeZone
+    elevation_ascended DOUBLE PRECISION,  -- HKElevationAscended, in meters
+    average_mets       DOUBLE PRECISION,  -- HKAverageMETs
+
     metadata           JSONB,  -- array of metadata_t
     workout_events     JSONB,
     workout_routes     JSONB,
-    workout_statistics JSONB   -- array of workout_statistics_t
+    workout_statistics JSONB
+);
+
+DROP TABLE IF EXISTS workout_statistics;
+CREATE TABLE IF NOT EXISTS workout_statistics (
+    person_id  INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    workout_id INTEGER NOT NULL,
+    type       CHARACTER VARYING NOT NULL,
+    start_date TIMESTAMP WITH TIME ZONE,
+    end_date   TIMESTAMP WITH TIME ZONE,
+    average    DOUBLE PRECISION,
+    minimum    DOUBLE PRECISION,
+    maximum    DOUBLE PRECISION,
+    sum        DOUBLE PRECISION,
+    unit       CHARACTER VARYING
+);
+CREATE INDEX IF NOT EXISTS workout_statistics_workout_id_idx ON workout_statistics (workout_id);
+
+DROP TABLE IF EXISTS workout_events;
+CREATE TABLE IF NOT EXISTS workout_events (
+    id               BIGINT PRIMARY KEY, -- see health.NestedID
+    person_id        INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    workout_id       INTEGER NOT NULL,
+    type             CHARACTER VARYING NOT NULL, -- HKWorkoutEventTypePause, Resume, Lap, Segment, Marker...
+    date             TIMESTAMP WITH TIME ZONE,
+    duration         DOUBLE PRECISION,
+    duration_unit    CHARACTER VARYING,
+    duration_seconds DOUBLE PRECISION,
+    metadata         JSONB
+);
+CREATE INDEX IF NOT EXISTS workout_events_workout_id_idx ON workout_events (workout_id);
+
+-- trackpoints of the GPX files of workout routes, see pkg/route
+DROP TABLE IF EXISTS workout_route_points;
+CREATE TABLE IF NOT EXISTS workout_route_points (
+    person_id           INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    workout_id          INTEGER NOT NULL,
+    seq                 INTEGER NOT NULL,
+    time                TIMESTAMP WITH TIME ZONE,
+    latitude            DOUBLE PRECISION NOT NULL,
+    longitude           DOUBLE PRECISION NOT NULL,
+    elevation           DOUBLE PRECISION, -- meters
+    speed               DOUBLE PRECISION, -- meters per second
+    course              DOUBLE PRECISION, -- degrees
+    horizontal_accuracy DOUBLE PRECISION, -- meters
+    vertical_accuracy   DOUBLE PRECISION  -- meters
+);
+CREATE UNIQUE INDEX IF NOT EXISTS workout_route_points_workout_id_idx ON workout_route_points (workout_id, seq);
+CREATE INDEX IF NOT EXISTS workout_route_points_person_id_idx ON workout_route_points (person_id);
+
+DROP TABLE IF EXISTS workouts_deduplicated;
+CREATE TABLE IF NOT EXISTS workouts_deduplicated (
+    workout_id            INTEGER PRIMARY KEY,
+    person_id             INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    workout_activity_type CHARACTER VARYING NOT NULL,
+    source_name           CHARACTER VARYING NOT NULL,
+    start_date            TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_date              TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- nights of sleep built from the HKCategoryTypeIdentifierSleepAnalysis
+-- records of a single source, see pkg/sleep. night is the day the night
+-- starts, in the time zone of the records.
+DROP TABLE IF EXISTS sleep_sessions;
+CREATE TABLE IF NOT EXISTS sleep_sessions (
+    id                  SERIAL PRIMARY KEY,
+    person_id           INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    night               DATE NOT NULL,
+    source_name         CHARACTER VARYING NOT NULL,
+    bed_time            TIMESTAMP WITH TIME ZONE NOT NULL,
+    wake_time           TIMESTAMP WITH TIME ZONE NOT NULL,
+    in_bed_seconds      INTEGER NOT NULL,
+    asleep_seconds      INTEGER NOT NULL,
+    awake_seconds       INTEGER NOT NULL,
+    core_seconds        INTEGER NOT NULL,
+    deep_seconds        INTEGER NOT NULL,
+    rem_seconds         INTEGER NOT NULL,
+    unspecified_seconds INTEGER NOT NULL, -- asleep without a stage
+    awakenings          INTEGER NOT NULL,
+    efficiency          DOUBLE PRECISION NOT NULL -- asleep / in bed
+);
+CREATE INDEX IF NOT EXISTS sleep_sessions_night_idx ON sleep_sessions (person_id, night);
+
+DROP TABLE IF EXISTS sleep_stages;
+CREATE TABLE IF NOT EXISTS sleep_stages (
+    person_id        INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    session_id       INTEGER NOT NULL,
+    record_id        INTEGER NOT NULL,
+    stage            CHARACTER VARYING NOT NULL, -- in_bed, awake, asleep, core, deep or rem
+    start_date       TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_date         TIMESTAMP WITH TIME ZONE NOT NULL,
+    duration_seconds INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sleep_stages_session_id_idx ON sleep_stages (session_id);
+
+-- per day and per week aggregates of records_deduplicated, see pkg/rollup.
+-- Days are local to the time zone of the records. Cumulative types only
+-- have a sum, other types only min, avg, max and last.
+DROP TABLE IF EXISTS daily_metrics;
+CREATE TABLE IF NOT EXISTS daily_metrics (
+    person_id INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    day       DATE NOT NULL,
+    type      CHARACTER VARYING NOT NULL,
+    unit      CHARACTER VARYING NOT NULL,
+    samples   INTEGER NOT NULL,
+    sum       DOUBLE PRECISION,
+    min       DOUBLE PRECISION,
+    avg       DOUBLE PRECISION,
+    max       DOUBLE PRECISION,
+    last      DOUBLE PRECISION,
+    last_date TIMESTAMP WITH TIME ZONE NOT NULL, -- start of the last sample
+    import_id INTEGER -- the import the day was rolled up from
+);
+CREATE UNIQUE INDEX IF NOT EXISTS daily_metrics_type_idx ON daily_metrics (person_id, type, day, unit);
+CREATE INDEX IF NOT EXISTS daily_metrics_day_idx ON daily_metrics (person_id, day);
+
+DROP TABLE IF EXISTS weekly_metrics;
+CREATE TABLE IF NOT EXISTS weekly_metrics (
+    person_id INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    week      DATE NOT NULL, -- Monday
+    type      CHARACTER VARYING NOT NULL,
+    unit      CHARACTER VARYING NOT NULL,
+    days      INTEGER NOT NULL, -- days with samples
+    samples   INTEGER NOT NULL,
+    sum       DOUBLE PRECISION,
+    min       DOUBLE PRECISION,
+    avg       DOUBLE PRECISION,
+    max       DOUBLE PRECISION,
+    last      DOUBLE PRECISION
+);
+CREATE UNIQUE INDEX IF NOT EXISTS weekly_metrics_type_idx ON weekly_metrics (person_id, type, week, unit);
+CREATE INDEX IF NOT EXISTS weekly_metrics_week_idx ON weekly_metrics (person_id, week);
+
+-- heart rate zones and TRIMP (Banister's training impulse) of the
+-- deduplicated workouts with heart rate records, see pkg/training. Zones
+-- start at 50, 60, 70, 80 and 90% of max_hr, or of the heart rate reserve
+-- with karvonen; zone 0 is below zone 1.
+DROP TABLE IF EXISTS workout_hr_zones;
+CREATE TABLE IF NOT EXISTS workout_hr_zones (
+    workout_id    INTEGER PRIMARY KEY,
+    person_id     INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    max_hr        DOUBLE PRECISION NOT NULL,
+    resting_hr    DOUBLE PRECISION NOT NULL,
+    karvonen      BOOLEAN NOT NULL,
+    zone0_seconds DOUBLE PRECISION NOT NULL,
+    zone1_seconds DOUBLE PRECISION NOT NULL,
+    zone2_seconds DOUBLE PRECISION NOT NULL,
+    zone3_seconds DOUBLE PRECISION NOT NULL,
+    zone4_seconds DOUBLE PRECISION NOT NULL,
+    zone5_seconds DOUBLE PRECISION NOT NULL,
+    average_hr    DOUBLE PRECISION NOT NULL,
+    trimp         DOUBLE PRECISION NOT NULL
 );
 
+-- daily TRIMP of the workouts, from the first to the last workout day.
+-- acute_load and chronic_load average the last 7 and 28 days; monotony and
+-- strain (Foster) are null when the last 7 days did not vary.
+DROP TABLE IF EXISTS training_load;
+CREATE TABLE IF NOT EXISTS training_load (
+    person_id    INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    day          DATE NOT NULL,
+    workouts     INTEGER NOT NULL,
+    trimp        DOUBLE PRECISION NOT NULL,
+    acute_load   DOUBLE PRECISION NOT NULL,
+    chronic_load DOUBLE PRECISION NOT NULL,
+    acwr         DOUBLE PRECISION, -- acute / chronic
+    monotony     DOUBLE PRECISION,
+    strain       DOUBLE PRECISION
+);
+CREATE UNIQUE INDEX IF NOT EXISTS training_load_day_idx ON training_load (person_id, day);
+
 DROP TABLE IF EXISTS activity_summaries;
 CREATE TABLE IF NOT EXISTS activity_summaries (
+    person_id                 INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
     date_components           CHARACTER VARYING,
     active_energy_burned      CHARACTER VARYING,
     active_energy_burned_goal CHARACTER VARYING,
@@ -71,6 +372,7 @@ CREATE TABLE IF NOT EXISTS activity_summaries (
 
 DROP TABLE IF EXISTS clinical_records;
 CREATE TABLE IF NOT EXISTS clinical_records (
+    person_id          INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
     type               CHARACTER VARYING,
     identifier         CHARACTER VARYING,
     source_name        CHARACTER VARYING,
@@ -82,13 +384,15 @@ CREATE TABLE IF NOT EXISTS clinical_records (
 
 DROP TABLE IF EXISTS audiograms;
 CREATE TABLE IF NOT EXISTS audiograms (
-    type          CHARACTER VARYING NOT NULL,
-    sourceName    CHARACTER VARYING NOT NULL,
-    sourceVersion CHARACTER VARYING,
-    device        CHARACTER VARYING,
-    creationDate  TIMESTAMP WITH TIME ZONE,
-    startDate     TIMESTAMP WITH TIME ZONE NOT NULL,
-    endDate       TIMESTAMP WITH TIME ZONE NOT NULL,
+    id             SERIAL PRIMARY KEY,
+    person_id      INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    type           CHARACTER VARYING NOT NULL,
+    source_name    CHARACTER VARYING NOT NULL,
+    source_version CHARACTER VARYING,
+    device         CHARACTER VARYING,
+    creation_date  TIMESTAMP WITH TIME ZONE,
+    start_date     TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_date       TIMESTAMP WITH TIME ZONE NOT NULL,
 
     metadata           JSONB,
     sensitivity_points JSONB
@@ -96,13 +400,161 @@ CREATE TABLE IF NOT EXISTS audiograms (
 
 DROP TABLE IF EXISTS vision_prescriptions;
 CREATE TABLE IF NOT EXISTS vision_prescriptions (
-    type             CHARACTER VARYING NOT NULL,
-    dateIssued       CHARACTER VARYING NOT NULL,
-    expirationDate   CHARACTER VARYING,
-    brand            CHARACTER VARYING,
-
-    metadata    JSONB,
-    right_eye   JSONB,
-    left_eye    JSONB,
-    attachments JSONB
-);
\ No newline at end of file
+    id              SERIAL PRIMARY KEY,
+    person_id       INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    type            CHARACTER VARYING NOT NULL,
+    date_issued     CHARACTER VARYING NOT NULL,
+    expiration_date CHARACTER VARYING,
+    brand           CHARACTER VARYING,
+
+    metadata   JSONB,
+    right_eye  JSONB,
+    left_eye   JSONB,
+    attachment JSONB
+);
+
+DROP TABLE IF EXISTS clinical_resources;
+CREATE TABLE IF NOT EXISTS clinical_resources (
+    person_id     INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    identifier    CHARACTER VARYING NOT NULL,
+    fhir_version  CHARACTER VARYING,
+    resource_id   CHARACTER VARYING,
+    resource_type CHARACTER VARYING NOT NULL,
+    file_path     CHARACTER VARYING NOT NULL,
+    resource      JSONB NOT NULL
+);
+
+DROP TABLE IF EXISTS fhir_observations;
+CREATE TABLE IF NOT EXISTS fhir_observations (
+    person_id      INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    identifier     CHARACTER VARYING NOT NULL,
+    fhir_version   CHARACTER VARYING,
+    resource_id    CHARACTER VARYING,
+    code_system    CHARACTER VARYING,
+    code           CHARACTER VARYING,
+    display        CHARACTER VARYING,
+    status         CHARACTER VARYING,
+    category       CHARACTER VARYING,
+    value_numeric  DOUBLE PRECISION,
+    value_unit     CHARACTER VARYING,
+    value_text     CHARACTER VARYING,
+    reference_low  DOUBLE PRECISION,
+    reference_high DOUBLE PRECISION,
+    effective_date TIMESTAMP WITH TIME ZONE,
+    issued         TIMESTAMP WITH TIME ZONE
+);
+
+DROP TABLE IF EXISTS fhir_conditions;
+CREATE TABLE IF NOT EXISTS fhir_conditions (
+    person_id           INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    identifier          CHARACTER VARYING NOT NULL,
+    fhir_version        CHARACTER VARYING,
+    resource_id         CHARACTER VARYING,
+    code_system         CHARACTER VARYING,
+    code                CHARACTER VARYING,
+    display             CHARACTER VARYING,
+    clinical_status     CHARACTER VARYING,
+    verification_status CHARACTER VARYING,
+    onset_date          TIMESTAMP WITH TIME ZONE,
+    recorded_date       TIMESTAMP WITH TIME ZONE
+);
+
+DROP TABLE IF EXISTS fhir_medications;
+CREATE TABLE IF NOT EXISTS fhir_medications (
+    person_id       INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    identifier      CHARACTER VARYING NOT NULL,
+    fhir_version    CHARACTER VARYING,
+    resource_id     CHARACTER VARYING,
+    code_system     CHARACTER VARYING,
+    code            CHARACTER VARYING,
+    display         CHARACTER VARYING,
+    resource_type   CHARACTER VARYING NOT NULL, -- MedicationRequest, MedicationOrder (DSTU2) or MedicationStatement
+    status          CHARACTER VARYING,
+    dosage          CHARACTER VARYING,
+    authored_date   TIMESTAMP WITH TIME ZONE,
+    effective_start TIMESTAMP WITH TIME ZONE,
+    effective_end   TIMESTAMP WITH TIME ZONE
+);
+
+DROP TABLE IF EXISTS fhir_immunizations;
+CREATE TABLE IF NOT EXISTS fhir_immunizations (
+    person_id       INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    identifier      CHARACTER VARYING NOT NULL,
+    fhir_version    CHARACTER VARYING,
+    resource_id     CHARACTER VARYING,
+    code_system     CHARACTER VARYING,
+    code            CHARACTER VARYING,
+    display         CHARACTER VARYING,
+    status          CHARACTER VARYING,
+    occurrence_date TIMESTAMP WITH TIME ZONE
+);
+
+DROP TABLE IF EXISTS fhir_allergies;
+CREATE TABLE IF NOT EXISTS fhir_allergies (
+    person_id       INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    identifier      CHARACTER VARYING NOT NULL,
+    fhir_version    CHARACTER VARYING,
+    resource_id     CHARACTER VARYING,
+    code_system     CHARACTER VARYING,
+    code            CHARACTER VARYING,
+    display         CHARACTER VARYING,
+    clinical_status CHARACTER VARYING,
+    criticality     CHARACTER VARYING,
+    onset_date      TIMESTAMP WITH TIME ZONE,
+    recorded_date   TIMESTAMP WITH TIME ZONE
+);
+
+DROP TABLE IF EXISTS fhir_procedures;
+CREATE TABLE IF NOT EXISTS fhir_procedures (
+    person_id       INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    identifier      CHARACTER VARYING NOT NULL,
+    fhir_version    CHARACTER VARYING,
+    resource_id     CHARACTER VARYING,
+    code_system     CHARACTER VARYING,
+    code            CHARACTER VARYING,
+    display         CHARACTER VARYING,
+    status          CHARACTER VARYING,
+    performed_start TIMESTAMP WITH TIME ZONE,
+    performed_end   TIMESTAMP WITH TIME ZONE
+);
+
+DROP TABLE IF EXISTS fhir_diagnostic_reports;
+CREATE TABLE IF NOT EXISTS fhir_diagnostic_reports (
+    person_id      INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    identifier     CHARACTER VARYING NOT NULL,
+    fhir_version   CHARACTER VARYING,
+    resource_id    CHARACTER VARYING,
+    code_system    CHARACTER VARYING,
+    code           CHARACTER VARYING,
+    display        CHARACTER VARYING,
+    status         CHARACTER VARYING,
+    category       CHARACTER VARYING,
+    conclusion     CHARACTER VARYING,
+    effective_date TIMESTAMP WITH TIME ZONE,
+    issued         TIMESTAMP WITH TIME ZONE
+);
+
+DROP TABLE IF EXISTS ecg_recordings;
+CREATE TABLE IF NOT EXISTS ecg_recordings (
+    id               SERIAL PRIMARY KEY,
+    person_id        INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    record_id        INTEGER, -- matching HKDataTypeIdentifierElectrocardiogram record
+    file_name        CHARACTER VARYING NOT NULL,
+    name             CHARACTER VARYING,
+    date_of_birth    CHARACTER VARYING,
+    recorded_date    TIMESTAMP WITH TIME ZONE NOT NULL,
+    classification   CHARACTER VARYING,
+    symptoms         CHARACTER VARYING,
+    software_version CHARACTER VARYING,
+    device           CHARACTER VARYING,
+    sample_rate      DOUBLE PRECISION,
+    lead             CHARACTER VARYING,
+    unit             CHARACTER VARYING
+);
+
+DROP TABLE IF EXISTS ecg_samples;
+CREATE TABLE IF NOT EXISTS ecg_samples (
+    recording_id INTEGER PRIMARY KEY,
+    person_id    INTEGER NOT NULL REFERENCES persons (id) ON DELETE CASCADE,
+    samples      REAL[] NOT NULL
+);
@@ -0,0 +1,96 @@
+package health
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSchema(t *testing.T) {
+	const schema = `
+DROP TABLE IF EXISTS foo;
+CREATE TABLE IF NOT EXISTS foo (
+    id      SERIAL PRIMARY KEY,
+    name    CHARACTER VARYING NOT NULL, -- a comment
+    amount  DECIMAL,
+    samples REAL[] NOT NULL,
+    seen    TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS foo_name_idx ON foo (name);
+`
+
+	tables, err := ParseSchema(schema)
+	if err != nil {
+		t.Fatalf("ParseSchema: %v", err)
+	}
+
+	expected := []Table{{
+		Name: "foo",
+		Columns: []Column{
+			{Name: "id", Type: "integer", NotNull: true},
+			{Name: "name", Type: "character varying", NotNull: true},
+			{Name: "amount", Type: "numeric"},
+			{Name: "samples", Type: "ARRAY", NotNull: true},
+			{Name: "seen", Type: "timestamp with time zone"},
+		},
+	}}
+	if !reflect.DeepEqual(tables, expected) {
+		t.Errorf("expected %#v, got %#v", expected, tables)
+	}
+
+	if _, err := ParseSchema("CREATE TABLE IF NOT EXISTS foo (\n id INTEGER\n"); err == nil {
+		t.Errorf("expected error on an unterminated table")
+	}
+}
+
+func TestSchemaTables(t *testing.T) {
+	tables, err := SchemaTables()
+	if err != nil {
+		t.Fatalf("SchemaTables: %v", err)
+	}
+
+	for _, table := range tables {
+		if len(table.Columns) == 0 {
+			t.Errorf("table %s has no columns", table.Name)
+		}
+		if column, ok := table.Column("person_id"); table.Name != "persons" && (!ok || !column.NotNull) {
+			t.Errorf("table %s has no person_id column", table.Name)
+		}
+	}
+	if len(tables) == 0 {
+		t.Errorf("expected the embedded schema to declare tables")
+	}
+}
+
+func TestDiffSchema(t *testing.T) {
+	expected := []Table{
+		{Name: "foo", Columns: []Column{
+			{Name: "id", Type: "integer", NotNull: true},
+			{Name: "name", Type: "character varying"},
+			{Name: "amount", Type: "numeric"},
+		}},
+		{Name: "bar", Columns: []Column{{Name: "id", Type: "integer"}}},
+	}
+	actual := []Table{
+		{Name: "foo", Columns: []Column{
+			{Name: "id", Type: "integer", NotNull: true},
+			{Name: "name", Type: "text"},
+			{Name: "old", Type: "integer"},
+		}},
+		{Name: "unrelated", Columns: []Column{{Name: "id", Type: "integer"}}},
+	}
+
+	diff := DiffSchema(expected, actual)
+	want := []string{
+		"column foo.name is text, expected character varying",
+		"missing column foo.amount numeric",
+		"unexpected column foo.old",
+		"missing table bar",
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("expected %#v, got %#v", want, diff)
+	}
+
+	if diff := DiffSchema(expected, expected); len(diff) != 0 {
+		t.Errorf("expected no difference, got %#v", diff)
+	}
+}
@@ -3,35 +3,70 @@ package health
 import (
 	"database/sql/driver"
 	"encoding/xml"
+	"fmt"
 	"time"
 )
 
+// TimeLayout is the layout of every date in an export.
+const TimeLayout = "2006-01-02 15:04:05 -0700"
+
 type HealthTime time.Time
 
 func (t *HealthTime) UnmarshalXMLAttr(attr xml.Attr) error {
-	parsed, err := time.Parse("2006-01-02 15:04:05 -0700", attr.Value)
+	parsed, err := time.Parse(TimeLayout, attr.Value)
 	if err != nil {
 		return err
 	}
 	*t = HealthTime(parsed)
 	return nil
 }
+
+// MarshalXMLAttr writes the time in TimeLayout, keeping its offset. A nil
+// time is left out.
+func (t *HealthTime) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	if t == nil {
+		return xml.Attr{}, nil
+	}
+	return xml.Attr{Name: name, Value: time.Time(*t).Format(TimeLayout)}, nil
+}
 func (t HealthTime) String() string {
 	return time.Time(t).String()
 }
 func (t HealthTime) Value() (driver.Value, error) {
 	return time.Time(t), nil
 }
+func (t *HealthTime) Scan(src any) error {
+	parsed, ok := src.(time.Time)
+	if !ok {
+		return fmt.Errorf("HealthTime: cannot scan %T", src)
+	}
+	*t = HealthTime(parsed)
+	return nil
+}
 func (t HealthTime) MarshalJSON() ([]byte, error) {
 	return time.Time(t).MarshalJSON()
 }
+func (t *HealthTime) UnmarshalJSON(data []byte) error {
+	var parsed time.Time
+	if err := parsed.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*t = HealthTime(parsed)
+	return nil
+}
 
+// ExportDate is the date an export was made.
+type ExportDate struct {
+	Value *HealthTime `xml:"value,attr"`
+}
+
+// Me holds the characteristics of the user.
 type Me struct {
-	DateOfBirth                 string `xml:"HKCharacteristicTypeIdentifierDateOfBirth,attr"`
-	BiologicalSex               string `xml:"HKCharacteristicTypeIdentifierBiologicalSex,attr"`
-	BloodType                   string `xml:"HKCharacteristicTypeIdentifierBloodType,attr"`
-	FitzpatrickSkinType         string `xml:"HKCharacteristicTypeIdentifierFitzpatrickSkinType,attr"`
-	CardioFitnessMedicationsUse string `xml:"HKCharacteristicTypeIdentifierCardioFitnessMedicationsUse,attr"`
+	DateOfBirth                 *string `xml:"HKCharacteristicTypeIdentifierDateOfBirth,attr" db:"date_of_birth"`
+	BiologicalSex               *string `xml:"HKCharacteristicTypeIdentifierBiologicalSex,attr" db:"biological_sex"`
+	BloodType                   *string `xml:"HKCharacteristicTypeIdentifierBloodType,attr" db:"blood_type"`
+	FitzpatrickSkinType         *string `xml:"HKCharacteristicTypeIdentifierFitzpatrickSkinType,attr" db:"fitzpatrick_skin_type"`
+	CardioFitnessMedicationsUse *string `xml:"HKCharacteristicTypeIdentifierCardioFitnessMedicationsUse,attr" db:"cardio_fitness_medications_use"`
 }
 
 type MetadataEntry struct {
@@ -60,15 +95,20 @@ type Record struct {
 	StartDate     *HealthTime `xml:"startDate,attr" db:"start_date"` // required
 	EndDate       *HealthTime `xml:"endDate,attr" db:"end_date"`     // required
 
+	// promoted from metadata
+	WasUserEntered *bool   `xml:"-" db:"was_user_entered"`
+	TimeZone       *string `xml:"-" db:"time_zone"`
+
 	Metadata             []MetadataEntry                    `xml:"MetadataEntry" db:"metadata"`
 	HeartRateVariability []HeartRateVariabilityMetadataList `xml:"HeartRateVariabilityMetadataList" db:"hrv"`
 }
 
 type Correlation struct {
+	ID            int64       `xml:"-" db:"id"`
 	Type          string      `xml:"type,attr" db:"type"`              // required
 	SourceName    string      `xml:"sourceName,attr" db:"source_name"` // required
-	SourceVersion string      `xml:"sourceVersion,attr" db:"source_version"`
-	Device        string      `xml:"device,attr" db:"device"`
+	SourceVersion string      `xml:"sourceVersion,attr,omitempty" db:"source_version"`
+	Device        string      `xml:"device,attr,omitempty" db:"device"`
 	CreationDate  *HealthTime `xml:"creationDate,attr" db:"creation_date"`
 	StartDate     *HealthTime `xml:"startDate,attr" db:"start_date"` // required
 	EndDate       *HealthTime `xml:"endDate,attr" db:"end_date"`     // required
@@ -92,9 +132,9 @@ type FileReference struct {
 
 type WorkoutRoute struct {
 	SourceName    string `xml:"sourceName,attr" json:"source_name"` // required
-	SourceVersion string `xml:"sourceVersion,attr" json:"source_version,omitempty"`
-	Device        string `xml:"device,attr" json:"device,omitempty"`
-	CreationDate  string `xml:"creationDate,attr" json:"creation_date,omitempty"`
+	SourceVersion string `xml:"sourceVersion,attr,omitempty" json:"source_version,omitempty"`
+	Device        string `xml:"device,attr,omitempty" json:"device,omitempty"`
+	CreationDate  string `xml:"creationDate,attr,omitempty" json:"creation_date,omitempty"`
 	StartDate     string `xml:"startDate,attr" json:"start_date"` // required
 	EndDate       string `xml:"endDate,attr" json:"end_date"`     // required
 
@@ -114,21 +154,27 @@ type WorkoutStatistics struct {
 }
 
 type Workout struct {
-	ID                    int64       `db:"id"`
+	ID                    int64       `xml:"-" db:"id"`
 	WorkoutActivityType   string      `xml:"workoutActivityType,attr" db:"workout_activity_type"`
-	Duration              float64     `xml:"duration,attr" db:"duration"`
-	DurationUnit          string      `xml:"durationUnit,attr" db:"duration_unit"`
-	TotalDistance         string      `xml:"totalDistance,attr" db:"total_distance"`
-	TotalDistanceUnit     string      `xml:"totalDistanceUnit,attr" db:"total_distance_unit"`
-	TotalEnergyBurned     string      `xml:"totalEnergyBurned,attr" db:"total_energy_burned"`
-	TotalEnergyBurnedUnit string      `xml:"totalEnergyBurnedUnit,attr" db:"total_energy_burned_unit"`
+	Duration              float64     `xml:"duration,attr,omitempty" db:"duration"`
+	DurationUnit          string      `xml:"durationUnit,attr,omitempty" db:"duration_unit"`
+	TotalDistance         string      `xml:"totalDistance,attr,omitempty" db:"total_distance"`
+	TotalDistanceUnit     string      `xml:"totalDistanceUnit,attr,omitempty" db:"total_distance_unit"`
+	TotalEnergyBurned     string      `xml:"totalEnergyBurned,attr,omitempty" db:"total_energy_burned"`
+	TotalEnergyBurnedUnit string      `xml:"totalEnergyBurnedUnit,attr,omitempty" db:"total_energy_burned_unit"`
 	SourceName            string      `xml:"sourceName,attr" db:"source_name"`
-	SourceVersion         string      `xml:"sourceVersion,attr" db:"source_version"`
-	Device                string      `xml:"device,attr" db:"device"`
+	SourceVersion         string      `xml:"sourceVersion,attr,omitempty" db:"source_version"`
+	Device                string      `xml:"device,attr,omitempty" db:"device"`
 	CreationDate          *HealthTime `xml:"creationDate,attr" db:"creation_date"`
 	StartDate             *HealthTime `xml:"startDate,attr" db:"start_date"`
 	EndDate               *HealthTime `xml:"endDate,attr" db:"end_date"`
 
+	// promoted from metadata
+	Indoor            *bool    `xml:"-" db:"indoor"`
+	TimeZone          *string  `xml:"-" db:"time_zone"`
+	ElevationAscended *float64 `xml:"-" db:"elevation_ascended"` // meters
+	AverageMETs       *float64 `xml:"-" db:"average_mets"`
+
 	Metadata          []MetadataEntry     `xml:"MetadataEntry" db:"metadata,json"`
 	WorkoutEvent      []WorkoutEvent      `xml:"WorkoutEvent" db:"workout_events,json"`
 	WorkoutRoute      []WorkoutRoute      `xml:"WorkoutRoute" db:"workout_routes,json"`
@@ -136,26 +182,26 @@ type Workout struct {
 }
 
 type ActivitySummary struct {
-	DateComponents         *string `xml:"dateComponents" db:"date_components"`
-	ActiveEnergyBurned     *string `xml:"activeEnergyBurned" db:"active_energy_burned"`
-	ActiveEnergyBurnedGoal *string `xml:"activeEnergyBurnedGoal" db:"active_energy_burned_goal"`
-	ActiveEnergyBurnedUnit *string `xml:"activeEnergyBurnedUnit" db:"active_energy_burned_unit"`
-	AppleMoveTime          *string `xml:"appleMoveTime" db:"apple_move_time"`
-	AppleMoveTimeGoal      *string `xml:"appleMoveTimeGoal" db:"apple_move_time_goal"`
-	AppleExerciseTime      *string `xml:"appleExerciseTime" db:"apple_exercise_time"`
-	AppleExerciseTimeGoal  *string `xml:"appleExerciseTimeGoal" db:"apple_exercise_time_goal"`
-	AppleStandHours        *string `xml:"appleStandHours" db:"apple_stand_hours"`
-	AppleStandHoursGoal    *string `xml:"appleStandHoursGoal" db:"apple_stand_hours_goal"`
+	DateComponents         *string `xml:"dateComponents,attr" db:"date_components"`
+	ActiveEnergyBurned     *string `xml:"activeEnergyBurned,attr" db:"active_energy_burned"`
+	ActiveEnergyBurnedGoal *string `xml:"activeEnergyBurnedGoal,attr" db:"active_energy_burned_goal"`
+	ActiveEnergyBurnedUnit *string `xml:"activeEnergyBurnedUnit,attr" db:"active_energy_burned_unit"`
+	AppleMoveTime          *string `xml:"appleMoveTime,attr" db:"apple_move_time"`
+	AppleMoveTimeGoal      *string `xml:"appleMoveTimeGoal,attr" db:"apple_move_time_goal"`
+	AppleExerciseTime      *string `xml:"appleExerciseTime,attr" db:"apple_exercise_time"`
+	AppleExerciseTimeGoal  *string `xml:"appleExerciseTimeGoal,attr" db:"apple_exercise_time_goal"`
+	AppleStandHours        *string `xml:"appleStandHours,attr" db:"apple_stand_hours"`
+	AppleStandHoursGoal    *string `xml:"appleStandHoursGoal,attr" db:"apple_stand_hours_goal"`
 }
 
 type ClinicalRecord struct {
-	Type             *string `xml:"type" db:"type"`
-	Identifier       *string `xml:"identifier" db:"identifier"`
-	SourceName       *string `xml:"sourceName" db:"source_name"`
-	SourceURL        *string `xml:"sourceURL" db:"source_url"`
-	FhirVersion      *string `xml:"fhirVersion" db:"fhir_version"`
-	ReceivedDate     *string `xml:"receivedDate" db:"received_date"`
-	ResourceFilePath *string `xml:"resourceFilePath" db:"resource_file_path"`
+	Type             *string `xml:"type,attr" db:"type"`
+	Identifier       *string `xml:"identifier,attr" db:"identifier"`
+	SourceName       *string `xml:"sourceName,attr" db:"source_name"`
+	SourceURL        *string `xml:"sourceURL,attr" db:"source_url"`
+	FhirVersion      *string `xml:"fhirVersion,attr" db:"fhir_version"`
+	ReceivedDate     *string `xml:"receivedDate,attr" db:"received_date"`
+	ResourceFilePath *string `xml:"resourceFilePath,attr" db:"resource_file_path"`
 }
 
 type SensitivityPoint struct {
@@ -168,13 +214,14 @@ type SensitivityPoint struct {
 }
 
 type Audiogram struct {
-	Type          string      `xml:"type" db:"type"`
-	SourceName    string      `xml:"sourceName" db:"source_name"`
-	SourceVersion *string     `xml:"sourceVersion" db:"source_version"`
-	Device        *string     `xml:"device" db:"device"`
-	CreationDate  *HealthTime `xml:"creationDate" db:"creation_date,omitempty"`
-	StartDate     *HealthTime `xml:"startDate" db:"start_date"`
-	EndDate       *HealthTime `xml:"endDate" db:"end_date"`
+	ID            int64       `xml:"-" db:"id"`
+	Type          string      `xml:"type,attr" db:"type"`
+	SourceName    string      `xml:"sourceName,attr" db:"source_name"`
+	SourceVersion *string     `xml:"sourceVersion,attr" db:"source_version"`
+	Device        *string     `xml:"device,attr" db:"device"`
+	CreationDate  *HealthTime `xml:"creationDate,attr" db:"creation_date,omitempty"`
+	StartDate     *HealthTime `xml:"startDate,attr" db:"start_date"`
+	EndDate       *HealthTime `xml:"endDate,attr" db:"end_date"`
 
 	Metadata         []MetadataEntry    `xml:"MetadataEntry" db:"metadata,json"`
 	SensitivityPoint []SensitivityPoint `xml:"SensitivityPoint" db:"sensitivity_points,json"`
@@ -206,14 +253,15 @@ type Eye struct {
 }
 
 type Attachment struct {
-	Identifier *string `xml:"identifier" json:"identifier,omitempty"`
+	Identifier *string `xml:"identifier,attr" json:"identifier,omitempty"`
 }
 
 type VisionPrescription struct {
-	Type           string  `xml:"type" db:"type"`
-	DateIssued     string  `xml:"dateIssued" db:"date_issued"`
-	ExpirationDate *string `xml:"expirationDate" db:"expiration_date"`
-	Brand          *string `xml:"brand" db:"brand"`
+	ID             int64   `xml:"-" db:"id"`
+	Type           string  `xml:"type,attr" db:"type"`
+	DateIssued     string  `xml:"dateIssued,attr" db:"date_issued"`
+	ExpirationDate *string `xml:"expirationDate,attr" db:"expiration_date"`
+	Brand          *string `xml:"brand,attr" db:"brand"`
 
 	Metadata   []MetadataEntry `xml:"MetadataEntry" db:"metadata,json"`
 	RightEye   []Eye           `xml:"RightEye" db:"right_eye,json"`
@@ -222,7 +270,8 @@ type VisionPrescription struct {
 }
 
 type HealthData struct {
-	ExportDate         string               `xml:"ExportDate"`
+	Locale             string               `xml:"locale,attr"`
+	ExportDate         ExportDate           `xml:"ExportDate"`
 	Me                 Me                   `xml:"Me"`
 	Records            []Record             `xml:"Record"`
 	Correlations       []Correlation        `xml:"Correlation"`
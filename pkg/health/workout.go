@@ -0,0 +1,139 @@
+package health
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// WorkoutStatisticsRow is a WorkoutStatistics entry with numeric values,
+// stored in the workout_statistics table.
+type WorkoutStatisticsRow struct {
+	WorkoutID int64       `db:"workout_id"`
+	Type      string      `db:"type"`
+	StartDate *HealthTime `db:"start_date"`
+	EndDate   *HealthTime `db:"end_date"`
+	Average   *float64    `db:"average"`
+	Minimum   *float64    `db:"minimum"`
+	Maximum   *float64    `db:"maximum"`
+	Sum       *float64    `db:"sum"`
+	Unit      *string     `db:"unit"`
+}
+
+// WorkoutEventRow is a WorkoutEvent (pause, resume, lap, segment, marker...)
+// with a parsed date and its duration converted to seconds, stored in the
+// workout_events table.
+type WorkoutEventRow struct {
+	ID              int64           `db:"id"`
+	WorkoutID       int64           `db:"workout_id"`
+	Type            string          `db:"type"`
+	Date            *time.Time      `db:"date"`
+	Duration        *float64        `db:"duration"`
+	DurationUnit    *string         `db:"duration_unit"`
+	DurationSeconds *float64        `db:"duration_seconds"`
+	Metadata        []MetadataEntry `db:"metadata,json"`
+}
+
+func parseFloat(value *string) (*float64, error) {
+	if value == nil || *value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseFloat(*value, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parsed, nil
+}
+
+var durationUnits = map[string]time.Duration{
+	"ms":  time.Millisecond,
+	"s":   time.Second,
+	"sec": time.Second,
+	"min": time.Minute,
+	"hr":  time.Hour,
+	"h":   time.Hour,
+	"d":   24 * time.Hour,
+}
+
+// DurationSeconds converts a duration expressed in one of the time units
+// used by exports to seconds.
+func DurationSeconds(value float64, unit string) (float64, bool) {
+	scale, ok := durationUnits[unit]
+	if !ok {
+		return 0, false
+	}
+
+	return value * scale.Seconds(), true
+}
+
+// StatisticsRows returns the statistics of the workout as rows keyed by
+// the workout id.
+func (w *Workout) StatisticsRows() ([]WorkoutStatisticsRow, error) {
+	rows := make([]WorkoutStatisticsRow, len(w.WorkoutStatistics))
+	for i, stat := range w.WorkoutStatistics {
+		row := WorkoutStatisticsRow{
+			WorkoutID: w.ID,
+			Type:      stat.Type,
+			StartDate: stat.StartDate,
+			EndDate:   stat.EndDate,
+			Unit:      stat.Unit,
+		}
+
+		var err error
+		if row.Average, err = parseFloat(stat.Average); err != nil {
+			return nil, fmt.Errorf("%s average: %w", stat.Type, err)
+		}
+		if row.Minimum, err = parseFloat(stat.Minimum); err != nil {
+			return nil, fmt.Errorf("%s minimum: %w", stat.Type, err)
+		}
+		if row.Maximum, err = parseFloat(stat.Maximum); err != nil {
+			return nil, fmt.Errorf("%s maximum: %w", stat.Type, err)
+		}
+		if row.Sum, err = parseFloat(stat.Sum); err != nil {
+			return nil, fmt.Errorf("%s sum: %w", stat.Type, err)
+		}
+
+		rows[i] = row
+	}
+
+	return rows, nil
+}
+
+// EventRows returns the events of the workout as rows keyed by the workout
+// id.
+func (w *Workout) EventRows() ([]WorkoutEventRow, error) {
+	rows := make([]WorkoutEventRow, len(w.WorkoutEvent))
+	for i, event := range w.WorkoutEvent {
+		row := WorkoutEventRow{
+			ID:           NestedID(w.ID, i),
+			WorkoutID:    w.ID,
+			Type:         event.Type,
+			DurationUnit: event.DurationUnit,
+			Metadata:     event.Metadata,
+		}
+
+		if event.Date != "" {
+			date, err := time.Parse(TimeLayout, event.Date)
+			if err != nil {
+				return nil, fmt.Errorf("%s date: %w", event.Type, err)
+			}
+			row.Date = &date
+		}
+
+		duration, err := parseFloat(event.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("%s duration: %w", event.Type, err)
+		}
+		row.Duration = duration
+		if duration != nil && event.DurationUnit != nil {
+			if seconds, ok := DurationSeconds(*duration, *event.DurationUnit); ok {
+				row.DurationSeconds = &seconds
+			}
+		}
+
+		rows[i] = row
+	}
+
+	return rows, nil
+}
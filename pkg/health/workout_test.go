@@ -0,0 +1,59 @@
+package health
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+const workoutXML = `<Workout workoutActivityType="HKWorkoutActivityTypeRunning" duration="30" durationUnit="min">
+  <WorkoutEvent type="HKWorkoutEventTypeSegment" date="2022-01-01 12:00:00 -0500" duration="5.5" durationUnit="min"/>
+  <WorkoutEvent type="HKWorkoutEventTypePause" date="2022-01-01 12:10:00 -0500"/>
+  <WorkoutStatistics type="HKQuantityTypeIdentifierHeartRate" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500" average="142.5" minimum="98" maximum="171" unit="count/min"/>
+  <WorkoutStatistics type="HKQuantityTypeIdentifierActiveEnergyBurned" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500" sum="312.25" unit="kcal"/>
+</Workout>`
+
+func TestWorkoutRows(t *testing.T) {
+	var workout Workout
+	if err := xml.Unmarshal([]byte(workoutXML), &workout); err != nil {
+		t.Fatalf("xml.Unmarshal: %v", err)
+	}
+	workout.ID = 7
+
+	statistics, err := workout.StatisticsRows()
+	if err != nil {
+		t.Fatalf("StatisticsRows: %v", err)
+	}
+	if len(statistics) != 2 {
+		t.Fatalf("expected 2 statistics, got %d", len(statistics))
+	}
+	hr := statistics[0]
+	if hr.WorkoutID != 7 || *hr.Average != 142.5 || *hr.Minimum != 98 || *hr.Maximum != 171 || hr.Sum != nil {
+		t.Errorf("unexpected heart rate statistics %#v", hr)
+	}
+	if energy := statistics[1]; *energy.Sum != 312.25 || energy.Average != nil {
+		t.Errorf("unexpected energy statistics %#v", energy)
+	}
+
+	events, err := workout.EventRows()
+	if err != nil {
+		t.Fatalf("EventRows: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if segment := events[0]; segment.DurationSeconds == nil || *segment.DurationSeconds != 330 || segment.Date == nil {
+		t.Errorf("unexpected segment %#v", segment)
+	}
+	if pause := events[1]; pause.Duration != nil || pause.DurationSeconds != nil {
+		t.Errorf("unexpected pause %#v", pause)
+	}
+
+	workout.WorkoutStatistics[0].Average = ptr("fast")
+	if _, err := workout.StatisticsRows(); err == nil {
+		t.Errorf("expected error on a non numeric average")
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,683 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lsmoura/health/pkg/anonymize"
+	"github.com/lsmoura/health/pkg/dbfieldvalues"
+	"github.com/lsmoura/health/pkg/ecg"
+	"github.com/lsmoura/health/pkg/fhir"
+	"github.com/lsmoura/health/pkg/filter"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/pipeline"
+	"github.com/lsmoura/health/pkg/route"
+	"io"
+	"io/fs"
+)
+
+type table struct {
+	name     string
+	sequence string // serial sequence of the id column, if any
+	row      any    // zero value used to list the columns
+}
+
+// tables lists every table written by an import, in the order their counts
+// are reported.
+var tables = []table{
+	{"me", "", health.Me{}},
+	{"records", "records_id_seq", health.Record{}},
+	{"metadata", "", health.MetadataRow{}},
+	{"correlations", "correlations_id_seq", health.Correlation{}},
+	{"blood_pressure_readings", "", health.BloodPressureReading{}},
+	{"meals", "", health.Meal{}},
+	{"workouts", "workouts_id_seq", health.Workout{}},
+	{"workout_statistics", "", health.WorkoutStatisticsRow{}},
+	{"workout_events", "", health.WorkoutEventRow{}},
+	{"workout_route_points", "", route.Point{}},
+	{"activity_summaries", "", health.ActivitySummary{}},
+	{"clinical_records", "", health.ClinicalRecord{}},
+	{"audiograms", "audiograms_id_seq", health.Audiogram{}},
+	{"vision_prescriptions", "vision_prescriptions_id_seq", health.VisionPrescription{}},
+	{"clinical_resources", "", fhir.ClinicalResource{}},
+	{"fhir_observations", "", fhir.Observation{}},
+	{"fhir_conditions", "", fhir.Condition{}},
+	{"fhir_medications", "", fhir.Medication{}},
+	{"fhir_immunizations", "", fhir.Immunization{}},
+	{"fhir_allergies", "", fhir.Allergy{}},
+	{"fhir_procedures", "", fhir.Procedure{}},
+	{"fhir_diagnostic_reports", "", fhir.DiagnosticReport{}},
+	{"ecg_recordings", "ecg_recordings_id_seq", ecg.Recording{}},
+	{"ecg_samples", "", ecg.Samples{}},
+}
+
+// TableNames lists the tables written by an import.
+func TableNames() []string {
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = t.name
+	}
+
+	return names
+}
+
+// Tables lists the tables written by an import with their columns.
+func Tables() []pipeline.Table {
+	out := make([]pipeline.Table, len(tables))
+	for i, t := range tables {
+		out[i] = pipeline.Table{Name: t.name, Columns: dbfieldvalues.Fields(t.row)}
+	}
+
+	return out
+}
+
+// Importer loads an export into the database. Elements are decoded by a pool
+// of workers and streamed into their tables with COPY.
+type Importer struct {
+	Pool *pgxpool.Pool
+
+	// PersonID is the person the export belongs to. Only their rows are
+	// replaced by an import.
+	PersonID int64
+
+	// ExportDir is the directory holding the files referenced by the
+	// export, such as clinical records and electrocardiograms. It is nil
+	// when the export is read from standard input.
+	ExportDir fs.FS
+
+	Workers   int
+	BatchSize int
+
+	// Input names the export in the imports table.
+	Input string
+
+	// Filter, if not nil, selects the elements to import.
+	Filter *filter.Filter
+
+	// Anonymizer, if not nil, anonymizes the elements once they are
+	// selected by Filter.
+	Anonymizer *anonymize.Anonymizer
+
+	// Log, if not nil, receives the files of the export that are skipped
+	// and the rows copied into each table.
+	Log io.Writer
+
+	// firstIDs holds, per table with a serial id, the id before the first
+	// one of the import, so the ids of persons do not collide.
+	firstIDs map[string]int64
+}
+
+// id returns the id of the seq-th row of a table with a serial id.
+func (i *Importer) id(table string, seq int64) int64 {
+	return i.firstIDs[table] + seq
+}
+
+func (i *Importer) logf(format string, args ...any) {
+	if i.Log != nil {
+		fmt.Fprintf(i.Log, format, args...)
+	}
+}
+
+// keep anonymizes an element, and returns false when it must be dropped.
+func (i *Importer) keep(element any) bool {
+	return i.Anonymizer == nil || i.Anonymizer.Element(element)
+}
+
+func write(ctx context.Context, sink pipeline.Sink, table string, row any) error {
+	values, err := dbfieldvalues.Values(row)
+	if err != nil {
+		return fmt.Errorf("dbfieldvalues.Values: %w", err)
+	}
+
+	return sink.Write(ctx, table, values)
+}
+
+func writeAll[T any](ctx context.Context, sink pipeline.Sink, table string, rows []T) error {
+	for _, row := range rows {
+		if err := write(ctx, sink, table, row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decode unmarshals an element and writes it to table.
+func decode[T any](i *Importer, table string) func(context.Context, pipeline.Sink, *pipeline.Element) error {
+	return func(ctx context.Context, sink pipeline.Sink, e *pipeline.Element) error {
+		var row T
+		if err := xml.Unmarshal(e.Data, &row); err != nil {
+			return fmt.Errorf("xml.Unmarshal: %w", err)
+		}
+		if !i.keep(&row) {
+			return nil
+		}
+
+		return write(ctx, sink, table, row)
+	}
+}
+
+// Handler returns the pipeline handler that decodes every known element and
+// writes its rows to sink. Unknown elements are ignored.
+func (i *Importer) Handler(sink pipeline.Sink) pipeline.Handler {
+	handlers := map[string]func(context.Context, pipeline.Sink, *pipeline.Element) error{
+		"Me":                 decode[health.Me](i, "me"),
+		"Record":             i.handleRecord,
+		"Correlation":        i.handleCorrelation,
+		"Workout":            i.handleWorkout,
+		"ActivitySummary":    decode[health.ActivitySummary](i, "activity_summaries"),
+		"ClinicalRecord":     i.handleClinicalRecord,
+		"Audiogram":          i.handleAudiogram,
+		"VisionPrescription": i.handleVisionPrescription,
+	}
+
+	return func(ctx context.Context, e *pipeline.Element) error {
+		handle, ok := handlers[e.Name]
+		if !ok {
+			return nil
+		}
+
+		return handle(ctx, sink, e)
+	}
+}
+
+func (i *Importer) handleRecord(ctx context.Context, sink pipeline.Sink, e *pipeline.Element) error {
+	var record health.Record
+	if err := xml.Unmarshal(e.Data, &record); err != nil {
+		return fmt.Errorf("xml.Unmarshal: %w", err)
+	}
+	if !i.keep(&record) {
+		return nil
+	}
+	record.ID = i.id("records", e.Seq)
+	record.PromoteMetadata()
+
+	if err := write(ctx, sink, "records", record); err != nil {
+		return err
+	}
+
+	return writeAll(ctx, sink, "metadata", health.MetadataRows(health.EntityRecord, record.ID, record.Metadata))
+}
+
+func (i *Importer) handleCorrelation(ctx context.Context, sink pipeline.Sink, e *pipeline.Element) error {
+	var correlation health.Correlation
+	if err := xml.Unmarshal(e.Data, &correlation); err != nil {
+		return fmt.Errorf("xml.Unmarshal: %w", err)
+	}
+	if !i.keep(&correlation) {
+		return nil
+	}
+	correlation.ID = i.id("correlations", e.Seq)
+
+	if err := write(ctx, sink, "correlations", correlation); err != nil {
+		return err
+	}
+	if err := writeAll(ctx, sink, "metadata", health.MetadataRows(health.EntityCorrelation, correlation.ID, correlation.Metadata)); err != nil {
+		return err
+	}
+
+	switch correlation.Type {
+	case health.BloodPressureType:
+		return write(ctx, sink, "blood_pressure_readings", correlation.BloodPressure())
+	case health.FoodType:
+		return write(ctx, sink, "meals", correlation.Meal())
+	}
+
+	return nil
+}
+
+func (i *Importer) handleWorkout(ctx context.Context, sink pipeline.Sink, e *pipeline.Element) error {
+	var workout health.Workout
+	if err := xml.Unmarshal(e.Data, &workout); err != nil {
+		return fmt.Errorf("xml.Unmarshal: %w", err)
+	}
+	workout.ID = i.id("workouts", e.Seq)
+	workout.PromoteMetadata()
+
+	// anonymizing removes the references to the route files
+	var routeFiles []string
+	for _, r := range workout.WorkoutRoute {
+		for _, file := range r.FileReference {
+			routeFiles = append(routeFiles, file.Path)
+		}
+	}
+	if !i.keep(&workout) {
+		return nil
+	}
+
+	if err := write(ctx, sink, "workouts", workout); err != nil {
+		return err
+	}
+	if err := writeAll(ctx, sink, "metadata", health.MetadataRows(health.EntityWorkout, workout.ID, workout.Metadata)); err != nil {
+		return err
+	}
+
+	statistics, err := workout.StatisticsRows()
+	if err != nil {
+		return fmt.Errorf("StatisticsRows: %w", err)
+	}
+	if err := writeAll(ctx, sink, "workout_statistics", statistics); err != nil {
+		return err
+	}
+
+	events, err := workout.EventRows()
+	if err != nil {
+		return fmt.Errorf("EventRows: %w", err)
+	}
+
+	if err := writeAll(ctx, sink, "workout_events", events); err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := writeAll(ctx, sink, "metadata", health.MetadataRows(health.EntityWorkoutEvent, event.ID, event.Metadata)); err != nil {
+			return err
+		}
+	}
+	for n, r := range workout.WorkoutRoute {
+		if err := writeAll(ctx, sink, "metadata", health.MetadataRows(health.EntityWorkoutRoute, health.NestedID(workout.ID, n), r.Metadata)); err != nil {
+			return err
+		}
+	}
+
+	return i.writeRoutes(ctx, sink, workout.ID, routeFiles)
+}
+
+func (i *Importer) handleAudiogram(ctx context.Context, sink pipeline.Sink, e *pipeline.Element) error {
+	var audiogram health.Audiogram
+	if err := xml.Unmarshal(e.Data, &audiogram); err != nil {
+		return fmt.Errorf("xml.Unmarshal: %w", err)
+	}
+	if !i.keep(&audiogram) {
+		return nil
+	}
+	audiogram.ID = i.id("audiograms", e.Seq)
+
+	if err := write(ctx, sink, "audiograms", audiogram); err != nil {
+		return err
+	}
+
+	return writeAll(ctx, sink, "metadata", health.MetadataRows(health.EntityAudiogram, audiogram.ID, audiogram.Metadata))
+}
+
+func (i *Importer) handleVisionPrescription(ctx context.Context, sink pipeline.Sink, e *pipeline.Element) error {
+	var prescription health.VisionPrescription
+	if err := xml.Unmarshal(e.Data, &prescription); err != nil {
+		return fmt.Errorf("xml.Unmarshal: %w", err)
+	}
+	if !i.keep(&prescription) {
+		return nil
+	}
+	prescription.ID = i.id("vision_prescriptions", e.Seq)
+
+	if err := write(ctx, sink, "vision_prescriptions", prescription); err != nil {
+		return err
+	}
+
+	return writeAll(ctx, sink, "metadata", health.MetadataRows(health.EntityVisionPrescription, prescription.ID, prescription.Metadata))
+}
+
+// writeRoutes loads the route files of a workout. Points are numbered across
+// the files of the workout.
+func (i *Importer) writeRoutes(ctx context.Context, sink pipeline.Sink, workoutID int64, paths []string) error {
+	if i.ExportDir == nil {
+		return nil
+	}
+
+	var points []route.Point
+	for _, path := range paths {
+		loaded, err := route.Load(i.ExportDir, path)
+		if err != nil {
+			i.logf("skipping route %s: %v\n", path, err)
+			continue
+		}
+		points = append(points, loaded...)
+	}
+	for n := range points {
+		points[n].WorkoutID = workoutID
+		points[n].Seq = n
+	}
+	if i.Anonymizer != nil {
+		points = i.Anonymizer.Route(points)
+	}
+
+	return writeAll(ctx, sink, "workout_route_points", points)
+}
+
+func (i *Importer) handleClinicalRecord(ctx context.Context, sink pipeline.Sink, e *pipeline.Element) error {
+	var record health.ClinicalRecord
+	if err := xml.Unmarshal(e.Data, &record); err != nil {
+		return fmt.Errorf("xml.Unmarshal: %w", err)
+	}
+	if !i.keep(&record) {
+		return nil
+	}
+	if err := write(ctx, sink, "clinical_records", record); err != nil {
+		return err
+	}
+
+	if i.ExportDir == nil || record.ResourceFilePath == nil || record.Identifier == nil {
+		return nil
+	}
+	var fhirVersion string
+	if record.FhirVersion != nil {
+		fhirVersion = *record.FhirVersion
+	}
+
+	var resources fhir.Resources
+	if err := resources.LoadFile(i.ExportDir, *record.Identifier, fhirVersion, *record.ResourceFilePath); err != nil {
+		i.logf("skipping clinical record %s: %v\n", *record.Identifier, err)
+		return nil
+	}
+
+	return writeResources(ctx, sink, &resources)
+}
+
+func writeResources(ctx context.Context, sink pipeline.Sink, resources *fhir.Resources) error {
+	if err := writeAll(ctx, sink, "clinical_resources", resources.Raw); err != nil {
+		return err
+	}
+	if err := writeAll(ctx, sink, "fhir_observations", resources.Observations); err != nil {
+		return err
+	}
+	if err := writeAll(ctx, sink, "fhir_conditions", resources.Conditions); err != nil {
+		return err
+	}
+	if err := writeAll(ctx, sink, "fhir_medications", resources.Medications); err != nil {
+		return err
+	}
+	if err := writeAll(ctx, sink, "fhir_immunizations", resources.Immunizations); err != nil {
+		return err
+	}
+	if err := writeAll(ctx, sink, "fhir_allergies", resources.Allergies); err != nil {
+		return err
+	}
+	if err := writeAll(ctx, sink, "fhir_procedures", resources.Procedures); err != nil {
+		return err
+	}
+
+	return writeAll(ctx, sink, "fhir_diagnostic_reports", resources.DiagnosticReports)
+}
+
+// writeElectrocardiograms loads the ECG files of the export, skipping the
+// ones that cannot be parsed, since the rows of the person are already
+// cleared. Recording ids follow the file order. Type filters match them as
+// ecg.RecordType, the type of their Record.
+func (i *Importer) writeElectrocardiograms(ctx context.Context, sink pipeline.Sink) error {
+	if i.ExportDir == nil {
+		return nil
+	}
+	if i.Filter != nil && !i.Filter.RecordTypes.Keep(ecg.RecordType) {
+		return nil
+	}
+
+	recordings, skipped, err := ecg.Load(i.ExportDir)
+	if err != nil {
+		return fmt.Errorf("ecg.Load: %w", err)
+	}
+	for _, err := range skipped {
+		i.logf("skipping electrocardiogram %v\n", err)
+	}
+
+	for n, recording := range recordings {
+		if i.Filter != nil && recording.RecordedDate != nil && !i.Filter.KeepTime(*recording.RecordedDate) {
+			continue
+		}
+		if i.Filter != nil && recording.Device != "" && !i.Filter.Devices.Keep(health.DeviceName(recording.Device)) {
+			continue
+		}
+		recording.ID = i.id("ecg_recordings", int64(n+1))
+		if i.Anonymizer != nil {
+			i.Anonymizer.Recording(&recording)
+		}
+		if err := write(ctx, sink, "ecg_recordings", recording); err != nil {
+			return err
+		}
+		samples := ecg.Samples{RecordingID: recording.ID, Samples: recording.Samples}
+		if err := write(ctx, sink, "ecg_samples", samples); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// personSink adds the person_id column to the rows written to a sink.
+type personSink struct {
+	pipeline.Sink
+	personID int64
+}
+
+func (s personSink) Write(ctx context.Context, table string, values []any) error {
+	return s.Sink.Write(ctx, table, append(values, s.personID))
+}
+
+// copyTables lists the tables of Tables with their person_id column, as
+// written by personSink.
+func copyTables() []pipeline.Table {
+	out := Tables()
+	for n := range out {
+		out[n].Columns = append(out[n].Columns, "person_id")
+	}
+
+	return out
+}
+
+// clear deletes the rows of the person.
+func (i *Importer) clear(ctx context.Context) error {
+	for _, t := range tables {
+		if _, err := i.Pool.Exec(ctx, "DELETE FROM "+t.name+" WHERE person_id = $1", i.PersonID); err != nil {
+			return fmt.Errorf("DELETE FROM %s: %w", t.name, err)
+		}
+	}
+
+	return nil
+}
+
+// reserveIDs starts the ids of the import after the ids of the rows of the
+// other persons.
+func (i *Importer) reserveIDs(ctx context.Context) error {
+	i.firstIDs = make(map[string]int64)
+	for _, t := range tables {
+		if t.sequence == "" {
+			continue
+		}
+		var last int64
+		if err := i.Pool.QueryRow(ctx, "SELECT COALESCE(MAX(id), 0) FROM "+t.name).Scan(&last); err != nil {
+			return fmt.Errorf("SELECT MAX(id) FROM %s: %w", t.name, err)
+		}
+		i.firstIDs[t.name] = last
+	}
+
+	return nil
+}
+
+// resetSequences moves every serial sequence past the ids that were
+// imported explicitly.
+func (i *Importer) resetSequences(ctx context.Context) error {
+	for _, t := range tables {
+		if t.sequence == "" {
+			continue
+		}
+		query := "SELECT setval($1, COALESCE((SELECT MAX(id) FROM " + t.name + "), 0) + 1, false)"
+		if _, err := i.Pool.Exec(ctx, query, t.sequence); err != nil {
+			return fmt.Errorf("setval %s: %w", t.sequence, err)
+		}
+	}
+
+	return nil
+}
+
+// linkElectrocardiograms points every ECG recording at the electrocardiogram
+// record closest to its recorded date.
+func (i *Importer) linkElectrocardiograms(ctx context.Context) error {
+	_, err := i.Pool.Exec(ctx, `
+		UPDATE ecg_recordings e SET record_id = (
+			SELECT r.id FROM records r
+			WHERE r.type = $1
+			  AND r.person_id = e.person_id
+			  AND r.start_date BETWEEN e.recorded_date - INTERVAL '1 minute' AND e.recorded_date + INTERVAL '1 minute'
+			ORDER BY ABS(EXTRACT(EPOCH FROM r.start_date - e.recorded_date))
+			LIMIT 1
+		)
+		WHERE person_id = $2`,
+		ecg.RecordType, i.PersonID,
+	)
+	if err != nil {
+		return fmt.Errorf("pool.Exec: %w", err)
+	}
+
+	return nil
+}
+
+// linkPulses fills the pulse of the blood pressure readings without one with
+// the heart rate their source recorded at the same time.
+func (i *Importer) linkPulses(ctx context.Context) error {
+	_, err := i.Pool.Exec(ctx, `
+		UPDATE blood_pressure_readings b SET pulse = (
+			SELECT r.value::DOUBLE PRECISION FROM records r
+			WHERE r.type = 'HKQuantityTypeIdentifierHeartRate'
+			  AND r.person_id = b.person_id
+			  AND r.source_name = b.source_name
+			  AND r.start_date BETWEEN b.start_date - INTERVAL '1 minute' AND b.start_date + INTERVAL '1 minute'
+			ORDER BY ABS(EXTRACT(EPOCH FROM r.start_date - b.start_date))
+			LIMIT 1
+		)
+		WHERE pulse IS NULL AND person_id = $1`,
+		i.PersonID,
+	)
+	if err != nil {
+		return fmt.Errorf("pool.Exec: %w", err)
+	}
+
+	return nil
+}
+
+// Decode writes every row of the export read by scanner, and of the files
+// next to it, to sink. check, if not nil, is called for every element before
+// it is decoded.
+func (i *Importer) Decode(ctx context.Context, scanner *pipeline.Scanner, sink pipeline.Sink, check pipeline.Handler) error {
+	if !i.Filter.IsZero() {
+		scanner.Filter = i.Filter.Keep
+	}
+
+	handle := i.Handler(sink)
+	if check != nil {
+		decode := handle
+		handle = func(ctx context.Context, e *pipeline.Element) error {
+			if err := check(ctx, e); err != nil {
+				return err
+			}
+			return decode(ctx, e)
+		}
+	}
+
+	if err := pipeline.RunScanner(ctx, scanner, i.Workers, handle); err != nil {
+		return fmt.Errorf("pipeline.Run: %w", err)
+	}
+	if err := i.writeElectrocardiograms(ctx, sink); err != nil {
+		return fmt.Errorf("writeElectrocardiograms: %w", err)
+	}
+
+	return nil
+}
+
+// begin records the start of an import and returns its id.
+func (i *Importer) begin(ctx context.Context) (int64, error) {
+	var filters *string
+	if !i.Filter.IsZero() {
+		data, err := json.Marshal(i.Filter)
+		if err != nil {
+			return 0, fmt.Errorf("json.Marshal: %w", err)
+		}
+		s := string(data)
+		filters = &s
+	}
+
+	var id int64
+	err := i.Pool.QueryRow(ctx,
+		"INSERT INTO imports (person_id, started_at, input, filters) VALUES ($1, now(), $2, $3) RETURNING id",
+		i.PersonID, i.Input, filters,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("pool.QueryRow: %w", err)
+	}
+
+	return id, nil
+}
+
+// finish records the end of a successful import.
+func (i *Importer) finish(ctx context.Context, id int64, counts map[string]int64) error {
+	data, err := json.Marshal(counts)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	_, err = i.Pool.Exec(ctx, "UPDATE imports SET finished_at = now(), row_counts = $2 WHERE id = $1", id, string(data))
+	if err != nil {
+		return fmt.Errorf("pool.Exec: %w", err)
+	}
+
+	return nil
+}
+
+// importLock is the advisory lock held during an import: the ids of an
+// import start after the ids found when it begins, so imports of several
+// persons run one at a time.
+const importLock = 6010
+
+// Import replaces the rows of the person with the export read from r.
+func (i *Importer) Import(ctx context.Context, r io.Reader) error {
+	conn, err := i.Pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("pool.Acquire: %w", err)
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", importLock); err != nil {
+		return fmt.Errorf("pg_advisory_lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", importLock)
+
+	importID, err := i.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+
+	if err := i.clear(ctx); err != nil {
+		return fmt.Errorf("clear: %w", err)
+	}
+	if err := i.reserveIDs(ctx); err != nil {
+		return fmt.Errorf("reserveIDs: %w", err)
+	}
+
+	writer := pipeline.NewCopyWriter(ctx, i.Pool, copyTables(), i.BatchSize)
+
+	err = i.Decode(ctx, pipeline.NewScanner(r), personSink{writer, i.PersonID}, nil)
+	counts, closeErr := writer.Close()
+	if err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("writer.Close: %w", closeErr)
+	}
+
+	for _, t := range tables {
+		i.logf("Copied %d rows into %s\n", counts[t.name], t.name)
+	}
+
+	if err := i.resetSequences(ctx); err != nil {
+		return fmt.Errorf("resetSequences: %w", err)
+	}
+	if err := i.linkElectrocardiograms(ctx); err != nil {
+		return fmt.Errorf("linkElectrocardiograms: %w", err)
+	}
+	if err := i.linkPulses(ctx); err != nil {
+		return fmt.Errorf("linkPulses: %w", err)
+	}
+	if err := i.finish(ctx, importID, counts); err != nil {
+		return fmt.Errorf("finish: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,316 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"github.com/lsmoura/health/pkg/anonymize"
+	"github.com/lsmoura/health/pkg/dbfieldvalues"
+	"github.com/lsmoura/health/pkg/filter"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/pipeline"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// memorySink keeps every row it receives, per table.
+type memorySink struct {
+	mu   sync.Mutex
+	rows map[string][][]any
+}
+
+func (s *memorySink) Write(ctx context.Context, table string, values []any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rows == nil {
+		s.rows = make(map[string][][]any)
+	}
+	s.rows[table] = append(s.rows[table], values)
+	return nil
+}
+
+const export = `<?xml version="1.0" encoding="UTF-8"?>
+<HealthData locale="en_US">
+ <Me HKCharacteristicTypeIdentifierDateOfBirth="1980-01-02" HKCharacteristicTypeIdentifierBiologicalSex="HKBiologicalSexFemale"/>
+ <Record type="HKQuantityTypeIdentifierStepCount" sourceName="iPhone" unit="count" value="10" startDate="2022-01-01 10:00:00 -0500" endDate="2022-01-01 10:05:00 -0500"/>
+ <Record type="HKQuantityTypeIdentifierStepCount" sourceName="iPhone" unit="count" value="20" startDate="2022-01-01 11:00:00 -0500" endDate="2022-01-01 11:05:00 -0500"/>
+ <Correlation type="HKCorrelationTypeIdentifierBloodPressure" sourceName="Cuff" startDate="2022-01-01 08:00:00 -0500" endDate="2022-01-01 08:00:00 -0500">
+  <MetadataEntry key="HKWasUserEntered" value="1"/>
+  <Record type="HKQuantityTypeIdentifierBloodPressureSystolic" sourceName="Cuff" unit="mmHg" value="120" startDate="2022-01-01 08:00:00 -0500" endDate="2022-01-01 08:00:00 -0500"/>
+ </Correlation>
+ <Workout workoutActivityType="HKWorkoutActivityTypeRunning" duration="30" durationUnit="min" sourceName="Watch" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500">
+  <MetadataEntry key="HKIndoorWorkout" value="0"/>
+  <WorkoutEvent type="HKWorkoutEventTypeSegment" date="2022-01-01 12:00:00 -0500" duration="10" durationUnit="min">
+   <MetadataEntry key="HKWorkoutEventTypeSegment" value="1"/>
+  </WorkoutEvent>
+  <WorkoutRoute sourceName="Watch" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500">
+   <MetadataEntry key="HKMetadataKeySyncVersion" value="2"/>
+  </WorkoutRoute>
+ </Workout>
+ <Audiogram type="HKDataTypeIdentifierAudiogram" sourceName="Mimi" startDate="2022-01-01 09:00:00 -0500" endDate="2022-01-01 09:00:00 -0500">
+  <MetadataEntry key="HKDeviceName" value="AirPods"/>
+ </Audiogram>
+ <VisionPrescription type="HKVisionPrescriptionTypeGlasses" dateIssued="2022-01-01 09:00:00 -0500">
+  <MetadataEntry key="HKMetadataKeySyncVersion" value="1"/>
+ </VisionPrescription>
+ <ClinicalRecord type="HKClinicalTypeIdentifierLabResultRecord" identifier="lab-1" sourceName="Hospital" fhirVersion="4.0.1" resourceFilePath="/clinical-records/lab-1.json"/>
+ <ActivitySummary dateComponents="2022-01-01" activeEnergyBurned="500" activeEnergyBurnedUnit="Cal"/>
+ <Unknown/>
+</HealthData>
+`
+
+func TestHandler(t *testing.T) {
+	var sink memorySink
+	var imp Importer
+
+	if err := pipeline.Run(context.Background(), strings.NewReader(export), 2, imp.Handler(&sink)); err != nil {
+		t.Fatalf("pipeline.Run: %v", err)
+	}
+
+	tests := []struct {
+		table string
+		count int
+	}{
+		{"me", 1},
+		{"records", 2},
+		{"correlations", 1},
+		{"blood_pressure_readings", 1},
+		{"meals", 0},
+		{"workouts", 1},
+		{"clinical_records", 1},
+		{"clinical_resources", 0}, // no export directory
+		{"activity_summaries", 1},
+		{"workout_events", 1},
+		{"audiograms", 1},
+		{"vision_prescriptions", 1},
+	}
+	for _, test := range tests {
+		if got := len(sink.rows[test.table]); got != test.count {
+			t.Errorf("%s: expected %d rows, got %d", test.table, test.count, got)
+		}
+	}
+
+	// every entity with metadata entries has its rows, keyed by its id
+	entities := make(map[string]int64)
+	for _, row := range sink.rows["metadata"] {
+		entities[row[0].(string)] = row[1].(int64)
+	}
+	expected := map[string]int64{
+		health.EntityWorkout:            1,
+		health.EntityCorrelation:        1,
+		health.EntityWorkoutEvent:       health.NestedID(1, 0),
+		health.EntityWorkoutRoute:       health.NestedID(1, 0),
+		health.EntityAudiogram:          1,
+		health.EntityVisionPrescription: 1,
+	}
+	if !reflect.DeepEqual(entities, expected) {
+		t.Errorf("expected metadata of %v, got %v", expected, entities)
+	}
+	if id := sink.rows["workout_events"][0][0].(int64); id != health.NestedID(1, 0) {
+		t.Errorf("expected the event id %d, got %d", health.NestedID(1, 0), id)
+	}
+
+	// ids follow document order regardless of which worker decoded the row
+	for _, row := range sink.rows["records"] {
+		id := row[0].(int64)
+		value := *row[3].(*string)
+		if (id == 1 && value != "10") || (id == 2 && value != "20") {
+			t.Errorf("unexpected record %d with value %s", id, value)
+		}
+	}
+
+	// activity summaries are made of attributes
+	if date, _ := sink.rows["activity_summaries"][0][0].(*string); date == nil || *date != "2022-01-01" {
+		t.Errorf("unexpected activity summary date %v", date)
+	}
+
+	for _, table := range tables {
+		columns := dbfieldvalues.Fields(table.row)
+		for _, row := range sink.rows[table.name] {
+			if len(row) != len(columns) {
+				t.Errorf("%s: expected %d values, got %d", table.name, len(columns), len(row))
+			}
+		}
+	}
+}
+
+func TestTablesMatchSchema(t *testing.T) {
+	schema, err := health.SchemaTables()
+	if err != nil {
+		t.Fatalf("health.SchemaTables: %v", err)
+	}
+	declared := make(map[string]health.Table, len(schema))
+	for _, table := range schema {
+		declared[table.Name] = table
+	}
+
+	for _, table := range copyTables() {
+		schemaTable, ok := declared[table.Name]
+		if !ok {
+			t.Errorf("table %s is not declared in schema.sql", table.Name)
+			continue
+		}
+		for _, column := range table.Columns {
+			if _, ok := schemaTable.Column(column); !ok {
+				t.Errorf("column %s.%s is not declared in schema.sql", table.Name, column)
+			}
+		}
+	}
+}
+
+func TestPersonRows(t *testing.T) {
+	var sink memorySink
+	imp := Importer{firstIDs: map[string]int64{"records": 100, "workouts": 10}}
+
+	if err := pipeline.Run(context.Background(), strings.NewReader(export), 2, imp.Handler(personSink{&sink, 7})); err != nil {
+		t.Fatalf("pipeline.Run: %v", err)
+	}
+
+	for _, table := range copyTables() {
+		for _, row := range sink.rows[table.Name] {
+			if len(row) != len(table.Columns) || row[len(row)-1] != int64(7) {
+				t.Errorf("%s: expected the person id as the last of %d values, got %v", table.Name, len(table.Columns), row)
+			}
+		}
+	}
+
+	// ids start after the ids of the other persons
+	for _, row := range sink.rows["records"] {
+		if id := row[0].(int64); id != 101 && id != 102 {
+			t.Errorf("unexpected record id %d", id)
+		}
+	}
+	if id := sink.rows["workouts"][0][0].(int64); id != 11 {
+		t.Errorf("expected workout id 11, got %d", id)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	const route = `<gpx><trk><trkseg>
+ <trkpt lon="-122.03" lat="37.33"><time>2022-01-01T17:00:00Z</time></trkpt>
+ <trkpt lon="-122.02" lat="37.33"><time>2022-01-01T17:01:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+	const export = `<HealthData>
+ <Workout workoutActivityType="HKWorkoutActivityTypeRunning" sourceName="Watch" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500">
+  <WorkoutRoute sourceName="Watch" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500">
+   <FileReference path="/workout-routes/route_1.gpx"/>
+  </WorkoutRoute>
+  <WorkoutRoute sourceName="Watch" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500">
+   <FileReference path="/workout-routes/missing.gpx"/>
+  </WorkoutRoute>
+ </Workout>
+</HealthData>`
+
+	var sink memorySink
+	var log strings.Builder
+	imp := Importer{ExportDir: fstest.MapFS{"workout-routes/route_1.gpx": {Data: []byte(route)}}, Log: &log}
+	if err := pipeline.Run(context.Background(), strings.NewReader(export), 1, imp.Handler(&sink)); err != nil {
+		t.Fatalf("pipeline.Run: %v", err)
+	}
+	if !strings.HasPrefix(log.String(), "skipping route /workout-routes/missing.gpx") {
+		t.Errorf("expected the missing route to be logged, got %q", log.String())
+	}
+
+	points := sink.rows["workout_route_points"]
+	if len(points) != 2 {
+		t.Fatalf("expected 2 route points, got %d", len(points))
+	}
+	for seq, row := range points {
+		if row[0].(int64) != 1 || row[1].(int) != seq {
+			t.Errorf("unexpected route point %v", row)
+		}
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	const route = `<gpx><trk><trkseg>
+ <trkpt lon="-122.03" lat="37.33"><time>2022-01-01T17:00:00Z</time></trkpt>
+ <trkpt lon="-122.025" lat="37.33"><time>2022-01-01T17:00:30Z</time></trkpt>
+ <trkpt lon="-122.02" lat="37.33"><time>2022-01-01T17:01:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+	const export = `<HealthData>
+ <Record type="HKQuantityTypeIdentifierStepCount" sourceName="iPhone" unit="count" value="10" startDate="2022-01-01 10:00:00 -0500" endDate="2022-01-01 10:05:00 -0500"/>
+ <Workout workoutActivityType="HKWorkoutActivityTypeRunning" sourceName="Watch" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500">
+  <WorkoutRoute sourceName="Watch" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500">
+   <FileReference path="/workout-routes/route_1.gpx"/>
+  </WorkoutRoute>
+ </Workout>
+ <ClinicalRecord type="HKClinicalTypeIdentifierLabResultRecord" identifier="lab-1" sourceName="Hospital" fhirVersion="4.0.1" resourceFilePath="/clinical-records/lab-1.json"/>
+</HealthData>`
+
+	anonymizer, err := anonymize.New(anonymize.Options{Salt: []byte("salt")})
+	if err != nil {
+		t.Fatalf("anonymize.New: %v", err)
+	}
+	var sink memorySink
+	imp := Importer{ExportDir: fstest.MapFS{"workout-routes/route_1.gpx": {Data: []byte(route)}}, Anonymizer: anonymizer}
+	if err := pipeline.Run(context.Background(), strings.NewReader(export), 1, imp.Handler(&sink)); err != nil {
+		t.Fatalf("pipeline.Run: %v", err)
+	}
+
+	if rows := sink.rows["clinical_records"]; len(rows) != 0 {
+		t.Errorf("expected no clinical records, got %v", rows)
+	}
+	records := sink.rows["records"]
+	if len(records) != 1 || *records[0][3].(*string) != "10" || records[0][4].(string) == "iPhone" {
+		t.Fatalf("unexpected records %v", records)
+	}
+	if start := time.Time(*records[0][8].(*health.HealthTime)); start.Weekday() != time.Saturday || start.Hour() != 10 || start.Year() == 2022 && start.YearDay() == 1 {
+		t.Errorf("expected a Saturday at 10:00 other than 2022-01-01, got %v", start)
+	}
+
+	points := sink.rows["workout_route_points"]
+	if len(points) != 2 {
+		t.Fatalf("expected the start and end of the route, got %v", points)
+	}
+	for seq, row := range points {
+		if row[0].(int64) != 1 || row[1].(int) != seq || row[3].(float64) == 37.33 {
+			t.Errorf("unexpected route point %v", row)
+		}
+	}
+}
+
+func TestElectrocardiogramFilter(t *testing.T) {
+	const recording = `Recorded Date,2021-03-01 10:20:30 -0500
+Device,%s
+Sample Rate,512 hertz
+
+-12.5
+`
+	fsys := fstest.MapFS{
+		"electrocardiograms/ecg_1.csv": {Data: []byte(fmt.Sprintf(recording, "Watch6,1"))},
+		"electrocardiograms/ecg_2.csv": {Data: []byte(fmt.Sprintf(recording, "Watch7,2"))},
+	}
+	devices, err := filter.ParsePattern("Watch6*")
+	if err != nil {
+		t.Fatalf("ParsePattern: %v", err)
+	}
+
+	var sink memorySink
+	imp := Importer{ExportDir: fsys, Filter: &filter.Filter{Devices: filter.List{Include: filter.Patterns{devices}}}}
+	if err := imp.writeElectrocardiograms(context.Background(), &sink); err != nil {
+		t.Fatalf("writeElectrocardiograms: %v", err)
+	}
+
+	recordings := sink.rows["ecg_recordings"]
+	if len(recordings) != 1 || recordings[0][1] != "ecg_1.csv" {
+		t.Errorf("expected the recording of the included device, got %v", recordings)
+	}
+
+	heartRate, err := filter.ParsePattern("*HeartRate")
+	if err != nil {
+		t.Fatalf("ParsePattern: %v", err)
+	}
+	var typed memorySink
+	imp = Importer{ExportDir: fsys, Filter: &filter.Filter{RecordTypes: filter.List{Include: filter.Patterns{heartRate}}}}
+	if err := imp.writeElectrocardiograms(context.Background(), &typed); err != nil {
+		t.Fatalf("writeElectrocardiograms: %v", err)
+	}
+	if recordings := typed.rows["ecg_recordings"]; len(recordings) != 0 {
+		t.Errorf("expected no recording without their type included, got %v", recordings)
+	}
+}
@@ -0,0 +1,365 @@
+package influx
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/metadata"
+	"github.com/lsmoura/health/pkg/pipeline"
+	"github.com/lsmoura/health/pkg/units"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Precision is the unit of the timestamps of the lines.
+type Precision string
+
+const (
+	Nanoseconds  Precision = "ns"
+	Microseconds Precision = "us"
+	Milliseconds Precision = "ms"
+	Seconds      Precision = "s"
+)
+
+// ParsePrecision parses ns, us, ms or s.
+func ParsePrecision(s string) (Precision, error) {
+	switch p := Precision(s); p {
+	case Nanoseconds, Microseconds, Milliseconds, Seconds:
+		return p, nil
+	}
+
+	return "", fmt.Errorf("unknown precision %q, expected ns, us, ms or s", s)
+}
+
+func (p Precision) timestamp(t time.Time) int64 {
+	switch p {
+	case Microseconds:
+		return t.UnixMicro()
+	case Milliseconds:
+		return t.UnixMilli()
+	case Seconds:
+		return t.Unix()
+	}
+
+	return t.UnixNano()
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	keyEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// line is a point of the line protocol.
+type line struct {
+	measurement string
+	tags        map[string]string
+	fields      map[string]string // formatted values
+	time        time.Time
+}
+
+func (l *line) tag(key, value string) {
+	if value != "" {
+		l.tags[key] = value
+	}
+}
+
+func (l *line) float(key string, value float64) {
+	l.fields[key] = strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func (l *line) text(key, value string) {
+	l.fields[key] = `"` + stringEscaper.Replace(value) + `"`
+}
+
+// metadata adds the parsed metadata entries as fields: numbers and
+// quantities as floats, with the unit of quantities in KEY_unit, booleans
+// as booleans and the rest as strings.
+func (l *line) metadata(entries []health.MetadataEntry) {
+	for _, entry := range entries {
+		value := metadata.Parse(entry.Key, entry.Value)
+		if b, ok := value.Bool(); ok {
+			l.fields[entry.Key] = strconv.FormatBool(b)
+			continue
+		}
+		if value.Numeric == nil {
+			l.text(entry.Key, value.Text)
+			continue
+		}
+		l.float(entry.Key, *value.Numeric)
+		if value.Unit != "" {
+			l.text(entry.Key+"_unit", value.Unit)
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (l *line) format(precision Precision) string {
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(l.measurement))
+	for _, key := range sortedKeys(l.tags) {
+		b.WriteString("," + keyEscaper.Replace(key) + "=" + keyEscaper.Replace(l.tags[key]))
+	}
+	for i, key := range sortedKeys(l.fields) {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(keyEscaper.Replace(key) + "=" + l.fields[key])
+	}
+	b.WriteString(" " + strconv.FormatInt(precision.timestamp(l.time), 10) + "\n")
+
+	return b.String()
+}
+
+// Writer is a pipeline.Sink that streams records, workouts and their
+// statistics as InfluxDB line protocol, timestamped with their start date.
+//
+// Records are written to the measurement of their type, tagged with their
+// source_name, device and unit, with their value and metadata as fields.
+// Workouts are written to the measurement of their activity type, with
+// their duration, distance, energy and metadata as fields, and each of
+// their statistics as another line tagged with its type and unit.
+type Writer struct {
+	Precision Precision
+
+	columns map[string]map[string]int // by table, then by name
+
+	mu       sync.Mutex
+	out      *bufio.Writer
+	workouts map[int64]line // without fields, for their statistics
+}
+
+// NewWriter returns a writer of the rows of tables, as listed by
+// importer.Tables, to out.
+func NewWriter(out io.Writer, tables []pipeline.Table, precision Precision) *Writer {
+	w := &Writer{
+		Precision: precision,
+		columns:   make(map[string]map[string]int),
+		out:       bufio.NewWriter(out),
+		workouts:  make(map[int64]line),
+	}
+	for _, table := range tables {
+		columns := make(map[string]int, len(table.Columns))
+		for i, name := range table.Columns {
+			columns[name] = i
+		}
+		w.columns[table.Name] = columns
+	}
+
+	return w
+}
+
+type row struct {
+	columns map[string]int
+	values  []any
+}
+
+func (r row) value(name string) any {
+	i, ok := r.columns[name]
+	if !ok || i >= len(r.values) {
+		return nil
+	}
+
+	return r.values[i]
+}
+
+func (r row) text(name string) string {
+	switch v := r.value(name).(type) {
+	case string:
+		return v
+	case *string:
+		if v != nil {
+			return *v
+		}
+	}
+
+	return ""
+}
+
+func (r row) float(name string) (float64, bool) {
+	switch v := r.value(name).(type) {
+	case float64:
+		return v, true
+	case *float64:
+		if v != nil {
+			return *v, true
+		}
+	}
+
+	parsed, err := strconv.ParseFloat(r.text(name), 64)
+	return parsed, err == nil
+}
+
+func (r row) time(name string) (time.Time, bool) {
+	switch v := r.value(name).(type) {
+	case health.HealthTime:
+		return time.Time(v), true
+	case *health.HealthTime:
+		if v != nil {
+			return time.Time(*v), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// metadata returns the metadata entries of a row, stored as they are or as
+// JSON.
+func (r row) metadata() []health.MetadataEntry {
+	switch v := r.value("metadata").(type) {
+	case []health.MetadataEntry:
+		return v
+	case []byte:
+		var entries []health.MetadataEntry
+		if err := json.Unmarshal(v, &entries); err == nil {
+			return entries
+		}
+	}
+
+	return nil
+}
+
+func newLine(measurement string, r row) (*line, bool) {
+	start, ok := r.time("start_date")
+	if !ok || measurement == "" {
+		return nil, false
+	}
+
+	l := &line{measurement: measurement, tags: make(map[string]string), fields: make(map[string]string), time: start}
+	l.tag("source_name", r.text("source_name"))
+	l.tag("device", health.DeviceName(r.text("device")))
+
+	return l, true
+}
+
+func record(r row) (*line, bool) {
+	l, ok := newLine(r.text("type"), r)
+	if !ok {
+		return nil, false
+	}
+	l.tag("unit", r.text("unit"))
+	l.metadata(r.metadata())
+
+	if value, ok := r.float("value"); ok {
+		l.float("value", value)
+	} else if value := r.text("value"); value != "" {
+		l.text("value", value) // category values, like sleep stages
+	}
+
+	return l, true
+}
+
+func workout(r row) (*line, bool) {
+	l, ok := newLine(r.text("workout_activity_type"), r)
+	if !ok {
+		return nil, false
+	}
+	l.metadata(r.metadata())
+
+	converted := []struct {
+		field, column, unitColumn, unit string
+	}{
+		{"duration_seconds", "duration", "duration_unit", "s"},
+		{"total_distance_meters", "total_distance", "total_distance_unit", "m"},
+		{"total_energy_burned_kcal", "total_energy_burned", "total_energy_burned_unit", "kcal"},
+	}
+	for _, c := range converted {
+		value, ok := r.float(c.column)
+		if !ok {
+			continue
+		}
+		if value, err := units.Convert(value, r.text(c.unitColumn), c.unit); err == nil {
+			l.float(c.field, value)
+		}
+	}
+
+	return l, true
+}
+
+// statistics returns the line of a statistic of a workout, which is written
+// before its statistics.
+func (w *Writer) statistics(r row) (*line, bool) {
+	id, _ := r.value("workout_id").(int64)
+	w.mu.Lock()
+	parent, ok := w.workouts[id]
+	w.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	start, ok := r.time("start_date")
+	if !ok {
+		start = parent.time
+	}
+
+	l := &line{measurement: parent.measurement, tags: make(map[string]string), fields: make(map[string]string), time: start}
+	for key, value := range parent.tags {
+		l.tag(key, value)
+	}
+	l.tag("statistic", r.text("type"))
+	l.tag("unit", r.text("unit"))
+	for _, field := range []string{"average", "minimum", "maximum", "sum"} {
+		if value, ok := r.float(field); ok {
+			l.float(field, value)
+		}
+	}
+
+	return l, true
+}
+
+func (w *Writer) Write(ctx context.Context, table string, values []any) error {
+	r := row{columns: w.columns[table], values: values}
+
+	var l *line
+	var ok bool
+	switch table {
+	case "records":
+		l, ok = record(r)
+	case "workouts":
+		if l, ok = workout(r); ok {
+			id, _ := r.value("id").(int64)
+			w.mu.Lock()
+			w.workouts[id] = line{measurement: l.measurement, tags: l.tags, time: l.time}
+			w.mu.Unlock()
+		}
+	case "workout_statistics":
+		l, ok = w.statistics(r)
+	}
+	if !ok || len(l.fields) == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.out.WriteString(l.format(w.Precision)); err != nil {
+		return fmt.Errorf("WriteString: %w", err)
+	}
+
+	return nil
+}
+
+// Flush writes the buffered lines to the underlying writer.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.out.Flush()
+}
@@ -0,0 +1,95 @@
+package influx
+
+import (
+	"bytes"
+	"context"
+	"github.com/lsmoura/health/pkg/importer"
+	"github.com/lsmoura/health/pkg/pipeline"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const export = `<?xml version="1.0" encoding="UTF-8"?>
+<HealthData locale="en_US">
+ <Record type="HKQuantityTypeIdentifierHeartRate" sourceName="Jane's Watch" device="&lt;&lt;HKDevice: 0x1&gt;, name:Apple Watch&gt;" unit="count/min" value="61" startDate="2022-01-01 10:00:00 -0500" endDate="2022-01-01 10:00:00 -0500">
+  <MetadataEntry key="HKMetadataKeyHeartRateMotionContext" value="1"/>
+  <MetadataEntry key="HKWasUserEntered" value="0"/>
+  <MetadataEntry key="HKWeatherTemperature" value="68 degF"/>
+ </Record>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="Watch" value="HKCategoryValueSleepAnalysisAsleepCore" startDate="2022-01-01 01:00:00 -0500" endDate="2022-01-01 02:00:00 -0500"/>
+ <Record type="HKCategoryTypeIdentifierMindfulSession" sourceName="Watch" startDate="2022-01-01 01:00:00 -0500" endDate="2022-01-01 02:00:00 -0500"/>
+ <Workout workoutActivityType="HKWorkoutActivityTypeRunning" duration="30" durationUnit="min" totalDistance="5" totalDistanceUnit="km" sourceName="Watch" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500">
+  <MetadataEntry key="HKIndoorWorkout" value="0"/>
+  <WorkoutStatistics type="HKQuantityTypeIdentifierHeartRate" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500" average="150" minimum="120" maximum="170" unit="count/min"/>
+ </Workout>
+</HealthData>
+`
+
+func TestWriter(t *testing.T) {
+	var imp importer.Importer
+	var out bytes.Buffer
+	w := NewWriter(&out, importer.Tables(), Seconds)
+	if err := pipeline.Run(context.Background(), strings.NewReader(export), 2, imp.Handler(w)); err != nil {
+		t.Fatalf("pipeline.Run: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	// workers write in any order, and the record without value is skipped
+	expected := []string{
+		`HKCategoryTypeIdentifierSleepAnalysis,source_name=Watch value="HKCategoryValueSleepAnalysisAsleepCore" 1641016800`,
+		`HKQuantityTypeIdentifierHeartRate,device=name:Apple\ Watch,source_name=Jane's\ Watch,unit=count/min HKMetadataKeyHeartRateMotionContext=1,HKWasUserEntered=false,HKWeatherTemperature=68,HKWeatherTemperature_unit="degF",value=61 1641049200`,
+		`HKWorkoutActivityTypeRunning,source_name=Watch HKIndoorWorkout=false,duration_seconds=1800,total_distance_meters=5000 1641056400`,
+		`HKWorkoutActivityTypeRunning,source_name=Watch,statistic=HKQuantityTypeIdentifierHeartRate,unit=count/min average=150,maximum=170,minimum=120 1641056400`,
+	}
+	got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestPrecision(t *testing.T) {
+	at := time.Date(2022, 1, 1, 10, 0, 0, 123456789, time.UTC)
+	tests := []struct {
+		precision string
+		timestamp int64
+	}{
+		{"ns", 1641031200123456789},
+		{"us", 1641031200123456},
+		{"ms", 1641031200123},
+		{"s", 1641031200},
+	}
+	for _, test := range tests {
+		precision, err := ParsePrecision(test.precision)
+		if err != nil {
+			t.Fatalf("ParsePrecision(%s): %v", test.precision, err)
+		}
+		if got := precision.timestamp(at); got != test.timestamp {
+			t.Errorf("%s: expected %d, got %d", test.precision, test.timestamp, got)
+		}
+	}
+
+	if _, err := ParsePrecision("h"); err == nil {
+		t.Errorf("expected an error for an unknown precision")
+	}
+}
+
+func TestEscape(t *testing.T) {
+	l := line{
+		measurement: "a measurement,with comma",
+		tags:        map[string]string{"source_name": "Jane's iPhone, v2", "device": "a=b"},
+		fields:      map[string]string{},
+		time:        time.Unix(1, 0),
+	}
+	l.text("note", `say "hi" \o/`)
+
+	expected := `a\ measurement\,with\ comma,device=a\=b,source_name=Jane's\ iPhone\,\ v2 note="say \"hi\" \\o/" 1` + "\n"
+	if got := l.format(Seconds); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
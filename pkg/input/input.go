@@ -0,0 +1,156 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// Stdin is the input name that reads from standard input.
+const Stdin = "-"
+
+type Compression string
+
+const (
+	None  Compression = "none"
+	Gzip  Compression = "gzip"
+	Zstd  Compression = "zstd"
+	Bzip2 Compression = "bzip2"
+)
+
+var magics = []struct {
+	compression Compression
+	magic       []byte
+}{
+	{Gzip, []byte{0x1f, 0x8b}},
+	{Zstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{Bzip2, []byte("BZh")},
+}
+
+// Detect returns the compression format whose magic bytes prefix header.
+func Detect(header []byte) Compression {
+	for _, m := range magics {
+		if bytes.HasPrefix(header, m.magic) {
+			return m.compression
+		}
+	}
+
+	return None
+}
+
+// countingReader counts the bytes read from the underlying source, before
+// any decompression, so progress can be reported against the file size.
+type countingReader struct {
+	r     io.Reader
+	count atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.count.Add(int64(n))
+	return n, err
+}
+
+// Reader is a decompressed view over a file or standard input.
+type Reader struct {
+	io.Reader
+
+	Name        string
+	Compression Compression
+
+	source  io.Closer
+	raw     *countingReader
+	size    int64
+	closeFn func()
+}
+
+// Open opens name, or standard input when name is "-", and transparently
+// decompresses gzip, zstd and bzip2 streams detected by their magic bytes.
+func Open(name string) (*Reader, error) {
+	var f *os.File
+	if name == Stdin {
+		f = os.Stdin
+	} else {
+		var err error
+		f, err = os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("os.Open: %w", err)
+		}
+	}
+
+	r, err := newReader(f, name)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+		r.size = info.Size()
+	}
+
+	return r, nil
+}
+
+func newReader(source io.ReadCloser, name string) (*Reader, error) {
+	raw := &countingReader{r: source}
+	buffered := bufio.NewReader(raw)
+
+	header, err := buffered.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("peek: %w", err)
+	}
+
+	r := &Reader{
+		Name:        name,
+		Compression: Detect(header),
+		source:      source,
+		raw:         raw,
+	}
+
+	switch r.Compression {
+	case Gzip:
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("gzip.NewReader: %w", err)
+		}
+		r.Reader = gz
+	case Zstd:
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("zstd.NewReader: %w", err)
+		}
+		r.Reader = zr
+		r.closeFn = zr.Close
+	case Bzip2:
+		r.Reader = bzip2.NewReader(buffered)
+	default:
+		r.Reader = buffered
+	}
+
+	return r, nil
+}
+
+// Progress returns how many bytes of the source have been consumed and its
+// total size. total is zero when the size is not known, e.g. on stdin.
+func (r *Reader) Progress() (read, total int64) {
+	return r.raw.count.Load(), r.size
+}
+
+// IsStdin reports whether the reader consumes standard input.
+func (r *Reader) IsStdin() bool {
+	return r.Name == Stdin
+}
+
+func (r *Reader) Close() error {
+	if r.closeFn != nil {
+		r.closeFn()
+	}
+
+	return r.source.Close()
+}
@@ -0,0 +1,86 @@
+package input
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		header   []byte
+		expected Compression
+	}{
+		{header: nil, expected: None},
+		{header: []byte("<?xml"), expected: None},
+		{header: []byte{0x1f, 0x8b, 0x08, 0x00}, expected: Gzip},
+		{header: []byte{0x28, 0xb5, 0x2f, 0xfd}, expected: Zstd},
+		{header: []byte("BZh9"), expected: Bzip2},
+	}
+
+	for _, test := range tests {
+		if got := Detect(test.header); got != test.expected {
+			t.Errorf("Detect(%v): expected %s, got %s", test.header, test.expected, got)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	const content = `<?xml version="1.0" encoding="UTF-8"?><HealthData locale="en_US"></HealthData>`
+
+	var gz bytes.Buffer
+	gzWriter := gzip.NewWriter(&gz)
+	gzWriter.Write([]byte(content))
+	gzWriter.Close()
+
+	zstdWriter, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("zstd.NewWriter: %v", err)
+	}
+	zst := zstdWriter.EncodeAll([]byte(content), nil)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		compression Compression
+	}{
+		{"export.xml", []byte(content), None},
+		{"export.xml.gz", gz.Bytes(), Gzip},
+		{"export.xml.zst", zst, Zstd},
+		{"export.bin", gz.Bytes(), Gzip}, // detection does not rely on the extension
+	}
+
+	dir := t.TempDir()
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+		if err := os.WriteFile(path, test.data, 0o600); err != nil {
+			t.Fatalf("os.WriteFile: %v", err)
+		}
+
+		r, err := Open(path)
+		if err != nil {
+			t.Errorf("Open(%s): %v", test.name, err)
+			continue
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Errorf("ReadAll(%s): %v", test.name, err)
+			continue
+		}
+
+		if r.Compression != test.compression {
+			t.Errorf("%s: expected compression %s, got %s", test.name, test.compression, r.Compression)
+		}
+		if string(data) != content {
+			t.Errorf("%s: unexpected content %q", test.name, data)
+		}
+		if read, total := r.Progress(); read != int64(len(test.data)) || total != int64(len(test.data)) {
+			t.Errorf("%s: expected progress %d/%d, got %d/%d", test.name, len(test.data), len(test.data), read, total)
+		}
+	}
+}
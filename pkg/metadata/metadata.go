@@ -0,0 +1,163 @@
+package metadata
+
+import (
+	"strconv"
+	"strings"
+)
+
+type Kind int
+
+const (
+	Text Kind = iota
+	Bool
+	Number
+	Quantity // a number followed by its unit, e.g. "123 cm"
+)
+
+// Common HealthKit metadata keys.
+const (
+	TimeZone           = "HKTimeZone"
+	WasUserEntered     = "HKWasUserEntered"
+	IndoorWorkout      = "HKIndoorWorkout"
+	ElevationAscended  = "HKElevationAscended"
+	ElevationDescended = "HKElevationDescended"
+	AverageMETs        = "HKAverageMETs"
+	SyncIdentifier     = "HKMetadataKeySyncIdentifier"
+	SyncVersion        = "HKMetadataKeySyncVersion"
+	ExternalUUID       = "HKExternalUUID"
+	WeatherTemperature = "HKWeatherTemperature"
+	WeatherHumidity    = "HKWeatherHumidity"
+	LapLength          = "HKLapLength"
+	AverageSpeed       = "HKAverageSpeed"
+	MaximumSpeed       = "HKMaximumSpeed"
+	SwimmingLocation   = "HKSwimmingLocationType"
+	SwimmingStroke     = "HKSwimmingStrokeStyle"
+	HeartRateContext   = "HKMetadataKeyHeartRateMotionContext"
+	VO2MaxTestType     = "HKVO2MaxTestType"
+	BloodGlucoseMeal   = "HKBloodGlucoseMealTime"
+	FoodType           = "HKFoodType"
+	MenstrualCycle     = "HKMenstrualCycleStart"
+	SexualProtection   = "HKSexualActivityProtectionUsed"
+	WasTakenInLab      = "HKWasTakenInLab"
+	DeviceCalibrated   = "HKMetadataKeyAppleDeviceCalibrated"
+)
+
+// Keys maps the metadata keys we know about to the kind of their values.
+// Unknown keys are guessed from their value.
+var Keys = map[string]Kind{
+	TimeZone:           Text,
+	WasUserEntered:     Bool,
+	IndoorWorkout:      Bool,
+	ElevationAscended:  Quantity,
+	ElevationDescended: Quantity,
+	AverageMETs:        Quantity,
+	SyncIdentifier:     Text,
+	SyncVersion:        Number,
+	ExternalUUID:       Text,
+	WeatherTemperature: Quantity,
+	WeatherHumidity:    Quantity,
+	LapLength:          Quantity,
+	AverageSpeed:       Quantity,
+	MaximumSpeed:       Quantity,
+	SwimmingLocation:   Number,
+	SwimmingStroke:     Number,
+	HeartRateContext:   Number,
+	VO2MaxTestType:     Number,
+	BloodGlucoseMeal:   Number,
+	FoodType:           Text,
+	MenstrualCycle:     Bool,
+	SexualProtection:   Bool,
+	WasTakenInLab:      Bool,
+	DeviceCalibrated:   Bool,
+}
+
+// Value is a parsed metadata entry.
+type Value struct {
+	Key     string
+	Kind    Kind
+	Text    string
+	Numeric *float64
+	Unit    string
+}
+
+// Bool returns the value of a boolean entry. HealthKit stores booleans as
+// "1" and "0".
+func (v Value) Bool() (bool, bool) {
+	if v.Kind != Bool || v.Numeric == nil {
+		return false, false
+	}
+
+	return *v.Numeric != 0, true
+}
+
+// splitQuantity splits "123 cm" into 123 and "cm".
+func splitQuantity(value string) (float64, string, bool) {
+	number, unit, found := strings.Cut(strings.TrimSpace(value), " ")
+	if !found {
+		return 0, "", false
+	}
+	parsed, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, "", false
+	}
+
+	return parsed, strings.TrimSpace(unit), true
+}
+
+func guess(value string) Kind {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return Number
+	}
+	if _, _, ok := splitQuantity(value); ok {
+		return Quantity
+	}
+
+	return Text
+}
+
+// Parse interprets the value of a metadata entry according to its key.
+// Text is always the original value.
+func Parse(key, value string) Value {
+	kind, ok := Keys[key]
+	if !ok {
+		kind = guess(value)
+	}
+
+	v := Value{Key: key, Kind: kind, Text: value}
+	switch kind {
+	case Bool, Number:
+		if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			v.Numeric = &parsed
+		}
+	case Quantity:
+		if parsed, unit, ok := splitQuantity(value); ok {
+			v.Numeric = &parsed
+			v.Unit = unit
+		} else if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			v.Numeric = &parsed
+		}
+	}
+
+	return v
+}
+
+var lengthToMeters = map[string]float64{
+	"m":  1,
+	"cm": 0.01,
+	"mm": 0.001,
+	"km": 1000,
+	"ft": 0.3048,
+	"in": 0.0254,
+	"yd": 0.9144,
+	"mi": 1609.344,
+}
+
+// Meters converts a length quantity to meters.
+func (v Value) Meters() (float64, bool) {
+	scale, ok := lengthToMeters[v.Unit]
+	if !ok || v.Numeric == nil {
+		return 0, false
+	}
+
+	return *v.Numeric * scale, true
+}
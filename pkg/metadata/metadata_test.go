@@ -0,0 +1,55 @@
+package metadata
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		key     string
+		value   string
+		kind    Kind
+		numeric *float64
+		unit    string
+	}{
+		{key: TimeZone, value: "America/Toronto", kind: Text},
+		{key: WasUserEntered, value: "1", kind: Bool, numeric: ptr(1.0)},
+		{key: IndoorWorkout, value: "0", kind: Bool, numeric: ptr(0.0)},
+		{key: ElevationAscended, value: "123 cm", kind: Quantity, numeric: ptr(123.0), unit: "cm"},
+		{key: AverageMETs, value: "5.2 kcal/hr·kg", kind: Quantity, numeric: ptr(5.2), unit: "kcal/hr·kg"},
+		{key: SyncIdentifier, value: "1234-ABCD", kind: Text},
+		{key: HeartRateContext, value: "2", kind: Number, numeric: ptr(2.0)},
+		{key: WeatherTemperature, value: "bogus", kind: Quantity},
+		// unknown keys are guessed from their value
+		{key: "MyApp.score", value: "42.5", kind: Number, numeric: ptr(42.5)},
+		{key: "MyApp.depth", value: "3 m", kind: Quantity, numeric: ptr(3.0), unit: "m"},
+		{key: "MyApp.label", value: "two words", kind: Text},
+	}
+
+	for _, test := range tests {
+		v := Parse(test.key, test.value)
+		if v.Kind != test.kind || v.Unit != test.unit || v.Text != test.value {
+			t.Errorf("Parse(%q, %q): unexpected %#v", test.key, test.value, v)
+		}
+		if (v.Numeric == nil) != (test.numeric == nil) || (v.Numeric != nil && *v.Numeric != *test.numeric) {
+			t.Errorf("Parse(%q, %q): expected numeric %v, got %v", test.key, test.value, test.numeric, v.Numeric)
+		}
+	}
+}
+
+func TestBoolAndMeters(t *testing.T) {
+	if b, ok := Parse(WasUserEntered, "1").Bool(); !ok || !b {
+		t.Errorf("expected HKWasUserEntered=1 to be true")
+	}
+	if _, ok := Parse(TimeZone, "1").Bool(); ok {
+		t.Errorf("expected a text entry not to be a boolean")
+	}
+	if m, ok := Parse(ElevationAscended, "123 cm").Meters(); !ok || m != 1.23 {
+		t.Errorf("expected 1.23 meters, got %v", m)
+	}
+	if _, ok := Parse(AverageMETs, "5.2 kcal/hr·kg").Meters(); ok {
+		t.Errorf("expected METs not to convert to meters")
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
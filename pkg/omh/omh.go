@@ -0,0 +1,353 @@
+package omh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/sleep"
+	"github.com/lsmoura/health/pkg/units"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dataPointSchema = "data-point-1.0"
+
+// Record types written as data points.
+const (
+	HeartRateType        = "HKQuantityTypeIdentifierHeartRate"
+	RestingHeartRateType = "HKQuantityTypeIdentifierRestingHeartRate"
+	StepCountType        = "HKQuantityTypeIdentifierStepCount"
+	BodyMassType         = "HKQuantityTypeIdentifierBodyMass"
+)
+
+// RecordTypes lists the record types written as data points.
+var RecordTypes = []string{BodyMassType, HeartRateType, RestingHeartRateType, StepCountType}
+
+type SchemaID struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+}
+
+// String returns the file name of a bundled schema, such as "heart-rate-2.0".
+func (s SchemaID) String() string {
+	return s.Name + "-" + s.Version
+}
+
+// Provenance is the acquisition_provenance of a header. Device is not part
+// of the Open mHealth schema, which allows additional properties.
+type Provenance struct {
+	SourceName             string `json:"source_name"`
+	SourceCreationDateTime string `json:"source_creation_date_time,omitempty"`
+	Modality               string `json:"modality,omitempty"`
+	Device                 string `json:"device,omitempty"`
+}
+
+type Header struct {
+	ID                    string      `json:"id"`
+	CreationDateTime      string      `json:"creation_date_time"`
+	SchemaID              SchemaID    `json:"schema_id"`
+	AcquisitionProvenance *Provenance `json:"acquisition_provenance,omitempty"`
+}
+
+// DataPoint is an Open mHealth data point. Body is one of the body types
+// of this package.
+type DataPoint struct {
+	Header Header `json:"header"`
+	Body   any    `json:"body"`
+}
+
+type UnitValue struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+type TimeInterval struct {
+	StartDateTime string `json:"start_date_time"`
+	EndDateTime   string `json:"end_date_time"`
+}
+
+// TimeFrame is either a point in time or an interval.
+type TimeFrame struct {
+	DateTime     string        `json:"date_time,omitempty"`
+	TimeInterval *TimeInterval `json:"time_interval,omitempty"`
+}
+
+type HeartRate struct {
+	HeartRate          UnitValue `json:"heart_rate"`
+	EffectiveTimeFrame TimeFrame `json:"effective_time_frame"`
+	// TemporalRelationship is "at rest" for resting heart rates.
+	TemporalRelationship string `json:"temporal_relationship_to_physical_activity,omitempty"`
+}
+
+type StepCount struct {
+	StepCount          float64   `json:"step_count"`
+	EffectiveTimeFrame TimeFrame `json:"effective_time_frame"`
+}
+
+type BodyWeight struct {
+	BodyWeight         UnitValue `json:"body_weight"`
+	EffectiveTimeFrame TimeFrame `json:"effective_time_frame"`
+}
+
+type PhysicalActivity struct {
+	ActivityName       string     `json:"activity_name"`
+	EffectiveTimeFrame TimeFrame  `json:"effective_time_frame"`
+	Distance           *UnitValue `json:"distance,omitempty"`
+	KcalBurned         *UnitValue `json:"kcal_burned,omitempty"`
+}
+
+type SleepEpisode struct {
+	EffectiveTimeFrame                   TimeFrame  `json:"effective_time_frame"`
+	TotalSleepTime                       UnitValue  `json:"total_sleep_time"`
+	NumberOfAwakenings                   int        `json:"number_of_awakenings"`
+	SleepMaintenanceEfficiencyPercentage *UnitValue `json:"sleep_maintenance_efficiency_percentage,omitempty"`
+}
+
+var (
+	heartRateSchema        = SchemaID{"omh", "heart-rate", "2.0"}
+	stepCountSchema        = SchemaID{"omh", "step-count", "2.0"}
+	bodyWeightSchema       = SchemaID{"omh", "body-weight", "1.0"}
+	physicalActivitySchema = SchemaID{"omh", "physical-activity", "1.2"}
+	sleepEpisodeSchema     = SchemaID{"omh", "sleep-episode", "1.0"}
+)
+
+// Schemas lists the schemas of the data points written by this package.
+var Schemas = []SchemaID{bodyWeightSchema, heartRateSchema, physicalActivitySchema, sleepEpisodeSchema, stepCountSchema}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+// dataPointID derives a UUID from what identifies a sample, so the same
+// sample keeps its id across exports.
+func dataPointID(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	sum[6] = sum[6]&0x0f | 0x50 // version 5, name based
+	sum[8] = sum[8]&0x3f | 0x80 // RFC 4122 variant
+	id := hex.EncodeToString(sum[:16])
+	return id[:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:]
+}
+
+// instant formats a time for dataPointID, whatever its offset.
+func instant(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// timeFrame returns a point in time, or an interval when end is later than
+// start.
+func timeFrame(start, end time.Time) TimeFrame {
+	if end.After(start) {
+		return interval(start, end)
+	}
+	return TimeFrame{DateTime: formatTime(start)}
+}
+
+func interval(start, end time.Time) TimeFrame {
+	return TimeFrame{TimeInterval: &TimeInterval{StartDateTime: formatTime(start), EndDateTime: formatTime(end)}}
+}
+
+// provenance describes where a sample comes from: sensed by a device, or
+// self-reported when it was entered by hand.
+func provenance(source, device string, created *health.HealthTime, userEntered *bool) *Provenance {
+	p := &Provenance{SourceName: source, Device: health.DeviceName(device)}
+	if created != nil {
+		p.SourceCreationDateTime = formatTime(time.Time(*created))
+	}
+	switch {
+	case userEntered != nil && *userEntered:
+		p.Modality = "self-reported"
+	case p.Device != "":
+		p.Modality = "sensed"
+	}
+
+	return p
+}
+
+func newDataPoint(schema SchemaID, id string, created time.Time, p *Provenance, body any) *DataPoint {
+	return &DataPoint{
+		Header: Header{ID: id, CreationDateTime: formatTime(created), SchemaID: schema, AcquisitionProvenance: p},
+		Body:   body,
+	}
+}
+
+// RecordDataPoint returns the data point of a record, if its type is one of
+// RecordTypes and its value is in a unit of the schema.
+func RecordDataPoint(r *health.Record) (*DataPoint, bool) {
+	if r.StartDate == nil || r.Value == nil {
+		return nil, false
+	}
+	value, err := strconv.ParseFloat(*r.Value, 64)
+	if err != nil {
+		return nil, false
+	}
+	var unit, device string
+	if r.Unit != nil {
+		unit = *r.Unit
+	}
+	if r.Device != nil {
+		device = *r.Device
+	}
+	start, end := time.Time(*r.StartDate), time.Time(*r.StartDate)
+	if r.EndDate != nil {
+		end = time.Time(*r.EndDate)
+	}
+
+	var schema SchemaID
+	var body any
+	switch {
+	case (r.Type == HeartRateType || r.Type == RestingHeartRateType) && unit == "count/min":
+		hr := HeartRate{HeartRate: UnitValue{value, "beats/min"}, EffectiveTimeFrame: timeFrame(start, end)}
+		if r.Type == RestingHeartRateType {
+			hr.TemporalRelationship = "at rest"
+		}
+		schema, body = heartRateSchema, hr
+	case r.Type == StepCountType && unit == "count":
+		schema, body = stepCountSchema, StepCount{StepCount: value, EffectiveTimeFrame: interval(start, end)}
+	case r.Type == BodyMassType:
+		kg, err := units.Convert(value, unit, "kg")
+		if err != nil {
+			return nil, false
+		}
+		schema, body = bodyWeightSchema, BodyWeight{BodyWeight: UnitValue{kg, "kg"}, EffectiveTimeFrame: timeFrame(start, end)}
+	default:
+		return nil, false
+	}
+
+	created := start
+	if r.CreationDate != nil {
+		created = time.Time(*r.CreationDate)
+	}
+	id := dataPointID(r.Type, r.SourceName, instant(start), *r.Value, unit)
+	return newDataPoint(schema, id, created, provenance(r.SourceName, device, r.CreationDate, r.WasUserEntered), body), true
+}
+
+// converted parses a total of a workout and converts it to unit.
+func converted(value, from, to string) *UnitValue {
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	out, err := units.Convert(parsed, from, to)
+	if err != nil {
+		return nil
+	}
+
+	return &UnitValue{out, to}
+}
+
+// WorkoutDataPoint returns a workout as a physical activity, named after
+// its activity type, such as "Running".
+func WorkoutDataPoint(w *health.Workout) (*DataPoint, bool) {
+	if w.StartDate == nil || w.EndDate == nil {
+		return nil, false
+	}
+	start, end := time.Time(*w.StartDate), time.Time(*w.EndDate)
+
+	body := PhysicalActivity{
+		ActivityName:       strings.TrimPrefix(w.WorkoutActivityType, "HKWorkoutActivityType"),
+		EffectiveTimeFrame: timeFrame(start, end),
+		Distance:           converted(w.TotalDistance, w.TotalDistanceUnit, "m"),
+		KcalBurned:         converted(w.TotalEnergyBurned, w.TotalEnergyBurnedUnit, "kcal"),
+	}
+
+	created := start
+	if w.CreationDate != nil {
+		created = time.Time(*w.CreationDate)
+	}
+	id := dataPointID(w.WorkoutActivityType, w.SourceName, instant(start), instant(end))
+	return newDataPoint(physicalActivitySchema, id, created, provenance(w.SourceName, w.Device, w.CreationDate, nil), body), true
+}
+
+// SleepDataPoint returns a sleep session as a sleep episode, from going to
+// bed to waking up.
+func SleepDataPoint(s *sleep.Session) *DataPoint {
+	body := SleepEpisode{
+		EffectiveTimeFrame: interval(s.BedTime, s.WakeTime),
+		TotalSleepTime:     UnitValue{s.Asleep.Minutes(), "min"},
+		NumberOfAwakenings: s.Awakenings,
+	}
+	if s.InBed() > 0 {
+		body.SleepMaintenanceEfficiencyPercentage = &UnitValue{s.Efficiency * 100, "%"}
+	}
+
+	id := dataPointID(sleep.RecordType, s.Source, instant(s.BedTime), instant(s.WakeTime))
+	return newDataPoint(sleepEpisodeSchema, id, s.WakeTime, &Provenance{SourceName: s.Source}, body)
+}
+
+// InvalidError is returned for a data point that does not match its schema.
+type InvalidError struct {
+	ID     string
+	Schema string
+	Issues []string
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("data point %s does not match %s: %s", e.ID, e.Schema, strings.Join(e.Issues, "; "))
+}
+
+// Validate checks a data point against the data point schema, and its body
+// against the schema named by its header.
+func Validate(p *DataPoint) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	return validate(p, data)
+}
+
+// validate checks data, the encoding of p.
+func validate(p *DataPoint, data []byte) error {
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	name := p.Header.SchemaID.String()
+	schema, ok := schemas[name]
+	if !ok {
+		return &InvalidError{ID: p.Header.ID, Schema: name, Issues: []string{"unknown schema"}}
+	}
+	issues := schemas[dataPointSchema].Validate(decoded)
+	for _, issue := range schema.Validate(decoded["body"]) {
+		issues = append(issues, "body."+strings.TrimPrefix(issue, "."))
+	}
+	if len(issues) > 0 {
+		return &InvalidError{ID: p.Header.ID, Schema: name, Issues: issues}
+	}
+
+	return nil
+}
+
+// Writer writes data points as NDJSON, one per line, after validating them.
+type Writer struct {
+	Written map[string]int // data points written, by schema
+
+	w io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{Written: make(map[string]int), w: w}
+}
+
+// Write writes a data point, or returns an *InvalidError without writing it
+// when it does not match its schema.
+func (w *Writer) Write(p *DataPoint) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	if err := validate(p, data); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	w.Written[p.Header.SchemaID.String()]++
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package omh
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/sleep"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func record(t *testing.T, data string) *health.Record {
+	t.Helper()
+
+	var r health.Record
+	if err := xml.Unmarshal([]byte(data), &r); err != nil {
+		t.Fatalf("xml.Unmarshal: %v", err)
+	}
+	return &r
+}
+
+// decode returns a data point as written, validating it first.
+func decode(t *testing.T, p *DataPoint) map[string]any {
+	t.Helper()
+
+	if err := Validate(p); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	return decoded
+}
+
+func TestRecordDataPoint(t *testing.T) {
+	p, ok := RecordDataPoint(record(t, `<Record type="HKQuantityTypeIdentifierHeartRate" sourceName="Jane's Watch" device="&lt;&lt;HKDevice: 0x1&gt;, name:Apple Watch&gt;" unit="count/min" value="62" creationDate="2022-01-01 08:01:00 -0300" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:00:00 -0300"/>`))
+	if !ok {
+		t.Fatalf("expected a data point")
+	}
+	expected := map[string]any{
+		"header": map[string]any{
+			"id":                 p.Header.ID,
+			"creation_date_time": "2022-01-01T08:01:00-03:00",
+			"schema_id":          map[string]any{"namespace": "omh", "name": "heart-rate", "version": "2.0"},
+			"acquisition_provenance": map[string]any{
+				"source_name":               "Jane's Watch",
+				"source_creation_date_time": "2022-01-01T08:01:00-03:00",
+				"modality":                  "sensed",
+				"device":                    "name:Apple Watch",
+			},
+		},
+		"body": map[string]any{
+			"heart_rate":           map[string]any{"value": 62.0, "unit": "beats/min"},
+			"effective_time_frame": map[string]any{"date_time": "2022-01-01T08:00:00-03:00"},
+		},
+	}
+	if decoded := decode(t, p); !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("expected %v, got %v", expected, decoded)
+	}
+	if len(p.Header.ID) != 36 || p.Header.ID[14] != '5' {
+		t.Errorf("expected a version 5 UUID, got %q", p.Header.ID)
+	}
+
+	p, ok = RecordDataPoint(record(t, `<Record type="HKQuantityTypeIdentifierStepCount" sourceName="Phone" unit="count" value="120" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:10:00 -0300"/>`))
+	if !ok {
+		t.Fatalf("expected a data point")
+	}
+	body := decode(t, p)["body"].(map[string]any)
+	interval := map[string]any{"time_interval": map[string]any{"start_date_time": "2022-01-01T08:00:00-03:00", "end_date_time": "2022-01-01T08:10:00-03:00"}}
+	if body["step_count"] != 120.0 || !reflect.DeepEqual(body["effective_time_frame"], interval) {
+		t.Errorf("unexpected body %v", body)
+	}
+	if p.Header.AcquisitionProvenance.Modality != "" {
+		t.Errorf("expected no modality without a device, got %q", p.Header.AcquisitionProvenance.Modality)
+	}
+
+	r := record(t, `<Record type="HKQuantityTypeIdentifierBodyMass" sourceName="Health" unit="lb" value="154.3" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:00:00 -0300"/>`)
+	r.WasUserEntered = ptr(true)
+	p, ok = RecordDataPoint(r)
+	if !ok {
+		t.Fatalf("expected a data point")
+	}
+	weight := p.Body.(BodyWeight).BodyWeight
+	if math.Abs(weight.Value-69.989) > 0.001 || weight.Unit != "kg" || p.Header.AcquisitionProvenance.Modality != "self-reported" {
+		t.Errorf("unexpected data point %+v", p)
+	}
+
+	p, ok = RecordDataPoint(record(t, `<Record type="HKQuantityTypeIdentifierRestingHeartRate" sourceName="Watch" unit="count/min" value="52" startDate="2022-01-01 00:00:00 -0300" endDate="2022-01-01 23:59:00 -0300"/>`))
+	if !ok || p.Body.(HeartRate).TemporalRelationship != "at rest" {
+		t.Errorf("unexpected data point %+v", p)
+	}
+
+	for _, data := range []string{
+		`<Record type="HKQuantityTypeIdentifierHeartRate" sourceName="Watch" unit="count/s" value="1" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:00:00 -0300"/>`,
+		`<Record type="HKQuantityTypeIdentifierBodyMass" sourceName="Watch" unit="kg" value="heavy" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:00:00 -0300"/>`,
+		`<Record type="HKQuantityTypeIdentifierBodyFatPercentage" sourceName="Scale" unit="%" value="0.2" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:00:00 -0300"/>`,
+	} {
+		if p, ok := RecordDataPoint(record(t, data)); ok {
+			t.Errorf("unexpected data point %+v", p)
+		}
+	}
+}
+
+func TestWorkoutDataPoint(t *testing.T) {
+	data := `<Workout workoutActivityType="HKWorkoutActivityTypeRunning" duration="30" durationUnit="min" totalDistance="3.1" totalDistanceUnit="mi" totalEnergyBurned="1200" totalEnergyBurnedUnit="kJ" sourceName="Watch" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:30:00 -0300"/>`
+	var w health.Workout
+	if err := xml.Unmarshal([]byte(data), &w); err != nil {
+		t.Fatalf("xml.Unmarshal: %v", err)
+	}
+
+	p, ok := WorkoutDataPoint(&w)
+	if !ok {
+		t.Fatalf("expected a data point")
+	}
+	decode(t, p)
+	body := p.Body.(PhysicalActivity)
+	if body.ActivityName != "Running" || body.EffectiveTimeFrame.TimeInterval == nil {
+		t.Errorf("unexpected body %+v", body)
+	}
+	if body.Distance == nil || math.Abs(body.Distance.Value-4988.97) > 0.01 || body.Distance.Unit != "m" {
+		t.Errorf("unexpected distance %+v", body.Distance)
+	}
+	if body.KcalBurned == nil || math.Abs(body.KcalBurned.Value-286.807) > 0.001 {
+		t.Errorf("unexpected energy %+v", body.KcalBurned)
+	}
+
+	w.TotalDistance, w.TotalEnergyBurned = "", ""
+	p, _ = WorkoutDataPoint(&w)
+	if body := p.Body.(PhysicalActivity); body.Distance != nil || body.KcalBurned != nil {
+		t.Errorf("expected no totals, got %+v", body)
+	}
+}
+
+func TestSleepDataPoint(t *testing.T) {
+	bed := time.Date(2022, 3, 1, 23, 0, 0, 0, time.UTC)
+	s := &sleep.Session{Source: "Watch", BedTime: bed, WakeTime: bed.Add(8 * time.Hour), Asleep: 7 * time.Hour, Awakenings: 2, Efficiency: 0.875}
+
+	body := decode(t, SleepDataPoint(s))["body"].(map[string]any)
+	expected := map[string]any{
+		"effective_time_frame":                    map[string]any{"time_interval": map[string]any{"start_date_time": "2022-03-01T23:00:00Z", "end_date_time": "2022-03-02T07:00:00Z"}},
+		"total_sleep_time":                        map[string]any{"value": 420.0, "unit": "min"},
+		"number_of_awakenings":                    2.0,
+		"sleep_maintenance_efficiency_percentage": map[string]any{"value": 87.5, "unit": "%"},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Errorf("expected %v, got %v", expected, body)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out)
+
+	valid, _ := RecordDataPoint(record(t, `<Record type="HKQuantityTypeIdentifierStepCount" sourceName="Phone" unit="count" value="120" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:10:00 -0300"/>`))
+	if err := w.Write(valid); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	invalid, _ := RecordDataPoint(record(t, `<Record type="HKQuantityTypeIdentifierStepCount" sourceName="Phone" unit="count" value="-3" startDate="2022-01-01 08:00:00 -0300" endDate="2022-01-01 08:10:00 -0300"/>`))
+	err := w.Write(invalid)
+	var invalidErr *InvalidError
+	if !errors.As(err, &invalidErr) || invalidErr.Schema != "step-count-2.0" || !reflect.DeepEqual(invalidErr.Issues, []string{"body.step_count: -3 is less than 0"}) {
+		t.Fatalf("expected an invalid data point, got %v", err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 1 || w.Written["step-count-2.0"] != 1 {
+		t.Errorf("expected a single data point, got %v:\n%s", w.Written, out.String())
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,197 @@
+package omh
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The schemas are condensed from the Open mHealth ones: each file inlines
+// the definitions it refers to, so a schema never refers to another file.
+//
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// Schema is the subset of JSON Schema (draft 4) the bundled schemas use.
+type Schema struct {
+	Ref         string             `json:"$ref"`
+	Type        string             `json:"type"`
+	Required    []string           `json:"required"`
+	Properties  map[string]*Schema `json:"properties"`
+	Enum        []any              `json:"enum"`
+	Minimum     *float64           `json:"minimum"`
+	Maximum     *float64           `json:"maximum"`
+	Format      string             `json:"format"`
+	OneOf       []*Schema          `json:"oneOf"`
+	Definitions map[string]*Schema `json:"definitions"`
+}
+
+var schemas = loadSchemas()
+
+// loadSchemas reads the bundled schemas, by file name without extension,
+// such as "heart-rate-2.0".
+func loadSchemas() map[string]*Schema {
+	names, err := schemaFiles.ReadDir("schemas")
+	if err != nil {
+		panic(err)
+	}
+
+	loaded := make(map[string]*Schema)
+	for _, entry := range names {
+		data, err := schemaFiles.ReadFile(path.Join("schemas", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var s Schema
+		if err := json.Unmarshal(data, &s); err != nil {
+			panic(fmt.Sprintf("%s: %v", entry.Name(), err))
+		}
+		loaded[strings.TrimSuffix(entry.Name(), ".json")] = &s
+	}
+
+	return loaded
+}
+
+// Validate checks a value decoded by encoding/json against the schema, and
+// returns where it does not match, such as "heart_rate.unit: not one of
+// [beats/min]".
+func (s *Schema) Validate(value any) []string {
+	v := validator{root: s}
+	v.validate(s, value, "")
+	return v.issues
+}
+
+type validator struct {
+	root   *Schema
+	issues []string
+}
+
+func (v *validator) fail(at, format string, args ...any) {
+	if at == "" {
+		at = "."
+	}
+	v.issues = append(v.issues, at+": "+fmt.Sprintf(format, args...))
+}
+
+func join(at, name string) string {
+	if at == "" {
+		return name
+	}
+	return at + "." + name
+}
+
+// resolve follows a reference to the definitions of the root schema.
+func (v *validator) resolve(s *Schema) (*Schema, error) {
+	for s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/definitions/")
+		target, ok := v.root.Definitions[name]
+		if name == s.Ref || !ok {
+			return nil, fmt.Errorf("unknown reference %q", s.Ref)
+		}
+		s = target
+	}
+
+	return s, nil
+}
+
+func typeOf(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+
+	return fmt.Sprintf("%T", value)
+}
+
+func (v *validator) validate(s *Schema, value any, at string) {
+	s, err := v.resolve(s)
+	if err != nil {
+		v.fail(at, "%v", err)
+		return
+	}
+
+	kind := typeOf(value)
+	if s.Type != "" && s.Type != kind && !(s.Type == "number" && kind == "integer") {
+		v.fail(at, "expected %s, got %s", s.Type, kind)
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(at, "not one of %v", s.Enum)
+		}
+	}
+
+	if number, ok := value.(float64); ok {
+		if s.Minimum != nil && number < *s.Minimum {
+			v.fail(at, "%v is less than %v", number, *s.Minimum)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			v.fail(at, "%v is more than %v", number, *s.Maximum)
+		}
+	}
+
+	if text, ok := value.(string); ok && s.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339Nano, text); err != nil {
+			v.fail(at, "invalid date-time %q", text)
+		}
+	}
+
+	if object, ok := value.(map[string]any); ok {
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				v.fail(at, "missing %s", name)
+			}
+		}
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if field, ok := object[name]; ok {
+				v.validate(s.Properties[name], field, join(at, name))
+			}
+		}
+	}
+
+	if len(s.OneOf) > 0 {
+		matches := 0
+		for _, option := range s.OneOf {
+			sub := validator{root: v.root}
+			sub.validate(option, value, at)
+			if len(sub.issues) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			v.fail(at, "matches %d of the oneOf schemas instead of 1", matches)
+		}
+	}
+}
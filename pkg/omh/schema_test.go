@@ -0,0 +1,67 @@
+package omh
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSchemasAreBundled(t *testing.T) {
+	if _, ok := schemas[dataPointSchema]; !ok {
+		t.Errorf("missing %s", dataPointSchema)
+	}
+	for _, schema := range Schemas {
+		if _, ok := schemas[schema.String()]; !ok {
+			t.Errorf("missing %s", schema)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		schema   string
+		document string
+		issues   []string
+	}{
+		{
+			"heart-rate-2.0",
+			`{"heart_rate": {"value": 60, "unit": "beats/min"}, "effective_time_frame": {"date_time": "2022-01-01T08:00:00Z"}}`,
+			nil,
+		},
+		{
+			"heart-rate-2.0",
+			`{"heart_rate": {"value": "60", "unit": "bpm"}}`,
+			[]string{".: missing effective_time_frame", "heart_rate.unit: not one of [beats/min]", "heart_rate.value: expected number, got string"},
+		},
+		{
+			"heart-rate-2.0",
+			`{"heart_rate": {"value": 60, "unit": "beats/min"}, "effective_time_frame": {"date_time": "yesterday"}}`,
+			[]string{"effective_time_frame.date_time: invalid date-time \"yesterday\""},
+		},
+		{
+			"body-weight-1.0",
+			`{"body_weight": {"value": 70, "unit": "kg"}, "effective_time_frame": {"date_time": "2022-01-01T08:00:00Z", "time_interval": {"start_date_time": "2022-01-01T08:00:00Z", "end_date_time": "2022-01-01T09:00:00Z"}}}`,
+			[]string{"effective_time_frame: matches 2 of the oneOf schemas instead of 1"},
+		},
+		{
+			"sleep-episode-1.0",
+			`{"effective_time_frame": {"time_interval": {"start_date_time": "2022-01-01T23:00:00Z", "end_date_time": "2022-01-02T07:00:00Z"}}, "number_of_awakenings": 1.5, "sleep_maintenance_efficiency_percentage": {"value": 120, "unit": "%"}}`,
+			[]string{"number_of_awakenings: expected integer, got number", "sleep_maintenance_efficiency_percentage.value: 120 is more than 100"},
+		},
+		{
+			"data-point-1.0",
+			`{"header": {"id": "1", "creation_date_time": "2022-01-01T08:00:00Z", "schema_id": {"namespace": "omh", "name": "step-count"}, "acquisition_provenance": {"source_name": "Phone", "modality": "guessed"}}, "body": {}}`,
+			[]string{"header.acquisition_provenance.modality: not one of [sensed self-reported]", "header.schema_id: missing version"},
+		},
+	}
+
+	for _, test := range tests {
+		var document any
+		if err := json.Unmarshal([]byte(test.document), &document); err != nil {
+			t.Fatalf("json.Unmarshal: %v", err)
+		}
+		if issues := schemas[test.schema].Validate(document); !reflect.DeepEqual(issues, test.issues) {
+			t.Errorf("%s %s: expected %q, got %q", test.schema, test.document, test.issues, issues)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package openmetrics
+
+import (
+	"bufio"
+	"context"
+	"github.com/lsmoura/health/pkg/dedup"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/pipeline"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Prefix is prepended to every metric name.
+const Prefix = "health_"
+
+var typePrefixes = []string{
+	"HKQuantityTypeIdentifier",
+	"HKCategoryTypeIdentifier",
+	"HKDataTypeIdentifier",
+	"HK",
+}
+
+// unitNames maps HealthKit units to the suffixes of metric names. Units
+// that are not listed are spelled out, like "mg/dL" as "mg_per_dl".
+var unitNames = map[string]string{
+	"count":     "",
+	"count/min": "bpm",
+	"%":         "ratio",
+	"kcal":      "kilocalories",
+	"Cal":       "kilocalories",
+	"kJ":        "kilojoules",
+	"m":         "meters",
+	"cm":        "centimeters",
+	"km":        "kilometers",
+	"in":        "inches",
+	"ft":        "feet",
+	"mi":        "miles",
+	"g":         "grams",
+	"mg":        "milligrams",
+	"mcg":       "micrograms",
+	"kg":        "kilograms",
+	"lb":        "pounds",
+	"mL":        "milliliters",
+	"L":         "liters",
+	"fl_oz_us":  "fluid_ounces",
+	"ms":        "milliseconds",
+	"s":         "seconds",
+	"min":       "minutes",
+	"hr":        "hours",
+	"degC":      "celsius",
+	"degF":      "fahrenheit",
+	"dBASPL":    "decibels",
+	"dBHL":      "decibels",
+	"mmHg":      "mmhg",
+	"W":         "watts",
+	"lx":        "lux",
+}
+
+var (
+	annotation = regexp.MustCompile(`<[^>]*>`) // like mmol<180.15588>/L
+	invalid    = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// snakeCase turns a name like "HeartRateVariabilitySDNN" into
+// "heart_rate_variability_sdnn".
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			previous := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
+
+// UnitName returns the suffix of the metric names of a unit, empty for
+// plain counts.
+func UnitName(unit string) string {
+	if name, ok := unitNames[unit]; ok {
+		return name
+	}
+
+	unit = annotation.ReplaceAllString(unit, "")
+	unit = strings.ToLower(strings.ReplaceAll(unit, "/", "_per_"))
+	return strings.Trim(invalid.ReplaceAllString(unit, "_"), "_")
+}
+
+// MetricName returns the name of the metric family of a record type, like
+// "health_heart_rate_bpm" for HKQuantityTypeIdentifierHeartRate in count/min.
+func MetricName(recordType, unit string) string {
+	for _, prefix := range typePrefixes {
+		if strings.HasPrefix(recordType, prefix) {
+			recordType = strings.TrimPrefix(recordType, prefix)
+			break
+		}
+	}
+
+	name := Prefix + strings.Trim(invalid.ReplaceAllString(snakeCase(recordType), "_"), "_")
+	if suffix := UnitName(unit); suffix != "" && !strings.HasSuffix(name, "_"+suffix) {
+		name += "_" + suffix
+	}
+
+	return name
+}
+
+type sample struct {
+	id     int64
+	labels string
+	time   time.Time
+	value  float64
+}
+
+type family struct {
+	name       string
+	recordType string
+	unit       string
+	counter    bool
+	samples    []sample
+}
+
+// Writer is a pipeline.Sink that keeps the numeric records of an import and
+// writes them as OpenMetrics samples with their start date as timestamp.
+// Cumulative types, like steps, are counters of their running total; other
+// types are gauges.
+type Writer struct {
+	columns struct {
+		id, kind, unit, value, source, device, start int
+	}
+
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+func index(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// NewWriter returns a writer for the rows of tables, as listed by
+// importer.Tables.
+func NewWriter(tables []pipeline.Table) *Writer {
+	w := &Writer{families: make(map[string]*family)}
+	for _, table := range tables {
+		if table.Name != "records" {
+			continue
+		}
+		w.columns.id = index(table.Columns, "id")
+		w.columns.kind = index(table.Columns, "type")
+		w.columns.unit = index(table.Columns, "unit")
+		w.columns.value = index(table.Columns, "value")
+		w.columns.source = index(table.Columns, "source_name")
+		w.columns.device = index(table.Columns, "device")
+		w.columns.start = index(table.Columns, "start_date")
+	}
+
+	return w
+}
+
+func text(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case *string:
+		if v != nil {
+			return *v
+		}
+	}
+
+	return ""
+}
+
+func date(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case health.HealthTime:
+		return time.Time(v), true
+	case *health.HealthTime:
+		if v != nil {
+			return time.Time(*v), true
+		}
+	case time.Time:
+		return v, !v.IsZero()
+	}
+
+	return time.Time{}, false
+}
+
+// escape escapes a label value.
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func labels(source, device string) string {
+	pairs := []string{`source="` + escape(source) + `"`}
+	if device != "" {
+		pairs = append(pairs, `device="`+escape(device)+`"`)
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (w *Writer) Write(ctx context.Context, table string, values []any) error {
+	if table != "records" {
+		return nil
+	}
+
+	at := func(i int) any {
+		if i < 0 || i >= len(values) {
+			return nil
+		}
+		return values[i]
+	}
+
+	value, err := strconv.ParseFloat(text(at(w.columns.value)), 64)
+	if err != nil {
+		return nil // category values, like sleep stages
+	}
+	start, ok := date(at(w.columns.start))
+	if !ok {
+		return nil
+	}
+	id, _ := at(w.columns.id).(int64)
+	recordType, unit := text(at(w.columns.kind)), text(at(w.columns.unit))
+
+	s := sample{
+		id:     id,
+		labels: labels(text(at(w.columns.source)), health.DeviceName(text(at(w.columns.device)))),
+		time:   start,
+		value:  value,
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	name := MetricName(recordType, unit)
+	f := w.families[name]
+	if f == nil {
+		f = &family{name: name, recordType: recordType, unit: UnitName(unit), counter: dedup.Cumulative[recordType]}
+		w.families[name] = f
+	}
+	f.samples = append(f.samples, s)
+
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', -1, 64)
+}
+
+func (f *family) write(w *bufio.Writer) {
+	kind, sampleName := "gauge", f.name
+	if f.counter {
+		kind, sampleName = "counter", f.name+"_total"
+	}
+	w.WriteString("# TYPE " + f.name + " " + kind + "\n")
+	if f.unit != "" {
+		w.WriteString("# UNIT " + f.name + " " + f.unit + "\n")
+	}
+	w.WriteString("# HELP " + f.name + " " + f.recordType + "\n")
+
+	sort.Slice(f.samples, func(i, j int) bool {
+		a, b := f.samples[i], f.samples[j]
+		if a.labels != b.labels {
+			return a.labels < b.labels
+		}
+		if !a.time.Equal(b.time) {
+			return a.time.Before(b.time)
+		}
+		return a.id < b.id
+	})
+
+	var total float64
+	for i, s := range f.samples {
+		total += s.value
+		// a series takes a single value per timestamp: the last one, or
+		// the total of all of them for counters
+		if i+1 < len(f.samples) {
+			next := f.samples[i+1]
+			if next.labels == s.labels && formatTime(next.time) == formatTime(s.time) {
+				continue
+			}
+		}
+
+		value := s.value
+		if f.counter {
+			value = total
+		}
+		w.WriteString(sampleName + s.labels + " " + strconv.FormatFloat(value, 'g', -1, 64) + " " + formatTime(s.time) + "\n")
+
+		if i+1 < len(f.samples) && f.samples[i+1].labels != s.labels {
+			total = 0
+		}
+	}
+}
+
+// WriteTo writes the samples kept so far, one metric family after the other
+// and sorted by time within each series, as expected by
+// promtool tsdb create-blocks-from openmetrics.
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	names := make([]string, 0, len(w.families))
+	for name := range w.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	counter := &countingWriter{w: out}
+	b := bufio.NewWriter(counter)
+	for _, name := range names {
+		w.families[name].write(b)
+	}
+	b.WriteString("# EOF\n")
+	err := b.Flush()
+
+	return counter.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,71 @@
+package openmetrics
+
+import (
+	"bytes"
+	"context"
+	"github.com/lsmoura/health/pkg/importer"
+	"github.com/lsmoura/health/pkg/pipeline"
+	"strings"
+	"testing"
+)
+
+func TestMetricName(t *testing.T) {
+	tests := []struct {
+		recordType string
+		unit       string
+		name       string
+	}{
+		{"HKQuantityTypeIdentifierHeartRate", "count/min", "health_heart_rate_bpm"},
+		{"HKQuantityTypeIdentifierStepCount", "count", "health_step_count"},
+		{"HKQuantityTypeIdentifierHeartRateVariabilitySDNN", "ms", "health_heart_rate_variability_sdnn_milliseconds"},
+		{"HKQuantityTypeIdentifierVO2Max", "mL/min·kg", "health_vo2_max_ml_per_min_kg"},
+		{"HKQuantityTypeIdentifierDietaryVitaminB12", "mcg", "health_dietary_vitamin_b12_micrograms"},
+		{"HKQuantityTypeIdentifierBloodGlucose", "mmol<180.1558800000541>/L", "health_blood_glucose_mmol_per_l"},
+		{"HKQuantityTypeIdentifierOxygenSaturation", "%", "health_oxygen_saturation_ratio"},
+	}
+	for _, test := range tests {
+		if got := MetricName(test.recordType, test.unit); got != test.name {
+			t.Errorf("MetricName(%s, %s): expected %s, got %s", test.recordType, test.unit, test.name, got)
+		}
+	}
+}
+
+const export = `<?xml version="1.0" encoding="UTF-8"?>
+<HealthData locale="en_US">
+ <Record type="HKQuantityTypeIdentifierStepCount" sourceName="iPhone" unit="count" value="20" startDate="2022-01-01 11:00:00 -0500" endDate="2022-01-01 11:05:00 -0500"/>
+ <Record type="HKQuantityTypeIdentifierStepCount" sourceName="iPhone" unit="count" value="10" startDate="2022-01-01 10:00:00 -0500" endDate="2022-01-01 10:05:00 -0500"/>
+ <Record type="HKQuantityTypeIdentifierStepCount" sourceName="Jane's &quot;Watch&quot;" unit="count" value="5" startDate="2022-01-01 10:00:00 -0500" endDate="2022-01-01 10:01:00 -0500"/>
+ <Record type="HKQuantityTypeIdentifierHeartRate" sourceName="Watch" device="&lt;&lt;HKDevice: 0x1&gt;, name:Apple Watch&gt;" unit="count/min" value="61" startDate="2022-01-01 10:00:00 -0500" endDate="2022-01-01 10:00:00 -0500"/>
+ <Record type="HKQuantityTypeIdentifierHeartRate" sourceName="Watch" device="&lt;&lt;HKDevice: 0x1&gt;, name:Apple Watch&gt;" unit="count/min" value="62.5" startDate="2022-01-01 10:00:00 -0500" endDate="2022-01-01 10:00:00 -0500"/>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="Watch" value="HKCategoryValueSleepAnalysisAsleepCore" startDate="2022-01-01 01:00:00 -0500" endDate="2022-01-01 02:00:00 -0500"/>
+</HealthData>
+`
+
+func TestWriter(t *testing.T) {
+	var imp importer.Importer
+	w := NewWriter(importer.Tables())
+	if err := pipeline.Run(context.Background(), strings.NewReader(export), 2, imp.Handler(w)); err != nil {
+		t.Fatalf("pipeline.Run: %v", err)
+	}
+
+	var out bytes.Buffer
+	if _, err := w.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	// heart rates of the same time keep the last one, steps are totals
+	expected := `# TYPE health_heart_rate_bpm gauge
+# UNIT health_heart_rate_bpm bpm
+# HELP health_heart_rate_bpm HKQuantityTypeIdentifierHeartRate
+health_heart_rate_bpm{source="Watch",device="name:Apple Watch"} 62.5 1641049200
+# TYPE health_step_count counter
+# HELP health_step_count HKQuantityTypeIdentifierStepCount
+health_step_count_total{source="Jane's \"Watch\""} 5 1641049200
+health_step_count_total{source="iPhone"} 10 1641049200
+health_step_count_total{source="iPhone"} 30 1641052800
+# EOF
+`
+	if got := out.String(); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
@@ -0,0 +1,147 @@
+package person
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// DefaultName is the person of the commands run without one, so a database
+// holding a single person never has to name them.
+const DefaultName = "default"
+
+// ErrNotFound is returned for a person missing from the persons table.
+var ErrNotFound = errors.New("person not found")
+
+// Person is a row of the persons table.
+type Person struct {
+	ID        int64
+	Name      string
+	Role      *string // database role seeing their rows
+	CreatedAt time.Time
+}
+
+// Ensure returns the id of the named person, adding them when they are
+// missing.
+func Ensure(ctx context.Context, pool *pgxpool.Pool, name string) (int64, error) {
+	var id int64
+	err := pool.QueryRow(ctx, `
+		INSERT INTO persons (name) VALUES ($1)
+		ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id`, name).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("pool.QueryRow: %w", err)
+	}
+
+	return id, nil
+}
+
+// Lookup returns the id of the named person.
+func Lookup(ctx context.Context, pool *pgxpool.Pool, name string) (int64, error) {
+	var id int64
+	err := pool.QueryRow(ctx, "SELECT id FROM persons WHERE name = $1", name).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%q: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("pool.QueryRow: %w", err)
+	}
+
+	return id, nil
+}
+
+// List returns every person, by name.
+func List(ctx context.Context, pool *pgxpool.Pool) ([]Person, error) {
+	rows, err := pool.Query(ctx, "SELECT id, name, role, created_at FROM persons ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var persons []Person
+	for rows.Next() {
+		var p Person
+		if err := rows.Scan(&p.ID, &p.Name, &p.Role, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		persons = append(persons, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return persons, nil
+}
+
+// SetRole sets the database role that sees the rows of a person under the
+// row level security policies. A nil role hides them from every role.
+func SetRole(ctx context.Context, pool *pgxpool.Pool, id int64, role *string) error {
+	if _, err := pool.Exec(ctx, "UPDATE persons SET role = $2 WHERE id = $1", id, role); err != nil {
+		return fmt.Errorf("pool.Exec: %w", err)
+	}
+
+	return nil
+}
+
+// tables lists the tables with a person_id column.
+func tables(ctx context.Context, tx pgx.Tx) ([]string, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT c.table_name
+		FROM information_schema.columns c
+		JOIN information_schema.tables USING (table_schema, table_name)
+		WHERE c.table_schema = current_schema()
+		  AND c.column_name = 'person_id'
+		  AND table_type = 'BASE TABLE'
+		ORDER BY c.table_name`)
+	if err != nil {
+		return nil, fmt.Errorf("tx.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// Remove deletes a person and their rows from every table, and returns how
+// many rows were deleted from each table.
+func Remove(ctx context.Context, pool *pgxpool.Pool, id int64) (map[string]int64, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	names, err := tables(ctx, tx)
+	if err != nil {
+		return nil, fmt.Errorf("tables: %w", err)
+	}
+
+	counts := make(map[string]int64, len(names))
+	for _, name := range names {
+		tag, err := tx.Exec(ctx, "DELETE FROM "+pgx.Identifier{name}.Sanitize()+" WHERE person_id = $1", id)
+		if err != nil {
+			return nil, fmt.Errorf("DELETE FROM %s: %w", name, err)
+		}
+		counts[name] = tag.RowsAffected()
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM persons WHERE id = $1", id); err != nil {
+		return nil, fmt.Errorf("DELETE FROM persons: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("tx.Commit: %w", err)
+	}
+
+	return counts, nil
+}
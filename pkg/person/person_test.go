@@ -0,0 +1,154 @@
+package person
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/importer"
+	"os"
+	"strings"
+	"testing"
+)
+
+const export = `<?xml version="1.0" encoding="UTF-8"?>
+<HealthData locale="en_US">
+ <Record type="HKQuantityTypeIdentifierStepCount" sourceName="iPhone" unit="count" value="10" startDate="2022-01-01 10:00:00 -0500" endDate="2022-01-01 10:05:00 -0500"/>
+ <Record type="HKQuantityTypeIdentifierStepCount" sourceName="iPhone" unit="count" value="20" startDate="2022-01-01 11:00:00 -0500" endDate="2022-01-01 11:05:00 -0500"/>
+ <Workout workoutActivityType="HKWorkoutActivityTypeRunning" duration="30" durationUnit="min" sourceName="Watch" startDate="2022-01-01 12:00:00 -0500" endDate="2022-01-01 12:30:00 -0500"/>
+</HealthData>
+`
+
+// testPool recreates the tables of the database of HEALTH_TEST_DSN, with
+// their row level security policies, so it must be a throwaway database.
+func testPool(t *testing.T) *pgxpool.Pool {
+	dsn := os.Getenv("HEALTH_TEST_DSN")
+	if dsn == "" {
+		t.Skip("HEALTH_TEST_DSN is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("pgxpool.New: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	schema, err := health.Schema()
+	if err != nil {
+		t.Fatalf("health.Schema: %v", err)
+	}
+	if _, err := pool.Exec(ctx, schema); err != nil {
+		t.Fatalf("apply schema: %v", err)
+	}
+	policies, err := health.Policies()
+	if err != nil {
+		t.Fatalf("health.Policies: %v", err)
+	}
+	if _, err := pool.Exec(ctx, policies); err != nil {
+		t.Fatalf("apply policies: %v", err)
+	}
+
+	return pool
+}
+
+func count(t *testing.T, pool *pgxpool.Pool, table string, id int64) int64 {
+	var n int64
+	if err := pool.QueryRow(context.Background(), "SELECT COUNT(*) FROM "+table+" WHERE person_id = $1", id).Scan(&n); err != nil {
+		t.Fatalf("count %s: %v", table, err)
+	}
+	return n
+}
+
+func TestPolicies(t *testing.T) {
+	pool := testPool(t)
+
+	tables, err := health.SchemaTables()
+	if err != nil {
+		t.Fatalf("health.SchemaTables: %v", err)
+	}
+	var policies int
+	err = pool.QueryRow(context.Background(),
+		"SELECT COUNT(*) FROM pg_policies WHERE schemaname = current_schema() AND policyname = 'person_rows'").Scan(&policies)
+	if err != nil {
+		t.Fatalf("pg_policies: %v", err)
+	}
+	if policies != len(tables) {
+		t.Errorf("expected a policy on each of the %d tables, got %d", len(tables), policies)
+	}
+}
+
+func TestPersons(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+
+	ids := make(map[string]int64)
+	for _, name := range []string{"alice", "bob"} {
+		id, err := Ensure(ctx, pool, name)
+		if err != nil {
+			t.Fatalf("Ensure(%s): %v", name, err)
+		}
+		ids[name] = id
+
+		imp := importer.Importer{Pool: pool, PersonID: id, Workers: 2, BatchSize: 100}
+		if err := imp.Import(ctx, strings.NewReader(export)); err != nil {
+			t.Fatalf("Import(%s): %v", name, err)
+		}
+	}
+	if id, err := Ensure(ctx, pool, "alice"); err != nil || id != ids["alice"] {
+		t.Errorf("Ensure of an existing person: expected %d, got %d (%v)", ids["alice"], id, err)
+	}
+	if id, err := Lookup(ctx, pool, "bob"); err != nil || id != ids["bob"] {
+		t.Errorf("Lookup: expected %d, got %d (%v)", ids["bob"], id, err)
+	}
+	if _, err := Lookup(ctx, pool, "carol"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup of a missing person: expected ErrNotFound, got %v", err)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		t.Fatalf("pool.Begin: %v", err)
+	}
+	var current int64
+	if _, err := tx.Exec(ctx, "SELECT set_config('health.person', 'bob', true)"); err != nil {
+		t.Fatalf("set_config: %v", err)
+	}
+	if err := tx.QueryRow(ctx, "SELECT health_person()").Scan(&current); err != nil || current != ids["bob"] {
+		t.Errorf("health_person: expected %d, got %d (%v)", ids["bob"], current, err)
+	}
+	tx.Rollback(ctx)
+
+	role := "bob"
+	if err := SetRole(ctx, pool, ids["bob"], &role); err != nil {
+		t.Fatalf("SetRole: %v", err)
+	}
+	persons, err := List(ctx, pool)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(persons) != 2 || persons[0].Role != nil || persons[1].Role == nil || *persons[1].Role != "bob" {
+		t.Errorf("unexpected persons %+v", persons)
+	}
+
+	counts, err := Remove(ctx, pool, ids["alice"])
+	if err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if counts["records"] != 2 || counts["workouts"] != 1 || counts["imports"] != 1 {
+		t.Errorf("unexpected removed rows %v", counts)
+	}
+	for _, table := range []string{"records", "workouts", "imports"} {
+		if n := count(t, pool, table, ids["alice"]); n != 0 {
+			t.Errorf("expected no %s of alice, got %d", table, n)
+		}
+	}
+	if n := count(t, pool, "records", ids["bob"]); n != 2 {
+		t.Errorf("expected the 2 records of bob to be kept, got %d", n)
+	}
+	if n := count(t, pool, "workouts", ids["bob"]); n != 1 {
+		t.Errorf("expected the workout of bob to be kept, got %d", n)
+	}
+	if _, err := Lookup(ctx, pool, "alice"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected alice to be removed, got %v", err)
+	}
+}
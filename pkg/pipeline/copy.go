@@ -0,0 +1,157 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"sync"
+)
+
+// Sink receives the rows produced by handlers.
+type Sink interface {
+	Write(ctx context.Context, table string, values []any) error
+}
+
+// Table describes a destination table of a CopyWriter.
+type Table struct {
+	Name    string
+	Columns []string
+}
+
+type tableWriter struct {
+	table Table
+	rows  chan []any
+	count int64
+}
+
+// CopyWriter streams rows into their tables with COPY. Each table has its
+// own goroutine that groups rows in batches, so a connection is only held
+// while a batch is being copied and the number of tables is not bounded by
+// the pool size.
+type CopyWriter struct {
+	pool      *pgxpool.Pool
+	batchSize int
+	tables    map[string]*tableWriter
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+func NewCopyWriter(ctx context.Context, pool *pgxpool.Pool, tables []Table, batchSize int) *CopyWriter {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &CopyWriter{
+		pool:      pool,
+		batchSize: batchSize,
+		tables:    make(map[string]*tableWriter, len(tables)),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+
+	for _, table := range tables {
+		tw := &tableWriter{table: table, rows: make(chan []any, batchSize)}
+		w.tables[table.Name] = tw
+
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			if err := w.run(tw); err != nil {
+				w.fail(fmt.Errorf("%s: %w", tw.table.Name, err))
+			}
+		}()
+	}
+
+	return w
+}
+
+func (w *CopyWriter) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err == nil {
+		w.err = err
+		w.cancel()
+	}
+}
+
+func (w *CopyWriter) run(tw *tableWriter) error {
+	batch := make([][]any, 0, w.batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := w.pool.CopyFrom(w.ctx, pgx.Identifier{tw.table.Name}, tw.table.Columns, pgx.CopyFromRows(batch))
+		if err != nil {
+			return fmt.Errorf("pool.CopyFrom: %w", err)
+		}
+		tw.count += n
+		batch = batch[:0]
+		return nil
+	}
+
+	for values := range tw.rows {
+		batch = append(batch, values)
+		if len(batch) < w.batchSize {
+			continue
+		}
+		if err := flush(); err != nil {
+			// keep draining so producers do not block on a dead writer
+			for range tw.rows {
+			}
+			return err
+		}
+	}
+
+	return flush()
+}
+
+// Err returns the first error met by a table writer, or the context error
+// once the writer is closed.
+func (w *CopyWriter) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	return w.ctx.Err()
+}
+
+// Write queues a row for table. It blocks while the table's queue is full.
+func (w *CopyWriter) Write(ctx context.Context, table string, values []any) error {
+	tw, ok := w.tables[table]
+	if !ok {
+		return fmt.Errorf("copywriter: unknown table %s", table)
+	}
+
+	select {
+	case tw.rows <- values:
+		return nil
+	case <-w.ctx.Done():
+		return fmt.Errorf("copywriter: %w", w.Err())
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes the pending rows and returns how many rows were copied into
+// each table.
+func (w *CopyWriter) Close() (map[string]int64, error) {
+	for _, tw := range w.tables {
+		close(tw.rows)
+	}
+	w.wg.Wait()
+	w.cancel()
+
+	counts := make(map[string]int64, len(w.tables))
+	for name, tw := range w.tables {
+		counts[name] = tw.count
+	}
+
+	return counts, w.err
+}
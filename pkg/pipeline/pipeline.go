@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/sync/errgroup"
+	"io"
+)
+
+// Handler processes a single element. It is called concurrently from every
+// worker, so it must be safe for concurrent use.
+type Handler func(ctx context.Context, e *Element) error
+
+// Run splits r into top-level elements and hands them to a pool of workers
+// that call handle. The channel between the scanner and the workers is
+// bounded, so a slow handler slows the scanner down instead of buffering the
+// whole document.
+func Run(ctx context.Context, r io.Reader, workers int, handle Handler) error {
+	return RunScanner(ctx, NewScanner(r), workers, handle)
+}
+
+// RunScanner is Run for a scanner created by the caller, which can then look
+// at the prolog of the document. Elements are only handed to the workers
+// after the prolog has been read, so a handler may call scanner.Doctype.
+func RunScanner(ctx context.Context, scanner *Scanner, workers int, handle Handler) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	elements := make(chan *Element, workers*4)
+
+	g.Go(func() error {
+		defer close(elements)
+
+		for {
+			e, err := scanner.Next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("scanner.Next: %w", err)
+			}
+
+			select {
+			case elements <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+
+	for i := 0; i < workers; i++ {
+		g.Go(func() error {
+			for e := range elements {
+				if err := handle(ctx, e); err != nil {
+					return fmt.Errorf("%s #%d: %w", e.Name, e.Seq, err)
+				}
+			}
+			return nil
+		})
+	}
+
+	return g.Wait()
+}
@@ -0,0 +1,153 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Element is a top-level child of the HealthData root element.
+type Element struct {
+	Name  string
+	Attrs []xml.Attr
+
+	// Seq is the 1-based position of the element among the elements with
+	// the same name, in document order. It is used as the row id, so ids do
+	// not depend on the order in which workers finish.
+	Seq int64
+
+	// Data holds the raw bytes of the element, from its start tag to its
+	// end tag, ready to be passed to xml.Unmarshal.
+	Data []byte
+}
+
+// Attr returns the value of the named attribute.
+func (e *Element) Attr(name string) string {
+	for _, attr := range e.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+// recorder keeps the bytes read from r that have not been released yet.
+// base is the stream offset of buf[0].
+type recorder struct {
+	r    io.Reader
+	buf  []byte
+	base int64
+}
+
+func (rec *recorder) Read(p []byte) (int, error) {
+	n, err := rec.r.Read(p)
+	rec.buf = append(rec.buf, p[:n]...)
+	return n, err
+}
+
+func (rec *recorder) slice(start, end int64) []byte {
+	out := make([]byte, end-start)
+	copy(out, rec.buf[start-rec.base:end-rec.base])
+	return out
+}
+
+// release drops every byte before offset.
+func (rec *recorder) release(offset int64) {
+	n := int(offset - rec.base)
+	remaining := copy(rec.buf, rec.buf[n:])
+	rec.buf = rec.buf[:remaining]
+	rec.base = offset
+}
+
+// Scanner splits an export into its top-level elements without decoding
+// them, so decoding can be spread over several goroutines.
+type Scanner struct {
+	// Filter, if not nil, is called with the name and attributes of every
+	// top-level element. Elements it rejects are skipped without being
+	// kept in memory, but still count for Seq, so ids do not depend on the
+	// filter.
+	Filter func(name string, attrs []xml.Attr) bool
+
+	rec     *recorder
+	decoder *xml.Decoder
+	depth   int
+	seq     map[string]int64
+	doctype string
+}
+
+func NewScanner(r io.Reader) *Scanner {
+	rec := &recorder{r: r}
+	return &Scanner{
+		rec:     rec,
+		decoder: xml.NewDecoder(rec),
+		seq:     make(map[string]int64),
+	}
+}
+
+// Doctype returns the DOCTYPE directive of the document, without its
+// delimiters, once the scanner has read past it.
+func (s *Scanner) Doctype() string {
+	return s.doctype
+}
+
+// Next returns the next top-level element, or io.EOF at the end of the
+// document.
+func (s *Scanner) Next() (*Element, error) {
+	var current *Element
+	var start int64
+	var skipping bool
+
+	for {
+		offset := s.decoder.InputOffset()
+		token, err := s.decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			if s.depth != 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("xml.RawToken: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.Directive:
+			if s.depth == 0 && bytes.HasPrefix(t, []byte("DOCTYPE")) {
+				s.doctype = string(t)
+			}
+		case xml.StartElement:
+			s.depth++
+			if s.depth == 2 {
+				s.seq[t.Name.Local]++
+				if s.Filter != nil && !s.Filter(t.Name.Local, t.Attr) {
+					skipping = true
+					s.rec.release(s.decoder.InputOffset())
+					continue
+				}
+				current = &Element{
+					Name:  t.Name.Local,
+					Attrs: append([]xml.Attr(nil), t.Attr...),
+					Seq:   s.seq[t.Name.Local],
+				}
+				start = offset
+				s.rec.release(offset)
+			}
+		case xml.EndElement:
+			s.depth--
+			if skipping {
+				s.rec.release(s.decoder.InputOffset())
+				skipping = s.depth > 1
+				continue
+			}
+			if s.depth == 1 && current != nil {
+				end := s.decoder.InputOffset()
+				current.Data = s.rec.slice(start, end)
+				s.rec.release(end)
+				return current, nil
+			}
+		}
+	}
+}
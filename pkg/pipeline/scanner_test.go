@@ -0,0 +1,133 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+)
+
+const export = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE HealthData [
+<!ELEMENT HealthData (ExportDate,Me,(Record|Workout)*)>
+]>
+<HealthData locale="en_US">
+ <ExportDate value="2022-12-01 10:00:00 -0500"/>
+ <Me HKCharacteristicTypeIdentifierDateOfBirth="1980-01-02"/>
+ <Record type="HKQuantityTypeIdentifierStepCount" value="10"/>
+ <Record type="HKQuantityTypeIdentifierHeartRate" value="60">
+  <MetadataEntry key="HKMetadataKeyHeartRateMotionContext" value="0"/>
+ </Record>
+ <Workout workoutActivityType="HKWorkoutActivityTypeRunning">
+  <WorkoutEvent type="HKWorkoutEventTypePause"/>
+ </Workout>
+</HealthData>
+`
+
+func TestScanner(t *testing.T) {
+	expected := []struct {
+		name string
+		seq  int64
+		attr string
+		data string
+	}{
+		{"ExportDate", 1, "2022-12-01 10:00:00 -0500", `<ExportDate value="2022-12-01 10:00:00 -0500"/>`},
+		{"Me", 1, "", `<Me HKCharacteristicTypeIdentifierDateOfBirth="1980-01-02"/>`},
+		{"Record", 1, "", `<Record type="HKQuantityTypeIdentifierStepCount" value="10"/>`},
+		{"Record", 2, "", "<Record type=\"HKQuantityTypeIdentifierHeartRate\" value=\"60\">\n  <MetadataEntry key=\"HKMetadataKeyHeartRateMotionContext\" value=\"0\"/>\n </Record>"},
+		{"Workout", 1, "", "<Workout workoutActivityType=\"HKWorkoutActivityTypeRunning\">\n  <WorkoutEvent type=\"HKWorkoutEventTypePause\"/>\n </Workout>"},
+	}
+
+	// a one byte reader makes sure elements spanning several reads are
+	// reassembled correctly
+	scanner := NewScanner(iotest.OneByteReader(strings.NewReader(export)))
+	for _, exp := range expected {
+		e, err := scanner.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if e.Name != exp.name || e.Seq != exp.seq || string(e.Data) != exp.data {
+			t.Errorf("expected %s #%d %q, got %s #%d %q", exp.name, exp.seq, exp.data, e.Name, e.Seq, e.Data)
+		}
+		if exp.attr != "" && e.Attr("value") != exp.attr {
+			t.Errorf("expected attribute %q, got %q", exp.attr, e.Attr("value"))
+		}
+	}
+
+	if _, err := scanner.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+	if doctype := scanner.Doctype(); !strings.HasPrefix(doctype, "DOCTYPE HealthData [") {
+		t.Errorf("unexpected doctype %q", doctype)
+	}
+}
+
+func TestScannerFilter(t *testing.T) {
+	scanner := NewScanner(strings.NewReader(export))
+	scanner.Filter = func(name string, attrs []xml.Attr) bool {
+		return name != "Record" || attrs[0].Value != "HKQuantityTypeIdentifierStepCount"
+	}
+
+	var got []string
+	for {
+		e, err := scanner.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		got = append(got, fmt.Sprintf("%s #%d", e.Name, e.Seq))
+	}
+
+	// skipped elements still count, so ids do not change
+	expected := "ExportDate #1, Me #1, Record #2, Workout #1"
+	if strings.Join(got, ", ") != expected {
+		t.Errorf("expected %s, got %s", expected, strings.Join(got, ", "))
+	}
+}
+
+func TestScannerTruncated(t *testing.T) {
+	scanner := NewScanner(strings.NewReader(export[:len(export)/2]))
+	for {
+		_, err := scanner.Next()
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			t.Errorf("expected an error on a truncated document, got io.EOF")
+		}
+		break
+	}
+}
+
+func TestRun(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]int)
+
+	err := Run(context.Background(), strings.NewReader(export), 4, func(ctx context.Context, e *Element) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[e.Name]++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if seen["Record"] != 2 || seen["Workout"] != 1 || seen["Me"] != 1 {
+		t.Errorf("unexpected elements %v", seen)
+	}
+
+	failure := errors.New("failure")
+	err = Run(context.Background(), strings.NewReader(export), 4, func(ctx context.Context, e *Element) error {
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("expected handler error, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package rollup
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Sample is a record value with the time zone it was taken in, if known.
+type Sample struct {
+	Type     string
+	Unit     string
+	Time     time.Time
+	Value    float64
+	Location *time.Location
+}
+
+// Metric aggregates the samples of a type over a day or a week.
+type Metric struct {
+	Period     time.Time // the day, or the Monday of the week, at midnight UTC
+	Type       string
+	Unit       string
+	Cumulative bool
+	Days       int // days with samples
+	Samples    int
+	Sum        float64
+	Min        float64
+	Max        float64
+	Last       float64
+	LastTime   time.Time
+}
+
+func (m *Metric) Avg() float64 {
+	if m.Samples == 0 {
+		return 0
+	}
+	return m.Sum / float64(m.Samples)
+}
+
+// merge adds the samples aggregated by o.
+func (m *Metric) merge(o Metric) {
+	if m.Samples == 0 || o.Min < m.Min {
+		m.Min = o.Min
+	}
+	if m.Samples == 0 || o.Max > m.Max {
+		m.Max = o.Max
+	}
+	if m.Samples == 0 || !o.LastTime.Before(m.LastTime) {
+		m.Last, m.LastTime = o.Last, o.LastTime
+	}
+	m.Days += o.Days
+	m.Samples += o.Samples
+	m.Sum += o.Sum
+}
+
+// Day returns the local day of t, at midnight UTC so days of different time
+// zones compare equal.
+func Day(t time.Time, location *time.Location) time.Time {
+	t = t.In(location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Week returns the Monday of the week of day.
+func Week(day time.Time) time.Time {
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+type key struct {
+	period time.Time
+	kind   string
+	unit   string
+}
+
+func sorted(metrics map[key]*Metric) []Metric {
+	out := make([]Metric, 0, len(metrics))
+	for _, m := range metrics {
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if !a.Period.Equal(b.Period) {
+			return a.Period.Before(b.Period)
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Unit < b.Unit
+	})
+
+	return out
+}
+
+// Daily aggregates samples by local day. Samples count for the day they
+// start on, in their own time zone, else in Location.
+type Daily struct {
+	Location   *time.Location
+	Cumulative map[string]bool
+
+	metrics map[key]*Metric
+}
+
+func (d *Daily) Add(s Sample) {
+	location := s.Location
+	if location == nil {
+		location = d.Location
+	}
+	if location == nil {
+		location = time.Local
+	}
+	if d.metrics == nil {
+		d.metrics = make(map[key]*Metric)
+	}
+
+	k := key{Day(s.Time, location), s.Type, s.Unit}
+	m, ok := d.metrics[k]
+	if !ok {
+		m = &Metric{Period: k.period, Type: s.Type, Unit: s.Unit, Cumulative: d.Cumulative[s.Type], Days: 1}
+		d.metrics[k] = m
+	}
+	m.merge(Metric{Samples: 1, Sum: s.Value, Min: s.Value, Max: s.Value, Last: s.Value, LastTime: s.Time})
+}
+
+// Metrics returns the daily metrics, sorted by day, type and unit.
+func (d *Daily) Metrics() []Metric {
+	return sorted(d.metrics)
+}
+
+// Weekly aggregates daily metrics by week, starting on Mondays.
+func Weekly(daily []Metric) []Metric {
+	metrics := make(map[key]*Metric)
+	for _, day := range daily {
+		k := key{Week(day.Period), day.Type, day.Unit}
+		m, ok := metrics[k]
+		if !ok {
+			m = &Metric{Period: k.period, Type: day.Type, Unit: day.Unit, Cumulative: day.Cumulative}
+			metrics[k] = m
+		}
+		m.merge(day)
+	}
+
+	return sorted(metrics)
+}
+
+// same reports whether two metrics of a day store the same values: the sum
+// of cumulative metrics, and the min, avg, max and last of the others.
+func same(a, b Metric) bool {
+	if a.Cumulative != b.Cumulative || a.Samples != b.Samples || !a.LastTime.Equal(b.LastTime) {
+		return false
+	}
+	// stored sums are rebuilt from their average
+	if math.Abs(a.Sum-b.Sum) > 1e-9*math.Max(1, math.Abs(a.Sum)) {
+		return false
+	}
+
+	return a.Cumulative || (a.Min == b.Min && a.Max == b.Max && a.Last == b.Last)
+}
+
+// ChangedDays returns the days whose metrics differ between daily and
+// stored, including the days that only one of them has, sorted.
+func ChangedDays(daily, stored []Metric) []time.Time {
+	previous := make(map[key]Metric, len(stored))
+	for _, m := range stored {
+		previous[key{m.Period, m.Type, m.Unit}] = m
+	}
+
+	changed := make(map[time.Time]bool)
+	for _, m := range daily {
+		k := key{m.Period, m.Type, m.Unit}
+		if p, ok := previous[k]; !ok || !same(m, p) {
+			changed[m.Period] = true
+		}
+		delete(previous, k)
+	}
+	for k := range previous {
+		changed[k.period] = true
+	}
+
+	days := make([]time.Time, 0, len(changed))
+	for day := range changed {
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	return days
+}
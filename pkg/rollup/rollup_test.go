@@ -0,0 +1,122 @@
+package rollup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWeek(t *testing.T) {
+	tests := []struct {
+		day  string
+		week string
+	}{
+		{"2022-03-07", "2022-03-07"}, // Monday
+		{"2022-03-09", "2022-03-07"},
+		{"2022-03-13", "2022-03-07"}, // Sunday
+		{"2022-03-01", "2022-02-28"},
+	}
+	for _, test := range tests {
+		day, _ := time.Parse("2006-01-02", test.day)
+		if got := Week(day).Format("2006-01-02"); got != test.week {
+			t.Errorf("Week(%s): expected %s, got %s", test.day, test.week, got)
+		}
+	}
+}
+
+func TestDaily(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("time.LoadLocation: %v", err)
+	}
+	utc := func(day, hour int) time.Time {
+		return time.Date(2022, 3, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	const steps = "HKQuantityTypeIdentifierStepCount"
+	const heartRate = "HKQuantityTypeIdentifierHeartRate"
+	daily := Daily{Location: time.UTC, Cumulative: map[string]bool{steps: true}}
+	for _, s := range []Sample{
+		{Type: steps, Unit: "count", Time: utc(8, 10), Value: 100},
+		{Type: steps, Unit: "count", Time: utc(8, 12), Value: 50},
+		{Type: steps, Unit: "count", Time: utc(8, 20), Value: 10, Location: tokyo}, // the 9th in Tokyo
+		{Type: heartRate, Unit: "count/min", Time: utc(8, 12), Value: 80},
+		{Type: heartRate, Unit: "count/min", Time: utc(8, 10), Value: 60},
+		{Type: heartRate, Unit: "count/min", Time: utc(9, 8), Value: 100},
+	} {
+		daily.Add(s)
+	}
+
+	metrics := daily.Metrics()
+	if len(metrics) != 4 {
+		t.Fatalf("expected 4 metrics, got %d", len(metrics))
+	}
+
+	tests := []struct {
+		day                 int
+		kind                string
+		samples             int
+		sum, min, max, last float64
+	}{
+		{8, heartRate, 2, 140, 60, 80, 80},
+		{8, steps, 2, 150, 50, 100, 50},
+		{9, heartRate, 1, 100, 100, 100, 100},
+		{9, steps, 1, 10, 10, 10, 10},
+	}
+	for i, test := range tests {
+		m := metrics[i]
+		if !m.Period.Equal(utc(test.day, 0)) || m.Type != test.kind {
+			t.Errorf("%d: expected %s on the %d, got %s on %s", i, test.kind, test.day, m.Type, m.Period)
+			continue
+		}
+		if m.Samples != test.samples || m.Sum != test.sum || m.Min != test.min || m.Max != test.max || m.Last != test.last {
+			t.Errorf("%d: expected %+v, got %+v", i, test, m)
+		}
+		if m.Cumulative != (test.kind == steps) {
+			t.Errorf("%d: expected cumulative to be %v", i, test.kind == steps)
+		}
+	}
+
+	weekly := Weekly(metrics)
+	if len(weekly) != 2 {
+		t.Fatalf("expected 2 weekly metrics, got %d", len(weekly))
+	}
+	if m := weekly[0]; m.Type != heartRate || m.Days != 2 || m.Samples != 3 || m.Avg() != 80 || m.Min != 60 || m.Max != 100 || m.Last != 100 {
+		t.Errorf("unexpected heart rate week %+v", m)
+	}
+	if m := weekly[1]; m.Type != steps || m.Days != 2 || m.Sum != 160 || !m.Period.Equal(utc(7, 0)) {
+		t.Errorf("unexpected steps week %+v", m)
+	}
+}
+
+func TestChangedDays(t *testing.T) {
+	day := func(n int) time.Time {
+		return time.Date(2022, 3, n, 0, 0, 0, 0, time.UTC)
+	}
+	steps := func(n int, sum float64) Metric {
+		return Metric{Period: day(n), Type: "steps", Unit: "count", Cumulative: true, Days: 1, Samples: 2, Sum: sum, LastTime: day(n).Add(time.Hour)}
+	}
+	heartRate := func(n int, max float64) Metric {
+		return Metric{Period: day(n), Type: "heart rate", Unit: "count/min", Days: 1, Samples: 3, Sum: 180, Min: 50, Max: max, Last: 60, LastTime: day(n)}
+	}
+
+	stored := []Metric{steps(1, 100), heartRate(1, 70), steps(2, 100), heartRate(3, 70), steps(4, 100)}
+	// the min, max and last of cumulative metrics are not stored
+	daily := []Metric{steps(1, 100), heartRate(1, 70), steps(2, 150), heartRate(3, 80), heartRate(5, 70)}
+	daily[0].Min, daily[0].Max = 10, 90
+
+	got := ChangedDays(daily, stored)
+	expected := []time.Time{day(2), day(3), day(4), day(5)}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if !got[i].Equal(expected[i]) {
+			t.Errorf("expected %v, got %v", expected, got)
+			break
+		}
+	}
+
+	if got := ChangedDays(daily, daily); len(got) != 0 {
+		t.Errorf("expected no changed day, got %v", got)
+	}
+}
@@ -0,0 +1,199 @@
+package rollup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// Roller rebuilds the daily_metrics and weekly_metrics rows of a person from
+// their records. Every record of a person comes from their latest import,
+// which replaces them, so only the days whose metrics changed, and the weeks
+// holding them, are rewritten. Days left without records are deleted.
+type Roller struct {
+	Pool     *pgxpool.Pool
+	PersonID int64
+
+	// Location is used for the records without a time zone.
+	Location *time.Location
+
+	// Cumulative lists the types that are summed.
+	Cumulative map[string]bool
+}
+
+func (r *Roller) daily(ctx context.Context) ([]Metric, error) {
+	rows, err := r.Pool.Query(ctx, `
+		SELECT d.type, COALESCE(d.unit, ''), d.start_date, d.value, r.time_zone
+		FROM records_deduplicated d
+		JOIN records r ON r.id = d.record_id
+		WHERE d.person_id = $1`, r.PersonID)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	daily := Daily{Location: r.Location, Cumulative: r.Cumulative}
+	locations := make(map[string]*time.Location)
+	for rows.Next() {
+		var s Sample
+		var timeZone *string
+		if err := rows.Scan(&s.Type, &s.Unit, &s.Time, &s.Value, &timeZone); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		if timeZone != nil {
+			location, ok := locations[*timeZone]
+			if !ok {
+				location, _ = time.LoadLocation(*timeZone) // unknown zones fall back to Location
+				locations[*timeZone] = location
+			}
+			s.Location = location
+		}
+		daily.Add(s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return daily.Metrics(), nil
+}
+
+// stored reads back the daily metrics of a person.
+func stored(ctx context.Context, tx pgx.Tx, personID int64) ([]Metric, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT day, type, unit, samples, sum, min, avg, max, last, last_date
+		FROM daily_metrics
+		WHERE person_id = $1`, personID)
+	if err != nil {
+		return nil, fmt.Errorf("tx.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var metrics []Metric
+	for rows.Next() {
+		m := Metric{Days: 1}
+		var sum, min, avg, max, last *float64
+		if err := rows.Scan(&m.Period, &m.Type, &m.Unit, &m.Samples, &sum, &min, &avg, &max, &last, &m.LastTime); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		if sum != nil {
+			m.Cumulative = true
+			m.Sum = *sum
+		} else if avg != nil && min != nil && max != nil && last != nil {
+			m.Sum, m.Min, m.Max, m.Last = *avg*float64(m.Samples), *min, *max, *last
+		}
+		metrics = append(metrics, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return metrics, nil
+}
+
+// values returns the sum of cumulative metrics, and the min, avg, max and
+// last of the others.
+func values(m Metric) []any {
+	if m.Cumulative {
+		return []any{m.Sum, nil, nil, nil, nil}
+	}
+	return []any{nil, m.Min, m.Avg(), m.Max, m.Last}
+}
+
+func latestImport(ctx context.Context, tx pgx.Tx, personID int64) (*int64, error) {
+	var id int64
+	err := tx.QueryRow(ctx, "SELECT id FROM imports WHERE finished_at IS NOT NULL AND person_id = $1 ORDER BY id DESC LIMIT 1", personID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tx.QueryRow: %w", err)
+	}
+
+	return &id, nil
+}
+
+// Run rewrites the rollups of the days whose records changed since they
+// were last rolled up.
+func (r *Roller) Run(ctx context.Context) error {
+	daily, err := r.daily(ctx)
+	if err != nil {
+		return fmt.Errorf("daily: %w", err)
+	}
+
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	previous, err := stored(ctx, tx, r.PersonID)
+	if err != nil {
+		return fmt.Errorf("stored: %w", err)
+	}
+	days := ChangedDays(daily, previous)
+	if len(days) == 0 {
+		fmt.Println("Rollups are up to date")
+		return nil
+	}
+	changed := make(map[time.Time]bool, len(days))
+	weeks := make(map[time.Time]bool)
+	var weekList []time.Time
+	for _, day := range days {
+		changed[day] = true
+		if week := Week(day); !weeks[week] {
+			weeks[week] = true
+			weekList = append(weekList, week)
+		}
+	}
+
+	importID, err := latestImport(ctx, tx, r.PersonID)
+	if err != nil {
+		return fmt.Errorf("latestImport: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM daily_metrics WHERE person_id = $1 AND day = ANY($2::DATE[])", r.PersonID, days); err != nil {
+		return fmt.Errorf("DELETE FROM daily_metrics: %w", err)
+	}
+	var rows [][]any
+	var inWeeks []Metric
+	for _, m := range daily {
+		if weeks[Week(m.Period)] {
+			inWeeks = append(inWeeks, m)
+		}
+		if !changed[m.Period] {
+			continue
+		}
+		row := append([]any{r.PersonID, m.Period, m.Type, m.Unit, m.Samples}, values(m)...)
+		rows = append(rows, append(row, m.LastTime, importID))
+	}
+	columns := []string{"person_id", "day", "type", "unit", "samples", "sum", "min", "avg", "max", "last", "last_date", "import_id"}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"daily_metrics"}, columns, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("CopyFrom daily_metrics: %w", err)
+	}
+	dailyRows := len(rows)
+
+	// the other days of the weeks are stored as they were computed
+	weekly := Weekly(inWeeks)
+	if _, err := tx.Exec(ctx, "DELETE FROM weekly_metrics WHERE person_id = $1 AND week = ANY($2::DATE[])", r.PersonID, weekList); err != nil {
+		return fmt.Errorf("DELETE FROM weekly_metrics: %w", err)
+	}
+	rows = make([][]any, len(weekly))
+	for i, m := range weekly {
+		rows[i] = append([]any{r.PersonID, m.Period, m.Type, m.Unit, m.Days, m.Samples}, values(m)...)
+	}
+	columns = []string{"person_id", "week", "type", "unit", "days", "samples", "sum", "min", "avg", "max", "last"}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"weekly_metrics"}, columns, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("CopyFrom weekly_metrics: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("tx.Commit: %w", err)
+	}
+
+	fmt.Printf("Rolled up %d daily and %d weekly metrics of %d changed days from %s to %s\n",
+		dailyRows, len(weekly), len(days), days[0].Format("2006-01-02"), days[len(days)-1].Format("2006-01-02"))
+	return nil
+}
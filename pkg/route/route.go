@@ -0,0 +1,112 @@
+package route
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"strings"
+	"time"
+)
+
+// Point is a trackpoint of a workout route, stored in the
+// workout_route_points table.
+type Point struct {
+	WorkoutID          int64      `db:"workout_id"`
+	Seq                int        `db:"seq"` // order of the point in the route files
+	Time               *time.Time `db:"time"`
+	Latitude           float64    `db:"latitude"`
+	Longitude          float64    `db:"longitude"`
+	Elevation          *float64   `db:"elevation"`           // meters
+	Speed              *float64   `db:"speed"`               // meters per second
+	Course             *float64   `db:"course"`              // degrees
+	HorizontalAccuracy *float64   `db:"horizontal_accuracy"` // meters
+	VerticalAccuracy   *float64   `db:"vertical_accuracy"`   // meters
+}
+
+// trkpt is a trackpoint of the GPX files written by Apple Health.
+type trkpt struct {
+	Lat        float64  `xml:"lat,attr"`
+	Lon        float64  `xml:"lon,attr"`
+	Ele        *float64 `xml:"ele"`
+	Time       string   `xml:"time"`
+	Extensions struct {
+		Speed  *float64 `xml:"speed"`
+		Course *float64 `xml:"course"`
+		HAcc   *float64 `xml:"hAcc"`
+		VAcc   *float64 `xml:"vAcc"`
+	} `xml:"extensions"`
+}
+
+type gpx struct {
+	Tracks []struct {
+		Segments []struct {
+			Points []trkpt `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// Parse reads the trackpoints of a GPX file.
+func Parse(r io.Reader) ([]Point, error) {
+	var doc gpx
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("xml.Decode: %w", err)
+	}
+
+	var points []Point
+	for _, track := range doc.Tracks {
+		for _, segment := range track.Segments {
+			for _, p := range segment.Points {
+				point := Point{
+					Seq:                len(points),
+					Latitude:           p.Lat,
+					Longitude:          p.Lon,
+					Elevation:          p.Ele,
+					Speed:              p.Extensions.Speed,
+					Course:             p.Extensions.Course,
+					HorizontalAccuracy: p.Extensions.HAcc,
+					VerticalAccuracy:   p.Extensions.VAcc,
+				}
+				if p.Time != "" {
+					t, err := time.Parse(time.RFC3339, strings.TrimSpace(p.Time))
+					if err != nil {
+						return nil, fmt.Errorf("time.Parse: %w", err)
+					}
+					point.Time = &t
+				}
+				points = append(points, point)
+			}
+		}
+	}
+
+	return points, nil
+}
+
+// Load reads the trackpoints of a route file referenced by an export, such
+// as /workout-routes/route_2022-01-01_12.00pm.gpx.
+func Load(fsys fs.FS, path string) ([]Point, error) {
+	f, err := fsys.Open(strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("fsys.Open: %w", err)
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// earthRadius is the mean radius of the Earth, in meters.
+const earthRadius = 6371008.8
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// Distance returns the great-circle distance between two points, in meters.
+func Distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat, dLon := lat2-lat1, radians(b.Longitude-a.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,58 @@
+package route
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+const routeFile = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="Apple Health Export" xmlns="http://www.topografix.com/GPX/1/1">
+ <metadata>
+  <time>2022-01-01T17:30:00Z</time>
+ </metadata>
+ <trk>
+  <name>Route 2022-01-01 12:00pm</name>
+  <trkseg>
+   <trkpt lon="-122.030000" lat="37.330000"><ele>10.5</ele><time>2022-01-01T17:00:00Z</time><extensions><speed>2.9</speed><course>90.0</course><hAcc>3.2</hAcc><vAcc>2.1</vAcc></extensions></trkpt>
+   <trkpt lon="-122.029000" lat="37.330000"><ele>11.0</ele><time>2022-01-01T17:00:30Z</time><extensions><speed>3.0</speed></extensions></trkpt>
+  </trkseg>
+ </trk>
+</gpx>
+`
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{"workout-routes/route_1.gpx": {Data: []byte(routeFile)}}
+	points, err := Load(fsys, "/workout-routes/route_1.gpx")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("expected 2 points, got %d", len(points))
+	}
+
+	first := points[0]
+	if first.Latitude != 37.33 || first.Longitude != -122.03 || first.Seq != 0 {
+		t.Errorf("unexpected position %v, %v (%d)", first.Latitude, first.Longitude, first.Seq)
+	}
+	if first.Time == nil || !first.Time.Equal(time.Date(2022, 1, 1, 17, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected time %v", first.Time)
+	}
+	if first.Elevation == nil || *first.Elevation != 10.5 || first.Speed == nil || *first.Speed != 2.9 || first.HorizontalAccuracy == nil || *first.HorizontalAccuracy != 3.2 {
+		t.Errorf("unexpected point %+v", first)
+	}
+	if points[1].Course != nil || points[1].Seq != 1 {
+		t.Errorf("unexpected second point %+v", points[1])
+	}
+
+	// 0.001 degree of longitude at 37.33 degrees north
+	if d := Distance(points[0], points[1]); math.Abs(d-88.5) > 0.5 {
+		t.Errorf("unexpected distance %v", d)
+	}
+
+	if _, err := Parse(strings.NewReader("<gpx><trk><trkseg><trkpt><time>noon</time></trkpt></trkseg></trk></gpx>")); err == nil {
+		t.Errorf("expected an error for an invalid time")
+	}
+}
@@ -0,0 +1,219 @@
+package sleep
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// RecordType is the type of the sleep records.
+const RecordType = "HKCategoryTypeIdentifierSleepAnalysis"
+
+// Stage is the value of a sleep record.
+type Stage string
+
+const (
+	InBed  Stage = "in_bed"
+	Awake  Stage = "awake"
+	Asleep Stage = "asleep" // asleep, without a stage
+	Core   Stage = "core"
+	Deep   Stage = "deep"
+	REM    Stage = "rem"
+)
+
+// Stages lists every stage, in the order of the sleep_sessions columns.
+var Stages = []Stage{InBed, Awake, Asleep, Core, Deep, REM}
+
+var stageValues = map[string]Stage{
+	"InBed":             InBed,
+	"Awake":             Awake,
+	"Asleep":            Asleep,
+	"AsleepUnspecified": Asleep,
+	"AsleepCore":        Core,
+	"AsleepDeep":        Deep,
+	"AsleepREM":         REM,
+}
+
+// ParseStage parses the value of a sleep record, such as
+// "HKCategoryValueSleepAnalysisAsleepCore".
+func ParseStage(value string) (Stage, bool) {
+	stage, ok := stageValues[strings.TrimPrefix(value, "HKCategoryValueSleepAnalysis")]
+	return stage, ok
+}
+
+func (s Stage) IsAsleep() bool {
+	return s == Asleep || s == Core || s == Deep || s == REM
+}
+
+// Fragment is a sleep record.
+type Fragment struct {
+	RecordID int64
+	Source   string
+	Stage    Stage
+	Start    time.Time
+	End      time.Time
+
+	// Location is the time zone the record was taken in, if known.
+	Location *time.Location
+}
+
+// Session is a night of sleep, made of the fragments of a single source.
+type Session struct {
+	Night      time.Time // the day the night starts, at midnight UTC
+	Source     string
+	BedTime    time.Time
+	WakeTime   time.Time
+	Asleep     time.Duration
+	Stages     map[Stage]time.Duration
+	Awakenings int // interruptions between the first and the last sleep
+	Efficiency float64
+	Fragments  []Fragment
+}
+
+// InBed is the time between going to bed and waking up.
+func (s Session) InBed() time.Duration {
+	return s.WakeTime.Sub(s.BedTime)
+}
+
+// Options configures how fragments are grouped into sessions.
+type Options struct {
+	// DayBoundary is the time of day at which a night ends and the next one
+	// starts, such as 12h for noon.
+	DayBoundary time.Duration
+
+	// Location is used for the fragments without a time zone.
+	Location *time.Location
+
+	// Rank orders sources, 0 being the preferred one. Sources of the same
+	// rank are ordered by how long they recorded sleep.
+	Rank func(source string) int
+}
+
+func (o Options) night(f Fragment) time.Time {
+	location := f.Location
+	if location == nil {
+		location = o.Location
+	}
+	if location == nil {
+		location = time.Local
+	}
+
+	t := f.Start.In(location).Add(-o.DayBoundary)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+type interval struct {
+	start, end time.Time
+}
+
+// union merges overlapping intervals, sorted by start.
+func union(fragments []Fragment, keep func(Fragment) bool) []interval {
+	var all []interval
+	for _, f := range fragments {
+		if keep(f) && f.End.After(f.Start) {
+			all = append(all, interval{f.Start, f.End})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].start.Before(all[j].start) })
+
+	var merged []interval
+	for _, in := range all {
+		if n := len(merged); n > 0 && !in.start.After(merged[n-1].end) {
+			if in.end.After(merged[n-1].end) {
+				merged[n-1].end = in.end
+			}
+			continue
+		}
+		merged = append(merged, in)
+	}
+
+	return merged
+}
+
+func total(intervals []interval) time.Duration {
+	var d time.Duration
+	for _, in := range intervals {
+		d += in.end.Sub(in.start)
+	}
+	return d
+}
+
+func newSession(night time.Time, source string, fragments []Fragment) Session {
+	sort.Slice(fragments, func(i, j int) bool { return fragments[i].Start.Before(fragments[j].Start) })
+
+	s := Session{
+		Night:     night,
+		Source:    source,
+		BedTime:   fragments[0].Start,
+		Stages:    make(map[Stage]time.Duration),
+		Fragments: fragments,
+	}
+	for _, f := range fragments {
+		if f.End.After(s.WakeTime) {
+			s.WakeTime = f.End
+		}
+	}
+	for _, stage := range Stages {
+		s.Stages[stage] = total(union(fragments, func(f Fragment) bool { return f.Stage == stage }))
+	}
+
+	asleep := union(fragments, func(f Fragment) bool { return f.Stage.IsAsleep() })
+	s.Asleep = total(asleep)
+	if len(asleep) > 0 {
+		s.Awakenings = len(asleep) - 1
+	}
+	if inBed := s.InBed(); inBed > 0 {
+		s.Efficiency = float64(s.Asleep) / float64(inBed)
+	}
+
+	return s
+}
+
+// Sessions groups fragments into one session per night, keeping the
+// fragments of the preferred source of each night.
+func Sessions(fragments []Fragment, options Options) []Session {
+	type key struct {
+		night  time.Time
+		source string
+	}
+	groups := make(map[key][]Fragment)
+	var nights []time.Time
+	seen := make(map[time.Time]bool) // nights are all in UTC, so they can be keys
+	for _, f := range fragments {
+		k := key{options.night(f), f.Source}
+		groups[k] = append(groups[k], f)
+		if !seen[k.night] {
+			seen[k.night] = true
+			nights = append(nights, k.night)
+		}
+	}
+	sort.Slice(nights, func(i, j int) bool { return nights[i].Before(nights[j]) })
+
+	rank := options.Rank
+	if rank == nil {
+		rank = func(string) int { return 0 }
+	}
+
+	var sessions []Session
+	for _, night := range nights {
+		var candidates []Session
+		for k, group := range groups {
+			if k.night.Equal(night) {
+				candidates = append(candidates, newSession(night, k.source, group))
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			if ra, rb := rank(a.Source), rank(b.Source); ra != rb {
+				return ra < rb
+			}
+			if a.Asleep != b.Asleep {
+				return a.Asleep > b.Asleep
+			}
+			return a.Source < b.Source
+		})
+		sessions = append(sessions, candidates[0])
+	}
+
+	return sessions
+}
@@ -0,0 +1,97 @@
+package sleep
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStage(t *testing.T) {
+	tests := []struct {
+		value string
+		stage Stage
+		ok    bool
+	}{
+		{"HKCategoryValueSleepAnalysisInBed", InBed, true},
+		{"HKCategoryValueSleepAnalysisAsleep", Asleep, true},
+		{"HKCategoryValueSleepAnalysisAsleepUnspecified", Asleep, true},
+		{"HKCategoryValueSleepAnalysisAsleepREM", REM, true},
+		{"HKCategoryValueSleepAnalysisNapping", "", false},
+	}
+	for _, test := range tests {
+		if stage, ok := ParseStage(test.value); stage != test.stage || ok != test.ok {
+			t.Errorf("ParseStage(%s): expected %q %v, got %q %v", test.value, test.stage, test.ok, stage, ok)
+		}
+	}
+}
+
+func TestSessions(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("time.LoadLocation: %v", err)
+	}
+	// local times in Paris
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2022, 3, day, hour, minute, 0, 0, paris)
+	}
+
+	watch := "Jane's Apple Watch"
+	phone := "Jane's iPhone"
+	fragments := []Fragment{
+		// the night of the 1st, recorded by both sources
+		{RecordID: 1, Source: phone, Stage: InBed, Start: at(1, 22, 0), End: at(2, 7, 0), Location: paris},
+		{RecordID: 2, Source: watch, Stage: InBed, Start: at(1, 22, 30), End: at(2, 6, 30), Location: paris},
+		{RecordID: 3, Source: watch, Stage: Core, Start: at(1, 23, 0), End: at(2, 1, 0), Location: paris},
+		{RecordID: 4, Source: watch, Stage: Deep, Start: at(2, 1, 0), End: at(2, 2, 0), Location: paris},
+		{RecordID: 5, Source: watch, Stage: Awake, Start: at(2, 2, 0), End: at(2, 2, 30), Location: paris},
+		{RecordID: 6, Source: watch, Stage: REM, Start: at(2, 2, 30), End: at(2, 6, 0), Location: paris},
+		// an afternoon nap belongs to the next night, since it is after noon
+		{RecordID: 7, Source: phone, Stage: Asleep, Start: at(2, 14, 0), End: at(2, 15, 0)},
+	}
+
+	priority := func(source string) int {
+		if source == watch {
+			return 0
+		}
+		return 1
+	}
+	sessions := Sessions(fragments, Options{DayBoundary: 12 * time.Hour, Location: paris, Rank: priority})
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	s := sessions[0]
+	if s.Night != time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC) || s.Source != watch {
+		t.Errorf("expected the watch on 2022-03-01, got %s on %s", s.Source, s.Night)
+	}
+	if !s.BedTime.Equal(at(1, 22, 30)) || !s.WakeTime.Equal(at(2, 6, 30)) {
+		t.Errorf("expected 22:30 to 06:30, got %s to %s", s.BedTime, s.WakeTime)
+	}
+	if s.Asleep != 6*time.Hour+30*time.Minute {
+		t.Errorf("expected 6h30m asleep, got %s", s.Asleep)
+	}
+	expected := map[Stage]time.Duration{InBed: 8 * time.Hour, Awake: 30 * time.Minute, Asleep: 0, Core: 2 * time.Hour, Deep: time.Hour, REM: 3*time.Hour + 30*time.Minute}
+	for stage, d := range expected {
+		if s.Stages[stage] != d {
+			t.Errorf("%s: expected %s, got %s", stage, d, s.Stages[stage])
+		}
+	}
+	if s.Awakenings != 1 {
+		t.Errorf("expected 1 awakening, got %d", s.Awakenings)
+	}
+	if s.Efficiency != 6.5/8 {
+		t.Errorf("expected an efficiency of %v, got %v", 6.5/8, s.Efficiency)
+	}
+	if len(s.Fragments) != 5 {
+		t.Errorf("expected the 5 fragments of the watch, got %d", len(s.Fragments))
+	}
+
+	if s := sessions[1]; s.Night != time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC) || s.Asleep != time.Hour || s.Awakenings != 0 {
+		t.Errorf("expected an hour on 2022-03-02, got %s on %s", s.Asleep, s.Night)
+	}
+
+	// without a priority, the source with the most sleep wins
+	sessions = Sessions(fragments, Options{DayBoundary: 12 * time.Hour, Location: paris})
+	if sessions[0].Source != watch {
+		t.Errorf("expected the watch, got %s", sessions[0].Source)
+	}
+}
@@ -0,0 +1,121 @@
+package sleep
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// Analyzer rebuilds the sleep_sessions and sleep_stages tables from the
+// sleep records of a person.
+type Analyzer struct {
+	Pool     *pgxpool.Pool
+	PersonID int64
+	Options  Options
+}
+
+func (a *Analyzer) fragments(ctx context.Context) ([]Fragment, error) {
+	rows, err := a.Pool.Query(ctx, `
+		SELECT id, source_name, value, start_date, end_date, time_zone
+		FROM records
+		WHERE person_id = $1 AND type = $2 AND value IS NOT NULL
+		ORDER BY start_date`, a.PersonID, RecordType)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	locations := make(map[string]*time.Location)
+	var fragments []Fragment
+	for rows.Next() {
+		var f Fragment
+		var value string
+		var timeZone *string
+		if err := rows.Scan(&f.RecordID, &f.Source, &value, &f.Start, &f.End, &timeZone); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		stage, ok := ParseStage(value)
+		if !ok {
+			continue
+		}
+		f.Stage = stage
+
+		if timeZone != nil {
+			location, ok := locations[*timeZone]
+			if !ok {
+				location, _ = time.LoadLocation(*timeZone) // unknown zones fall back to Options.Location
+				locations[*timeZone] = location
+			}
+			f.Location = location
+		}
+
+		fragments = append(fragments, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return fragments, nil
+}
+
+func seconds(d time.Duration) int64 {
+	return int64(d / time.Second)
+}
+
+// Run replaces the rows of the person in the sleep tables.
+func (a *Analyzer) Run(ctx context.Context) error {
+	fragments, err := a.fragments(ctx)
+	if err != nil {
+		return fmt.Errorf("fragments: %w", err)
+	}
+	sessions := Sessions(fragments, a.Options)
+
+	tx, err := a.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, table := range []string{"sleep_stages", "sleep_sessions"} {
+		if _, err := tx.Exec(ctx, "DELETE FROM "+table+" WHERE person_id = $1", a.PersonID); err != nil {
+			return fmt.Errorf("DELETE FROM %s: %w", table, err)
+		}
+	}
+
+	var stages [][]any
+	for _, s := range sessions {
+		var id int64
+		err := tx.QueryRow(ctx, `
+			INSERT INTO sleep_sessions (person_id, night, source_name, bed_time, wake_time, in_bed_seconds, asleep_seconds,
+				awake_seconds, core_seconds, deep_seconds, rem_seconds, unspecified_seconds, awakenings, efficiency)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			RETURNING id`,
+			a.PersonID, s.Night, s.Source, s.BedTime, s.WakeTime, seconds(s.InBed()), seconds(s.Asleep),
+			seconds(s.Stages[Awake]), seconds(s.Stages[Core]), seconds(s.Stages[Deep]), seconds(s.Stages[REM]),
+			seconds(s.Stages[Asleep]), s.Awakenings, s.Efficiency,
+		).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("INSERT INTO sleep_sessions: %w", err)
+		}
+
+		for _, f := range s.Fragments {
+			stages = append(stages, []any{id, a.PersonID, f.RecordID, string(f.Stage), f.Start, f.End, seconds(f.End.Sub(f.Start))})
+		}
+	}
+
+	if len(stages) > 0 {
+		columns := []string{"session_id", "person_id", "record_id", "stage", "start_date", "end_date", "duration_seconds"}
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"sleep_stages"}, columns, pgx.CopyFromRows(stages)); err != nil {
+			return fmt.Errorf("CopyFrom sleep_stages: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("tx.Commit: %w", err)
+	}
+
+	fmt.Printf("Found %d sleep sessions\n", len(sessions))
+	return nil
+}
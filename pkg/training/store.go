@@ -0,0 +1,244 @@
+package training
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// DefaultRestingHR is used without a resting heart rate setting or record.
+const DefaultRestingHR = 60
+
+// DefaultMaxHR is used without a max heart rate setting or date of birth.
+const DefaultMaxHR = 190
+
+// Options are the settings of an Analyzer. A zero MaxHR is estimated from
+// the date of birth, and a zero RestingHR is the average of the resting
+// heart rate records.
+type Options struct {
+	MaxHR     float64
+	RestingHR float64
+	Karvonen  bool
+
+	// Location is used for the workouts without a time zone.
+	Location *time.Location
+}
+
+// Analyzer rebuilds the workout_hr_zones and training_load tables from the
+// deduplicated workouts and heart rate records of a person.
+type Analyzer struct {
+	Pool     *pgxpool.Pool
+	PersonID int64
+	Options  Options
+}
+
+type workout struct {
+	id       int64
+	start    time.Time
+	end      time.Time
+	location *time.Location
+}
+
+// me returns the date of birth, if known, and whether the user is a woman.
+func (a *Analyzer) me(ctx context.Context) (*time.Time, bool, error) {
+	var birth, sex *string
+	err := a.Pool.QueryRow(ctx, "SELECT date_of_birth, biological_sex FROM me WHERE person_id = $1 LIMIT 1", a.PersonID).Scan(&birth, &sex)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("pool.QueryRow: %w", err)
+	}
+
+	female := sex != nil && *sex == "HKBiologicalSexFemale"
+	if birth == nil {
+		return nil, female, nil
+	}
+	t, err := time.Parse("2006-01-02", *birth)
+	if err != nil {
+		return nil, female, nil // a missing date of birth is not worth failing
+	}
+
+	return &t, female, nil
+}
+
+func (a *Analyzer) restingHR(ctx context.Context) (float64, error) {
+	var resting *float64
+	err := a.Pool.QueryRow(ctx, "SELECT AVG(value) FROM records_deduplicated WHERE person_id = $1 AND type = $2", a.PersonID, RestingHeartRateType).Scan(&resting)
+	if err != nil {
+		return 0, fmt.Errorf("pool.QueryRow: %w", err)
+	}
+	if resting == nil {
+		return DefaultRestingHR, nil
+	}
+
+	return *resting, nil
+}
+
+func (a *Analyzer) workouts(ctx context.Context) ([]workout, error) {
+	rows, err := a.Pool.Query(ctx, `
+		SELECT d.workout_id, d.start_date, d.end_date, w.time_zone
+		FROM workouts_deduplicated d
+		JOIN workouts w ON w.id = d.workout_id
+		WHERE d.person_id = $1
+		ORDER BY d.start_date`, a.PersonID)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	locations := make(map[string]*time.Location)
+	var workouts []workout
+	for rows.Next() {
+		var w workout
+		var timeZone *string
+		if err := rows.Scan(&w.id, &w.start, &w.end, &timeZone); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		w.location = a.Options.Location
+		if timeZone != nil {
+			location, ok := locations[*timeZone]
+			if !ok {
+				location, _ = time.LoadLocation(*timeZone) // unknown zones fall back to Options.Location
+				locations[*timeZone] = location
+			}
+			if location != nil {
+				w.location = location
+			}
+		}
+		if w.location == nil {
+			w.location = time.Local
+		}
+		workouts = append(workouts, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return workouts, nil
+}
+
+func (a *Analyzer) heartRates(ctx context.Context, w workout) ([]HeartRate, error) {
+	rows, err := a.Pool.Query(ctx, `
+		SELECT start_date, value
+		FROM records_deduplicated
+		WHERE person_id = $1 AND type = $2 AND start_date >= $3 AND start_date < $4
+		ORDER BY start_date`, a.PersonID, HeartRateType, w.start, w.end)
+	if err != nil {
+		return nil, fmt.Errorf("pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []HeartRate
+	for rows.Next() {
+		var s HeartRate
+		if err := rows.Scan(&s.Time, &s.BPM); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		samples = append(samples, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return samples, nil
+}
+
+// Run replaces the rows of the person in the training tables.
+func (a *Analyzer) Run(ctx context.Context) error {
+	birth, female, err := a.me(ctx)
+	if err != nil {
+		return fmt.Errorf("me: %w", err)
+	}
+	resting := a.Options.RestingHR
+	if resting == 0 {
+		if resting, err = a.restingHR(ctx); err != nil {
+			return fmt.Errorf("restingHR: %w", err)
+		}
+	}
+	workouts, err := a.workouts(ctx)
+	if err != nil {
+		return fmt.Errorf("workouts: %w", err)
+	}
+
+	var zones, daily [][]any
+	var days []Load
+	for _, w := range workouts {
+		profile := Profile{MaxHR: a.Options.MaxHR, RestingHR: resting, Karvonen: a.Options.Karvonen, Female: female}
+		if profile.MaxHR == 0 {
+			profile.MaxHR = DefaultMaxHR
+			if birth != nil {
+				profile.MaxHR = MaxHR(Age(*birth, w.start))
+			}
+		}
+
+		samples, err := a.heartRates(ctx, w)
+		if err != nil {
+			return fmt.Errorf("heartRates: %w", err)
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		result := Analyze(profile, w.start, w.end, samples)
+
+		row := []any{w.id, a.PersonID, profile.MaxHR, profile.RestingHR, profile.Karvonen}
+		for _, seconds := range result.Seconds {
+			row = append(row, seconds)
+		}
+		zones = append(zones, append(row, result.AverageHR, result.TRIMP))
+
+		start := w.start.In(w.location)
+		day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+		days = append(days, Load{Day: day, Workouts: 1, TRIMP: result.TRIMP})
+	}
+	for _, l := range Loads(days) {
+		var acwr, monotony, strain *float64
+		if l.Chronic > 0 {
+			v := l.ACWR()
+			acwr = &v
+		}
+		if l.Monotony > 0 {
+			m, s := l.Monotony, l.Strain
+			monotony, strain = &m, &s
+		}
+		daily = append(daily, []any{a.PersonID, l.Day, l.Workouts, l.TRIMP, l.Acute, l.Chronic, acwr, monotony, strain})
+	}
+
+	tx, err := a.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tables := []struct {
+		name    string
+		columns []string
+		rows    [][]any
+	}{
+		{"workout_hr_zones", []string{"workout_id", "person_id", "max_hr", "resting_hr", "karvonen",
+			"zone0_seconds", "zone1_seconds", "zone2_seconds", "zone3_seconds", "zone4_seconds", "zone5_seconds",
+			"average_hr", "trimp"}, zones},
+		{"training_load", []string{"person_id", "day", "workouts", "trimp", "acute_load", "chronic_load", "acwr", "monotony", "strain"}, daily},
+	}
+	for _, t := range tables {
+		if _, err := tx.Exec(ctx, "DELETE FROM "+t.name+" WHERE person_id = $1", a.PersonID); err != nil {
+			return fmt.Errorf("DELETE FROM %s: %w", t.name, err)
+		}
+		if len(t.rows) == 0 {
+			continue
+		}
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{t.name}, t.columns, pgx.CopyFromRows(t.rows)); err != nil {
+			return fmt.Errorf("CopyFrom %s: %w", t.name, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("tx.Commit: %w", err)
+	}
+
+	fmt.Printf("Analyzed heart rate zones of %d workouts and training load of %d days\n", len(zones), len(daily))
+	return nil
+}
@@ -0,0 +1,230 @@
+package training
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// HeartRateType is the type of the heart rate records.
+const HeartRateType = "HKQuantityTypeIdentifierHeartRate"
+
+// RestingHeartRateType is the type of the resting heart rate records.
+const RestingHeartRateType = "HKQuantityTypeIdentifierRestingHeartRate"
+
+// Zones is the number of heart rate zones. Zone 0 is below the first one.
+const Zones = 5
+
+// MaxGap is the longest time a heart rate sample is assumed to last, so
+// gaps in the recording are not counted.
+const MaxGap = 2 * time.Minute
+
+// Profile holds what zones and TRIMP are computed from.
+type Profile struct {
+	MaxHR     float64
+	RestingHR float64
+
+	// Karvonen puts zone bounds at percentages of the heart rate reserve,
+	// between the resting and the max heart rate, instead of percentages of
+	// the max heart rate.
+	Karvonen bool
+
+	// Female selects the TRIMP weighting of women.
+	Female bool
+}
+
+// MaxHR estimates the max heart rate from the age, as 220 - age.
+func MaxHR(age int) float64 {
+	return float64(220 - age)
+}
+
+// Age returns the age in years at t of someone born on birth.
+func Age(birth, t time.Time) int {
+	age := t.Year() - birth.Year()
+	if t.Month() < birth.Month() || (t.Month() == birth.Month() && t.Day() < birth.Day()) {
+		age--
+	}
+	return age
+}
+
+// Bounds returns the lower bound of zones 1 to 5, at 50, 60, 70, 80 and 90%.
+func (p Profile) Bounds() [Zones]float64 {
+	var bounds [Zones]float64
+	for i := range bounds {
+		percent := 0.5 + 0.1*float64(i)
+		if p.Karvonen {
+			bounds[i] = p.RestingHR + percent*(p.MaxHR-p.RestingHR)
+		} else {
+			bounds[i] = percent * p.MaxHR
+		}
+	}
+	return bounds
+}
+
+// Zone returns the zone of a heart rate, 0 being below zone 1.
+func (p Profile) Zone(bpm float64) int {
+	bounds := p.Bounds()
+	zone := 0
+	for i, bound := range bounds {
+		if bpm >= bound {
+			zone = i + 1
+		}
+	}
+	return zone
+}
+
+// trimp is Banister's training impulse of a number of minutes at a heart
+// rate.
+func (p Profile) trimp(minutes, bpm float64) float64 {
+	if p.MaxHR <= p.RestingHR {
+		return 0
+	}
+	reserve := (bpm - p.RestingHR) / (p.MaxHR - p.RestingHR)
+	if reserve <= 0 {
+		return 0
+	}
+	if p.Female {
+		return minutes * reserve * 0.86 * math.Exp(1.67*reserve)
+	}
+	return minutes * reserve * 0.64 * math.Exp(1.92*reserve)
+}
+
+// HeartRate is a heart rate sample.
+type HeartRate struct {
+	Time time.Time
+	BPM  float64
+}
+
+// Workout is the heart rate analysis of a workout.
+type Workout struct {
+	Seconds   [Zones + 1]float64 // time in each zone, zone 0 first
+	AverageHR float64            // weighted by time
+	TRIMP     float64
+}
+
+// Analyze computes the time in each zone and the TRIMP of a workout. A
+// sample lasts until the next one, the end of the workout or MaxGap.
+func Analyze(p Profile, start, end time.Time, samples []HeartRate) Workout {
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+
+	var w Workout
+	var total float64
+	for i, s := range samples {
+		if s.Time.Before(start) || !s.Time.Before(end) {
+			continue
+		}
+		until := end
+		if i+1 < len(samples) && samples[i+1].Time.Before(until) {
+			until = samples[i+1].Time
+		}
+		if max := s.Time.Add(MaxGap); max.Before(until) {
+			until = max
+		}
+
+		seconds := until.Sub(s.Time).Seconds()
+		w.Seconds[p.Zone(s.BPM)] += seconds
+		w.AverageHR += s.BPM * seconds
+		w.TRIMP += p.trimp(seconds/60, s.BPM)
+		total += seconds
+	}
+	if total > 0 {
+		w.AverageHR /= total
+	}
+
+	return w
+}
+
+// Load is the training load of a day.
+type Load struct {
+	Day      time.Time // at midnight UTC
+	Workouts int
+	TRIMP    float64
+
+	Acute   float64 // average daily TRIMP over the last 7 days
+	Chronic float64 // average daily TRIMP over the last 28 days
+
+	// Monotony is the average daily TRIMP over the last 7 days divided by
+	// its standard deviation, and Strain the TRIMP of those 7 days times
+	// the monotony. Both are 0 when the load did not vary.
+	Monotony float64
+	Strain   float64
+}
+
+// ACWR is the acute to chronic workload ratio, or 0 without a chronic load.
+func (l Load) ACWR() float64 {
+	if l.Chronic == 0 {
+		return 0
+	}
+	return l.Acute / l.Chronic
+}
+
+// Loads computes the training load of every day from the first to the last
+// day of daily, which holds the workouts and TRIMP of the days with
+// workouts.
+func Loads(daily []Load) []Load {
+	if len(daily) == 0 {
+		return nil
+	}
+	byDay := make(map[time.Time]Load, len(daily))
+	first, last := daily[0].Day, daily[0].Day
+	for _, d := range daily {
+		l := byDay[d.Day]
+		l.Workouts += d.Workouts
+		l.TRIMP += d.TRIMP
+		byDay[d.Day] = l
+		if d.Day.Before(first) {
+			first = d.Day
+		}
+		if d.Day.After(last) {
+			last = d.Day
+		}
+	}
+
+	var loads []Load
+	var history []float64
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		l := byDay[day]
+		l.Day = day
+		history = append(history, l.TRIMP)
+
+		week := window(history, 7)
+		l.Acute = mean(week, 7)
+		l.Chronic = mean(window(history, 28), 28)
+		if sd := stddev(week, 7); sd > 0 {
+			l.Monotony = l.Acute / sd
+			l.Strain = l.Acute * 7 * l.Monotony
+		}
+
+		loads = append(loads, l)
+	}
+
+	return loads
+}
+
+// window returns the last n values, or fewer at the start.
+func window(values []float64, n int) []float64 {
+	if len(values) > n {
+		return values[len(values)-n:]
+	}
+	return values
+}
+
+// mean averages values over n days, the missing days before the first one
+// counting as rest days.
+func mean(values []float64, n int) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(n)
+}
+
+func stddev(values []float64, n int) float64 {
+	m := mean(values, n)
+	var sum float64
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	sum += float64(n-len(values)) * m * m // rest days
+	return math.Sqrt(sum / float64(n))
+}
@@ -0,0 +1,103 @@
+package training
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAge(t *testing.T) {
+	birth := time.Date(1980, 3, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		at  time.Time
+		age int
+	}{
+		{time.Date(2020, 3, 14, 0, 0, 0, 0, time.UTC), 39},
+		{time.Date(2020, 3, 15, 0, 0, 0, 0, time.UTC), 40},
+		{time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC), 40},
+	}
+	for _, test := range tests {
+		if got := Age(birth, test.at); got != test.age {
+			t.Errorf("Age at %s: expected %d, got %d", test.at, test.age, got)
+		}
+	}
+}
+
+func TestZone(t *testing.T) {
+	tests := []struct {
+		profile Profile
+		bpm     float64
+		zone    int
+	}{
+		{Profile{MaxHR: 200}, 99, 0},
+		{Profile{MaxHR: 200}, 100, 1},
+		{Profile{MaxHR: 200}, 150, 3},
+		{Profile{MaxHR: 200}, 195, 5},
+		{Profile{MaxHR: 200, RestingHR: 60, Karvonen: true}, 129, 0}, // 60 + 50% of 140
+		{Profile{MaxHR: 200, RestingHR: 60, Karvonen: true}, 130, 1},
+		{Profile{MaxHR: 200, RestingHR: 60, Karvonen: true}, 144, 2},
+	}
+	for _, test := range tests {
+		if got := test.profile.Zone(test.bpm); got != test.zone {
+			t.Errorf("Zone(%v) with %+v: expected %d, got %d", test.bpm, test.profile, test.zone, got)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	start := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	profile := Profile{MaxHR: 200, RestingHR: 60}
+	samples := []HeartRate{
+		{at(2), 160},  // zone 4 for a minute
+		{at(0), 120},  // zone 2 for 2 minutes
+		{at(3), 180},  // zone 5 until the gap
+		{at(10), 90},  // zone 0 until the end
+		{at(12), 150}, // after the end
+	}
+	w := Analyze(profile, start, at(11), samples)
+
+	expected := [Zones + 1]float64{60, 0, 120, 0, 60, 120}
+	if w.Seconds != expected {
+		t.Errorf("expected %v, got %v", expected, w.Seconds)
+	}
+	if average := (120*120 + 160*60 + 180*120 + 90*60) / 360.0; w.AverageHR != average {
+		t.Errorf("expected an average of %v, got %v", average, w.AverageHR)
+	}
+
+	trimp := 0.0
+	for _, s := range []struct{ minutes, bpm float64 }{{2, 120}, {1, 160}, {2, 180}, {1, 90}} {
+		reserve := (s.bpm - 60) / 140
+		trimp += s.minutes * reserve * 0.64 * math.Exp(1.92*reserve)
+	}
+	if math.Abs(w.TRIMP-trimp) > 1e-9 {
+		t.Errorf("expected a TRIMP of %v, got %v", trimp, w.TRIMP)
+	}
+}
+
+func TestLoads(t *testing.T) {
+	day := func(n int) time.Time { return time.Date(2022, 1, n, 0, 0, 0, 0, time.UTC) }
+
+	loads := Loads([]Load{
+		{Day: day(1), Workouts: 1, TRIMP: 70},
+		{Day: day(3), Workouts: 1, TRIMP: 70},
+		{Day: day(3), Workouts: 1, TRIMP: 70},
+	})
+	if len(loads) != 3 {
+		t.Fatalf("expected 3 days, got %d", len(loads))
+	}
+
+	if l := loads[1]; !l.Day.Equal(day(2)) || l.Workouts != 0 || l.Acute != 10 || l.Chronic != 2.5 {
+		t.Errorf("unexpected rest day %+v", l)
+	}
+	l := loads[2]
+	if l.Workouts != 2 || l.TRIMP != 140 || l.Acute != 30 || l.ACWR() != 4 {
+		t.Errorf("unexpected last day %+v", l)
+	}
+	// 70, 0 and 140 after 4 days of rest: a mean of 30 and a variance of 2600
+	monotony := 30 / math.Sqrt(2600)
+	if math.Abs(l.Monotony-monotony) > 1e-9 || math.Abs(l.Strain-210*monotony) > 1e-9 {
+		t.Errorf("expected a monotony of %v and a strain of %v, got %v and %v", monotony, 210*monotony, l.Monotony, l.Strain)
+	}
+}
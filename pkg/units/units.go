@@ -0,0 +1,78 @@
+package units
+
+import "fmt"
+
+// unit is a unit of a dimension, as value * scale + offset in the base unit
+// of the dimension.
+type unit struct {
+	dimension string
+	scale     float64
+	offset    float64
+}
+
+// units lists the HealthKit units that can be converted, by dimension: mass
+// in grams, length in meters, energy in kilocalories, volume in milliliters,
+// time in seconds and temperature in degrees Celsius.
+var units = map[string]unit{
+	"g":   {"mass", 1, 0},
+	"mg":  {"mass", 1e-3, 0},
+	"mcg": {"mass", 1e-6, 0},
+	"kg":  {"mass", 1e3, 0},
+	"oz":  {"mass", 28.349523125, 0},
+	"lb":  {"mass", 453.59237, 0},
+	"st":  {"mass", 6350.29318, 0},
+
+	"m":  {"length", 1, 0},
+	"cm": {"length", 1e-2, 0},
+	"mm": {"length", 1e-3, 0},
+	"km": {"length", 1e3, 0},
+	"in": {"length", 0.0254, 0},
+	"ft": {"length", 0.3048, 0},
+	"yd": {"length", 0.9144, 0},
+	"mi": {"length", 1609.344, 0},
+
+	"kcal": {"energy", 1, 0},
+	"Cal":  {"energy", 1, 0},
+	"cal":  {"energy", 1e-3, 0},
+	"kJ":   {"energy", 1 / 4.184, 0},
+	"J":    {"energy", 1 / 4184.0, 0},
+
+	"mL":       {"volume", 1, 0},
+	"cL":       {"volume", 10, 0},
+	"dL":       {"volume", 100, 0},
+	"L":        {"volume", 1e3, 0},
+	"fl_oz_us": {"volume", 29.5735295625, 0},
+	"cup_us":   {"volume", 236.5882365, 0},
+
+	"ms":  {"time", 1e-3, 0},
+	"s":   {"time", 1, 0},
+	"min": {"time", 60, 0},
+	"hr":  {"time", 3600, 0},
+	"d":   {"time", 86400, 0},
+
+	"degC": {"temperature", 1, 0},
+	"degF": {"temperature", 5.0 / 9, -32 * 5.0 / 9},
+	"K":    {"temperature", 1, -273.15},
+}
+
+// Convert converts a value between two units of the same dimension, such as
+// "lb" and "kg". Identical units always convert.
+func Convert(value float64, from, to string) (float64, error) {
+	if from == to {
+		return value, nil
+	}
+
+	f, ok := units[from]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", from)
+	}
+	t, ok := units[to]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", to)
+	}
+	if f.dimension != t.dimension {
+		return 0, fmt.Errorf("cannot convert %s (%s) to %s (%s)", from, f.dimension, to, t.dimension)
+	}
+
+	return (value*f.scale + f.offset - t.offset) / t.scale, nil
+}
@@ -0,0 +1,36 @@
+package units
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		value    float64
+		from, to string
+		expected float64
+		ok       bool
+	}{
+		{1, "count", "count", 1, true},
+		{1, "kg", "lb", 2.2046226218, true},
+		{5, "km", "mi", 3.1068559612, true},
+		{2092, "kJ", "kcal", 500, true},
+		{98.6, "degF", "degC", 37, true},
+		{37, "degC", "degF", 98.6, true},
+		{0, "degC", "K", 273.15, true},
+		{90, "min", "hr", 1.5, true},
+		{1, "kg", "km", 0, false},
+		{1, "count/min", "kg", 0, false},
+	}
+	for _, test := range tests {
+		got, err := Convert(test.value, test.from, test.to)
+		if (err == nil) != test.ok {
+			t.Errorf("Convert(%v, %s, %s): unexpected error %v", test.value, test.from, test.to, err)
+			continue
+		}
+		if math.Abs(got-test.expected) > 1e-6 {
+			t.Errorf("Convert(%v, %s, %s): expected %v, got %v", test.value, test.from, test.to, test.expected, got)
+		}
+	}
+}
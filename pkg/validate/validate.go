@@ -0,0 +1,391 @@
+package validate
+
+import (
+	"context"
+	"github.com/lsmoura/health/pkg/dtd"
+	"github.com/lsmoura/health/pkg/filter"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/pipeline"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxIDs is the number of ids kept as examples of a NOT NULL violation.
+const maxIDs = 10
+
+// Count is the number of rows holding a value.
+type Count struct {
+	Value string `json:"value"`
+	Rows  int64  `json:"rows"`
+}
+
+// TableSummary describes the rows an import would write to a table.
+type TableSummary struct {
+	Name      string     `json:"name"`
+	Rows      int64      `json:"rows"`
+	FirstDate *time.Time `json:"first_date,omitempty"`
+	LastDate  *time.Time `json:"last_date,omitempty"`
+	Types     []Count    `json:"types,omitempty"`
+	Sources   []Count    `json:"sources,omitempty"`
+	Devices   []Count    `json:"devices,omitempty"`
+}
+
+// Violation counts the rows that would be rejected by a NOT NULL
+// constraint. IDs holds the smallest ids of those rows, when the table has
+// an id column.
+type Violation struct {
+	Table  string  `json:"table"`
+	Column string  `json:"column"`
+	Rows   int64   `json:"rows"`
+	IDs    []int64 `json:"ids,omitempty"`
+}
+
+// IssueCount is a DTD issue and the number of elements it was found in.
+type IssueCount struct {
+	dtd.Issue
+	Count int64 `json:"count"`
+}
+
+// Report is the result of a dry run.
+type Report struct {
+	Filter     *filter.Filter `json:"filter,omitempty"`
+	Tables     []TableSummary `json:"tables"`
+	Violations []Violation    `json:"not_null_violations"`
+	DTDIssues  []IssueCount   `json:"dtd_issues"`
+}
+
+// columns lists the positions of the columns a summary looks at. -1 means
+// the table has no such column.
+type columns struct {
+	id, date, kind, source, device int
+	notNull                        []int
+}
+
+type tableStats struct {
+	name        string
+	names       []string
+	columns     columns
+	rows        int64
+	first, last time.Time
+	types       map[string]int64
+	sources     map[string]int64
+	devices     map[string]int64
+	violations  map[int]*Violation
+}
+
+// Summary is a pipeline.Sink that keeps statistics about the rows written to
+// it instead of storing them.
+type Summary struct {
+	mu     sync.Mutex
+	tables []*tableStats
+	byName map[string]*tableStats
+	issues map[dtd.Issue]int64
+}
+
+func index(names []string, candidates ...string) int {
+	for _, candidate := range candidates {
+		for i, name := range names {
+			if name == candidate {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// dateColumn picks the column used for the date range of a table: the
+// start date when there is one, or the first other date.
+func dateColumn(names []string) int {
+	if i := index(names, "start_date", "date"); i >= 0 {
+		return i
+	}
+	for i, name := range names {
+		if strings.HasSuffix(name, "_date") && name != "creation_date" {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// NewSummary returns a summary of the given tables. NOT NULL constraints are
+// taken from schema.
+func NewSummary(tables []pipeline.Table, schema []health.Table) *Summary {
+	declared := make(map[string]health.Table, len(schema))
+	for _, table := range schema {
+		declared[table.Name] = table
+	}
+
+	s := &Summary{byName: make(map[string]*tableStats), issues: make(map[dtd.Issue]int64)}
+	for _, table := range tables {
+		stats := &tableStats{
+			name:  table.Name,
+			names: table.Columns,
+			columns: columns{
+				id:     index(table.Columns, "id"),
+				date:   dateColumn(table.Columns),
+				kind:   index(table.Columns, "type", "workout_activity_type"),
+				source: index(table.Columns, "source_name"),
+				device: index(table.Columns, "device"),
+			},
+			types:      make(map[string]int64),
+			sources:    make(map[string]int64),
+			devices:    make(map[string]int64),
+			violations: make(map[int]*Violation),
+		}
+		for i, name := range table.Columns {
+			if column, ok := declared[table.Name].Column(name); ok && column.NotNull {
+				stats.columns.notNull = append(stats.columns.notNull, i)
+			}
+		}
+		s.tables = append(s.tables, stats)
+		s.byName[table.Name] = stats
+	}
+
+	return s
+}
+
+func isNull(value any) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+func text(value any) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, v != ""
+	case *string:
+		if v != nil {
+			return *v, *v != ""
+		}
+	}
+
+	return "", false
+}
+
+var dateLayouts = []string{health.TimeLayout, time.RFC3339, "2006-01-02"}
+
+func date(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, !v.IsZero()
+	case *time.Time:
+		if v != nil {
+			return *v, true
+		}
+	case health.HealthTime:
+		return time.Time(v), true
+	case *health.HealthTime:
+		if v != nil {
+			return time.Time(*v), true
+		}
+	}
+
+	if s, ok := text(value); ok {
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func id(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	}
+
+	return 0, false
+}
+
+func (t *tableStats) add(values []any) {
+	t.rows++
+
+	at := func(i int) any {
+		if i < 0 || i >= len(values) {
+			return nil
+		}
+		return values[i]
+	}
+
+	if d, ok := date(at(t.columns.date)); ok {
+		if t.first.IsZero() || d.Before(t.first) {
+			t.first = d
+		}
+		if t.last.IsZero() || d.After(t.last) {
+			t.last = d
+		}
+	}
+	if v, ok := text(at(t.columns.kind)); ok {
+		t.types[v]++
+	}
+	if v, ok := text(at(t.columns.source)); ok {
+		t.sources[v]++
+	}
+	if v, ok := text(at(t.columns.device)); ok {
+		t.devices[health.DeviceName(v)]++
+	}
+
+	for _, column := range t.columns.notNull {
+		if !isNull(at(column)) {
+			continue
+		}
+		violation := t.violations[column]
+		if violation == nil {
+			violation = &Violation{Table: t.name, Column: t.names[column]}
+			t.violations[column] = violation
+		}
+		violation.Rows++
+		if rowID, ok := id(at(t.columns.id)); ok {
+			violation.IDs = keepSmallest(violation.IDs, rowID)
+		}
+	}
+}
+
+// keepSmallest adds id to the sorted ids, keeping at most maxIDs of them, so
+// the examples do not depend on the order in which rows were written.
+func keepSmallest(ids []int64, id int64) []int64 {
+	i := sort.Search(len(ids), func(i int) bool { return ids[i] >= id })
+	if i >= maxIDs {
+		return ids
+	}
+	ids = append(ids, 0)
+	copy(ids[i+1:], ids[i:])
+	ids[i] = id
+	if len(ids) > maxIDs {
+		ids = ids[:maxIDs]
+	}
+
+	return ids
+}
+
+// Write implements pipeline.Sink.
+func (s *Summary) Write(ctx context.Context, table string, values []any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats, ok := s.byName[table]
+	if !ok {
+		stats = &tableStats{name: table, columns: columns{-1, -1, -1, -1, -1, nil}}
+		s.tables = append(s.tables, stats)
+		s.byName[table] = stats
+	}
+	stats.add(values)
+
+	return nil
+}
+
+// AddIssues records the DTD issues found in an element.
+func (s *Summary) AddIssues(issues []dtd.Issue) {
+	if len(issues) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, issue := range issues {
+		s.issues[issue]++
+	}
+}
+
+func counts(m map[string]int64) []Count {
+	out := make([]Count, 0, len(m))
+	for value, rows := range m {
+		out = append(out, Count{Value: value, Rows: rows})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Rows != out[j].Rows {
+			return out[i].Rows > out[j].Rows
+		}
+		return out[i].Value < out[j].Value
+	})
+
+	return out
+}
+
+// Report returns what has been written so far.
+func (s *Summary) Report() *Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &Report{Violations: []Violation{}, DTDIssues: []IssueCount{}}
+	for _, t := range s.tables {
+		summary := TableSummary{
+			Name:    t.name,
+			Rows:    t.rows,
+			Types:   counts(t.types),
+			Sources: counts(t.sources),
+			Devices: counts(t.devices),
+		}
+		if !t.first.IsZero() {
+			first, last := t.first, t.last
+			summary.FirstDate, summary.LastDate = &first, &last
+		}
+		report.Tables = append(report.Tables, summary)
+
+		for _, column := range t.columns.notNull {
+			if violation, ok := t.violations[column]; ok {
+				report.Violations = append(report.Violations, *violation)
+			}
+		}
+	}
+
+	for issue, count := range s.issues {
+		report.DTDIssues = append(report.DTDIssues, IssueCount{Issue: issue, Count: count})
+	}
+	sort.Slice(report.DTDIssues, func(i, j int) bool {
+		a, b := report.DTDIssues[i], report.DTDIssues[j]
+		if a.Element != b.Element {
+			return a.Element < b.Element
+		}
+		return a.Message < b.Message
+	})
+
+	return report
+}
+
+// Checker returns a handler that checks every element against the DOCTYPE
+// read by scanner, and records what it finds in the summary.
+func (s *Summary) Checker(scanner *pipeline.Scanner) pipeline.Handler {
+	var once sync.Once
+	var d *dtd.DTD
+
+	return func(ctx context.Context, e *pipeline.Element) error {
+		once.Do(func() {
+			doctype := scanner.Doctype()
+			if doctype == "" {
+				s.AddIssues([]dtd.Issue{{Element: "HealthData", Message: "export has no DOCTYPE"}})
+				return
+			}
+
+			var err error
+			if d, err = dtd.Parse(doctype); err != nil {
+				s.AddIssues([]dtd.Issue{{Element: "HealthData", Message: err.Error()}})
+			}
+		})
+		if d == nil {
+			return nil
+		}
+
+		issues, err := d.Validate(e.Data)
+		s.AddIssues(issues)
+		return err
+	}
+}
@@ -0,0 +1,107 @@
+package validate
+
+import (
+	"context"
+	"github.com/lsmoura/health/pkg/dtd"
+	"github.com/lsmoura/health/pkg/health"
+	"github.com/lsmoura/health/pkg/pipeline"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const export = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE HealthData [
+<!ELEMENT HealthData (Record*)>
+<!ELEMENT Record EMPTY>
+<!ATTLIST Record
+  type      CDATA #REQUIRED
+  startDate CDATA #REQUIRED
+>
+]>
+<HealthData>
+ <Record type="a" startDate="x"/>
+ <Record type="b" unit="count"/>
+ <Workout/>
+</HealthData>
+`
+
+func TestSummary(t *testing.T) {
+	schema, err := health.ParseSchema(`CREATE TABLE IF NOT EXISTS records (
+    id         SERIAL PRIMARY KEY,
+    type       CHARACTER VARYING NOT NULL,
+    source_name CHARACTER VARYING NOT NULL,
+    start_date TIMESTAMP WITH TIME ZONE NOT NULL
+);`)
+	if err != nil {
+		t.Fatalf("ParseSchema: %v", err)
+	}
+	tables := []pipeline.Table{{Name: "records", Columns: []string{"id", "type", "source_name", "device", "start_date"}}}
+	summary := NewSummary(tables, schema)
+
+	day := func(d int) *health.HealthTime {
+		t := health.HealthTime(time.Date(2022, 1, d, 0, 0, 0, 0, time.UTC))
+		return &t
+	}
+	device := "<<HKDevice: 0x283a9c0a0>, name:Apple Watch, model:Watch>"
+	rows := [][]any{
+		{int64(3), "HKStepCount", "Watch", &device, day(2)},
+		{int64(1), "HKStepCount", "iPhone", nil, (*health.HealthTime)(nil)},
+		{int64(2), "HKHeartRate", "Watch", &device, day(5)},
+	}
+	for _, row := range rows {
+		summary.Write(context.Background(), "records", row)
+	}
+
+	report := summary.Report()
+	first, last := time.Time(*day(2)), time.Time(*day(5))
+	expected := &Report{
+		Tables: []TableSummary{{
+			Name:      "records",
+			Rows:      3,
+			FirstDate: &first,
+			LastDate:  &last,
+			Types:     []Count{{"HKStepCount", 2}, {"HKHeartRate", 1}},
+			Sources:   []Count{{"Watch", 2}, {"iPhone", 1}},
+			Devices:   []Count{{"name:Apple Watch, model:Watch", 2}},
+		}},
+		Violations: []Violation{{Table: "records", Column: "start_date", Rows: 1, IDs: []int64{1}}},
+		DTDIssues:  []IssueCount{},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected %+v, got %+v", expected, report)
+	}
+}
+
+func TestChecker(t *testing.T) {
+	summary := NewSummary(nil, nil)
+	scanner := pipeline.NewScanner(strings.NewReader(export))
+	if err := pipeline.RunScanner(context.Background(), scanner, 2, summary.Checker(scanner)); err != nil {
+		t.Fatalf("RunScanner: %v", err)
+	}
+
+	expected := []IssueCount{
+		{dtd.Issue{Element: "HealthData", Message: "unexpected child Workout"}, 1},
+		{dtd.Issue{Element: "Record", Message: "missing required attribute startDate"}, 1},
+		{dtd.Issue{Element: "Record", Message: "undeclared attribute unit"}, 1},
+		{dtd.Issue{Element: "Workout", Message: "element is not declared"}, 1},
+	}
+	if got := summary.Report().DTDIssues; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestKeepSmallest(t *testing.T) {
+	var ids []int64
+	for id := int64(20); id > 0; id -= 2 {
+		ids = keepSmallest(ids, id)
+	}
+	ids = keepSmallest(ids, 21)
+	ids = keepSmallest(ids, 1)
+
+	expected := []int64{1, 2, 4, 6, 8, 10, 12, 14, 16, 18}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v, got %v", expected, ids)
+	}
+}